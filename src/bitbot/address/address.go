@@ -0,0 +1,73 @@
+/*
+Package address validates cryptocurrency addresses and keeps the book of approved
+withdrawal destinations.
+
+Supported formats:
+
+	BTC, BCH   Base58Check (P2PKH, P2SH), bech32/bech32m for BTC
+	LTC        Base58Check (P2PKH, P2SH), bech32/bech32m
+	ZEC        Base58Check transparent addresses (t1, t3)
+	ETH, ETC   hexadecimal with EIP-55 checksum
+
+Addresses of other currencies are rejected.
+*/
+package address
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type format struct {
+	// versions are the accepted Base58Check version prefixes.
+	versions [][]byte
+	// hrp is the bech32 human readable part (empty when segwit isn't supported).
+	hrp   string
+	eip55 bool
+}
+
+var formats = map[string]format{
+	"BTC": {versions: [][]byte{{0x00}, {0x05}}, hrp: "bc"},
+	"BCH": {versions: [][]byte{{0x00}, {0x05}}},
+	"LTC": {versions: [][]byte{{0x30}, {0x32}, {0x05}}, hrp: "ltc"},
+	"ZEC": {versions: [][]byte{{0x1c, 0xb8}, {0x1c, 0xbd}}},
+	"ETH": {eip55: true},
+	"ETC": {eip55: true},
+}
+
+// Validate returns an error when addr isn't a valid address of cur.
+func Validate(cur, addr string) error {
+	f, ok := formats[cur]
+	if !ok {
+		return fmt.Errorf("address: unsupported currency %s", cur)
+	}
+
+	if f.eip55 {
+		if err := checkEIP55(addr); err != nil {
+			return fmt.Errorf("address: invalid %s address %s - %s", cur, addr, err)
+		}
+		return nil
+	}
+
+	if f.hrp != "" && strings.HasPrefix(strings.ToLower(addr), f.hrp+"1") {
+		if err := decodeSegwit(f.hrp, addr); err != nil {
+			return fmt.Errorf("address: invalid %s address %s - %s", cur, addr, err)
+		}
+		return nil
+	}
+
+	payload, err := decodeBase58Check(addr)
+	if err != nil {
+		return fmt.Errorf("address: invalid %s address %s - %s", cur, addr, err)
+	}
+
+	for _, v := range f.versions {
+		// the payload is a version followed by a 20 bytes hash
+		if len(payload) == len(v)+20 && bytes.HasPrefix(payload, v) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("address: invalid %s address %s - unexpected version or length", cur, addr)
+}
@@ -0,0 +1,73 @@
+package address
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []struct{ cur, addr string }{
+		{"BTC", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{"BTC", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"},
+		{"BTC", "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"},
+		{"BTC", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+		{"LTC", "LKDyUEtTR1HXamkiEphisSiBJu6o3ZPE34"},
+		{"ZEC", "t1HsdDMzmJfq4vc7T17XYjEkLMLvbgM1fCi"},
+		{"ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{"ETH", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"},
+		{"ETC", "0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB"},
+		{"ETH", "0xd1220a0cf47c7b9be7a2e6ba89f429762e7b9adb"},
+	}
+
+	for _, v := range valid {
+		if err := Validate(v.cur, v.addr); err != nil {
+			t.Errorf("%s should be valid - %s", v.addr, err)
+		}
+	}
+
+	invalid := []struct{ cur, addr string }{
+		// checksum errors
+		{"BTC", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb"},
+		{"BTC", "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdr"},
+		{"ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD"},
+		// wrong network
+		{"LTC", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{"ZEC", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{"BTC", "LKDyUEtTR1HXamkiEphisSiBJu6o3ZPE34"},
+		// malformed
+		{"ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA"},
+		{"BTC", "Poloniex-BTC"},
+		{"XMR", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		// no witness program, too short programs
+		{"LTC", "ltc1pdtjxt"},
+		{"BTC", "bc1rw5uspcuh"},
+		{"BTC", "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P"},
+	}
+
+	for _, v := range invalid {
+		if err := Validate(v.cur, v.addr); err == nil {
+			t.Errorf("%s should be an invalid %s address", v.addr, v.cur)
+		}
+	}
+}
+
+func TestBook(t *testing.T) {
+	b := NewBook()
+
+	if err := b.Add(&Entry{"Poloniex", "BTC", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", ""}); err == nil {
+		t.Error("invalid addresses should be refused")
+	}
+
+	if err := b.Add(&Entry{"Poloniex", "BTC", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "Poloniex-BTC"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Check("Poloniex", "BTC", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"); err != nil {
+		t.Error(err)
+	}
+	if err := b.Check("Poloniex", "BTC", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"); err == nil {
+		t.Error("addresses that aren't approved should be refused")
+	}
+	if _, err := b.Destination("Hitbtc", "BTC"); err == nil {
+		t.Error("unknown destinations should be refused")
+	}
+}
@@ -0,0 +1,89 @@
+package address
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Entry is an approved withdrawal destination: the address of an exchanger deposit
+// account for a currency.
+type Entry struct {
+	Exchanger string
+	Currency  string
+	Address   string
+	// KrakenKey is the name the address was registered under in the Kraken UI. Kraken
+	// withdrawals refer to keys instead of addresses.
+	KrakenKey string
+}
+
+// Book is the set of approved destinations, indexed by exchanger and currency.
+type Book struct {
+	entries map[string]map[string]*Entry
+}
+
+func NewBook() *Book {
+	return &Book{map[string]map[string]*Entry{}}
+}
+
+// Add validates the address of e and adds it to the book. It replaces the previous
+// destination of the same exchanger and currency.
+func (b *Book) Add(e *Entry) error {
+	if err := Validate(e.Currency, e.Address); err != nil {
+		return err
+	}
+
+	if b.entries[e.Exchanger] == nil {
+		b.entries[e.Exchanger] = map[string]*Entry{}
+	}
+	b.entries[e.Exchanger][e.Currency] = e
+	return nil
+}
+
+// Destination returns the approved destination of cur on ex.
+func (b *Book) Destination(ex, cur string) (*Entry, error) {
+	e, ok := b.entries[ex][cur]
+	if !ok {
+		return nil, fmt.Errorf("address: no approved %s address for %s", cur, ex)
+	}
+	return e, nil
+}
+
+// Check returns an error unless addr is the approved destination of cur on ex.
+func (b *Book) Check(ex, cur, addr string) error {
+	e, err := b.Destination(ex, cur)
+	if err != nil {
+		return err
+	}
+
+	if e.Address != addr {
+		return fmt.Errorf("address: %s isn't the approved %s address of %s (%s)", addr, cur, ex, e.Address)
+	}
+	return nil
+}
+
+// LoadBook reads the book from the `address_book` table. Invalid entries are logged and
+// skipped.
+func LoadBook(db *sql.DB) (*Book, error) {
+	const query = "select exchanger, currency, address, coalesce(kraken_key, '') from address_book"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	b := NewBook()
+	for rows.Next() {
+		e := &Entry{}
+		if err := rows.Scan(&e.Exchanger, &e.Currency, &e.Address, &e.KrakenKey); err != nil {
+			return nil, err
+		}
+
+		if err := b.Add(e); err != nil {
+			log.Printf("LoadBook: skipping %s entry - %s\n", e.Exchanger, err)
+		}
+	}
+
+	return b, rows.Err()
+}
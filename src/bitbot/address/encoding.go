@@ -0,0 +1,191 @@
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// decodeBase58Check decodes a Base58Check string and verifies its checksum. It returns the
+// payload (version bytes included) without the checksum.
+func decodeBase58Check(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+
+	for _, r := range s {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+
+	// leading ones encode leading zero bytes
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+
+	decoded := append(make([]byte, zeros), n.Bytes()...)
+	if len(decoded) < 5 {
+		return nil, fmt.Errorf("base58 string too short")
+	}
+
+	payload := decoded[:len(decoded)-4]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], decoded[len(decoded)-4:]) {
+		return nil, fmt.Errorf("invalid base58 checksum")
+	}
+
+	return payload, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Bech32 checksum constants (BIP 173 and BIP 350).
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := uint(0); i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := []byte{}
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// decodeSegwit decodes a bech32 (witness version 0) or bech32m (versions 1 to 16) segwit
+// address and checks its human readable part is hrp.
+func decodeSegwit(hrp, s string) error {
+	if len(s) > 90 {
+		return fmt.Errorf("bech32 string too long")
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return fmt.Errorf("mixed case bech32 string")
+	}
+	s = strings.ToLower(s)
+
+	// the data part holds the witness version and the 6 characters of the checksum
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+8 > len(s) {
+		return fmt.Errorf("invalid bech32 separator position")
+	}
+	if s[:pos] != hrp {
+		return fmt.Errorf("invalid human readable part %s", s[:pos])
+	}
+
+	data := []byte{}
+	for _, r := range s[pos+1:] {
+		i := strings.IndexRune(bech32Charset, r)
+		if i < 0 {
+			return fmt.Errorf("invalid bech32 character %q", r)
+		}
+		data = append(data, byte(i))
+	}
+
+	version := data[0]
+	expected := uint32(bech32Const)
+	if version > 0 {
+		expected = bech32mConst
+	}
+	if version > 16 {
+		return fmt.Errorf("invalid witness version %d", version)
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(hrp), data...)) != expected {
+		return fmt.Errorf("invalid bech32 checksum")
+	}
+
+	// convert the 5 bits groups of the witness program to bytes
+	program := []byte{}
+	var acc uint32
+	var bits uint
+	for _, v := range data[1 : len(data)-6] {
+		acc = acc<<5 | uint32(v)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			program = append(program, byte(acc>>bits))
+		}
+	}
+	if bits >= 5 || acc&(1<<bits-1) != 0 {
+		return fmt.Errorf("invalid bech32 padding")
+	}
+
+	if len(program) < 2 || len(program) > 40 {
+		return fmt.Errorf("invalid witness program length %d", len(program))
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return fmt.Errorf("invalid witness v0 program length %d", len(program))
+	}
+
+	return nil
+}
+
+// checkEIP55 verifies an Ethereum address. All lower case and all upper case addresses
+// carry no checksum, mixed case addresses must match their EIP-55 checksum.
+func checkEIP55(s string) error {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return fmt.Errorf("an address is 0x followed by 40 hexadecimal characters")
+	}
+
+	hexPart := s[2:]
+	if _, err := hex.DecodeString(hexPart); err != nil {
+		return fmt.Errorf("invalid hexadecimal address")
+	}
+
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return nil
+	}
+
+	if checksumEIP55(hexPart) != hexPart {
+		return fmt.Errorf("invalid EIP-55 checksum")
+	}
+	return nil
+}
+
+// checksumEIP55 returns the mixed case encoding of a 40 characters hexadecimal address.
+func checksumEIP55(hexPart string) string {
+	lower := strings.ToLower(hexPart)
+	hash := keccak256([]byte(lower))
+
+	out := []byte(lower)
+	for i, c := range out {
+		nibble := hash[i/2] >> 4
+		if i%2 == 1 {
+			nibble = hash[i/2] & 0x0f
+		}
+		if c >= 'a' && nibble >= 8 {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return string(out)
+}
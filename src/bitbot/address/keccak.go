@@ -0,0 +1,99 @@
+package address
+
+// Keccak-256 as used by Ethereum. It differs from SHA3-256 by its padding (0x01 instead
+// of 0x06).
+
+var roundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A, 0x8000000080008000,
+	0x000000000000808B, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008A, 0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800A, 0x800000008000000A,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var rotations = [25]uint{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+func rotl(x uint64, n uint) uint64 {
+	return x<<n | x>>(64-n)
+}
+
+// keccakF applies the Keccak-f[1600] permutation. The state is indexed by x + 5*y.
+func keccakF(a *[25]uint64) {
+	var b [25]uint64
+	var c, d [5]uint64
+
+	for round := 0; round < 24; round++ {
+		// theta
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d[x] = c[(x+4)%5] ^ rotl(c[(x+1)%5], 1)
+		}
+		for i := 0; i < 25; i++ {
+			a[i] ^= d[i%5]
+		}
+
+		// rho and pi
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				i := x + 5*y
+				b[y+5*((2*x+3*y)%5)] = rotl(a[i], rotations[i]%64)
+			}
+		}
+
+		// chi
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 5; x++ {
+				a[x+5*y] = b[x+5*y] ^ (^b[(x+1)%5+5*y] & b[(x+2)%5+5*y])
+			}
+		}
+
+		// iota
+		a[0] ^= roundConstants[round]
+	}
+}
+
+// keccak256 returns the Keccak-256 digest of data.
+func keccak256(data []byte) []byte {
+	const rate = 136
+
+	var state [25]uint64
+
+	absorb := func(block []byte) {
+		for i := 0; i < rate/8; i++ {
+			var lane uint64
+			for j := 0; j < 8; j++ {
+				lane |= uint64(block[8*i+j]) << (8 * uint(j))
+			}
+			state[i] ^= lane
+		}
+		keccakF(&state)
+	}
+
+	for len(data) >= rate {
+		absorb(data[:rate])
+		data = data[rate:]
+	}
+
+	last := make([]byte, rate)
+	copy(last, data)
+	last[len(data)] ^= 0x01
+	last[rate-1] ^= 0x80
+	absorb(last)
+
+	out := make([]byte, 32)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 8; j++ {
+			out[8*i+j] = byte(state[i] >> (8 * uint(j)))
+		}
+	}
+	return out
+}
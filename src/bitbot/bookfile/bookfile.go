@@ -0,0 +1,308 @@
+/*
+Package bookfile stores the order book history of an exchanger and a pair in a compact
+binary file.
+
+Books are stored as price levels: prices and volumes are converted to integers (ticks)
+with the number of decimals of the header, and the orders of the same price are merged.
+The timestamps of the orders are not kept.
+
+A file starts with a header followed by records. Every KeyframeInterval records, a
+keyframe stores the whole book; the records in between only store the levels whose volume
+changed since the previous record, a zero volume removing a level. Integers are varints
+(the protobuf encoding) and the prices of a record are delta encoded, so that a level
+usually takes a few bytes instead of the 60 bytes of the JSON of the `orderbooks` table.
+
+	file     = magic header record*
+	header   = exchanger pair priceDecimals volumeDecimals
+	record   = length flags time latency [exchangeTime] side(bids) side(asks)
+	side     = count (priceDelta volume)*
+
+The reader indexes the keyframes to seek a time without decoding the whole file.
+*/
+package bookfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// magic identifies the files and the version of the format.
+const magic = "BKF1"
+
+// DefaultKeyframeInterval is the default number of records between two keyframes.
+const DefaultKeyframeInterval = 100
+
+// Record flags.
+const (
+	flagKeyframe     = 1 << 0
+	flagExchangeTime = 1 << 1
+)
+
+// ErrFormat is returned for files that aren't book files or are corrupted.
+var ErrFormat = errors.New("bookfile: invalid format")
+
+// Header describes the books of a file.
+type Header struct {
+	Exchanger string
+	Pair      exchanger.Pair
+	// PriceDecimals and VolumeDecimals are the precision of the prices and volumes, 8
+	// (satoshis) by default.
+	PriceDecimals  int
+	VolumeDecimals int
+}
+
+func (h *Header) setDefaults() {
+	if h.PriceDecimals == 0 {
+		h.PriceDecimals = 8
+	}
+	if h.VolumeDecimals == 0 {
+		h.VolumeDecimals = 8
+	}
+}
+
+func (h *Header) encode() []byte {
+	buf := []byte(magic)
+	buf = appendString(buf, h.Exchanger)
+	buf = appendString(buf, h.Pair.String())
+	buf = appendUvarint(buf, uint64(h.PriceDecimals))
+	buf = appendUvarint(buf, uint64(h.VolumeDecimals))
+	return buf
+}
+
+func readHeader(r io.ByteReader) (*Header, error) {
+	for i := 0; i < len(magic); i++ {
+		if c, err := r.ReadByte(); err != nil || c != magic[i] {
+			return nil, ErrFormat
+		}
+	}
+
+	h := &Header{}
+	var pair string
+	var priceDecimals, volumeDecimals uint64
+
+	d := &decoder{r: r}
+	h.Exchanger = d.string()
+	pair = d.string()
+	priceDecimals = d.uvarint()
+	volumeDecimals = d.uvarint()
+	if d.err != nil {
+		return nil, ErrFormat
+	}
+
+	h.Pair = exchanger.NewPair(pair)
+	h.PriceDecimals, h.VolumeDecimals = int(priceDecimals), int(volumeDecimals)
+	return h, nil
+}
+
+// level is a price level in ticks.
+type level struct {
+	price  int64
+	volume uint64
+}
+
+// book is the decoded state of a record.
+type book struct {
+	time         time.Time
+	latency      time.Duration
+	exchangeTime time.Time
+	// bids and asks map the prices to the volumes.
+	bids map[int64]uint64
+	asks map[int64]uint64
+}
+
+// scale converts between values and ticks.
+type scale float64
+
+func newScale(decimals int) scale {
+	return scale(math.Pow10(decimals))
+}
+
+func (s scale) ticks(v float64) int64 {
+	return int64(math.Floor(v*float64(s) + 0.5))
+}
+
+func (s scale) value(ticks int64) float64 {
+	return float64(ticks) / float64(s)
+}
+
+// levels merges the orders of the same price. Levels whose volume is below a tick are
+// dropped.
+func levels(orders []*exchanger.Order, prices, volumes scale) map[int64]uint64 {
+	m := map[int64]uint64{}
+	for _, o := range orders {
+		if v := volumes.ticks(o.Volume); v > 0 {
+			m[prices.ticks(o.Price)] += uint64(v)
+		}
+	}
+	return m
+}
+
+// orders returns the orders of a side, best price first.
+func orders(m map[int64]uint64, desc bool, prices, volumes scale) []*exchanger.Order {
+	levels := sortedLevels(m)
+	if desc {
+		for i, j := 0, len(levels)-1; i < j; i, j = i+1, j-1 {
+			levels[i], levels[j] = levels[j], levels[i]
+		}
+	}
+
+	orders := make([]*exchanger.Order, len(levels))
+	for i, l := range levels {
+		orders[i] = &exchanger.Order{Price: prices.value(l.price), Volume: volumes.value(int64(l.volume))}
+	}
+	return orders
+}
+
+// sortedLevels returns the levels of m by ascending price.
+func sortedLevels(m map[int64]uint64) []level {
+	levels := make([]level, 0, len(m))
+	for p, v := range m {
+		levels = append(levels, level{p, v})
+	}
+	sort.Sort(byPrice(levels))
+	return levels
+}
+
+type byPrice []level
+
+func (s byPrice) Len() int           { return len(s) }
+func (s byPrice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPrice) Less(i, j int) bool { return s[i].price < s[j].price }
+
+// diff returns the levels of next that changed since prev, removed levels having a zero
+// volume.
+func diff(prev, next map[int64]uint64) map[int64]uint64 {
+	changes := map[int64]uint64{}
+	for p, v := range next {
+		if prev[p] != v {
+			changes[p] = v
+		}
+	}
+	for p := range prev {
+		if _, ok := next[p]; !ok {
+			changes[p] = 0
+		}
+	}
+	return changes
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+// uvarintLen returns the length of the encoding of v.
+func uvarintLen(v uint64) int {
+	var tmp [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(tmp[:], v)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendSide encodes levels by ascending price, the prices as deltas.
+func appendSide(buf []byte, m map[int64]uint64) []byte {
+	buf = appendUvarint(buf, uint64(len(m)))
+
+	var prev int64
+	for _, l := range sortedLevels(m) {
+		buf = appendVarint(buf, l.price-prev)
+		buf = appendUvarint(buf, l.volume)
+		prev = l.price
+	}
+	return buf
+}
+
+// decoder reads varints and keeps the first error.
+type decoder struct {
+	r   io.ByteReader
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.err = err
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = err
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.err = err
+	return b
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > 1024 {
+		d.err = ErrFormat
+		return ""
+	}
+
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = d.byte()
+	}
+	return string(buf)
+}
+
+// side decodes the levels of a side.
+func (d *decoder) side() map[int64]uint64 {
+	m := map[int64]uint64{}
+
+	n := d.uvarint()
+	var price int64
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		price += d.varint()
+		m[price] = d.uvarint()
+	}
+	return m
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func formatError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrFormat
+	}
+	return fmt.Errorf("bookfile: %s", err)
+}
@@ -0,0 +1,204 @@
+package bookfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+// testBooks returns n books, every second from t0. A couple of levels change at each
+// snapshot.
+func testBooks(t0 time.Time, n int) []*storage.Book {
+	books := []*storage.Book{}
+	for i := 0; i < n; i++ {
+		ob := &exchanger.OrderBook{Exchanger: "Kraken"}
+		for j := 0; j < 50; j++ {
+			vol := float64(j + 1)
+			if j == i {
+				vol += 0.123
+			}
+			ob.Bids = append(ob.Bids, &exchanger.Order{Price: 0.05 - float64(j)*0.0001, Volume: vol})
+			ob.Asks = append(ob.Asks, &exchanger.Order{Price: 0.0501 + float64(j+i%2)*0.0001, Volume: 0.5})
+		}
+
+		ts := t0.Add(time.Duration(i) * time.Second)
+		ob.Sent, ob.Received = ts.Add(-100*time.Millisecond), ts.Add(100*time.Millisecond)
+		if i%2 == 0 {
+			ob.ExchangeTime = ts.Add(-time.Second)
+		}
+
+		books = append(books, &storage.Book{Pair: exchanger.ZEC_BTC, Time: ts, OrderBook: ob})
+	}
+	return books
+}
+
+func TestReadWrite(t *testing.T) {
+	t0 := time.Unix(1500000000, 0)
+	books := testBooks(t0, 10)
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, Header{Exchanger: "Kraken", Pair: exchanger.ZEC_BTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.KeyframeInterval = 4
+
+	jsonSize := 0
+	for _, b := range books {
+		if err := w.Write(b.Time, b.OrderBook); err != nil {
+			t.Fatal(err)
+		}
+
+		bids, _ := json.Marshal(b.Bids)
+		asks, _ := json.Marshal(b.Asks)
+		jsonSize += len(bids) + len(asks)
+	}
+
+	if buf.Len()*10 > jsonSize {
+		t.Errorf("%d bytes are not compact for %d bytes of JSON", buf.Len(), jsonSize)
+	}
+
+	if err := w.Write(t0, books[0].OrderBook); err == nil {
+		t.Error("books should be written in chronological order")
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Len() != 10 || len(r.keyframes) != 3 || !r.First().Equal(t0) || !r.Last().Equal(books[9].Time) {
+		t.Fatalf("wrong index: %d books, %d keyframes, %s - %s", r.Len(), len(r.keyframes), r.First(), r.Last())
+	}
+
+	// a diff after a keyframe
+	b, err := r.At(books[5].Time.Add(500 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBook(t, b, books[5])
+
+	if b, err := r.At(t0.Add(-time.Second)); err != nil || b != nil {
+		t.Errorf("no book expected before the first one, got %v (%v)", b, err)
+	}
+
+	read := []*storage.Book{}
+	err = r.Range(books[3].Time, books[8].Time, func(b *storage.Book) error {
+		read = append(read, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read) != 5 {
+		t.Fatalf("5 books expected, got %d", len(read))
+	}
+	for i, b := range read {
+		checkBook(t, b, books[3+i])
+	}
+}
+
+func TestOpenWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bookfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kraken_zec_btc.bkf")
+	h := Header{Exchanger: "Kraken", Pair: exchanger.ZEC_BTC}
+	books := testBooks(time.Unix(1500000000, 0), 6)
+
+	w, err := OpenWriter(path, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range books[:3] {
+		if err := w.Write(b.Time, b.OrderBook); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a record cut by a crash
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{100, 1, 2})
+	f.Close()
+
+	if _, err := OpenWriter(path, Header{Exchanger: "Poloniex", Pair: exchanger.ZEC_BTC}); err == nil {
+		t.Error("the header of the file should be checked")
+	}
+
+	w, err = OpenWriter(path, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Last().Equal(books[2].Time) {
+		t.Errorf("last book should be at %s, got %s", books[2].Time, w.Last())
+	}
+	for _, b := range books[3:] {
+		if err := w.Write(b.Time, b.OrderBook); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Len() != 6 || len(r.keyframes) != 2 {
+		t.Fatalf("6 books and 2 keyframes expected, got %d and %d", r.Len(), len(r.keyframes))
+	}
+
+	b, err := r.At(books[5].Time)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBook(t, b, books[5])
+}
+
+func checkBook(t *testing.T, got, expected *storage.Book) {
+	if got == nil {
+		t.Fatalf("book of %s expected, got none", expected.Time)
+	}
+
+	if !got.Time.Equal(expected.Time) || got.Latency() != expected.Latency() ||
+		!got.ExchangeTime.Equal(expected.ExchangeTime) {
+		t.Errorf("book of %s expected, got %s (latency %s, exchange time %s)",
+			expected.Time, got.Time, got.Latency(), got.ExchangeTime)
+	}
+
+	round := func(orders []*exchanger.Order) []exchanger.Order {
+		s := []exchanger.Order{}
+		for _, o := range orders {
+			s = append(s, exchanger.Order{Price: float64(int64(o.Price*1e8+0.5)) / 1e8, Volume: o.Volume})
+		}
+		return s
+	}
+
+	if !reflect.DeepEqual(round(got.Bids), round(expected.Bids)) {
+		t.Errorf("wrong bids at %s: %v", expected.Time, round(got.Bids))
+	}
+	if !reflect.DeepEqual(round(got.Asks), round(expected.Asks)) {
+		t.Errorf("wrong asks at %s: %v", expected.Time, round(got.Asks))
+	}
+}
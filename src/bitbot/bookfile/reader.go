@@ -0,0 +1,308 @@
+package bookfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+// keyframe is the position of a keyframe in the file.
+type keyframe struct {
+	time   time.Time
+	offset int64
+}
+
+// Reader reads the books of a file by time.
+type Reader struct {
+	Header Header
+
+	r       io.ReaderAt
+	closer  io.Closer
+	prices  scale
+	volumes scale
+
+	keyframes []keyframe
+	// end is the offset following the last complete record.
+	end   int64
+	count int
+	first time.Time
+	last  time.Time
+}
+
+// Open opens the file at path. The reader must be closed.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r, err := NewReader(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r.closer = f
+	return r, nil
+}
+
+// NewReader reads the header of the file of size bytes read by r and indexes its
+// keyframes. A truncated last record is ignored.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 0, size))
+
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &Reader{
+		Header:  *h,
+		r:       r,
+		prices:  newScale(h.PriceDecimals),
+		volumes: newScale(h.VolumeDecimals),
+		end:     int64(len(h.encode())),
+	}
+
+	var t time.Time
+	for {
+		payload, n, err := readRecord(br)
+		if err != nil {
+			// end of file, or record truncated by a crash
+			break
+		}
+
+		flags, rt, err := recordTime(payload, t)
+		if err != nil {
+			return nil, err
+		}
+
+		if flags&flagKeyframe != 0 {
+			reader.keyframes = append(reader.keyframes, keyframe{rt, reader.end})
+		} else if reader.count == 0 {
+			return nil, ErrFormat
+		}
+
+		if reader.count == 0 {
+			reader.first = rt
+		}
+
+		t = rt
+		reader.end += int64(n)
+		reader.count++
+	}
+
+	reader.last = t
+	return reader, nil
+}
+
+// Close closes the file opened by Open.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Len returns the number of books of the file.
+func (r *Reader) Len() int {
+	return r.count
+}
+
+// First and Last return the times of the first and the last books, zero for an empty
+// file.
+func (r *Reader) First() time.Time {
+	return r.first
+}
+
+func (r *Reader) Last() time.Time {
+	return r.last
+}
+
+// At returns the last book taken at or before t, nil if t is before the first book.
+func (r *Reader) At(t time.Time) (*storage.Book, error) {
+	var found *storage.Book
+
+	err := r.scan(t, func(b *book) bool {
+		if b.time.After(t) {
+			return false
+		}
+		found = r.book(b)
+		return true
+	})
+	return found, err
+}
+
+// Range calls f with the books taken in [from, to), in chronological order. It stops at
+// the first error returned by f.
+func (r *Reader) Range(from, to time.Time, f func(*storage.Book) error) error {
+	var err error
+
+	scanErr := r.scan(from, func(b *book) bool {
+		if !b.time.Before(to) {
+			return false
+		}
+		if b.time.Before(from) {
+			return true
+		}
+
+		err = f(r.book(b))
+		return err == nil
+	})
+
+	if scanErr != nil {
+		return scanErr
+	}
+	return err
+}
+
+// scan decodes the records from the last keyframe before t, and calls f with each of
+// them until it returns false.
+func (r *Reader) scan(t time.Time, f func(*book) bool) error {
+	if len(r.keyframes) == 0 {
+		return nil
+	}
+
+	i := sort.Search(len(r.keyframes), func(i int) bool { return r.keyframes[i].time.After(t) }) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	offset := r.keyframes[i].offset
+	br := bufio.NewReader(io.NewSectionReader(r.r, offset, r.end-offset))
+
+	var state *book
+	for {
+		payload, _, err := readRecord(br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return formatError(err)
+		}
+
+		if state, err = decodeRecord(payload, state); err != nil {
+			return err
+		}
+
+		if !f(state) {
+			return nil
+		}
+	}
+}
+
+// book converts a decoded record.
+func (r *Reader) book(b *book) *storage.Book {
+	sent := b.time.Add(-b.latency / 2)
+	return &storage.Book{
+		Pair: r.Header.Pair,
+		Time: b.time,
+		OrderBook: &exchanger.OrderBook{
+			Exchanger:    r.Header.Exchanger,
+			Bids:         orders(b.bids, true, r.prices, r.volumes),
+			Asks:         orders(b.asks, false, r.prices, r.volumes),
+			Sent:         sent,
+			Received:     sent.Add(b.latency),
+			ExchangeTime: b.exchangeTime,
+		},
+	}
+}
+
+// readRecord returns the payload of the next record and the length of the record.
+func readRecord(br *bufio.Reader) ([]byte, int, error) {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if length > 1<<26 {
+		return nil, 0, ErrFormat
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	return payload, uvarintLen(length) + int(length), nil
+}
+
+// recordTime decodes the flags and the time of a record following a record of time prev.
+func recordTime(payload []byte, prev time.Time) (byte, time.Time, error) {
+	d := &decoder{r: bytes.NewReader(payload)}
+
+	flags := d.byte()
+	var t time.Time
+	if flags&flagKeyframe != 0 {
+		t = fromMillis(d.varint())
+	} else {
+		t = prev.Add(time.Duration(d.uvarint()) * time.Millisecond)
+	}
+
+	if d.err != nil {
+		return 0, time.Time{}, formatError(d.err)
+	}
+	return flags, t, nil
+}
+
+// decodeRecord applies a record to the state of the previous one.
+func decodeRecord(payload []byte, prev *book) (*book, error) {
+	d := &decoder{r: bytes.NewReader(payload)}
+
+	flags := d.byte()
+	b := &book{}
+
+	if flags&flagKeyframe != 0 {
+		b.time = fromMillis(d.varint())
+	} else if prev == nil {
+		return nil, ErrFormat
+	} else {
+		b.time = prev.time.Add(time.Duration(d.uvarint()) * time.Millisecond)
+	}
+
+	b.latency = time.Duration(d.uvarint()) * time.Microsecond
+	if flags&flagExchangeTime != 0 {
+		b.exchangeTime = b.time.Add(time.Duration(d.varint()) * time.Millisecond)
+	}
+
+	bids, asks := d.side(), d.side()
+	if d.err != nil {
+		return nil, formatError(d.err)
+	}
+
+	if flags&flagKeyframe != 0 {
+		b.bids, b.asks = bids, asks
+	} else {
+		b.bids, b.asks = apply(prev.bids, bids), apply(prev.asks, asks)
+	}
+	return b, nil
+}
+
+// apply returns the levels of prev updated with changes.
+func apply(prev, changes map[int64]uint64) map[int64]uint64 {
+	m := make(map[int64]uint64, len(prev))
+	for p, v := range prev {
+		m[p] = v
+	}
+
+	for p, v := range changes {
+		if v == 0 {
+			delete(m, p)
+		} else {
+			m[p] = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,190 @@
+package bookfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Writer appends books to a file.
+type Writer struct {
+	// KeyframeInterval is the number of records between two keyframes.
+	KeyframeInterval int
+
+	header  Header
+	w       io.Writer
+	prices  scale
+	volumes scale
+
+	prev *book
+	// n is the number of records since the last keyframe.
+	n int
+	// last is the time of the last book of the file.
+	last time.Time
+}
+
+// NewWriter writes the header to w and returns a writer of books.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	h.setDefaults()
+	if _, err := w.Write(h.encode()); err != nil {
+		return nil, err
+	}
+	return newWriter(w, h), nil
+}
+
+// newWriter returns a writer after the header, starting with a keyframe.
+func newWriter(w io.Writer, h Header) *Writer {
+	return &Writer{
+		KeyframeInterval: DefaultKeyframeInterval,
+		header:           h,
+		w:                w,
+		prices:           newScale(h.PriceDecimals),
+		volumes:          newScale(h.VolumeDecimals),
+	}
+}
+
+// Header returns the header of the file.
+func (w *Writer) Header() Header {
+	return w.header
+}
+
+// Last returns the time of the last book written, zero before the first one.
+func (w *Writer) Last() time.Time {
+	return w.last
+}
+
+// Write appends the book taken at t, with a millisecond precision. Books must be
+// written in chronological order.
+func (w *Writer) Write(t time.Time, ob *exchanger.OrderBook) error {
+	next := &book{
+		time:         fromMillis(millis(t)),
+		latency:      ob.Latency(),
+		exchangeTime: ob.ExchangeTime,
+		bids:         levels(ob.Bids, w.prices, w.volumes),
+		asks:         levels(ob.Asks, w.prices, w.volumes),
+	}
+
+	if next.time.Before(w.last) {
+		return fmt.Errorf("bookfile: book of %s written after the one of %s", next.time, w.last)
+	}
+
+	keyframe := w.prev == nil || w.n >= w.KeyframeInterval
+
+	var flags byte
+	if keyframe {
+		flags |= flagKeyframe
+	}
+	if !next.exchangeTime.IsZero() {
+		flags |= flagExchangeTime
+	}
+
+	buf := []byte{flags}
+	if keyframe {
+		buf = appendVarint(buf, millis(next.time))
+	} else {
+		buf = appendUvarint(buf, uint64(millis(next.time)-millis(w.prev.time)))
+	}
+
+	buf = appendUvarint(buf, uint64(next.latency/time.Microsecond))
+	if !next.exchangeTime.IsZero() {
+		buf = appendVarint(buf, millis(next.exchangeTime)-millis(next.time))
+	}
+
+	if keyframe {
+		buf = appendSide(buf, next.bids)
+		buf = appendSide(buf, next.asks)
+	} else {
+		buf = appendSide(buf, diff(w.prev.bids, next.bids))
+		buf = appendSide(buf, diff(w.prev.asks, next.asks))
+	}
+
+	record := appendUvarint(make([]byte, 0, len(buf)+binary.MaxVarintLen64), uint64(len(buf)))
+	if _, err := w.w.Write(append(record, buf...)); err != nil {
+		return err
+	}
+
+	if keyframe {
+		w.n = 0
+	}
+	w.n++
+	w.prev = next
+	w.last = next.time
+	return nil
+}
+
+// FileWriter is a Writer on a file.
+type FileWriter struct {
+	*Writer
+	f   *os.File
+	buf *bufio.Writer
+}
+
+// OpenWriter opens the file at path to append books, creating it with the header h if
+// it doesn't exist. The header of an existing file must have the exchanger and the pair
+// of h, its precision is kept. A record truncated by a crash is removed.
+func OpenWriter(path string, h Header) (*FileWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	fw := &FileWriter{f: f, buf: bufio.NewWriter(f)}
+
+	if stat.Size() == 0 {
+		if fw.Writer, err = NewWriter(fw.buf, h); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return fw, nil
+	}
+
+	r, err := NewReader(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read %s - %s", path, err)
+	}
+
+	if r.Header.Exchanger != h.Exchanger || r.Header.Pair != h.Pair {
+		f.Close()
+		return nil, fmt.Errorf("%s stores %s %s books", path, r.Header.Exchanger, r.Header.Pair)
+	}
+
+	if err := f.Truncate(r.end); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(r.end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// the first record appended is a keyframe
+	fw.Writer = newWriter(fw.buf, r.Header)
+	fw.last = r.last
+	return fw, nil
+}
+
+// Flush writes the buffered records to the file.
+func (fw *FileWriter) Flush() error {
+	return fw.buf.Flush()
+}
+
+// Close flushes the records and closes the file.
+func (fw *FileWriter) Close() error {
+	if err := fw.buf.Flush(); err != nil {
+		fw.f.Close()
+		return err
+	}
+	return fw.f.Close()
+}
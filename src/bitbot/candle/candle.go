@@ -0,0 +1,225 @@
+/*
+Package candle builds the OHLCV bars of the markets.
+
+The bars of an exchanger are built from its public trades (see bitbot/tape), or from the
+mid price of its order book snapshots when the trades are unavailable: their volume is
+then zero. The bars of the larger intervals are merged from the ones of the smallest.
+Bars still missing are filled with the candles of the exchanger API, where available
+(see exchanger.CandleFunc).
+*/
+package candle
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+// Sources of the candles, by order of preference.
+const (
+	Trades = "trades"
+	Books  = "books"
+	Venue  = "venue"
+)
+
+var sources = []string{Trades, Books, Venue}
+
+// Candle is a bar and the data it was built from.
+type Candle struct {
+	exchanger.Candle
+	Source string
+}
+
+// DefaultIntervals are built when none is configured.
+var DefaultIntervals = []time.Duration{time.Minute, 5 * time.Minute, time.Hour, 24 * time.Hour}
+
+// ParseInterval parses the intervals written as a number of minutes, hours or days: 1m,
+// 5m, 1h, 1d.
+func ParseInterval(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'m': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour}
+
+	if len(s) >= 2 {
+		if unit, ok := units[s[len(s)-1]]; ok {
+			if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n > 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid interval `%s`", s)
+}
+
+// FormatInterval is the reverse of ParseInterval.
+func FormatInterval(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+}
+
+// Validate checks that the intervals are sorted, whole minutes and multiples of the first
+// one, from which the others are merged.
+func Validate(intervals []time.Duration) error {
+	if len(intervals) == 0 {
+		return fmt.Errorf("no interval")
+	}
+
+	for i, d := range intervals {
+		switch {
+		case d <= 0 || d%time.Minute != 0:
+			return fmt.Errorf("interval %s isn't a number of minutes", d)
+		case d%intervals[0] != 0:
+			return fmt.Errorf("interval %s isn't a multiple of %s", d, intervals[0])
+		case i > 0 && d <= intervals[i-1]:
+			return fmt.Errorf("intervals should be sorted: %s after %s", d, intervals[i-1])
+		}
+	}
+	return nil
+}
+
+// builder accumulates the prices of the bars of a market in chronological order.
+type builder struct {
+	ex       string
+	pair     exchanger.Pair
+	interval time.Duration
+	source   string
+	candles  []*Candle
+}
+
+func (b *builder) add(t time.Time, open, high, low, close, volume float64, trades int, source string) {
+	start := t.Truncate(b.interval)
+
+	if n := len(b.candles); n > 0 && b.candles[n-1].Start.Equal(start) {
+		c := b.candles[n-1]
+		c.High = max(c.High, high)
+		c.Low = min(c.Low, low)
+		c.Close = close
+		c.Volume += volume
+		c.Trades += trades
+		if rank(source) < rank(c.Source) {
+			c.Source = source
+		}
+		return
+	}
+
+	b.candles = append(b.candles, &Candle{exchanger.Candle{
+		Exchanger: b.ex,
+		Pair:      b.pair,
+		Interval:  b.interval,
+		Start:     start,
+		Open:      open,
+		High:      high,
+		Low:       low,
+		Close:     close,
+		Volume:    volume,
+		Trades:    trades,
+	}, source})
+}
+
+// FromTrades builds the bars of the trades of a market, in chronological order.
+func FromTrades(trades []*exchanger.PublicTrade, interval time.Duration) []*Candle {
+	if len(trades) == 0 {
+		return []*Candle{}
+	}
+
+	b := &builder{ex: trades[0].Exchanger, pair: trades[0].Pair, interval: interval, candles: []*Candle{}}
+	for _, t := range trades {
+		b.add(t.Time, t.Price, t.Price, t.Price, t.Price, t.Volume, 1, Trades)
+	}
+	return b.candles
+}
+
+// FromBooks builds the bars of the mid prices of the snapshots of a market, in
+// chronological order. The empty books are skipped.
+func FromBooks(books []*storage.Book, interval time.Duration) []*Candle {
+	b := &builder{interval: interval, candles: []*Candle{}}
+
+	for _, book := range books {
+		if len(book.Bids) == 0 || len(book.Asks) == 0 {
+			continue
+		}
+
+		b.ex, b.pair = book.Exchanger, book.Pair
+		mid := (book.Bids[0].Price + book.Asks[0].Price) / 2
+		b.add(book.Time, mid, mid, mid, mid, 0, 0, Books)
+	}
+	return b.candles
+}
+
+// FromVenue converts the candles of an exchanger API.
+func FromVenue(candles []*exchanger.Candle) []*Candle {
+	out := make([]*Candle, len(candles))
+	for i, c := range candles {
+		out[i] = &Candle{*c, Venue}
+	}
+	return out
+}
+
+// Merge merges the bars of a market into bars of a multiple of their interval. The
+// source of a merged bar is the best one of its bars.
+func Merge(candles []*Candle, interval time.Duration) []*Candle {
+	if len(candles) == 0 {
+		return []*Candle{}
+	}
+
+	b := &builder{ex: candles[0].Exchanger, pair: candles[0].Pair, interval: interval, candles: []*Candle{}}
+	for _, c := range candles {
+		b.add(c.Start, c.Open, c.High, c.Low, c.Close, c.Volume, c.Trades, c.Source)
+	}
+	return b.candles
+}
+
+// Fill adds the bars of others missing from candles, and returns them in chronological
+// order.
+func Fill(candles, others []*Candle) []*Candle {
+	starts := map[int64]bool{}
+	for _, c := range candles {
+		starts[c.Start.UnixNano()] = true
+	}
+
+	out := append([]*Candle{}, candles...)
+	for _, c := range others {
+		if !starts[c.Start.UnixNano()] {
+			out = append(out, c)
+		}
+	}
+
+	sort.Sort(byStart(out))
+	return out
+}
+
+type byStart []*Candle
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byStart) Less(i, j int) bool { return s[i].Start.Before(s[j].Start) }
+
+func rank(source string) int {
+	for i, s := range sources {
+		if s == source {
+			return i
+		}
+	}
+	return len(sources)
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package candle
+
+import (
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+func TestParseInterval(t *testing.T) {
+	for s, d := range map[string]time.Duration{"1m": time.Minute, "5m": 5 * time.Minute, "1h": time.Hour,
+		"1d": 24 * time.Hour} {
+		if v, err := ParseInterval(s); err != nil || v != d {
+			t.Errorf("%s: %s expected, got %s (%v)", s, d, v, err)
+		}
+		if FormatInterval(d) != s {
+			t.Errorf("%s expected, got %s", s, FormatInterval(d))
+		}
+	}
+
+	for _, s := range []string{"", "m", "0m", "1s", "1.5h"} {
+		if _, err := ParseInterval(s); err == nil {
+			t.Errorf("`%s` should be invalid", s)
+		}
+	}
+
+	if err := Validate(DefaultIntervals); err != nil {
+		t.Error(err)
+	}
+	if err := Validate([]time.Duration{5 * time.Minute, 7 * time.Minute}); err == nil {
+		t.Error("7m isn't a multiple of 5m")
+	}
+}
+
+func TestFromTrades(t *testing.T) {
+	t0 := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	trades := []*exchanger.PublicTrade{}
+	for i, price := range []float64{10, 12, 9, 11, 13, 8, 10, 10} {
+		trades = append(trades, &exchanger.PublicTrade{Exchanger: "Kraken", Pair: exchanger.ZEC_BTC,
+			Price: price, Volume: 1, Time: t0.Add(time.Duration(i) * 40 * time.Second)})
+	}
+
+	minutes := FromTrades(trades, time.Minute)
+	if len(minutes) != 5 {
+		t.Fatalf("5 candles expected, got %d", len(minutes))
+	}
+
+	c := minutes[0]
+	if !c.Start.Equal(t0) || c.Open != 10 || c.High != 12 || c.Low != 10 || c.Close != 12 || c.Volume != 2 ||
+		c.Trades != 2 || c.Source != Trades {
+		t.Errorf("wrong first candle %+v", c)
+	}
+
+	direct := FromTrades(trades, 5*time.Minute)
+	merged := Merge(minutes, 5*time.Minute)
+	if len(direct) != 1 || len(merged) != 1 || direct[0].Candle != merged[0].Candle {
+		t.Errorf("merged candles %v should equal %v", merged, direct)
+	}
+	if c := merged[0]; c.Open != 10 || c.High != 13 || c.Low != 8 || c.Close != 10 || c.Volume != 8 {
+		t.Errorf("wrong merged candle %+v", c)
+	}
+}
+
+func TestFill(t *testing.T) {
+	t0 := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	book := func(ts time.Time, bid, ask float64) *storage.Book {
+		return &storage.Book{Pair: exchanger.ZEC_BTC, Time: ts, OrderBook: &exchanger.OrderBook{
+			Exchanger: "Kraken",
+			Bids:      []*exchanger.Order{{Price: bid, Volume: 1}},
+			Asks:      []*exchanger.Order{{Price: ask, Volume: 1}},
+		}}
+	}
+
+	trades := FromTrades([]*exchanger.PublicTrade{{Exchanger: "Kraken", Pair: exchanger.ZEC_BTC, Price: 10,
+		Volume: 1, Time: t0.Add(time.Minute)}}, time.Minute)
+	books := FromBooks([]*storage.Book{book(t0, 9, 11), book(t0.Add(time.Minute), 8, 10)}, time.Minute)
+	venue := FromVenue([]*exchanger.Candle{{Exchanger: "Kraken", Pair: exchanger.ZEC_BTC, Interval: time.Minute,
+		Start: t0.Add(2 * time.Minute), Open: 1, High: 1, Low: 1, Close: 1}})
+
+	candles := Fill(Fill(trades, books), venue)
+	if len(candles) != 3 {
+		t.Fatalf("3 candles expected, got %d", len(candles))
+	}
+
+	for i, source := range []string{Books, Trades, Venue} {
+		if c := candles[i]; c.Source != source || !c.Start.Equal(t0.Add(time.Duration(i)*time.Minute)) {
+			t.Errorf("candle %d: %s candle expected, got %+v", i, source, c)
+		}
+	}
+	if candles[0].Close != 10 {
+		t.Errorf("mid price 10 expected, got %v", candles[0].Close)
+	}
+
+	if c := Merge(candles, time.Hour)[0]; c.Source != Trades || c.Volume != 1 {
+		t.Errorf("wrong merged candle %+v", c)
+	}
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
@@ -28,3 +29,62 @@ func Openx(name, host, port, user, pwd string) *sqlx.DB {
 	errorutils.PanicOnError(err)
 	return db
 }
+
+// WithTx runs f in a transaction, committed when f succeeds.
+func WithTx(db *sql.DB, f func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("db.Begin() failed - %s", err)
+	}
+
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Seconds converts a resolution to the `resolution` columns.
+func Seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+// Timestamp scans the times of both MySQL, with or without parseTime, and SQLite. Null
+// times are zero.
+type Timestamp struct {
+	time.Time
+}
+
+func (t *Timestamp) Scan(v interface{}) error {
+	var err error
+
+	switch v := v.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v
+	case []byte:
+		t.Time, err = ParseTime(string(v))
+	case string:
+		t.Time, err = ParseTime(v)
+	default:
+		err = fmt.Errorf("cannot scan %T into a time", v)
+	}
+	return err
+}
+
+// ParseTime parses the times stored as text: MySQL datetimes and the times written by
+// the SQLite driver. The empty string is the zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano} {
+		// fractional seconds are parsed even when the layout has none
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time `%s`", s)
+}
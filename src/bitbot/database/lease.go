@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// duplicateEntry is the MySQL error raised by a duplicate primary key.
+const duplicateEntry = 1062
+
+// ErrLeaseLost is returned once another process took the lease over.
+var ErrLeaseLost = errors.New("lease lost")
+
+// Lease is a lock on a shared MySQL database, held by one process at a time through the
+// `leases` table. The holder renews it with heartbeats. A lease not renewed within its
+// TTL expires and can be taken over by another process.
+//
+// Each acquisition increments the fencing token of the lease: renewals only succeed
+// with the current token, so that a stale holder (paused, or cut from the database for
+// longer than the TTL) finds out it lost the lease and stops instead of acting beside
+// the new holder. Times are the database ones so that the clocks of the hosts don't
+// matter.
+type Lease struct {
+	Name   string
+	Holder string
+	TTL    time.Duration
+
+	db *sql.DB
+
+	mu    sync.Mutex
+	token int64
+	// renewed is the local time of the last successful acquisition or renewal.
+	renewed time.Time
+}
+
+// NewLease returns a lease on name, not acquired yet.
+func NewLease(db *sql.DB, name, holder string, ttl time.Duration) *Lease {
+	return &Lease{Name: name, Holder: holder, TTL: ttl, db: db}
+}
+
+// HolderID identifies the current process: host name and pid.
+func HolderID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Acquire takes the lease if it is free or expired. It returns false when another
+// process holds it.
+func (l *Lease) Acquire() (bool, error) {
+	start := time.Now()
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("db.Begin() failed - %s", err)
+	}
+
+	var holder string
+	var token int64
+	var expired bool
+
+	const query = "select holder, token, expires_at <= now(3) from leases where name = ? for update"
+	err = tx.QueryRow(query, l.Name).Scan(&holder, &token, &expired)
+
+	switch {
+	case err == sql.ErrNoRows:
+		const stmt = `
+			insert into leases
+				(name, holder, token, acquired_at, renewed_at, expires_at)
+			values
+				(?, ?, 1, now(3), now(3), now(3) + interval ? microsecond)
+		`
+		if _, err := tx.Exec(stmt, l.Name, l.Holder, l.TTL.Nanoseconds()/1000); err != nil {
+			_ = tx.Rollback()
+			// another process inserted the lease first
+			if e, ok := err.(*mysql.MySQLError); ok && e.Number == duplicateEntry {
+				return false, nil
+			}
+			return false, fmt.Errorf("cannot insert lease %s - %s", l.Name, err)
+		}
+		token = 1
+	case err != nil:
+		_ = tx.Rollback()
+		return false, fmt.Errorf("cannot read lease %s - %s", l.Name, err)
+	case !expired && holder != l.Holder:
+		_ = tx.Rollback()
+		return false, nil
+	default:
+		const stmt = `
+			update leases
+			set holder = ?, token = token + 1, acquired_at = now(3), renewed_at = now(3),
+				expires_at = now(3) + interval ? microsecond
+			where name = ?
+		`
+		if _, err := tx.Exec(stmt, l.Holder, l.TTL.Nanoseconds()/1000, l.Name); err != nil {
+			_ = tx.Rollback()
+			return false, fmt.Errorf("cannot take lease %s over - %s", l.Name, err)
+		}
+		token++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("tx.Commit() failed - %s", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.token = token
+	l.renewed = start
+	return true, nil
+}
+
+// Renew extends the lease by its TTL. It fails with ErrLeaseLost when the lease was
+// taken over.
+func (l *Lease) Renew() error {
+	start := time.Now()
+
+	const stmt = `
+		update leases
+		set renewed_at = now(3), expires_at = now(3) + interval ? microsecond
+		where name = ? and holder = ? and token = ?
+	`
+	res, err := l.db.Exec(stmt, l.TTL.Nanoseconds()/1000, l.Name, l.Holder, l.Token())
+	if err != nil {
+		return fmt.Errorf("cannot renew lease %s - %s", l.Name, err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("cannot renew lease %s - %s", l.Name, err)
+	} else if n == 0 {
+		return ErrLeaseLost
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.renewed = start
+	return nil
+}
+
+// Release frees the lease so that another process can take it without waiting for it
+// to expire.
+func (l *Lease) Release() error {
+	const stmt = "update leases set expires_at = now(3) where name = ? and holder = ? and token = ?"
+	_, err := l.db.Exec(stmt, l.Name, l.Holder, l.Token())
+	return err
+}
+
+// Token returns the fencing token of the last acquisition.
+func (l *Lease) Token() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// Held reports whether the lease was acquired or renewed less than a TTL ago. Holders
+// check it before acting: past the TTL another process may have taken the lease over.
+func (l *Lease) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.renewed.IsZero() && time.Since(l.renewed) < l.TTL
+}
+
+// Keep renews the lease every third of its TTL. It returns when the lease is lost, or
+// when it couldn't be renewed for a whole TTL: another process may hold it by then.
+func (l *Lease) Keep() error {
+	for {
+		time.Sleep(l.TTL / 3)
+
+		err := l.Renew()
+		if err == ErrLeaseLost {
+			return err
+		} else if err != nil && !l.Held() {
+			return fmt.Errorf("lease %s expired - %s", l.Name, err)
+		}
+	}
+}
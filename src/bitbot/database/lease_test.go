@@ -0,0 +1,75 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	m, err := NewMigrator(db, Migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(m.Latest()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("delete from leases where name = 'test'"); err != nil {
+		t.Fatal(err)
+	}
+
+	const ttl = 500 * time.Millisecond
+	a := NewLease(db, "test", "a", ttl)
+	b := NewLease(db, "test", "b", ttl)
+	c := NewLease(db, "test", "c", ttl)
+
+	if ok, err := a.Acquire(); err != nil || !ok {
+		t.Fatalf("a should acquire the free lease, got %t (%v)", ok, err)
+	}
+	if a.Token() != 1 || !a.Held() {
+		t.Errorf("a should hold the lease with token 1, got %d", a.Token())
+	}
+
+	if ok, err := b.Acquire(); err != nil || ok {
+		t.Errorf("b should not acquire the lease held by a, got %t (%v)", ok, err)
+	}
+	if err := a.Renew(); err != nil {
+		t.Errorf("a should renew its lease - %s", err)
+	}
+
+	// a stops renewing: b takes the lease over once it expired
+	time.Sleep(ttl + 100*time.Millisecond)
+	if a.Held() {
+		t.Error("a should not consider the lease held past its TTL")
+	}
+	if ok, err := b.Acquire(); err != nil || !ok {
+		t.Fatalf("b should take the expired lease over, got %t (%v)", ok, err)
+	}
+	if b.Token() != 2 {
+		t.Errorf("the takeover should increment the token, got %d", b.Token())
+	}
+
+	// the stale token of a is rejected
+	if err := a.Renew(); err != ErrLeaseLost {
+		t.Errorf("a should have lost the lease, got %v", err)
+	}
+	if err := a.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Acquire(); err != nil || ok {
+		t.Errorf("the release of a stale holder should not free the lease, got %t (%v)", ok, err)
+	}
+
+	// c gets the lease released by b without waiting for it to expire
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Acquire(); err != nil || !ok {
+		t.Errorf("c should acquire the released lease, got %t (%v)", ok, err)
+	}
+	if c.Token() != 3 {
+		t.Errorf("token 3 expected, got %d", c.Token())
+	}
+}
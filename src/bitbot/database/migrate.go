@@ -0,0 +1,245 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// noSuchTable is the MySQL error raised by a query on a missing table.
+const noSuchTable = 1146
+
+// Migration is a versioned change of the schema. Up applies it and Down reverts it,
+// one statement per string: the driver doesn't run several statements at once.
+type Migration struct {
+	Version int
+	Name    string
+	// Legacy upgrades the tables created before the migrations. They run before Up.
+	Legacy []*Upgrade
+	Up     []string
+	Down   []string
+	// Irreversible migrations have no Down: the initial one adopts the tables created
+	// before the migrations, which can't be told apart from the ones it created.
+	Irreversible bool
+}
+
+// Upgrade brings a table created before the migrations to the schema of a migration:
+// its statements run when the table exists without column. The column must appear with
+// the last statement, so that an upgrade failing half way is run again from the start.
+type Upgrade struct {
+	Table      string
+	Column     string
+	Statements []string
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Migrator applies and reverts migrations. The applied versions are recorded in the
+// `schema_version` table.
+//
+// MySQL commits DDL statements implicitly, so a migration can't run in a transaction.
+// Its version is recorded once all of its statements succeeded: a migration failing
+// half way is retried from the start, which is why the statements are idempotent
+// (`if not exists`, `if exists`).
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+// NewMigrator returns a migrator of db. The versions of the migrations must start at 1
+// and be consecutive.
+func NewMigrator(db *sql.DB, migrations []*Migration) (*Migrator, error) {
+	if err := Validate(migrations); err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Validate checks that the versions of the migrations start at 1 and are consecutive,
+// and that each of them can be reverted unless it is irreversible.
+func Validate(migrations []*Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %s should be version %d", m, i+1)
+		}
+		if m.Name == "" || len(m.Up) == 0 || len(m.Down) == 0 && !m.Irreversible {
+			return fmt.Errorf("migration %s requires a name, up and down statements", m)
+		}
+		if m.Irreversible && len(m.Down) > 0 {
+			return fmt.Errorf("migration %s is irreversible but has down statements", m)
+		}
+		for _, u := range m.Legacy {
+			if u.Table == "" || u.Column == "" || len(u.Statements) == 0 {
+				return fmt.Errorf("migration %s: legacy upgrades require a table, a column and statements", m)
+			}
+		}
+	}
+	return nil
+}
+
+// Latest returns the version of the last migration.
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the current version of the schema, 0 before the first migration.
+func (m *Migrator) Version() (int, error) {
+	var v sql.NullInt64
+	err := m.db.QueryRow("select max(version) from schema_version").Scan(&v)
+	if e, ok := err.(*mysql.MySQLError); ok && e.Number == noSuchTable {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("cannot read the schema version - %s", err)
+	}
+	return int(v.Int64), nil
+}
+
+// Up applies the migrations until version target, and returns the ones applied.
+func (m *Migrator) Up(target int) ([]*Migration, error) {
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("unknown version %d, the latest is %d", target, m.Latest())
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		return nil, err
+	} else if current >= target {
+		return []*Migration{}, nil
+	}
+
+	const create = `
+		create table if not exists schema_version (
+			version int not null,
+			name varchar(100) not null,
+			applied_at timestamp(3) not null,
+			primary key (version)
+		)
+	`
+	if _, err := m.db.Exec(create); err != nil {
+		return nil, fmt.Errorf("cannot create schema_version - %s", err)
+	}
+
+	applied := []*Migration{}
+	for _, mig := range m.migrations[current:target] {
+		if err := m.upgrade(mig); err != nil {
+			return applied, err
+		}
+		if err := m.exec(mig, mig.Up); err != nil {
+			return applied, err
+		}
+
+		const stmt = "insert into schema_version (version, name, applied_at) values (?, ?, now(3))"
+		if _, err := m.db.Exec(stmt, mig.Version, mig.Name); err != nil {
+			return applied, fmt.Errorf("cannot record migration %s - %s", mig, err)
+		}
+		applied = append(applied, mig)
+	}
+	return applied, nil
+}
+
+// Down reverts the migrations after version target, the last one first, and returns
+// the ones reverted. Nothing is reverted when one of them is irreversible.
+func (m *Migrator) Down(target int) ([]*Migration, error) {
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("unknown version %d, the latest is %d", target, m.Latest())
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		return nil, err
+	} else if current > m.Latest() {
+		return nil, fmt.Errorf("schema version %d is newer than the migrations (%d)", current, m.Latest())
+	}
+
+	for v := current; v > target; v-- {
+		if mig := m.migrations[v-1]; mig.Irreversible {
+			return nil, fmt.Errorf("migration %s can't be reverted", mig)
+		}
+	}
+
+	reverted := []*Migration{}
+	for v := current; v > target; v-- {
+		mig := m.migrations[v-1]
+		if err := m.exec(mig, mig.Down); err != nil {
+			return reverted, err
+		}
+
+		if _, err := m.db.Exec("delete from schema_version where version = ?", mig.Version); err != nil {
+			return reverted, fmt.Errorf("cannot record rollback of %s - %s", mig, err)
+		}
+		reverted = append(reverted, mig)
+	}
+	return reverted, nil
+}
+
+func (m *Migrator) exec(mig *Migration, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := m.db.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %s failed - %s", mig, err)
+		}
+	}
+	return nil
+}
+
+// upgrade runs the legacy upgrades of mig whose table exists without their column.
+func (m *Migrator) upgrade(mig *Migration) error {
+	for _, u := range mig.Legacy {
+		legacy, err := m.legacy(u)
+		if err != nil {
+			return fmt.Errorf("migration %s: cannot inspect %s - %s", mig, u.Table, err)
+		} else if !legacy {
+			continue
+		}
+
+		if err := m.exec(mig, u.Statements); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacy reports whether the table of u exists without its column.
+func (m *Migrator) legacy(u *Upgrade) (bool, error) {
+	const query = `
+		select
+			count(*),
+			coalesce(sum(column_name = ?), 0)
+		from information_schema.columns
+		where table_schema = database() and table_name = ?
+	`
+
+	var columns, found int
+	if err := m.db.QueryRow(query, u.Column, u.Table).Scan(&columns, &found); err != nil {
+		return false, err
+	}
+	return columns > 0 && found == 0, nil
+}
+
+// Check returns an error unless the schema is at the latest version.
+func (m *Migrator) Check() error {
+	v, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case v < m.Latest():
+		return fmt.Errorf("schema version %d is behind the latest one (%d), run `bin/migrate up`", v, m.Latest())
+	case v > m.Latest():
+		return fmt.Errorf("schema version %d is newer than the latest one known by this binary (%d)", v, m.Latest())
+	}
+	return nil
+}
+
+// CheckSchema returns an error unless the schema of db is at the version of Migrations.
+// Services call it at startup.
+func CheckSchema(db *sql.DB) error {
+	m, err := NewMigrator(db, Migrations)
+	if err != nil {
+		return err
+	}
+	return m.Check()
+}
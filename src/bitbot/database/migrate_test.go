@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	if err := Validate(Migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range Migrations {
+		statements := append(append([]string{}, m.Up...), m.Down...)
+		for _, u := range m.Legacy {
+			statements = append(statements, u.Statements...)
+		}
+
+		for _, stmt := range statements {
+			if strings.Contains(stmt, ";") {
+				t.Errorf("migration %s: one statement per string expected - %s", m, stmt)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	up, down := []string{"create table a (id int)"}, []string{"drop table a"}
+
+	invalid := [][]*Migration{
+		{{Version: 0, Name: "a", Up: up, Down: down}},
+		{{Version: 1, Name: "a", Up: up, Down: down}, {Version: 3, Name: "b", Up: up, Down: down}},
+		{{Version: 1, Name: "a", Up: up}},
+		{{Version: 1, Name: "a", Up: up, Down: down, Irreversible: true}},
+		{{Version: 1, Up: up, Down: down}},
+		{{Version: 1, Name: "a", Up: up, Down: down, Legacy: []*Upgrade{{Table: "a", Statements: up}}}},
+	}
+
+	for _, migrations := range invalid {
+		if err := Validate(migrations); err == nil {
+			t.Errorf("%v should be invalid", migrations)
+		}
+	}
+}
+
+// testDB opens the MySQL database of the BITBOT_TEST_MYSQL DSN, whose tables are dropped
+// by the tests: "user:pwd@tcp(localhost:3306)/bitbot_test". The test is skipped when it
+// isn't set.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("BITBOT_TEST_MYSQL")
+	if dsn == "" {
+		t.Skip("BITBOT_TEST_MYSQL not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestLegacyUpgrade migrates a database created from the schema of the first release
+// (testdata/baseline.sql).
+func TestLegacyUpgrade(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	rows, err := db.Query("select table_name from information_schema.tables where table_schema = database()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		if _, err := db.Exec("drop table " + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	baseline, err := ioutil.ReadFile("testdata/baseline.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := strings.Split(string(baseline), ";")
+	legacy = append(legacy,
+		"insert into orderbooks (exchanger, pair, ts, bids, asks) values ('Kraken', 'ZEC_BTC', '2017-06-01 12:00:00', '[]', '[]')",
+		`insert into arbitrage (arbitrage_id, buy_ex, sell_ex, pair, ts)
+			values ('a1', 'Kraken', 'Poloniex', 'ZEC_BTC', '2017-06-01 12:00:01')`,
+		"insert into order_ack values ('a1', 'o1', 'ZEC_BTC', 'Kraken', 'buy'), ('a1', 'o2', 'ZEC_BTC', 'Poloniex', 'sell')",
+		`insert into trade values
+			('a1', 't1', 0.01, 1, 'ZEC_BTC', 'buy', 0.0001, 'BTC'),
+			('a1', 't1', 0.0101, 1, 'ZEC_BTC', 'sell', 0.0001, 'BTC'),
+			('a2', 't2', 0.01, 1, 'ZEC_BTC', 'buy', 0.0001, 'BTC')`,
+	)
+	for _, stmt := range legacy {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s - %s", stmt, err)
+		}
+	}
+
+	m, err := NewMigrator(db, Migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(m.Latest()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the trade ids of the venues are only unique per exchanger
+	const query = "select exchanger, order_id, side, cast(ts as char) from trade where trade_id = 't1' order by exchanger"
+	rows, err = db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	expected := [][4]string{
+		{"Kraken", "o1", "buy", "2017-06-01 12:00:01.000"},
+		{"Poloniex", "o2", "sell", "2017-06-01 12:00:01.000"},
+	}
+	trades := [][4]string{}
+	for rows.Next() {
+		var tr [4]string
+		if err := rows.Scan(&tr[0], &tr[1], &tr[2], &tr[3]); err != nil {
+			t.Fatal(err)
+		}
+		trades = append(trades, tr)
+	}
+	if len(trades) != len(expected) || trades[0] != expected[0] || trades[1] != expected[1] {
+		t.Errorf("expected trades %v, got %v", expected, trades)
+	}
+
+	// the trade of an unknown arbitrage can't be attributed
+	var n int
+	if err := db.QueryRow("select count(*) from trade where trade_id = 't2'").Scan(&n); err != nil || n != 0 {
+		t.Errorf("the trade without arbitrage should not be upgraded, got %d (%v)", n, err)
+	}
+	if err := db.QueryRow("select count(*) from trade_legacy where trade_id = 't2'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("the trade without arbitrage should be kept in trade_legacy, got %d (%v)", n, err)
+	}
+
+	const books = "select count(*) from orderbooks where pair = 'ZEC_BTC' and sent_at is null"
+	if err := db.QueryRow(books).Scan(&n); err != nil || n != 1 {
+		t.Errorf("1 legacy book expected, got %d (%v)", n, err)
+	}
+
+	if _, err := m.Down(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(0); err == nil {
+		t.Error("the initial migration should not be reverted")
+	}
+}
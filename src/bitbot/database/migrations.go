@@ -0,0 +1,557 @@
+package database
+
+// Migrations is the schema of the bot, in order. Append new migrations at the end and
+// never edit the applied ones: `bin/migrate up` only runs the versions not recorded in
+// the schema_version table.
+//
+// The tables of the first migrations are created `if not exists` for the databases
+// created before the migrations (from db/init.sql and src/services/db.sql). The tables
+// whose schema changed since are upgraded first (see Migration.Legacy): the
+// `orderbooks` table gets its fetch times, and the `trade` table is copied into the new
+// schema, the former one being kept as `trade_legacy`. The first migration can't be
+// reverted.
+var Migrations = []*Migration{
+	// tables of the former db/init.sql
+	{
+		Version: 1,
+		Name:    "initial",
+		Legacy: []*Upgrade{
+			{
+				Table:  "orderbooks",
+				Column: "sent_at",
+				Statements: []string{
+					`
+						alter table orderbooks
+							add column sent_at timestamp(3) null,
+							add column received_at timestamp(3) null,
+							add column exchange_ts timestamp(3) null,
+							add key (pair, ts)
+					`,
+				},
+			},
+			{
+				// the legacy trades are attributed to the exchanger and the order of their
+				// acknowledgement, and timestamped with their arbitrage. The trades missing
+				// either are only kept in trade_legacy.
+				Table:  "trade",
+				Column: "exchanger",
+				Statements: []string{
+					"drop table if exists trade_upgrade",
+					`
+						create table trade_upgrade (
+							exchanger varchar(20) not null,
+							trade_id varchar(50) not null,
+							arbitrage_id varchar(100),
+							order_id varchar(50) not null,
+							price double not null,
+							quantity double not null,
+							pair varchar(10) not null,
+							side varchar(4) not null,
+							fee double not null,
+							fee_currency varchar(10) not null,
+							ts timestamp(3) not null,
+							primary key (exchanger, trade_id),
+							key (arbitrage_id)
+						)
+					`,
+					`
+						insert ignore into trade_upgrade
+							(exchanger, trade_id, arbitrage_id, order_id, price, quantity, pair, side, fee,
+							fee_currency, ts)
+						select
+							o.exchanger,
+							t.trade_id,
+							t.arbitrage_id,
+							o.external_id,
+							t.price,
+							t.quantity,
+							t.pair,
+							t.side,
+							t.fee,
+							t.fee_currency,
+							a.ts
+						from trade t
+						join (
+							select arbitrage_id, pair, side, min(exchanger) as exchanger,
+								min(external_id) as external_id
+							from order_ack
+							group by arbitrage_id, pair, side
+						) o on o.arbitrage_id = t.arbitrage_id and o.pair = t.pair and o.side = t.side
+						join arbitrage a on a.arbitrage_id = t.arbitrage_id
+					`,
+					"rename table trade to trade_legacy, trade_upgrade to trade",
+				},
+			},
+		},
+		Up: []string{
+			`
+				create table if not exists orderbooks (
+					exchanger varchar(50) not null,
+					pair varchar(10) not null,
+					ts timestamp(3) not null,
+					bids json,
+					asks json,
+					-- request and response times of the fetch, and time reported by the exchanger
+					sent_at timestamp(3) null,
+					received_at timestamp(3) null,
+					exchange_ts timestamp(3) null,
+					primary key (exchanger, pair, ts),
+					-- price lookups (see bitbot/pnl)
+					key (pair, ts)
+				)
+			`,
+			`
+				-- order book fetch latencies per exchanger, in milliseconds (see bitbot/latency)
+				create table if not exists book_latency (
+					ts timestamp(3) not null,
+					exchanger varchar(50) not null,
+					samples int not null,
+					errors int not null,
+					p50 double not null,
+					p90 double not null,
+					p99 double not null,
+					max double not null,
+					primary key (exchanger, ts)
+				)
+			`,
+			`
+				create table if not exists arbitrages (
+					buy_ex varchar(20),
+					sell_ex varchar(20),
+					pair varchar(10) not null,
+					ts timestamp(3) not null,
+					buy_price float,
+					sell_price float,
+					vol float,
+					spread float,
+					key (spread)
+				)
+			`,
+			`
+				-- consecutive crossings of two venues in the snapshots (see bitbot/episode)
+				create table if not exists episodes (
+					id int not null auto_increment,
+					pair varchar(10) not null,
+					buy_ex varchar(20) not null,
+					sell_ex varchar(20) not null,
+					-- first and last snapshots of the episode
+					start_ts timestamp(3) not null,
+					end_ts timestamp(3) not null,
+					peak_spread float not null,
+					avg_vol float not null,
+					snapshots int not null,
+					primary key (id),
+					key (pair, start_ts)
+				)
+			`,
+			`
+				create table if not exists arbitrage (
+					arbitrage_id varchar(100) not null,
+					buy_ex varchar(20) not null,
+					sell_ex varchar(20) not null,
+					pair varchar(10) not null,
+					ts timestamp(3) not null,
+					buy_price float,
+					sell_price float,
+					vol float,
+					spread float,
+					primary key (arbitrage_id)
+				)
+			`,
+			`
+				create table if not exists order_ack (
+					arbitrage_id varchar(100) not null,
+					-- depending on the exchanger external_id is either a trade_id or an
+					-- order_id. An order Id can be associated with several trade_id.
+					external_id varchar(50) not null,
+					pair varchar(10) not null,
+					exchanger varchar(20),
+					side varchar(10)
+				)
+			`,
+			`
+				-- orders of the engine, saved before being sent (see services-old/trader/intent.go)
+				create table if not exists intents (
+					intent_id varchar(100) not null,
+					group_id varchar(100) not null,
+					strategy varchar(30) not null,
+					exchanger varchar(20) not null,
+					pair varchar(10) not null,
+					side varchar(4) not null,
+					-- market, limit or cancel
+					type varchar(10) not null,
+					price double not null,
+					volume double not null,
+					-- order to cancel (cancel intents only)
+					target_id varchar(50) not null,
+					-- comma separated ids returned by the exchanger
+					order_ids varchar(255) not null,
+					-- pending, open, done, cancelled, failed or flagged
+					status varchar(10) not null,
+					error varchar(255) not null,
+					created_at timestamp(3) not null,
+					updated_at timestamp(3) not null,
+					primary key (intent_id),
+					key (status)
+				)
+			`,
+			`
+				-- trade history of the exchangers (see exchanger.TradeHistorian)
+				create table if not exists trade (
+					exchanger varchar(20) not null,
+					trade_id varchar(50) not null,
+					-- null for trades placed outside of the bot
+					arbitrage_id varchar(100),
+					order_id varchar(50) not null,
+					price double not null,
+					quantity double not null,
+					pair varchar(10) not null,
+					side varchar(4) not null,
+					fee double not null,
+					fee_currency varchar(10) not null,
+					ts timestamp(3) not null,
+					primary key (exchanger, trade_id),
+					key (arbitrage_id)
+				)
+			`,
+			`
+				-- position of the trade synchronization in the history of each exchanger
+				create table if not exists trade_cursor (
+					exchanger varchar(20) not null,
+					pair varchar(10) not null,
+					position varchar(50) not null,
+					updated_at timestamp(3) not null,
+					primary key (exchanger, pair)
+				)
+			`,
+			`
+				create table if not exists transfers (
+					transfer_id varchar(100) not null,
+					currency varchar(10) not null,
+					from_ex varchar(20) not null,
+					to_ex varchar(20) not null,
+					address varchar(120) not null,
+					amount double not null,
+					fee double not null,
+					-- requested, awaiting_approval, approved, withdrawing, withdrawal_acknowledged,
+					-- on_chain, credited, completed or failed
+					status varchar(30) not null,
+					withdrawal_id varchar(100),
+					tx_id varchar(150),
+					deposit_id varchar(150),
+					error varchar(255) not null,
+					created_at timestamp(3) not null,
+					updated_at timestamp(3) not null,
+					primary key (transfer_id),
+					unique key (to_ex, deposit_id),
+					key (status)
+				)
+			`,
+			`
+				create table if not exists transfer_history (
+					exchanger varchar(20) not null,
+					-- deposit or withdrawal
+					kind varchar(10) not null,
+					transfer_id varchar(150) not null,
+					currency varchar(10) not null,
+					amount float not null,
+					fee float not null,
+					address varchar(120) not null,
+					tx_id varchar(150) not null,
+					-- pending, completed or failed
+					status varchar(10) not null,
+					raw_status varchar(50) not null,
+					ts timestamp(3) not null,
+					primary key (exchanger, kind, transfer_id),
+					key (tx_id)
+				)
+			`,
+			`
+				-- approved withdrawal destinations (see bitbot/address)
+				create table if not exists address_book (
+					exchanger varchar(20) not null,
+					currency varchar(10) not null,
+					address varchar(120) not null,
+					-- name of the address in the Kraken UI, Kraken withdrawals refer to it
+					kraken_key varchar(50),
+					primary key (exchanger, currency)
+				)
+			`,
+			`
+				-- decisions of the withdrawal policy, written before any funds move
+				create table if not exists withdrawal_audit (
+					id int not null auto_increment,
+					transfer_id varchar(100) not null,
+					ts timestamp(3) not null,
+					-- allowed, rejected, approval_required, approved or manually_rejected
+					decision varchar(30) not null,
+					reason varchar(255) not null,
+					actor varchar(50) not null,
+					currency varchar(10) not null,
+					from_ex varchar(20) not null,
+					to_ex varchar(20) not null,
+					address varchar(120) not null,
+					amount float not null,
+					primary key (id),
+					key (transfer_id)
+				)
+			`,
+			`
+				-- balances of every account, valued with the recorded prices (null without price)
+				create table if not exists balance_snapshot (
+					ts timestamp(3) not null,
+					exchanger varchar(20) not null,
+					-- main or trading
+					account varchar(10) not null,
+					currency varchar(10) not null,
+					balance double not null,
+					value_btc double,
+					value_usd double,
+					value_eur double,
+					primary key (ts, exchanger, account, currency)
+				)
+			`,
+			`
+				-- alerts raised by the background jobs (see bitbot/reconcile)
+				create table if not exists alerts (
+					id int not null auto_increment,
+					ts timestamp(3) not null,
+					source varchar(30) not null,
+					kind varchar(30) not null,
+					exchanger varchar(20) not null,
+					currency varchar(10) not null,
+					message varchar(255) not null,
+					primary key (id),
+					key (ts)
+				)
+			`,
+			`
+				-- leases of the trading processes, one holder at a time (see bitbot/database/lease.go)
+				create table if not exists leases (
+					name varchar(50) not null,
+					-- host:pid
+					holder varchar(100) not null,
+					-- fencing token, incremented by each acquisition
+					token bigint not null,
+					acquired_at timestamp(3) not null,
+					renewed_at timestamp(3) not null,
+					expires_at timestamp(3) not null,
+					primary key (name)
+				)
+			`,
+		},
+		// the tables may predate the migrations: they are never dropped
+		Irreversible: true,
+	},
+	// Bittrex market summaries of services/trader, missing from db/init.sql
+	{
+		Version: 2,
+		Name:    "market_summary",
+		Up: []string{
+			`
+				create table if not exists market_summary (
+					market_name varchar(10) not null,
+					high decimal(40, 25) not null,
+					low decimal(40, 25) not null,
+					ask decimal(40, 25) not null,
+					bid decimal(40, 25) not null,
+					open_buy_orders int not null,
+					open_sell_orders int not null,
+					volume decimal(40, 25) not null,
+					last decimal(40, 25) not null,
+					base_volume decimal(40, 25) not null,
+					prev_day decimal(40, 25) not null,
+					creation_date datetime not null,
+					primary key (market_name, creation_date)
+				)
+			`,
+		},
+		Down: []string{
+			"drop table if exists market_summary",
+		},
+	},
+	// downsampled market data (see services/retention)
+	{
+		Version: 3,
+		Name:    "retention",
+		Up: []string{
+			`
+				-- downsampled market data (see services/retention), resolutions are in seconds
+				create table if not exists book_aggregates (
+					exchanger varchar(50) not null,
+					pair varchar(10) not null,
+					resolution int not null,
+					start_ts timestamp(3) not null,
+					samples int not null,
+					-- best prices
+					bid_open double not null,
+					bid_high double not null,
+					bid_low double not null,
+					bid_close double not null,
+					ask_open double not null,
+					ask_high double not null,
+					ask_low double not null,
+					ask_close double not null,
+					-- average mid price, and spreads relative to it in percent
+					mid double not null,
+					spread_avg double not null,
+					spread_min double not null,
+					spread_max double not null,
+					-- average volumes within 0.5%, 1%, 2% and 5% of the mid price
+					bid_depth json not null,
+					ask_depth json not null,
+					primary key (resolution, pair, exchanger, start_ts)
+				)
+			`,
+			`
+				create table if not exists market_summary_aggregates (
+					market_name varchar(10) not null,
+					resolution int not null,
+					start_ts timestamp(3) not null,
+					samples int not null,
+					last_open decimal(40, 25) not null,
+					last_high decimal(40, 25) not null,
+					last_low decimal(40, 25) not null,
+					last_close decimal(40, 25) not null,
+					-- values of the last summary of the period
+					bid decimal(40, 25) not null,
+					ask decimal(40, 25) not null,
+					volume decimal(40, 25) not null,
+					base_volume decimal(40, 25) not null,
+					primary key (resolution, market_name, start_ts)
+				)
+			`,
+			`
+				create table if not exists arbitrage_aggregates (
+					pair varchar(10) not null,
+					buy_ex varchar(20) not null,
+					sell_ex varchar(20) not null,
+					resolution int not null,
+					start_ts timestamp(3) not null,
+					count int not null,
+					spread_avg float not null,
+					spread_max float not null,
+					vol float not null,
+					primary key (resolution, pair, buy_ex, sell_ex, start_ts)
+				)
+			`,
+			`
+				-- periods aggregated by the retention job: the rows before aggregated_until are final
+				create table if not exists retention_state (
+					dataset varchar(30) not null,
+					resolution int not null,
+					aggregated_until timestamp(3) not null,
+					primary key (dataset, resolution)
+				)
+			`,
+		},
+		Down: []string{
+			"drop table if exists retention_state",
+			"drop table if exists arbitrage_aggregates",
+			"drop table if exists market_summary_aggregates",
+			"drop table if exists book_aggregates",
+		},
+	},
+	// 24h tickers of every exchanger (see exchanger.Ticker)
+	{
+		Version: 4,
+		Name:    "tickers",
+		Up: []string{
+			`
+				create table if not exists tickers (
+					exchanger varchar(20) not null,
+					pair varchar(20) not null,
+					-- time of the fetch
+					ts timestamp(3) not null,
+					last double not null,
+					bid double not null,
+					ask double not null,
+					high double not null,
+					low double not null,
+					-- 24h volumes in the base and the quote currencies of the pair
+					base_volume double not null,
+					quote_volume double not null,
+					prev_day double not null,
+					primary key (exchanger, pair, ts),
+					key (pair, ts)
+				)
+			`,
+		},
+		Down: []string{
+			"drop table if exists tickers",
+		},
+	},
+	// public trades of the exchangers (see services/recorder)
+	{
+		Version: 5,
+		Name:    "public_trades",
+		Up: []string{
+			`
+				create table if not exists public_trades (
+					exchanger varchar(20) not null,
+					pair varchar(20) not null,
+					trade_id varchar(100) not null,
+					price double not null,
+					volume double not null,
+					-- side of the aggressor: buy or sell
+					side varchar(4) not null,
+					ts timestamp(3) not null,
+					primary key (exchanger, pair, trade_id),
+					key (pair, ts)
+				)
+			`,
+		},
+		Down: []string{
+			"drop table if exists public_trades",
+		},
+	},
+	// OHLCV bars (see services/candles)
+	{
+		Version: 6,
+		Name:    "candles",
+		Up: []string{
+			`
+				create table if not exists candles (
+					exchanger varchar(20) not null,
+					pair varchar(20) not null,
+					-- interval in seconds
+					resolution int not null,
+					start_ts timestamp(3) not null,
+					open double not null,
+					high double not null,
+					low double not null,
+					close double not null,
+					-- in the base currency, 0 for the bars built from the books
+					volume double not null,
+					trades int not null,
+					-- trades, books or venue
+					source varchar(10) not null,
+					primary key (exchanger, pair, resolution, start_ts)
+				)
+			`,
+		},
+		Down: []string{
+			"drop table if exists candles",
+		},
+	},
+	// progress of the candles job, for the markets without data as well
+	{
+		Version: 7,
+		Name:    "candle_state",
+		Up: []string{
+			`
+				-- periods built by the candles job: the bars before built_until are final
+				create table if not exists candle_state (
+					exchanger varchar(20) not null,
+					pair varchar(20) not null,
+					resolution int not null,
+					built_until timestamp(3) not null,
+					primary key (exchanger, pair, resolution)
+				)
+			`,
+		},
+		Down: []string{
+			"drop table if exists candle_state",
+		},
+	},
+}
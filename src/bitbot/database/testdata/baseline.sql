@@ -0,0 +1,72 @@
+-- schema of the databases created before the migrations: db/init.sql and
+-- src/services/db.sql of the first release
+create table orderbooks (
+    exchanger varchar(50) not null,
+    pair varchar(10) not null,
+    ts timestamp(3) not null,
+    bids json,
+    asks json,
+    primary key (exchanger, pair, ts)
+);
+
+create table arbitrages (
+    buy_ex varchar(20),
+    sell_ex varchar(20),
+    pair varchar(10) not null,
+    ts timestamp(3) not null,
+    buy_price float,
+    sell_price float,
+    vol float,
+    spread float,
+    key (spread)
+);
+
+create table arbitrage (
+    arbitrage_id varchar(100) not null,
+    buy_ex varchar(20) not null,
+    sell_ex varchar(20) not null,
+    pair varchar(10) not null,
+    ts timestamp(3) not null,
+    buy_price float,
+    sell_price float,
+    vol float,
+    spread float,
+    primary key (arbitrage_id)
+);
+
+create table order_ack (
+    arbitrage_id varchar(100) not null,
+    -- depending on the exchanger external_id is either a trade_id or an
+    -- order_id. An order Id can be associated with several trade_id.
+    external_id varchar(50) not null,
+    pair varchar(10) not null,
+    exchanger varchar(20),
+    side varchar(10)
+);
+
+create table trade (
+    arbitrage_id varchar(100) not null,
+    trade_id varchar(50) not null,
+    price float not null,
+    quantity float not null,
+    pair varchar(10) not null,
+    side varchar(4) not null,
+    fee float not null,
+    fee_currency varchar(4) not null
+);
+
+create table market_summary (
+    market_name      varchar(10) not null,
+    high             decimal(40, 25) not null,
+    low              decimal(40, 25) not null,
+    ask              decimal(40, 25) not null,
+    bid              decimal(40, 25) not null,
+    open_buy_orders  int not null,
+    open_sell_orders int not null,
+    volume           decimal(40, 25) not null,
+    last             decimal(40, 25) not null,
+    base_volume      decimal(40, 25) not null,
+    prev_day         decimal(40, 25) not null,
+    creation_date    datetime not null,
+    primary key (market_name, creation_date)
+);
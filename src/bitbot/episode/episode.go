@@ -0,0 +1,151 @@
+/*
+Package episode links the consecutive crossings of two venues into opportunity episodes.
+
+The recorder stores one row per crossing (the ask of a venue below the bid of another
+one) and per snapshot. An episode groups the crossings of the same venues in consecutive
+snapshots: it tells whether an opportunity lasted a couple of seconds or twenty minutes,
+which decides whether it can be traded.
+*/
+package episode
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Crossing is an arbitrage opportunity seen in a snapshot: the ask of BuyEx is below the
+// bid of SellEx.
+type Crossing struct {
+	BuyEx  string
+	SellEx string
+	Spread float64
+	// Volume is the volume executable at the best prices.
+	Volume float64
+}
+
+// Episode is a sequence of crossings of the same venues in consecutive snapshots.
+type Episode struct {
+	Pair   exchanger.Pair
+	BuyEx  string
+	SellEx string
+	// Start and End are the times of the first and the last snapshots of the episode.
+	Start      time.Time
+	End        time.Time
+	PeakSpread float64
+	Snapshots  int
+
+	volume float64
+}
+
+// Duration is the time elapsed between the first and the last snapshots. It is zero for
+// an opportunity seen once.
+func (e *Episode) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// AvgVolume is the average volume executable at the best prices.
+func (e *Episode) AvgVolume() float64 {
+	if e.Snapshots == 0 {
+		return 0
+	}
+	return e.volume / float64(e.Snapshots)
+}
+
+func (e *Episode) String() string {
+	return fmt.Sprintf("%s %s -> %s: %s, %d snapshots, peak spread %.3f%%",
+		e.Pair, e.BuyEx, e.SellEx, e.Duration(), e.Snapshots, e.PeakSpread)
+}
+
+// Tracker follows the open episodes of every pair. It is safe for concurrent use.
+type Tracker struct {
+	// MaxGap is the maximum time between two snapshots of an episode. An episode whose
+	// venues were missing from the snapshots (failed fetch) for longer is closed.
+	MaxGap time.Duration
+
+	mu   sync.Mutex
+	open map[string]*Episode
+}
+
+// NewTracker returns a Tracker without open episodes.
+func NewTracker(maxGap time.Duration) *Tracker {
+	return &Tracker{MaxGap: maxGap, open: map[string]*Episode{}}
+}
+
+// Observe records the crossings of a snapshot of pair taken at t with the books of
+// venues. It returns the episodes closed by the snapshot: the ones whose crossing
+// disappeared although both venues were fetched, and the ones not seen for MaxGap.
+func (tr *Tracker) Observe(pair exchanger.Pair, t time.Time, venues []string, crossings []*Crossing) []*Episode {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	fetched := map[string]bool{}
+	for _, v := range venues {
+		fetched[v] = true
+	}
+
+	seen := map[string]bool{}
+	for _, c := range crossings {
+		k := key(pair, c.BuyEx, c.SellEx)
+		seen[k] = true
+
+		e, ok := tr.open[k]
+		if !ok {
+			e = &Episode{Pair: pair, BuyEx: c.BuyEx, SellEx: c.SellEx, Start: t}
+			tr.open[k] = e
+		}
+
+		e.End = t
+		e.Snapshots++
+		e.volume += c.Volume
+		e.PeakSpread = math.Max(e.PeakSpread, c.Spread)
+	}
+
+	closed := []*Episode{}
+	for k, e := range tr.open {
+		if e.Pair != pair || seen[k] {
+			continue
+		}
+
+		if fetched[e.BuyEx] && fetched[e.SellEx] || t.Sub(e.End) > tr.MaxGap {
+			closed = append(closed, e)
+			delete(tr.open, k)
+		}
+	}
+
+	sort.Sort(byStart(closed))
+	return closed
+}
+
+// Open returns the episodes still open, oldest first.
+func (tr *Tracker) Open() []*Episode {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	open := []*Episode{}
+	for _, e := range tr.open {
+		open = append(open, e)
+	}
+
+	sort.Sort(byStart(open))
+	return open
+}
+
+func key(pair exchanger.Pair, buyEx, sellEx string) string {
+	return pair.String() + "/" + buyEx + "/" + sellEx
+}
+
+type byStart []*Episode
+
+func (s byStart) Len() int      { return len(s) }
+func (s byStart) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byStart) Less(i, j int) bool {
+	if !s[i].Start.Equal(s[j].Start) {
+		return s[i].Start.Before(s[j].Start)
+	}
+	return s[i].BuyEx+s[i].SellEx < s[j].BuyEx+s[j].SellEx
+}
@@ -0,0 +1,78 @@
+package episode
+
+import (
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+var t0 = time.Date(2017, 7, 17, 10, 0, 0, 0, time.UTC)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(5 * time.Minute)
+	venues := []string{"A", "B", "C"}
+	pair := exchanger.ZEC_BTC
+
+	closed := tr.Observe(pair, t0, venues, []*Crossing{{"A", "B", 0.5, 2}, {"C", "B", 0.2, 1}})
+	if len(closed) != 0 {
+		t.Fatalf("no episode should be closed, got %v", closed)
+	}
+
+	// C -> B closes, the other pair doesn't interfere
+	tr.Observe(exchanger.ETH_BTC, t0, venues, []*Crossing{{"B", "A", 1, 1}})
+	closed = tr.Observe(pair, t0.Add(time.Minute), venues, []*Crossing{{"A", "B", 0.8, 4}})
+	if len(closed) != 1 || closed[0].BuyEx != "C" || closed[0].Duration() != 0 {
+		t.Fatalf("C -> B should be closed after one snapshot, got %v", closed)
+	}
+
+	// B isn't fetched: A -> B stays open
+	closed = tr.Observe(pair, t0.Add(2*time.Minute), []string{"A", "C"}, nil)
+	if len(closed) != 0 {
+		t.Fatalf("A -> B should stay open while B is missing, got %v", closed)
+	}
+
+	closed = tr.Observe(pair, t0.Add(3*time.Minute), venues, nil)
+	if len(closed) != 1 {
+		t.Fatalf("A -> B should be closed, got %v", closed)
+	}
+
+	e := closed[0]
+	if e.Duration() != time.Minute || e.Snapshots != 2 || e.PeakSpread != 0.8 || e.AvgVolume() != 3 {
+		t.Errorf("unexpected episode %s, average volume %f", e, e.AvgVolume())
+	}
+
+	if open := tr.Open(); len(open) != 1 || open[0].Pair != exchanger.ETH_BTC {
+		t.Errorf("the ETH episode should still be open, got %v", open)
+	}
+}
+
+func TestTrackerGap(t *testing.T) {
+	tr := NewTracker(5 * time.Minute)
+	pair := exchanger.ZEC_BTC
+
+	tr.Observe(pair, t0, []string{"A", "B"}, []*Crossing{{"A", "B", 0.5, 2}})
+	if closed := tr.Observe(pair, t0.Add(10*time.Minute), []string{"A"}, nil); len(closed) != 1 {
+		t.Errorf("an episode not seen for longer than the gap should be closed, got %v", closed)
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	durations := []time.Duration{0, 5 * time.Second, 30 * time.Second, 2 * time.Minute, 2 * time.Hour}
+
+	d := Distribute(durations)
+	if d.Count != 5 || d.Median != 30 || d.Max != 7200 || d.P90 != 7200 {
+		t.Errorf("unexpected distribution %+v", d)
+	}
+
+	expected := []int{2, 1, 1, 0, 0, 1}
+	for i, n := range expected {
+		if d.Histogram[i] != n {
+			t.Errorf("bucket %d: %d expected, got %d", i, n, d.Histogram[i])
+		}
+	}
+
+	if d := Distribute(nil); d.Count != 0 || len(d.Histogram) != len(Buckets)+1 {
+		t.Errorf("unexpected empty distribution %+v", d)
+	}
+}
@@ -0,0 +1,53 @@
+package episode
+
+import (
+	"sort"
+	"time"
+
+	"bitbot/stats"
+)
+
+// Buckets are the upper bounds of the duration histograms. The last bucket of a
+// histogram counts the longer episodes.
+var Buckets = []time.Duration{
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+}
+
+// Distribution summarizes the durations of episodes, in seconds.
+type Distribution struct {
+	Count  int
+	Mean   float64
+	Median float64
+	P90    float64
+	Max    float64
+	// Histogram counts the durations below each of the Buckets, and above the last one.
+	Histogram []int
+}
+
+// Distribute returns the distribution of durations.
+func Distribute(durations []time.Duration) *Distribution {
+	d := &Distribution{Count: len(durations), Histogram: make([]int, len(Buckets)+1)}
+	if len(durations) == 0 {
+		return d
+	}
+
+	seconds := make([]float64, len(durations))
+	for i, dur := range durations {
+		seconds[i] = dur.Seconds()
+		d.Mean += seconds[i]
+
+		n := sort.Search(len(Buckets), func(n int) bool { return dur < Buckets[n] })
+		d.Histogram[n]++
+	}
+
+	sort.Float64s(seconds)
+	d.Mean /= float64(len(seconds))
+	d.Median = stats.Percentile(seconds, 0.5)
+	d.P90 = stats.Percentile(seconds, 0.9)
+	d.Max = seconds[len(seconds)-1]
+	return d
+}
@@ -69,7 +69,7 @@ func (ko *orders) UnmarshalJSON(b []byte) error {
 			return err
 		}
 
-		*ko = append(*ko, &exchanger.Order{price, volume, timestamp})
+		*ko = append(*ko, &exchanger.Order{Price: price, Volume: volume, Timestamp: timestamp})
 	}
 	return nil
 }
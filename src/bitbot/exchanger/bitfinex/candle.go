@@ -0,0 +1,65 @@
+package bitfinex
+
+import (
+	"fmt"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+)
+
+// timeFrames are the intervals of the candles endpoint.
+var timeFrames = map[time.Duration]string{
+	time.Minute:      "1m",
+	5 * time.Minute:  "5m",
+	15 * time.Minute: "15m",
+	30 * time.Minute: "30m",
+	time.Hour:        "1h",
+	3 * time.Hour:    "3h",
+	6 * time.Hour:    "6h",
+	12 * time.Hour:   "12h",
+	24 * time.Hour:   "1D",
+}
+
+// Candles implements exchanger.CandleFunc with the candles endpoint of the v2 API, 1000
+// candles at most.
+func Candles(pair exchanger.Pair, interval time.Duration, since time.Time) ([]*exchanger.Candle, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("Bitfinex: Candles function doesn't support %s", pair)
+	}
+
+	tf, ok := timeFrames[interval]
+	if !ok {
+		return nil, &exchanger.IntervalError{Exchanger: ExchangerName, Interval: interval}
+	}
+
+	// rows are [time (ms), open, close, high, low, volume]
+	var rows [][]float64
+
+	url := fmt.Sprintf("%s/candles/trade:%s:t%s/hist?sort=1&limit=1000&start=%s", apiV2URL, tf, p, TapeCursor(since))
+	if err := httpreq.Get(url, nil, &rows); err != nil {
+		return nil, err
+	}
+
+	candles := []*exchanger.Candle{}
+	for _, row := range rows {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("Bitfinex: invalid candle %v", row)
+		}
+
+		candles = append(candles, &exchanger.Candle{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			Interval:  interval,
+			Start:     time.Unix(0, int64(row[0])*int64(time.Millisecond)),
+			Open:      row[1],
+			Close:     row[2],
+			High:      row[3],
+			Low:       row[4],
+			Volume:    row[5],
+		})
+	}
+
+	return candles, nil
+}
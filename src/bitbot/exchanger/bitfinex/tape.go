@@ -0,0 +1,75 @@
+package bitfinex
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+)
+
+const (
+	apiV2URL = "https://api.bitfinex.com/v2"
+	// tapeLimit is the maximum number of trades of a request.
+	tapeLimit = 1000
+)
+
+// PublicTrades implements exchanger.TapeFunc with the trades endpoint of the v2 API,
+// which pages forward from a time. The cursor is a time in milliseconds.
+func PublicTrades(pair exchanger.Pair, cursor string) ([]*exchanger.PublicTrade, string, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, "", fmt.Errorf("Bitfinex: PublicTrades function doesn't support %s", pair)
+	}
+
+	// the most recent trades first without cursor, the ones following it otherwise
+	url := fmt.Sprintf("%s/trades/t%s/hist?limit=%d", apiV2URL, p, tapeLimit)
+	if cursor != "" {
+		url += "&sort=1&start=" + cursor
+	}
+
+	// rows are [id, time (ms), amount, price], the amount is negative for the sells
+	var rows [][]float64
+	if err := httpreq.Get(url, nil, &rows); err != nil {
+		return nil, "", err
+	}
+
+	trades := []*exchanger.PublicTrade{}
+	for _, row := range rows {
+		if len(row) < 4 {
+			return nil, "", fmt.Errorf("Bitfinex: invalid trade %v", row)
+		}
+
+		t := &exchanger.PublicTrade{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			ID:        strconv.FormatInt(int64(row[0]), 10),
+			Price:     row[3],
+			Volume:    row[2],
+			Side:      exchanger.Buy,
+			Time:      time.Unix(0, int64(row[1])*int64(time.Millisecond)),
+		}
+		if t.Volume < 0 {
+			t.Volume, t.Side = -t.Volume, exchanger.Sell
+		}
+		trades = append(trades, t)
+	}
+
+	if cursor == "" {
+		for i, j := 0, len(trades)-1; i < j; i, j = i+1, j-1 {
+			trades[i], trades[j] = trades[j], trades[i]
+		}
+	}
+
+	next := cursor
+	if len(trades) > 0 {
+		next = TapeCursor(trades[len(trades)-1].Time)
+	}
+	return trades, next, nil
+}
+
+// TapeCursor implements exchanger.TapeCursorFunc.
+func TapeCursor(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
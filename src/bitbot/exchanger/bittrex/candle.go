@@ -0,0 +1,69 @@
+package bittrex
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/toorop/go-bittrex"
+
+	"bitbot/exchanger"
+)
+
+// tickIntervals are the intervals of the GetTicks endpoint.
+var tickIntervals = map[time.Duration]string{
+	time.Minute:      "oneMin",
+	5 * time.Minute:  "fiveMin",
+	30 * time.Minute: "thirtyMin",
+	time.Hour:        "hour",
+	24 * time.Hour:   "day",
+}
+
+// public calls the endpoints not requiring a key.
+var public = bittrex.New("", "")
+
+// Candles implements exchanger.CandleFunc with the GetTicks endpoint, which returns the
+// whole history kept at interval (about ten days of minutes), or GetLatestTick when
+// since is within the last interval.
+func Candles(pair exchanger.Pair, interval time.Duration, since time.Time) ([]*exchanger.Candle, error) {
+	tickInterval, ok := tickIntervals[interval]
+	if !ok {
+		return nil, &exchanger.IntervalError{Exchanger: ExchangerName, Interval: interval}
+	}
+
+	get := public.GetTicks
+	if time.Since(since) < interval {
+		get = public.GetLatestTick
+	}
+
+	ticks, err := get(Market(pair), tickInterval)
+	if err != nil {
+		return nil, fmt.Errorf("Bittrex: cannot get the ticks of %s - %s", pair, err)
+	}
+
+	candles := []*exchanger.Candle{}
+	for _, t := range ticks {
+		if t.TimeStamp.Before(since) {
+			continue
+		}
+
+		candles = append(candles, &exchanger.Candle{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			Interval:  interval,
+			Start:     t.TimeStamp.Time,
+			Open:      toFloat(t.Open),
+			High:      toFloat(t.High),
+			Low:       toFloat(t.Low),
+			Close:     toFloat(t.Close),
+			Volume:    toFloat(t.Volume),
+		})
+	}
+
+	return candles, nil
+}
+
+func toFloat(d decimal.Decimal) float64 {
+	v, _ := d.Float64()
+	return v
+}
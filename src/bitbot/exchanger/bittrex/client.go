@@ -0,0 +1,83 @@
+package bittrex
+
+import (
+	"fmt"
+
+	"github.com/toorop/go-bittrex"
+
+	"bitbot/exchanger"
+)
+
+// Client wraps the Bittrex API client of github.com/toorop/go-bittrex.
+type Client struct {
+	*bittrex.Bittrex
+}
+
+func NewClient(apiKey, apiSecret string) *Client {
+	return &Client{bittrex.New(apiKey, apiSecret)}
+}
+
+// Deposits implements exchanger.TransferHistorian. Bittrex only lists credited deposits.
+func (c *Client) Deposits(cur string) ([]*exchanger.Transfer, error) {
+	deposits, err := c.GetDepositHistory(cur)
+	if err != nil {
+		return nil, fmt.Errorf("Bittrex: call to GetDepositHistory failed - %s", err)
+	}
+
+	transfers := []*exchanger.Transfer{}
+	for _, d := range deposits {
+		amount, _ := d.Amount.Float64()
+		transfers = append(transfers, &exchanger.Transfer{
+			ID:        fmt.Sprint(d.Id),
+			Kind:      exchanger.Deposit,
+			Currency:  d.Currency,
+			Amount:    amount,
+			Address:   d.CryptoAddress,
+			TxID:      d.TxId,
+			Status:    exchanger.TransferCompleted,
+			RawStatus: fmt.Sprintf("%d confirmations", d.Confirmations),
+			Time:      d.LastUpdated.Time,
+		})
+	}
+
+	return transfers, nil
+}
+
+// Withdrawals implements exchanger.TransferHistorian.
+func (c *Client) Withdrawals(cur string) ([]*exchanger.Transfer, error) {
+	withdrawals, err := c.GetWithdrawalHistory(cur)
+	if err != nil {
+		return nil, fmt.Errorf("Bittrex: call to GetWithdrawalHistory failed - %s", err)
+	}
+
+	transfers := []*exchanger.Transfer{}
+	for _, w := range withdrawals {
+		amount, _ := w.Amount.Float64()
+		fee, _ := w.TxCost.Float64()
+
+		status, raw := exchanger.TransferCompleted, "completed"
+		switch {
+		case w.Canceled:
+			status, raw = exchanger.TransferFailed, "canceled"
+		case !w.Authorized:
+			status, raw = exchanger.TransferPending, "unauthorized"
+		case w.PendingPayment:
+			status, raw = exchanger.TransferPending, "pending payment"
+		}
+
+		transfers = append(transfers, &exchanger.Transfer{
+			ID:        w.PaymentUuid,
+			Kind:      exchanger.Withdrawal,
+			Currency:  w.Currency,
+			Amount:    amount,
+			Fee:       fee,
+			Address:   w.Address,
+			TxID:      w.TxId,
+			Status:    status,
+			RawStatus: raw,
+			Time:      w.Opened.Time,
+		})
+	}
+
+	return transfers, nil
+}
@@ -0,0 +1,87 @@
+package bittrex
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Market returns the Bittrex market of a pair: ZEC_BTC is BTC-ZEC.
+func Market(pair exchanger.Pair) string {
+	return pair.Quote + "-" + pair.Base
+}
+
+// PublicTrades implements exchanger.TapeFunc with the getmarkethistory endpoint. Bittrex
+// only lists the most recent trades of a market, the tape can't be backfilled: the
+// cursor, a time in milliseconds, only filters the trades already seen.
+func PublicTrades(pair exchanger.Pair, cursor string) ([]*exchanger.PublicTrade, string, error) {
+	var since time.Time
+	if cursor != "" {
+		ms, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("Bittrex: invalid cursor `%s`", cursor)
+		}
+		since = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	var result struct {
+		Success bool
+		Message string
+		Result  []struct {
+			Id        int64
+			TimeStamp string
+			Quantity  float64
+			Price     float64
+			OrderType string
+		}
+	}
+
+	url := fmt.Sprintf("%s/getmarkethistory?market=%s", APIURL, Market(pair))
+	if err := exchanger.FetchOrderBook(url, &result); err != nil {
+		return nil, "", err
+	}
+
+	if !result.Success {
+		return nil, "", fmt.Errorf("Bittrex returned an error. %s", result.Message)
+	}
+
+	trades := []*exchanger.PublicTrade{}
+	for _, r := range result.Result {
+		// UTC times without zone
+		ts, err := time.Parse("2006-01-02T15:04:05", r.TimeStamp)
+		if err != nil {
+			return nil, "", fmt.Errorf("Bittrex: invalid trade time `%s`", r.TimeStamp)
+		}
+		if ts.Before(since) {
+			continue
+		}
+
+		trades = append(trades, &exchanger.PublicTrade{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			ID:        strconv.FormatInt(r.Id, 10),
+			Price:     r.Price,
+			Volume:    r.Quantity,
+			Side:      strings.ToLower(r.OrderType),
+			Time:      ts,
+		})
+	}
+
+	// returned most recent first
+	sort.Sort(exchanger.ByTradeTime(trades))
+
+	next := cursor
+	if len(trades) > 0 {
+		next = TapeCursor(trades[len(trades)-1].Time)
+	}
+	return trades, next, nil
+}
+
+// TapeCursor implements exchanger.TapeCursorFunc.
+func TapeCursor(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
@@ -0,0 +1,40 @@
+package bittrex
+
+import (
+	"strings"
+	"time"
+
+	"github.com/toorop/go-bittrex"
+
+	"bitbot/exchanger"
+)
+
+// SummaryTickers converts the market summaries fetched at t. Bittrex names the markets
+// after the quote currency: BTC-ZEC is ZEC_BTC, and its base volume is in the quote
+// currency.
+func SummaryTickers(summaries []bittrex.MarketSummary, t time.Time) []*exchanger.Ticker {
+	tickers := []*exchanger.Ticker{}
+
+	for _, s := range summaries {
+		currencies := strings.Split(s.MarketName, "-")
+		if len(currencies) != 2 {
+			continue
+		}
+
+		tickers = append(tickers, &exchanger.Ticker{
+			Exchanger:   ExchangerName,
+			Pair:        exchanger.NewPair(currencies[1] + "_" + currencies[0]),
+			Last:        toFloat(s.Last),
+			Bid:         toFloat(s.Bid),
+			Ask:         toFloat(s.Ask),
+			High:        toFloat(s.High),
+			Low:         toFloat(s.Low),
+			BaseVolume:  toFloat(s.Volume),
+			QuoteVolume: toFloat(s.BaseVolume),
+			PrevDay:     toFloat(s.PrevDay),
+			Time:        t,
+		})
+	}
+
+	return tickers
+}
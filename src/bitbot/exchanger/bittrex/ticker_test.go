@@ -0,0 +1,66 @@
+package bittrex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/toorop/go-bittrex"
+
+	"bitbot/exchanger"
+)
+
+func TestSummaryTickers(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/marketsummaries.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summaries []bittrex.MarketSummary
+	if err := json.Unmarshal(b, &summaries); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	tickers := SummaryTickers(summaries, now)
+
+	// BTC-ZEC is ZEC_BTC, its base volume is in BTC
+	expected := []*exchanger.Ticker{
+		{
+			Exchanger:   ExchangerName,
+			Pair:        exchanger.ZEC_BTC,
+			Last:        0.1251,
+			Bid:         0.125,
+			Ask:         0.1254,
+			High:        0.127,
+			Low:         0.1215,
+			BaseVolume:  2210.51234,
+			QuoteVolume: 275.1043,
+			PrevDay:     0.1232,
+			Time:        now,
+		},
+		{
+			Exchanger:   ExchangerName,
+			Pair:        exchanger.NewPair("BTC_USDT"),
+			Last:        2455,
+			Bid:         2453.2,
+			Ask:         2456.9,
+			High:        2490,
+			Low:         2355.1,
+			BaseVolume:  1520.2,
+			QuoteVolume: 3690124.5,
+			PrevDay:     2400,
+			Time:        now,
+		},
+	}
+	if len(tickers) != len(expected) {
+		t.Fatalf("%d tickers expected, got %d", len(expected), len(tickers))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(tickers[i], expected[i]) {
+			t.Errorf("expected %+v, got %+v", expected[i], tickers[i])
+		}
+	}
+}
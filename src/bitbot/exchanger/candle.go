@@ -0,0 +1,36 @@
+package exchanger
+
+import (
+	"fmt"
+	"time"
+)
+
+// Candle is an OHLCV bar of a market. Volume is in the base currency of the pair.
+type Candle struct {
+	Exchanger string
+	Pair      Pair
+	Interval  time.Duration
+	Start     time.Time
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	Volume    float64
+	// Trades is the number of trades of the bar, 0 when unknown.
+	Trades int
+}
+
+// CandleFunc returns the candles of pair at interval starting from since, in
+// chronological order. The exchangers only return their recent history, and fail with an
+// *IntervalError on the intervals they don't provide.
+type CandleFunc func(pair Pair, interval time.Duration, since time.Time) ([]*Candle, error)
+
+// IntervalError is returned by the exchangers not providing the candles of an interval.
+type IntervalError struct {
+	Exchanger string
+	Interval  time.Duration
+}
+
+func (e *IntervalError) Error() string {
+	return fmt.Sprintf("%s: no candles at interval %s", e.Exchanger, e.Interval)
+}
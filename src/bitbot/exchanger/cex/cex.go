@@ -2,6 +2,7 @@ package cex
 
 import (
 	"fmt"
+	"time"
 
 	"bitbot/exchanger"
 )
@@ -46,7 +47,13 @@ func OrderBook(pair exchanger.Pair) (*exchanger.OrderBook, error) {
 		return nil, err
 	}
 
-	return exchanger.NewOrderbook(ExchangerName, bids, asks)
+	book, err := exchanger.NewOrderbook(ExchangerName, bids, asks)
+	if err != nil {
+		return nil, err
+	}
+
+	book.ExchangeTime = time.Unix(result.Timestamp, 0)
+	return book, nil
 }
 
 func parseOrders(rows [][]interface{}) ([]*exchanger.Order, error) {
@@ -0,0 +1,97 @@
+package cex
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// tickerResponse is the response of the tickers endpoint. The markets are named BTC:USD.
+type tickerResponse struct {
+	OK    string
+	Error string
+	Data  []struct {
+		Pair        string
+		Last        exchanger.Float
+		Bid         exchanger.Float
+		Ask         exchanger.Float
+		High        exchanger.Float
+		Low         exchanger.Float
+		Volume      exchanger.Float
+		PriceChange exchanger.Float
+	}
+}
+
+// Tickers returns the tickers of pairs with a single call to the tickers endpoint, which
+// lists the markets between a set of currencies.
+func Tickers(pairs []exchanger.Pair) ([]*exchanger.Ticker, error) {
+	currencies := []string{}
+	seen := map[string]bool{}
+
+	for _, pair := range pairs {
+		p, ok := Pairs[pair]
+		if !ok {
+			continue
+		}
+
+		for _, c := range strings.Split(p, "/") {
+			if !seen[c] {
+				seen[c] = true
+				currencies = append(currencies, c)
+			}
+		}
+	}
+	if len(currencies) == 0 {
+		return nil, fmt.Errorf("Cex: Tickers function doesn't support %v", pairs)
+	}
+
+	var result tickerResponse
+	url := fmt.Sprintf("%stickers/%s", APIURL, strings.Join(currencies, "/"))
+	if err := exchanger.FetchOrderBook(url, &result); err != nil {
+		return nil, err
+	}
+
+	return result.tickers(pairs, time.Now())
+}
+
+// tickers converts the response fetched at t. The response lists the markets between
+// the currencies of pairs: the other ones are dropped.
+func (result *tickerResponse) tickers(pairs []exchanger.Pair, t time.Time) ([]*exchanger.Ticker, error) {
+	if result.OK != "ok" {
+		return nil, fmt.Errorf("Cex returned an error. %s", result.Error)
+	}
+
+	byName := map[string]exchanger.Pair{}
+	for _, pair := range pairs {
+		if p, ok := Pairs[pair]; ok {
+			byName[strings.Replace(p, "/", ":", 1)] = pair
+		}
+	}
+
+	tickers := []*exchanger.Ticker{}
+	for _, r := range result.Data {
+		pair, ok := byName[r.Pair]
+		if !ok {
+			continue
+		}
+
+		tickers = append(tickers, &exchanger.Ticker{
+			Exchanger:  ExchangerName,
+			Pair:       pair,
+			Last:       float64(r.Last),
+			Bid:        float64(r.Bid),
+			Ask:        float64(r.Ask),
+			High:       float64(r.High),
+			Low:        float64(r.Low),
+			BaseVolume: float64(r.Volume),
+			// Cex doesn't report the quote volume
+			QuoteVolume: float64(r.Volume * r.Last),
+			PrevDay:     float64(r.Last - r.PriceChange),
+			Time:        t,
+		})
+	}
+
+	return tickers, nil
+}
@@ -0,0 +1,79 @@
+package cex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+func TestTickers(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/ticker.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result tickerResponse
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	tickers, err := result.tickers([]exchanger.Pair{exchanger.BTC_USD, exchanger.ETH_BTC}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// computed at run time, as the adapter: constant expressions are exact
+	mul := func(a, b float64) float64 { return a * b }
+	sub := func(a, b float64) float64 { return a - b }
+
+	// ETH:USD is listed with the currencies of the pairs but not requested, the quote
+	// volume is estimated with the last price
+	expected := []*exchanger.Ticker{
+		{
+			Exchanger:   ExchangerName,
+			Pair:        exchanger.BTC_USD,
+			Last:        2450.1,
+			Bid:         2449.5,
+			Ask:         2451,
+			High:        2480,
+			Low:         2350.5,
+			BaseVolume:  512.4422,
+			QuoteVolume: mul(512.4422, 2450.1),
+			PrevDay:     sub(2450.1, 50.1),
+			Time:        now,
+		},
+		{
+			Exchanger:   ExchangerName,
+			Pair:        exchanger.ETH_BTC,
+			Last:        0.0871,
+			Bid:         0.087,
+			Ask:         0.0872,
+			High:        0.0882,
+			Low:         0.0851,
+			BaseVolume:  320.25,
+			QuoteVolume: mul(320.25, 0.0871),
+			PrevDay:     sub(0.0871, 0.0011),
+			Time:        now,
+		},
+	}
+	if len(tickers) != len(expected) {
+		t.Fatalf("%d tickers expected, got %d", len(expected), len(tickers))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(tickers[i], expected[i]) {
+			t.Errorf("expected %+v, got %+v", expected[i], tickers[i])
+		}
+	}
+}
+
+func TestTickersError(t *testing.T) {
+	result := tickerResponse{OK: "error", Error: "Invalid Symbols Pair"}
+	if _, err := result.tickers([]exchanger.Pair{exchanger.BTC_USD}, time.Now()); err == nil {
+		t.Error("a response without ok should fail")
+	}
+}
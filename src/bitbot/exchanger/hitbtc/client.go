@@ -280,6 +280,73 @@ func (c *Client) Transaction(id string) (map[string]interface{}, error) {
 	return v.Transaction, err
 }
 
+// Transactions returns the last payment transactions (see Transaction for the fields).
+func (c *Client) Transactions(offset, limit int) ([]map[string]interface{}, error) {
+	path := fmt.Sprintf("/api/1/payment/transactions?offset=%d&limit=%d", offset, limit)
+	var v struct {
+		Transactions []map[string]interface{}
+	}
+	err := c.authGet(path, &v)
+	return v.Transactions, err
+}
+
+// Deposits implements exchanger.TransferHistorian. Deposits are credited to the main
+// account.
+func (c *Client) Deposits(cur string) ([]*exchanger.Transfer, error) {
+	return c.transfers("payin", exchanger.Deposit, cur)
+}
+
+// Withdrawals implements exchanger.TransferHistorian. The transfer ids are the ones
+// returned by Withdraw.
+func (c *Client) Withdrawals(cur string) ([]*exchanger.Transfer, error) {
+	return c.transfers("payout", exchanger.Withdrawal, cur)
+}
+
+func (c *Client) transfers(typ, kind, cur string) ([]*exchanger.Transfer, error) {
+	rows, err := c.Transactions(0, 1000)
+	if err != nil {
+		return nil, fmt.Errorf("Hitbtc: call to Transactions failed - %s", err)
+	}
+
+	transfers := []*exchanger.Transfer{}
+	for _, row := range rows {
+		if row["type"] != typ || row["currency_code_to"] != cur {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(fmt.Sprint(row["amount_to"]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Hitbtc: parsing `amount_to` failed - %s", err)
+		}
+
+		status := exchanger.TransferPending
+		switch row["status"] {
+		case "finished":
+			status = exchanger.TransferCompleted
+		case "failed", "canceled":
+			status = exchanger.TransferFailed
+		}
+
+		created, _ := row["created"].(float64)
+		address, _ := row["destination_data"].(string)
+		txID, _ := row["external_data"].(string)
+
+		transfers = append(transfers, &exchanger.Transfer{
+			ID:        fmt.Sprint(row["id"]),
+			Kind:      kind,
+			Currency:  cur,
+			Amount:    amount,
+			Address:   address,
+			TxID:      txID,
+			Status:    status,
+			RawStatus: fmt.Sprint(row["status"]),
+			Time:      time.Unix(int64(created), 0),
+		})
+	}
+
+	return transfers, nil
+}
+
 // TradesByOrder returns all trades of specified order.
 func (c *Client) TradesByOrder(clientOrderId string) ([]map[string]interface{}, error) {
 	const path = "/api/1/trading/trades/by/order"
@@ -290,6 +357,127 @@ func (c *Client) TradesByOrder(clientOrderId string) ([]map[string]interface{},
 	return v.Trades, err
 }
 
+// Trades implements exchanger.TradeHistorian. The cursor is the id of the last trade
+// returned. Orders are identified by their client order id, as returned by PlaceOrder.
+func (c *Client) Trades(pair exchanger.Pair, cursor string) ([]*exchanger.Trade, string, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, cursor, fmt.Errorf("Hitbtc: pair not supported %s", pair)
+	}
+
+	lotSize, ok := LotSizes[pair]
+	if !ok {
+		return nil, cursor, fmt.Errorf("Hitbtc: cannot find lot size for pair %s", pair)
+	}
+
+	const maxResults = 1000
+	trades := []*exchanger.Trade{}
+
+	for index := 0; ; index += maxResults {
+		path := fmt.Sprintf("/api/1/trading/trades?by=trade_id&sort=asc&start_index=%d&max_results=%d&symbols=%s", index, maxResults, p)
+		if cursor != "" {
+			path += "&from=" + cursor
+		}
+
+		var v struct {
+			Trades []struct {
+				TradeId       int64
+				ClientOrderId string
+				Side          string
+				ExecPrice     string
+				ExecQuantity  float64
+				Fee           string
+				Timestamp     int64
+			}
+		}
+
+		if err := c.authGet(path, &v); err != nil {
+			return nil, cursor, fmt.Errorf("Hitbtc: call to trades failed - %s", err)
+		}
+
+		for _, row := range v.Trades {
+			price, err := strconv.ParseFloat(row.ExecPrice, 64)
+			if err != nil {
+				return nil, cursor, fmt.Errorf("Hitbtc: parsing `execPrice` failed - %s", err)
+			}
+
+			fee, err := strconv.ParseFloat(row.Fee, 64)
+			if err != nil {
+				return nil, cursor, fmt.Errorf("Hitbtc: parsing `fee` failed - %s", err)
+			}
+
+			trades = append(trades, &exchanger.Trade{
+				ID:          strconv.FormatInt(row.TradeId, 10),
+				OrderID:     row.ClientOrderId,
+				Pair:        pair,
+				Side:        row.Side,
+				Price:       price,
+				Volume:      row.ExecQuantity * lotSize,
+				Fee:         fee,
+				FeeCurrency: pair.Quote,
+				Time:        time.Unix(0, row.Timestamp*int64(time.Millisecond)),
+			})
+		}
+
+		if len(v.Trades) < maxResults {
+			break
+		}
+	}
+
+	if len(trades) > 0 {
+		cursor = trades[len(trades)-1].ID
+	}
+
+	return trades, cursor, nil
+}
+
+// OpenOrders implements exchanger.OrderLister. Orders are identified by their client
+// order id, as returned by PlaceOrder.
+func (c *Client) OpenOrders(pair exchanger.Pair) ([]*exchanger.OpenOrder, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("Hitbtc: pair not supported %s", pair)
+	}
+
+	lotSize, ok := LotSizes[pair]
+	if !ok {
+		return nil, fmt.Errorf("Hitbtc: cannot find lot size for pair %s", pair)
+	}
+
+	var v struct {
+		Orders []struct {
+			ClientOrderId  string
+			Side           string
+			OrderPrice     string
+			QuantityLeaves float64
+			LastTimestamp  int64
+		}
+	}
+
+	if err := c.authGet("/api/1/trading/orders/active?symbols="+p, &v); err != nil {
+		return nil, fmt.Errorf("Hitbtc: call to orders/active failed - %s", err)
+	}
+
+	orders := []*exchanger.OpenOrder{}
+	for _, row := range v.Orders {
+		price, err := strconv.ParseFloat(row.OrderPrice, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Hitbtc: parsing `orderPrice` failed - %s", err)
+		}
+
+		orders = append(orders, &exchanger.OpenOrder{
+			ID:     row.ClientOrderId,
+			Pair:   pair,
+			Side:   row.Side,
+			Volume: row.QuantityLeaves * lotSize,
+			Price:  price,
+			Time:   time.Unix(0, row.LastTimestamp*int64(time.Millisecond)),
+		})
+	}
+
+	return orders, nil
+}
+
 func (c *Client) authGet(path string, v interface{}) error {
 	uri := authURI(path, c.ApiKey)
 	headers := authHeader(uri, "", c.ApiSecret)
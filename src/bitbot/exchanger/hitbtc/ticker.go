@@ -0,0 +1,60 @@
+package hitbtc
+
+import (
+	"fmt"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+)
+
+// tickerResponse is the response of the ticker endpoint, by market. The values are null
+// on the markets without trades.
+type tickerResponse map[string]struct {
+	Last        exchanger.Float
+	Bid         exchanger.Float
+	Ask         exchanger.Float
+	High        exchanger.Float
+	Low         exchanger.Float
+	Open        exchanger.Float
+	Volume      exchanger.Float
+	VolumeQuote exchanger.Float `json:"volume_quote"`
+}
+
+// Tickers returns the tickers of pairs. The ticker endpoint lists every market at once.
+func Tickers(pairs []exchanger.Pair) ([]*exchanger.Ticker, error) {
+	var result tickerResponse
+	url := fmt.Sprintf("%s/api/1/public/ticker", host)
+	if err := httpreq.Get(url, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result.tickers(pairs, time.Now()), nil
+}
+
+// tickers converts the response fetched at t.
+func (result tickerResponse) tickers(pairs []exchanger.Pair, t time.Time) []*exchanger.Ticker {
+	tickers := []*exchanger.Ticker{}
+	for _, pair := range pairs {
+		r, ok := result[Pairs[pair]]
+		if !ok {
+			continue
+		}
+
+		tickers = append(tickers, &exchanger.Ticker{
+			Exchanger:   ExchangerName,
+			Pair:        pair,
+			Last:        float64(r.Last),
+			Bid:         float64(r.Bid),
+			Ask:         float64(r.Ask),
+			High:        float64(r.High),
+			Low:         float64(r.Low),
+			BaseVolume:  float64(r.Volume),
+			QuoteVolume: float64(r.VolumeQuote),
+			PrevDay:     float64(r.Open),
+			Time:        t,
+		})
+	}
+
+	return tickers
+}
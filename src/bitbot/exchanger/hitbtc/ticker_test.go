@@ -0,0 +1,44 @@
+package hitbtc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+func TestTickers(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/ticker.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result tickerResponse
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	tickers := result.tickers([]exchanger.Pair{exchanger.ZEC_BTC, exchanger.ETH_BTC}, now)
+
+	// ETHBTC is missing from the response
+	expected := []*exchanger.Ticker{{
+		Exchanger:   ExchangerName,
+		Pair:        exchanger.ZEC_BTC,
+		Last:        0.1252,
+		Bid:         0.125,
+		Ask:         0.1255,
+		High:        0.127,
+		Low:         0.122,
+		BaseVolume:  820.5,
+		QuoteVolume: 102.7266,
+		PrevDay:     0.124,
+		Time:        now,
+	}}
+	if !reflect.DeepEqual(tickers, expected) {
+		t.Errorf("expected %v, got %v", expected, tickers)
+	}
+}
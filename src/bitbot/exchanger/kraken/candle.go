@@ -0,0 +1,95 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+)
+
+// candleIntervals are the intervals of the OHLC endpoint, in minutes.
+var candleIntervals = []int{1, 5, 15, 30, 60, 240, 1440, 10080, 21600}
+
+// Candles implements exchanger.CandleFunc with the OHLC endpoint, which returns the last
+// 720 candles at most.
+func Candles(pair exchanger.Pair, interval time.Duration, since time.Time) ([]*exchanger.Candle, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("Kraken: Candles function doesn't support %s", pair)
+	}
+
+	minutes := int(interval / time.Minute)
+	supported := false
+	for _, m := range candleIntervals {
+		if time.Duration(m)*time.Minute == interval {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, &exchanger.IntervalError{Exchanger: ExchangerName, Interval: interval}
+	}
+
+	// rows are [time, open, high, low, close, vwap, volume, count]
+	var result struct {
+		Error  []string
+		Result map[string]json.RawMessage
+	}
+
+	// since excludes the candle starting at since
+	url := fmt.Sprintf("%s/%s/public/OHLC?pair=%s&interval=%d&since=%d", APIURL, APIVersion, p, minutes,
+		since.Add(-time.Second).Unix())
+	if err := httpreq.Get(url, nil, &result); err != nil {
+		return nil, err
+	}
+
+	if len(result.Error) > 0 {
+		return nil, fmt.Errorf("Kraken returned an error. %s", result.Error[0])
+	}
+
+	var rows [][]interface{}
+	if err := json.Unmarshal(result.Result[p], &rows); err != nil {
+		return nil, fmt.Errorf("Kraken: cannot parse candles - %s", err)
+	}
+
+	candles := []*exchanger.Candle{}
+	for _, row := range rows {
+		if len(row) < 8 {
+			return nil, fmt.Errorf("Kraken: invalid candle %v", row)
+		}
+
+		values := make([]float64, 8)
+		for i, v := range row {
+			if i >= len(values) {
+				break
+			}
+			f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("Kraken: invalid candle %v", row)
+			}
+			values[i] = f
+		}
+
+		start := time.Unix(int64(values[0]), 0)
+		if start.Before(since) {
+			continue
+		}
+
+		candles = append(candles, &exchanger.Candle{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			Interval:  interval,
+			Start:     start,
+			Open:      values[1],
+			High:      values[2],
+			Low:       values[3],
+			Close:     values[4],
+			Volume:    values[6],
+			Trades:    int(values[7]),
+		})
+	}
+
+	return candles, nil
+}
@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"bitbot/exchanger"
@@ -32,10 +35,15 @@ func init() {
 type Client struct {
 	ApiKey    string
 	ApiSecret string
+
+	// Kraken rejects a nonce lower than the last one it received: private calls are
+	// serialized and their nonces strictly increasing.
+	mu    sync.Mutex
+	nonce int64
 }
 
 func NewClient(apiKey, apiSecret string) *Client {
-	return &Client{apiKey, apiSecret}
+	return &Client{ApiKey: apiKey, ApiSecret: apiSecret}
 }
 
 // AccountBalance returns account balance.
@@ -110,6 +118,17 @@ func (c *Client) AddOrder(side string, pair exchanger.Pair, price, vol float64,
 	return resp, err
 }
 
+// CancelOrder cancels an open order. The returned map contains the number of
+// orders canceled (`count`).
+func (c *Client) CancelOrder(txid string) (map[string]interface{}, error) {
+	data := map[string]string{
+		"txid": txid,
+	}
+	resp := map[string]interface{}{}
+	err := c.Query("CancelOrder", data, &resp)
+	return resp, err
+}
+
 func (c *Client) OrdersInfo(txid string, trades bool) (map[string]interface{}, error) {
 	data := map[string]string{
 		"txid": txid,
@@ -133,6 +152,231 @@ func (c *Client) TradesInfo(txid string) (map[string]interface{}, error) {
 	return resp, err
 }
 
+// DepositStatus returns the recent deposits of cur.
+func (c *Client) DepositStatus(cur string) ([]*exchanger.Transfer, error) {
+	return c.transferStatus("DepositStatus", exchanger.Deposit, cur)
+}
+
+// WithdrawStatus returns the recent withdrawals of cur. The transfer ids are the
+// references returned by the Withdraw method.
+func (c *Client) WithdrawStatus(cur string) ([]*exchanger.Transfer, error) {
+	return c.transferStatus("WithdrawStatus", exchanger.Withdrawal, cur)
+}
+
+// Deposits implements exchanger.TransferHistorian.
+func (c *Client) Deposits(cur string) ([]*exchanger.Transfer, error) {
+	return c.DepositStatus(cur)
+}
+
+// Withdrawals implements exchanger.TransferHistorian.
+func (c *Client) Withdrawals(cur string) ([]*exchanger.Transfer, error) {
+	return c.WithdrawStatus(cur)
+}
+
+// Trades implements exchanger.TradeHistorian. The cursor is the unix time of the last
+// trade returned. The history is shared by all pairs, it is paged 50 trades at a time,
+// newest first.
+func (c *Client) Trades(pair exchanger.Pair, cursor string) ([]*exchanger.Trade, string, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, cursor, fmt.Errorf("Kraken: pair not supported %s", pair)
+	}
+
+	var resp struct {
+		Trades map[string]struct {
+			Ordertxid string
+			Pair      string
+			Time      float64
+			Type      string
+			Price     string
+			Fee       string
+			Vol       string
+		}
+		Count int
+	}
+
+	trades := []*exchanger.Trade{}
+	for ofs := 0; ; ofs += len(resp.Trades) {
+		resp.Trades = nil
+		data := map[string]string{"ofs": strconv.Itoa(ofs)}
+		if cursor != "" {
+			data["start"] = cursor
+		}
+
+		err := c.Query("TradesHistory", data, &resp)
+		if err != nil {
+			return nil, cursor, fmt.Errorf("Kraken: call to TradesHistory failed - %s", err)
+		}
+
+		for id, row := range resp.Trades {
+			if row.Pair != p {
+				continue
+			}
+
+			price, err := strconv.ParseFloat(row.Price, 64)
+			if err != nil {
+				return nil, cursor, fmt.Errorf("Kraken: float parsing of `%s` failed - %s", row.Price, err)
+			}
+
+			vol, err := strconv.ParseFloat(row.Vol, 64)
+			if err != nil {
+				return nil, cursor, fmt.Errorf("Kraken: float parsing of `%s` failed - %s", row.Vol, err)
+			}
+
+			fee, err := strconv.ParseFloat(row.Fee, 64)
+			if err != nil {
+				return nil, cursor, fmt.Errorf("Kraken: float parsing of `%s` failed - %s", row.Fee, err)
+			}
+
+			sec := int64(row.Time)
+			trades = append(trades, &exchanger.Trade{
+				ID:          id,
+				OrderID:     row.Ordertxid,
+				Pair:        pair,
+				Side:        row.Type,
+				Price:       price,
+				Volume:      vol,
+				Fee:         fee,
+				FeeCurrency: pair.Quote,
+				Time:        time.Unix(sec, int64((row.Time-float64(sec))*1e9)),
+			})
+		}
+
+		if len(resp.Trades) == 0 || ofs+len(resp.Trades) >= resp.Count {
+			break
+		}
+	}
+
+	sort.Sort(exchanger.ByTime(trades))
+	if len(trades) > 0 {
+		t := trades[len(trades)-1].Time
+		cursor = strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 4, 64)
+	}
+
+	return trades, cursor, nil
+}
+
+// OpenOrders implements exchanger.OrderLister.
+func (c *Client) OpenOrders(pair exchanger.Pair) ([]*exchanger.OpenOrder, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("Kraken: pair not supported %s", pair)
+	}
+
+	var resp struct {
+		Open map[string]struct {
+			Opentm  float64
+			Vol     string
+			VolExec string `json:"vol_exec"`
+			Descr   struct {
+				Pair  string
+				Type  string
+				Price string
+			}
+		}
+	}
+
+	if err := c.Query("OpenOrders", map[string]string{}, &resp); err != nil {
+		return nil, fmt.Errorf("Kraken: call to OpenOrders failed - %s", err)
+	}
+
+	orders := []*exchanger.OpenOrder{}
+	for id, row := range resp.Open {
+		// order descriptions use the alternate pair names (XZECXXBT is ZECXBT)
+		if row.Descr.Pair != p && row.Descr.Pair != p[1:4]+p[5:] {
+			continue
+		}
+
+		values := []float64{}
+		for _, s := range []string{row.Vol, row.VolExec, row.Descr.Price} {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Kraken: float parsing of `%s` failed - %s", s, err)
+			}
+			values = append(values, v)
+		}
+
+		sec := int64(row.Opentm)
+		orders = append(orders, &exchanger.OpenOrder{
+			ID:     id,
+			Pair:   pair,
+			Side:   row.Descr.Type,
+			Volume: values[0] - values[1],
+			Price:  values[2],
+			Time:   time.Unix(sec, int64((row.Opentm-float64(sec))*1e9)),
+		})
+	}
+
+	return orders, nil
+}
+
+// transferStatus queries DepositStatus or WithdrawStatus. Kraken statuses are Initial,
+// Pending, Settled, Success and Failure. The status-prop field refines them: a withdrawal
+// goes through initiated, on hold (waiting for the email confirmation), pending, sending
+// and success.
+func (c *Client) transferStatus(method, kind, cur string) ([]*exchanger.Transfer, error) {
+	asset, ok := Currencies[cur]
+	if !ok {
+		asset = cur
+	}
+
+	resp := []struct {
+		Refid  string
+		Txid   string
+		Info   string
+		Amount string
+		Fee    string
+		Time   float64
+		Status string
+		Prop   string `json:"status-prop"`
+	}{}
+
+	err := c.Query(method, map[string]string{"asset": asset}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("Kraken: call to %s failed - %s", method, err)
+	}
+
+	transfers := []*exchanger.Transfer{}
+	for _, row := range resp {
+		amount, err := strconv.ParseFloat(row.Amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Kraken: float parsing of `%s` failed - %s", row.Amount, err)
+		}
+
+		// the fee is missing on some deposits
+		fee, _ := strconv.ParseFloat(row.Fee, 64)
+
+		status := exchanger.TransferPending
+		switch row.Status {
+		case "Success":
+			status = exchanger.TransferCompleted
+		case "Failure":
+			status = exchanger.TransferFailed
+		}
+
+		raw := row.Status
+		if row.Prop != "" {
+			raw = fmt.Sprintf("%s (%s)", row.Status, row.Prop)
+		}
+
+		sec := int64(row.Time)
+		transfers = append(transfers, &exchanger.Transfer{
+			ID:        row.Refid,
+			Kind:      kind,
+			Currency:  cur,
+			Amount:    amount,
+			Fee:       fee,
+			Address:   row.Info,
+			TxID:      row.Txid,
+			Status:    status,
+			RawStatus: raw,
+			Time:      time.Unix(sec, int64((row.Time-float64(sec))*1e9)),
+		})
+	}
+
+	return transfers, nil
+}
+
 func (c *Client) Query(method string, data map[string]string, typ interface{}) error {
 	values := url.Values{}
 	for key, value := range data {
@@ -142,7 +386,12 @@ func (c *Client) Query(method string, data map[string]string, typ interface{}) e
 	urlPath := fmt.Sprintf("/%s/private/%s", APIVersion, method)
 	reqURL := fmt.Sprintf("%s%s", APIURL, urlPath)
 	secret, _ := base64.StdEncoding.DecodeString(c.ApiSecret)
-	values.Set("nonce", fmt.Sprintf("%d", time.Now().UnixNano()))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nonce = nextNonce(c.nonce, time.Now())
+	values.Set("nonce", fmt.Sprintf("%d", c.nonce))
 
 	// Create signature
 	signature := createSignature(urlPath, values, secret)
@@ -169,21 +418,51 @@ func (c *Client) Query(method string, data map[string]string, typ interface{}) e
 	switch t := resp.Error.(type) {
 	case string:
 		if t != "" {
-			return fmt.Errorf("Kraken error: %s", t)
-		}
-	case []string:
-		if len(t) > 0 {
-			return fmt.Errorf("Kraken errors: %s", t[0])
+			return &APIError{[]string{t}}
 		}
 	case []interface{}:
 		if len(t) > 0 {
-			return fmt.Errorf("Kraken errors: %s", t)
+			errors := make([]string, len(t))
+			for i, e := range t {
+				errors[i] = fmt.Sprint(e)
+			}
+			return &APIError{errors}
 		}
 	}
 
 	return nil
 }
 
+// nextNonce returns the nonce following last at time t.
+func nextNonce(last int64, t time.Time) int64 {
+	if n := t.UnixNano(); n > last {
+		return n
+	}
+	return last + 1
+}
+
+// APIError holds the errors reported by Kraken in the response to a private call, such
+// as `EFunding:Insufficient funds` or `EService:Unavailable`.
+type APIError struct {
+	Errors []string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Kraken errors: %s", e.Errors)
+}
+
+// Rejected reports whether Kraken refused the request. The service errors
+// (`EService:Unavailable`, `EService:Busy`) and the internal errors don't tell whether
+// the request was processed.
+func (e *APIError) Rejected() bool {
+	for _, err := range e.Errors {
+		if strings.HasPrefix(err, "EService:") || strings.HasPrefix(err, "EGeneral:Internal") {
+			return false
+		}
+	}
+	return true
+}
+
 // getSha256 creates a sha256 hash for given []byte
 func getSha256(input []byte) []byte {
 	sha := sha256.New()
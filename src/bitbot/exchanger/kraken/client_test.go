@@ -0,0 +1,24 @@
+package kraken
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextNonce(t *testing.T) {
+	now := time.Now()
+
+	n := nextNonce(0, now)
+	if n != now.UnixNano() {
+		t.Errorf("the nonce should be the time, got %d", n)
+	}
+
+	// the clock went back or two calls share the same nanosecond
+	for _, at := range []time.Time{now, now.Add(-time.Second)} {
+		next := nextNonce(n, at)
+		if next != n+1 {
+			t.Errorf("nonce %d expected, got %d", n+1, next)
+		}
+		n = next
+	}
+}
@@ -0,0 +1,115 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+)
+
+// PublicTrades implements exchanger.TapeFunc with the Trades endpoint. The cursor is the
+// `since` parameter: a time in nanoseconds.
+func PublicTrades(pair exchanger.Pair, cursor string) ([]*exchanger.PublicTrade, string, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, "", fmt.Errorf("Kraken: PublicTrades function doesn't support %s", pair)
+	}
+
+	// the rows are [price, volume, time, side, type, misc], the times are numbers, and
+	// `last` a string, in the same object
+	var result struct {
+		Error  []string
+		Result map[string]json.RawMessage
+	}
+
+	url := fmt.Sprintf("%s/%s/public/Trades?pair=%s", APIURL, APIVersion, p)
+	if cursor != "" {
+		url += "&since=" + cursor
+	}
+	if err := httpreq.Get(url, nil, &result); err != nil {
+		return nil, "", err
+	}
+
+	if len(result.Error) > 0 {
+		return nil, "", fmt.Errorf("Kraken returned an error. %s", result.Error[0])
+	}
+
+	var rows [][]interface{}
+	if err := json.Unmarshal(result.Result[p], &rows); err != nil {
+		return nil, "", fmt.Errorf("Kraken: cannot parse trades - %s", err)
+	}
+
+	next := cursor
+	if err := json.Unmarshal(result.Result["last"], &next); err != nil {
+		return nil, "", fmt.Errorf("Kraken: cannot parse cursor - %s", err)
+	}
+
+	trades, err := parseTrades(pair, rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return trades, next, nil
+}
+
+// parseTrades converts the rows of a page of trades. Kraken doesn't identify its trades:
+// the ID is made of the time, price and volume, followed by the rank of the trade among
+// the identical ones of the page (several fills of a same order at a same level). The
+// first one keeps the bare ID. Identical trades split over two pages are ranked again
+// from zero on the second page and collide with the first ones, which are then lost,
+// but they share a same timestamp, which `since` pages rarely split.
+func parseTrades(pair exchanger.Pair, rows [][]interface{}) ([]*exchanger.PublicTrade, error) {
+	trades := []*exchanger.PublicTrade{}
+	seen := map[string]int{}
+	for _, row := range rows {
+		if len(row) < 4 {
+			return nil, fmt.Errorf("Kraken: invalid trade %v", row)
+		}
+
+		price, err := strconv.ParseFloat(fmt.Sprint(row[0]), 64)
+		if err != nil {
+			return nil, err
+		}
+		volume, err := strconv.ParseFloat(fmt.Sprint(row[1]), 64)
+		if err != nil {
+			return nil, err
+		}
+		ts, ok := row[2].(float64)
+		if !ok {
+			return nil, fmt.Errorf("Kraken: invalid trade time %v", row[2])
+		}
+
+		side := exchanger.Buy
+		if row[3] == "s" {
+			side = exchanger.Sell
+		}
+
+		id := fmt.Sprintf("%s-%s-%s", strconv.FormatFloat(ts, 'f', -1, 64), row[0], row[1])
+		n := seen[id]
+		seen[id]++
+		if n > 0 {
+			id = fmt.Sprintf("%s-%d", id, n)
+		}
+
+		sec := int64(ts)
+		trades = append(trades, &exchanger.PublicTrade{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			ID:        id,
+			Price:     price,
+			Volume:    volume,
+			Side:      side,
+			Time:      time.Unix(sec, int64((ts-float64(sec))*1e9)),
+		})
+	}
+
+	return trades, nil
+}
+
+// TapeCursor implements exchanger.TapeCursorFunc.
+func TapeCursor(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
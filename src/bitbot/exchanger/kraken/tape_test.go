@@ -0,0 +1,44 @@
+package kraken
+
+import (
+	"testing"
+
+	"bitbot/exchanger"
+)
+
+func TestParseTrades(t *testing.T) {
+	rows := [][]interface{}{
+		{"0.02500", "1.5", 1500000000.1234, "b", "l", ""},
+		{"0.02500", "1.5", 1500000000.1234, "b", "l", ""},
+		{"0.02510", "1.5", 1500000000.1234, "s", "m", ""},
+		{"0.02500", "1.5", 1500000000.1234, "b", "l", ""},
+	}
+
+	trades, err := parseTrades(exchanger.ZEC_BTC, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the identical trades are told apart by their rank in the page
+	expected := []string{
+		"1500000000.1234-0.02500-1.5",
+		"1500000000.1234-0.02500-1.5-1",
+		"1500000000.1234-0.02510-1.5",
+		"1500000000.1234-0.02500-1.5-2",
+	}
+	if len(trades) != len(expected) {
+		t.Fatalf("%d trades expected, got %d", len(expected), len(trades))
+	}
+	for i, trade := range trades {
+		if trade.ID != expected[i] {
+			t.Errorf("trade %d: expected ID %s, got %s", i, expected[i], trade.ID)
+		}
+	}
+	if trades[2].Side != exchanger.Sell || trades[2].Price != 0.0251 {
+		t.Errorf("unexpected trade %+v", trades[2])
+	}
+
+	if _, err := parseTrades(exchanger.ZEC_BTC, [][]interface{}{{"0.025", "1.5"}}); err == nil {
+		t.Error("truncated rows should fail")
+	}
+}
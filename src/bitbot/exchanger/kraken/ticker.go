@@ -0,0 +1,83 @@
+package kraken
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+)
+
+// tickerResponse is the response of the Ticker endpoint. The arrays hold the values of
+// the day and of the last 24 hours, a (ask), b (bid) and c (last trade) start with the
+// price.
+type tickerResponse struct {
+	Error  []string
+	Result map[string]struct {
+		A []exchanger.Float
+		B []exchanger.Float
+		C []exchanger.Float
+		V []exchanger.Float
+		P []exchanger.Float
+		L []exchanger.Float
+		H []exchanger.Float
+		O exchanger.Float
+	}
+}
+
+// Tickers returns the tickers of pairs with a single call to the Ticker endpoint.
+func Tickers(pairs []exchanger.Pair) ([]*exchanger.Ticker, error) {
+	names := []string{}
+	for _, pair := range pairs {
+		if p, ok := Pairs[pair]; ok {
+			names = append(names, p)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("Kraken: Tickers function doesn't support %v", pairs)
+	}
+
+	var result tickerResponse
+	url := fmt.Sprintf("%s/%s/public/Ticker?pair=%s", APIURL, APIVersion, strings.Join(names, ","))
+	if err := httpreq.Get(url, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result.tickers(pairs, time.Now())
+}
+
+// tickers converts the response fetched at t.
+func (result *tickerResponse) tickers(pairs []exchanger.Pair, t time.Time) ([]*exchanger.Ticker, error) {
+	if len(result.Error) > 0 {
+		return nil, fmt.Errorf("Kraken returned an error. %s", result.Error[0])
+	}
+
+	tickers := []*exchanger.Ticker{}
+	for _, pair := range pairs {
+		r, ok := result.Result[Pairs[pair]]
+		if !ok {
+			continue
+		}
+		if len(r.A) < 1 || len(r.B) < 1 || len(r.C) < 1 || len(r.V) < 2 || len(r.P) < 2 || len(r.L) < 2 || len(r.H) < 2 {
+			return nil, fmt.Errorf("Kraken: incomplete ticker for %s", pair)
+		}
+
+		tickers = append(tickers, &exchanger.Ticker{
+			Exchanger:  ExchangerName,
+			Pair:       pair,
+			Last:       float64(r.C[0]),
+			Bid:        float64(r.B[0]),
+			Ask:        float64(r.A[0]),
+			High:       float64(r.H[1]),
+			Low:        float64(r.L[1]),
+			BaseVolume: float64(r.V[1]),
+			// volume weighted average price times volume
+			QuoteVolume: float64(r.V[1] * r.P[1]),
+			PrevDay:     float64(r.O),
+			Time:        t,
+		})
+	}
+
+	return tickers, nil
+}
@@ -0,0 +1,54 @@
+package kraken
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+func TestTickers(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/ticker.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result tickerResponse
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	tickers, err := result.tickers([]exchanger.Pair{exchanger.ZEC_BTC, exchanger.BTC_USD}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pairs missing from the response are skipped, the values are the 24h ones
+	expected := []*exchanger.Ticker{{
+		Exchanger:   ExchangerName,
+		Pair:        exchanger.ZEC_BTC,
+		Last:        0.1252,
+		Bid:         0.125,
+		Ask:         0.1254,
+		High:        0.127,
+		Low:         0.122,
+		BaseVolume:  600,
+		QuoteVolume: 600 * 0.125,
+		PrevDay:     0.124,
+		Time:        now,
+	}}
+	if !reflect.DeepEqual(tickers, expected) {
+		t.Errorf("expected %+v, got %+v", expected[0], tickers[0])
+	}
+}
+
+func TestTickersError(t *testing.T) {
+	result := tickerResponse{Error: []string{"EQuery:Unknown asset pair"}}
+	if _, err := result.tickers([]exchanger.Pair{exchanger.ZEC_BTC}, time.Now()); err == nil {
+		t.Error("the errors of the response should fail")
+	}
+}
@@ -2,6 +2,8 @@ package exchanger
 
 import (
 	"fmt"
+	"math"
+	"time"
 
 	"bitbot/httpreq"
 )
@@ -11,6 +13,76 @@ type OrderBook struct {
 	Exchanger string
 	Bids      []*Order
 	Asks      []*Order
+
+	// Sent and Received are the times the request was sent and the response received
+	// (see Fetch). They are zero for books not fetched through Fetch.
+	Sent     time.Time
+	Received time.Time
+	// ExchangeTime is reported by the exchanger: the time of the snapshot (Cex) or of
+	// the last order update (Kraken, Bitfinex, Gemini). It is zero when not reported and
+	// comes from the exchanger clock.
+	ExchangeTime time.Time
+}
+
+// Latency is the time the book took to be fetched.
+func (b *OrderBook) Latency() time.Duration {
+	if b.Sent.IsZero() || b.Received.IsZero() {
+		return 0
+	}
+	return b.Received.Sub(b.Sent)
+}
+
+// Time estimates the time of the snapshot: the exchanger took it between the request
+// and the response. It is zero when the book wasn't fetched through Fetch.
+func (b *OrderBook) Time() time.Time {
+	if b.Received.IsZero() {
+		return time.Time{}
+	}
+	return b.Sent.Add(b.Latency() / 2)
+}
+
+// Age is the age of the book at t.
+func (b *OrderBook) Age(t time.Time) time.Duration {
+	return t.Sub(b.Time())
+}
+
+// Skew returns the time elapsed between the snapshots of two books.
+func Skew(a, b *OrderBook) time.Duration {
+	d := a.Time().Sub(b.Time())
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Fetch calls f and stamps the book with the request and response times. Books of
+// exchangers only reporting the time of their orders get the most recent one as
+// exchange time.
+func Fetch(f func(Pair) (*OrderBook, error), pair Pair) (*OrderBook, error) {
+	sent := time.Now()
+	book, err := f(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	book.Sent = sent
+	book.Received = time.Now()
+
+	if book.ExchangeTime.IsZero() {
+		var last float64
+		for _, orders := range [][]*Order{book.Bids, book.Asks} {
+			for _, o := range orders {
+				last = math.Max(last, o.Timestamp)
+			}
+		}
+
+		if last > 0 {
+			sec := int64(last)
+			book.ExchangeTime = time.Unix(sec, int64((last-float64(sec))*1e9))
+		}
+	}
+
+	return book, nil
 }
 
 type Order struct {
@@ -47,7 +119,7 @@ func NewOrderbook(Exchanger string, bids, asks []*Order) (*OrderBook, error) {
 		minAsk = o.Price
 	}
 
-	return &OrderBook{Exchanger, bids, asks}, nil
+	return &OrderBook{Exchanger: Exchanger, Bids: bids, Asks: asks}, nil
 }
 
 // TODO: inline those function calls
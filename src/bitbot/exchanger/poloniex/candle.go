@@ -0,0 +1,68 @@
+package poloniex
+
+import (
+	"fmt"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// candlePeriods are the periods of the returnChartData endpoint.
+var candlePeriods = []time.Duration{5 * time.Minute, 15 * time.Minute, 30 * time.Minute, 2 * time.Hour,
+	4 * time.Hour, 24 * time.Hour}
+
+// Candles implements exchanger.CandleFunc with the returnChartData endpoint.
+func Candles(pair exchanger.Pair, interval time.Duration, since time.Time) ([]*exchanger.Candle, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("Poloniex: Candles function doesn't support %s", pair)
+	}
+
+	supported := false
+	for _, period := range candlePeriods {
+		if period == interval {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, &exchanger.IntervalError{Exchanger: ExchangerName, Interval: interval}
+	}
+
+	// as for the tickers, quoteVolume is in the base currency of the pair
+	var result []struct {
+		Date        int64
+		Open        exchanger.Float
+		High        exchanger.Float
+		Low         exchanger.Float
+		Close       exchanger.Float
+		QuoteVolume exchanger.Float
+	}
+
+	url := fmt.Sprintf("%s?command=returnChartData&currencyPair=%s&period=%d&start=%d&end=%d", APIURL, p,
+		int64(interval/time.Second), since.Unix(), time.Now().Unix())
+	if err := exchanger.FetchOrderBook(url, &result); err != nil {
+		return nil, err
+	}
+
+	candles := []*exchanger.Candle{}
+	for _, r := range result {
+		// a single candle at 0 when there is none
+		if r.Date == 0 {
+			continue
+		}
+
+		candles = append(candles, &exchanger.Candle{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			Interval:  interval,
+			Start:     time.Unix(r.Date, 0),
+			Open:      float64(r.Open),
+			High:      float64(r.High),
+			Low:       float64(r.Low),
+			Close:     float64(r.Close),
+			Volume:    float64(r.QuoteVolume),
+		})
+	}
+
+	return candles, nil
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"bitbot/exchanger"
@@ -95,6 +97,21 @@ func (c *Client) PlaceOrder(cmd string, pair exchanger.Pair, rate, amount float6
 	return v, err
 }
 
+// CancelOrder cancels an order you have placed in a given market.
+func (c *Client) CancelOrder(orderNumber string) error {
+	data := &url.Values{}
+	data.Add("orderNumber", orderNumber)
+	var v struct {
+		Success int
+		Error   string
+	}
+	err := c.post("cancelOrder", data, &v)
+	if err == nil && v.Success != 1 {
+		err = fmt.Errorf("Poloniex: cannot cancel order %s - %s", orderNumber, v.Error)
+	}
+	return err
+}
+
 // Withdraw places a withdrawal for a given currency, with no email confirmation. In order to use
 // this method, the withdrawal privilege must be enabled for your API key.
 func (c *Client) Withdraw(amount float64, currency, address string) (string, error) {
@@ -116,6 +133,267 @@ func (c *Client) OrderTrades(orderNumber string) ([]map[string]interface{}, erro
 	return dest, err
 }
 
+// tradeHistoryLimit is the maximum number of trades returned by returnTradeHistory.
+const tradeHistoryLimit = 10000
+
+// Trades implements exchanger.TradeHistorian. The cursor is the unix time of the last
+// trade returned. returnTradeHistory returns the newest trades of a range first: ranges
+// holding more than tradeHistoryLimit trades are fetched backward.
+func (c *Client) Trades(pair exchanger.Pair, cursor string) ([]*exchanger.Trade, string, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, cursor, fmt.Errorf("Poloniex: pair not supported %s", pair)
+	}
+
+	start := int64(0)
+	if cursor != "" {
+		var err error
+		if start, err = strconv.ParseInt(cursor, 10, 64); err != nil {
+			return nil, cursor, fmt.Errorf("Poloniex: invalid cursor `%s` - %s", cursor, err)
+		}
+	}
+
+	type row struct {
+		TradeID     interface{}
+		Date        string
+		Rate        string
+		Amount      string
+		Total       string
+		Fee         string
+		OrderNumber string
+		Type        string
+	}
+
+	trades := []*exchanger.Trade{}
+	end := time.Now().Unix()
+
+	for {
+		prev := end
+		data := &url.Values{}
+		data.Add("currencyPair", p)
+		data.Add("start", fmt.Sprint(start))
+		data.Add("end", fmt.Sprint(end))
+		data.Add("limit", fmt.Sprint(tradeHistoryLimit))
+
+		rows := []row{}
+		if err := c.post("returnTradeHistory", data, &rows); err != nil {
+			return nil, cursor, fmt.Errorf("Poloniex: call to returnTradeHistory failed - %s", err)
+		}
+
+		for _, r := range rows {
+			ts, err := time.Parse("2006-01-02 15:04:05", r.Date)
+			if err != nil {
+				return nil, cursor, fmt.Errorf("Poloniex: cannot parse date `%s` - %s", r.Date, err)
+			}
+
+			values := []float64{}
+			for _, s := range []string{r.Rate, r.Amount, r.Total, r.Fee} {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					return nil, cursor, fmt.Errorf("Poloniex: float parsing of `%s` failed - %s", s, err)
+				}
+				values = append(values, v)
+			}
+			rate, amount, total, feePercent := values[0], values[1], values[2], values[3]
+
+			// fees are charged on the currency received
+			t := &exchanger.Trade{
+				ID:          fmt.Sprint(r.TradeID),
+				OrderID:     r.OrderNumber,
+				Pair:        pair,
+				Side:        r.Type,
+				Price:       rate,
+				Volume:      amount,
+				Fee:         total * feePercent,
+				FeeCurrency: pair.Quote,
+				Time:        ts,
+			}
+			if r.Type == exchanger.Buy {
+				t.Fee = amount * feePercent
+				t.FeeCurrency = pair.Base
+			}
+
+			trades = append(trades, t)
+			if ts.Unix() < end {
+				end = ts.Unix()
+			}
+		}
+
+		if len(rows) < tradeHistoryLimit || end == prev {
+			break
+		}
+	}
+
+	sort.Sort(exchanger.ByTime(trades))
+	if len(trades) > 0 {
+		cursor = fmt.Sprint(trades[len(trades)-1].Time.Unix())
+	}
+
+	return trades, cursor, nil
+}
+
+// OpenOrders implements exchanger.OrderLister.
+func (c *Client) OpenOrders(pair exchanger.Pair) ([]*exchanger.OpenOrder, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("Poloniex: pair not supported %s", pair)
+	}
+
+	data := &url.Values{}
+	data.Add("currencyPair", p)
+
+	rows := []struct {
+		OrderNumber string
+		Type        string
+		Rate        string
+		Amount      string
+		Date        string
+	}{}
+	if err := c.post("returnOpenOrders", data, &rows); err != nil {
+		return nil, fmt.Errorf("Poloniex: call to returnOpenOrders failed - %s", err)
+	}
+
+	orders := []*exchanger.OpenOrder{}
+	for _, r := range rows {
+		ts, err := time.Parse("2006-01-02 15:04:05", r.Date)
+		if err != nil {
+			return nil, fmt.Errorf("Poloniex: cannot parse date `%s` - %s", r.Date, err)
+		}
+
+		rate, err := strconv.ParseFloat(r.Rate, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Poloniex: float parsing of `%s` failed - %s", r.Rate, err)
+		}
+
+		amount, err := strconv.ParseFloat(r.Amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Poloniex: float parsing of `%s` failed - %s", r.Amount, err)
+		}
+
+		orders = append(orders, &exchanger.OpenOrder{
+			ID:     r.OrderNumber,
+			Pair:   pair,
+			Side:   r.Type,
+			Volume: amount,
+			Price:  rate,
+			Time:   ts,
+		})
+	}
+
+	return orders, nil
+}
+
+// DepositsWithdrawals returns your deposit and withdrawal history within a range, specified
+// by the "start" and "end" parameters.
+func (c *Client) DepositsWithdrawals(start, end time.Time) (deposits, withdrawals []*exchanger.Transfer, err error) {
+	data := &url.Values{}
+	data.Add("start", fmt.Sprint(start.Unix()))
+	data.Add("end", fmt.Sprint(end.Unix()))
+
+	type row struct {
+		WithdrawalNumber int64
+		Currency         string
+		Address          string
+		Amount           string
+		Fee              string
+		Txid             string
+		Timestamp        int64
+		Status           string
+	}
+
+	var v struct {
+		Deposits    []row
+		Withdrawals []row
+	}
+
+	err = c.post("returnDepositsWithdrawals", data, &v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parse := func(kind string, r row) (*exchanger.Transfer, error) {
+		amount, err := strconv.ParseFloat(r.Amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Poloniex: float parsing of `%s` failed - %s", r.Amount, err)
+		}
+
+		fee, _ := strconv.ParseFloat(r.Fee, 64)
+
+		t := &exchanger.Transfer{
+			Kind:      kind,
+			Currency:  r.Currency,
+			Amount:    amount,
+			Fee:       fee,
+			Address:   r.Address,
+			TxID:      r.Txid,
+			Status:    exchanger.TransferPending,
+			RawStatus: r.Status,
+			Time:      time.Unix(r.Timestamp, 0),
+		}
+
+		// withdrawal statuses look like "COMPLETE: <txid>"
+		switch {
+		case strings.HasPrefix(r.Status, "COMPLETE"):
+			t.Status = exchanger.TransferCompleted
+			if kind == exchanger.Withdrawal {
+				t.TxID = strings.TrimSpace(strings.TrimPrefix(r.Status, "COMPLETE:"))
+			}
+		case strings.HasPrefix(r.Status, "CANCELED"), strings.HasPrefix(r.Status, "FAILED"):
+			t.Status = exchanger.TransferFailed
+		}
+
+		if kind == exchanger.Withdrawal {
+			t.ID = fmt.Sprint(r.WithdrawalNumber)
+		} else {
+			t.ID = r.Txid
+		}
+
+		return t, nil
+	}
+
+	for _, r := range v.Deposits {
+		t, err := parse(exchanger.Deposit, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		deposits = append(deposits, t)
+	}
+
+	for _, r := range v.Withdrawals {
+		t, err := parse(exchanger.Withdrawal, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		withdrawals = append(withdrawals, t)
+	}
+
+	return deposits, withdrawals, nil
+}
+
+// Deposits implements exchanger.TransferHistorian. It returns the deposits of the last
+// 30 days.
+func (c *Client) Deposits(cur string) ([]*exchanger.Transfer, error) {
+	deposits, _, err := c.DepositsWithdrawals(time.Now().AddDate(0, 0, -30), time.Now())
+	return filterTransfers(deposits, cur), err
+}
+
+// Withdrawals implements exchanger.TransferHistorian. It returns the withdrawals of the
+// last 30 days.
+func (c *Client) Withdrawals(cur string) ([]*exchanger.Transfer, error) {
+	_, withdrawals, err := c.DepositsWithdrawals(time.Now().AddDate(0, 0, -30), time.Now())
+	return filterTransfers(withdrawals, cur), err
+}
+
+func filterTransfers(transfers []*exchanger.Transfer, cur string) []*exchanger.Transfer {
+	out := []*exchanger.Transfer{}
+	for _, t := range transfers {
+		if t.Currency == cur {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
 func (c *Client) post(cmd string, data *url.Values, v interface{}) error {
 	if data == nil {
 		data = &url.Values{}
@@ -0,0 +1,83 @@
+package poloniex
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// tapeWindow is the range of the trade history requested at once. Poloniex returns at
+// most 50000 trades per request.
+const tapeWindow = time.Hour
+
+// PublicTrades implements exchanger.TapeFunc with the returnTradeHistory endpoint. The
+// cursor is a time in seconds: the trades of the following hour are returned, and the
+// cursor moves to the end of the hour, or to the last trade once the hour reaches now.
+func PublicTrades(pair exchanger.Pair, cursor string) ([]*exchanger.PublicTrade, string, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, "", fmt.Errorf("Poloniex: PublicTrades function doesn't support %s", pair)
+	}
+
+	url := fmt.Sprintf("%s?command=returnTradeHistory&currencyPair=%s", APIURL, p)
+
+	var end time.Time
+	if cursor != "" {
+		start, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("Poloniex: invalid cursor `%s`", cursor)
+		}
+		end = time.Unix(start, 0).Add(tapeWindow)
+		url += fmt.Sprintf("&start=%d&end=%d", start, end.Unix())
+	}
+
+	var result []struct {
+		TradeID int64
+		Date    string
+		Type    string
+		Rate    exchanger.Float
+		Amount  exchanger.Float
+	}
+
+	if err := exchanger.FetchOrderBook(url, &result); err != nil {
+		return nil, "", err
+	}
+
+	trades := []*exchanger.PublicTrade{}
+	for _, r := range result {
+		ts, err := time.Parse("2006-01-02 15:04:05", r.Date)
+		if err != nil {
+			return nil, "", fmt.Errorf("Poloniex: invalid trade time `%s`", r.Date)
+		}
+
+		trades = append(trades, &exchanger.PublicTrade{
+			Exchanger: ExchangerName,
+			Pair:      pair,
+			ID:        strconv.FormatInt(r.TradeID, 10),
+			Price:     float64(r.Rate),
+			Volume:    float64(r.Amount),
+			Side:      r.Type,
+			Time:      ts,
+		})
+	}
+
+	// returned most recent first
+	sort.Sort(exchanger.ByTradeTime(trades))
+
+	next := cursor
+	if !end.IsZero() && end.Before(time.Now()) {
+		next = strconv.FormatInt(end.Unix(), 10)
+	} else if len(trades) > 0 {
+		next = strconv.FormatInt(trades[len(trades)-1].Time.Unix(), 10)
+	}
+
+	return trades, next, nil
+}
+
+// TapeCursor implements exchanger.TapeCursorFunc.
+func TapeCursor(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
@@ -0,0 +1,61 @@
+package poloniex
+
+import (
+	"fmt"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// tickerResponse is the response of the returnTicker endpoint, by market. Poloniex names
+// the pairs the other way around: its base volume is in the quote currency of the pair
+// (BTC for BTC_ZEC) and its quote volume in the base one.
+type tickerResponse map[string]struct {
+	Last          exchanger.Float
+	HighestBid    exchanger.Float
+	LowestAsk     exchanger.Float
+	High24hr      exchanger.Float
+	Low24hr       exchanger.Float
+	BaseVolume    exchanger.Float
+	QuoteVolume   exchanger.Float
+	PercentChange exchanger.Float
+}
+
+// Tickers returns the tickers of pairs. The returnTicker endpoint lists every market at
+// once.
+func Tickers(pairs []exchanger.Pair) ([]*exchanger.Ticker, error) {
+	var result tickerResponse
+	url := fmt.Sprintf("%s?command=returnTicker", APIURL)
+	if err := exchanger.FetchOrderBook(url, &result); err != nil {
+		return nil, err
+	}
+
+	return result.tickers(pairs, time.Now()), nil
+}
+
+// tickers converts the response fetched at t.
+func (result tickerResponse) tickers(pairs []exchanger.Pair, t time.Time) []*exchanger.Ticker {
+	tickers := []*exchanger.Ticker{}
+	for _, pair := range pairs {
+		r, ok := result[Pairs[pair]]
+		if !ok {
+			continue
+		}
+
+		tickers = append(tickers, &exchanger.Ticker{
+			Exchanger:   ExchangerName,
+			Pair:        pair,
+			Last:        float64(r.Last),
+			Bid:         float64(r.HighestBid),
+			Ask:         float64(r.LowestAsk),
+			High:        float64(r.High24hr),
+			Low:         float64(r.Low24hr),
+			BaseVolume:  float64(r.QuoteVolume),
+			QuoteVolume: float64(r.BaseVolume),
+			PrevDay:     float64(r.Last / (1 + r.PercentChange)),
+			Time:        t,
+		})
+	}
+
+	return tickers
+}
@@ -0,0 +1,44 @@
+package poloniex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+func TestTickers(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/ticker.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result tickerResponse
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	tickers := result.tickers([]exchanger.Pair{exchanger.ZEC_BTC}, now)
+
+	// the base volume of Poloniex is in BTC, the quote currency of ZEC_BTC
+	expected := []*exchanger.Ticker{{
+		Exchanger:   ExchangerName,
+		Pair:        exchanger.ZEC_BTC,
+		Last:        0.125,
+		Bid:         0.1249,
+		Ask:         0.1254,
+		High:        0.129,
+		Low:         0.1231,
+		BaseVolume:  1450.2,
+		QuoteVolume: 180.5,
+		PrevDay:     0.125 / (1 - 0.0234375),
+		Time:        now,
+	}}
+	if !reflect.DeepEqual(tickers, expected) {
+		t.Errorf("expected %+v, got %+v", expected[0], tickers[0])
+	}
+}
@@ -0,0 +1,35 @@
+package exchanger
+
+import (
+	"time"
+)
+
+// PublicTrade is a trade of the public tape of a market.
+type PublicTrade struct {
+	Exchanger string
+	Pair      Pair
+	// ID is the exchanger reference of the trade. Kraken doesn't number its trades: the
+	// reference is made of the time, price and volume of the trade.
+	ID     string
+	Price  float64
+	Volume float64
+	// Side is the side of the aggressor, the order that took the liquidity: Buy or Sell.
+	Side string
+	Time time.Time
+}
+
+// TapeFunc returns the public trades of pair following cursor in chronological order,
+// and the cursor to pass on the next call. The cursor is opaque and specific to each
+// exchanger, an empty cursor returns the most recent trades. Trades may be returned more
+// than once around the cursor.
+type TapeFunc func(pair Pair, cursor string) ([]*PublicTrade, string, error)
+
+// TapeCursorFunc returns the cursor of the trades following t, to backfill the tape.
+type TapeCursorFunc func(t time.Time) string
+
+// ByTradeTime sorts public trades in chronological order.
+type ByTradeTime []*PublicTrade
+
+func (s ByTradeTime) Len() int           { return len(s) }
+func (s ByTradeTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s ByTradeTime) Less(i, j int) bool { return s[i].Time.Before(s[j].Time) }
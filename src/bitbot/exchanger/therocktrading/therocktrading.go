@@ -5,8 +5,11 @@ import (
 	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"net/http"
 	urlpkg "net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -84,6 +87,8 @@ func (c *Client) Balances() ([]Balance, error) {
 	return v.Balances, err
 }
 
+// Transactions returns the last transactions of your account (trades, fees, deposits and
+// withdrawals).
 func (c *Client) Transactions() ([]Transaction, error) {
 	var v struct {
 		Transactions []Transaction
@@ -113,6 +118,17 @@ func (c *Client) PlaceOrder(side string, pair exchanger.Pair, price, amount floa
 	return order, err
 }
 
+// CancelOrder removes an active order from the order book.
+func (c *Client) CancelOrder(pair exchanger.Pair, id string) error {
+	p, ok := Pairs[pair]
+	if !ok {
+		return fmt.Errorf("The Rock Trading: Pair not supported %s", pair)
+	}
+
+	url := fmt.Sprintf("%s/funds/%s/orders/%s", APIURL, p, id)
+	return httpreq.Delete(url, c.authHeader(url), &Order{})
+}
+
 // Withdraw places a withdrawal for a given currency.
 func (c *Client) Withdraw(amount float64, currency, address string) (string, error) {
 	url := fmt.Sprintf("%s/atms/withdraw", APIURL)
@@ -126,6 +142,168 @@ func (c *Client) Withdraw(amount float64, currency, address string) (string, err
 	return v.Transaction_id, err
 }
 
+// Deposits implements exchanger.TransferHistorian. Deposits are reported once credited.
+func (c *Client) Deposits(cur string) ([]*exchanger.Transfer, error) {
+	return c.transfers("atm_payment", exchanger.Deposit, cur)
+}
+
+// Withdrawals implements exchanger.TransferHistorian. Withdrawals are reported once
+// processed: their status is completed when they have a transaction hash.
+func (c *Client) Withdrawals(cur string) ([]*exchanger.Transfer, error) {
+	return c.transfers("withdraw", exchanger.Withdrawal, cur)
+}
+
+func (c *Client) transfers(typ, kind, cur string) ([]*exchanger.Transfer, error) {
+	txs, err := c.Transactions()
+	if err != nil {
+		return nil, fmt.Errorf("The Rock Trading: call to Transactions failed - %s", err)
+	}
+
+	transfers := []*exchanger.Transfer{}
+	for _, tx := range txs {
+		if tx.Type != typ || tx.Currency != cur {
+			continue
+		}
+
+		ts, err := time.Parse(time.RFC3339, tx.Date)
+		if err != nil {
+			return nil, fmt.Errorf("The Rock Trading: cannot parse date `%s` - %s", tx.Date, err)
+		}
+
+		t := &exchanger.Transfer{
+			ID:        strconv.Itoa(tx.Id),
+			Kind:      kind,
+			Currency:  cur,
+			Amount:    math.Abs(tx.Price),
+			Status:    exchanger.TransferCompleted,
+			RawStatus: tx.Note,
+			Time:      ts,
+		}
+
+		if d := tx.TransferDetail; d != nil {
+			t.TxID = d.Id
+			t.Address = d.Recipient
+		}
+
+		if kind == exchanger.Withdrawal && t.TxID == "" {
+			t.Status = exchanger.TransferPending
+		}
+
+		transfers = append(transfers, t)
+	}
+
+	return transfers, nil
+}
+
+// Trades implements exchanger.TradeHistorian. The cursor is the date of the last trade
+// returned. Fees are charged through separate `paid_commission` transactions, they are
+// looked up in the last transactions of the account.
+func (c *Client) Trades(pair exchanger.Pair, cursor string) ([]*exchanger.Trade, string, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, cursor, fmt.Errorf("The Rock Trading: Pair not supported %s", pair)
+	}
+
+	const perPage = 200
+	rows := []Trade{}
+
+	for page := 1; ; page++ {
+		query := urlpkg.Values{}
+		query.Add("page", strconv.Itoa(page))
+		query.Add("per_page", strconv.Itoa(perPage))
+		if cursor != "" {
+			query.Add("after", cursor)
+		}
+
+		var v struct{ Trades []Trade }
+		url := fmt.Sprintf("%s/funds/%s/trades?%s", APIURL, p, query.Encode())
+		if err := c.get(url, &v); err != nil {
+			return nil, cursor, fmt.Errorf("The Rock Trading: call to trades failed - %s", err)
+		}
+
+		rows = append(rows, v.Trades...)
+		if len(v.Trades) < perPage {
+			break
+		}
+	}
+
+	txs, err := c.Transactions()
+	if err != nil {
+		return nil, cursor, fmt.Errorf("The Rock Trading: call to Transactions failed - %s", err)
+	}
+
+	trades := []*exchanger.Trade{}
+	for _, row := range rows {
+		ts, err := time.Parse(time.RFC3339, row.Date)
+		if err != nil {
+			return nil, cursor, fmt.Errorf("The Rock Trading: cannot parse date `%s` - %s", row.Date, err)
+		}
+
+		t := &exchanger.Trade{
+			ID:      strconv.Itoa(row.Id),
+			OrderID: strconv.Itoa(row.OrderId),
+			Pair:    pair,
+			Side:    row.Side,
+			Price:   row.Price,
+			Volume:  row.Amount,
+			Time:    ts,
+		}
+
+		for _, tx := range txs {
+			if tx.Type == "paid_commission" && tx.TradeId == row.Id {
+				t.Fee += math.Abs(tx.Price)
+				t.FeeCurrency = tx.Currency
+			}
+		}
+
+		trades = append(trades, t)
+	}
+
+	sort.Sort(exchanger.ByTime(trades))
+	if len(trades) > 0 {
+		cursor = trades[len(trades)-1].Time.Format(time.RFC3339)
+	}
+
+	return trades, cursor, nil
+}
+
+// OpenOrders implements exchanger.OrderLister.
+func (c *Client) OpenOrders(pair exchanger.Pair) ([]*exchanger.OpenOrder, error) {
+	p, ok := Pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("The Rock Trading: Pair not supported %s", pair)
+	}
+
+	var v struct{ Orders []Order }
+	url := fmt.Sprintf("%s/funds/%s/orders", APIURL, p)
+	if err := c.get(url, &v); err != nil {
+		return nil, fmt.Errorf("The Rock Trading: call to orders failed - %s", err)
+	}
+
+	orders := []*exchanger.OpenOrder{}
+	for _, row := range v.Orders {
+		if row.Status != "active" {
+			continue
+		}
+
+		ts, err := time.Parse(time.RFC3339, row.Date)
+		if err != nil {
+			return nil, fmt.Errorf("The Rock Trading: cannot parse date `%s` - %s", row.Date, err)
+		}
+
+		orders = append(orders, &exchanger.OpenOrder{
+			ID:     strconv.Itoa(row.Id),
+			Pair:   pair,
+			Side:   row.Side,
+			Volume: row.AmountUnfilled,
+			Price:  row.Price,
+			Time:   ts,
+		})
+	}
+
+	return orders, nil
+}
+
 // WithdrawLimit returns a currency related withdraw limit
 func (c *Client) WithdrawLimit(currency string) (WithdrawLimit, error) {
 	url := fmt.Sprintf("%s/withdraw_limits/%s", APIURL, currency)
@@ -202,7 +380,7 @@ type Order struct {
 	// Order submission timestamp (UTC time)
 	Date string
 	// Order to close at close_on timestamp if present
-	CloseOn string `json:"conditional_type"`
+	CloseOn string `json:"close_on"`
 	// Order leverage. Default 1 if not a leveraged order
 	Leverage float64
 	// Position ID present if a closing order (close_short|close_long)
@@ -216,6 +394,8 @@ type Trade struct {
 	Id int
 	// Fund symbol
 	FundId string `json:"fund_id"`
+	// Order filled (user trades only)
+	OrderId int `json:"order_id"`
 	// Actual traded amount
 	Amount float64
 	// Actual traded price
@@ -238,13 +418,28 @@ type WithdrawLimit struct {
 }
 
 type Transaction struct {
-	Id       int
-	Type     string
+	Id int
+	// Transaction type (atm_payment for deposits, withdraw, withdraw_fee...)
+	Type string
+	// Transaction amount
 	Price    float64
 	Currency string
-	Date     string
-	// OrderId        interface{} `json:"order_id"`
-	// TradeId        interface{} `json:"trade_id"`
-	// Note           string
-	// TransferDetail interface{} `json:"transfer_detail"`
+	// Transaction timestamp (UTC time)
+	Date string
+	// OrderId and TradeId are set on trades and commissions
+	OrderId int `json:"order_id"`
+	TradeId int `json:"trade_id"`
+	Note    string
+	// Blockchain details of deposits and withdrawals
+	TransferDetail *TransferDetail `json:"transfer_detail"`
+}
+
+type TransferDetail struct {
+	// Transfer method (bitcoin, ...)
+	Method string
+	// Transaction hash
+	Id string
+	// Destination address
+	Recipient     string
+	Confirmations int
 }
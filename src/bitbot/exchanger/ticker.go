@@ -0,0 +1,51 @@
+package exchanger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ticker is the 24h summary of a market, normalized across the exchangers. Volumes are
+// over the last 24 hours, BaseVolume in the base currency of the pair and QuoteVolume in
+// its quote currency.
+type Ticker struct {
+	Exchanger   string
+	Pair        Pair
+	Last        float64
+	Bid         float64
+	Ask         float64
+	High        float64
+	Low         float64
+	BaseVolume  float64
+	QuoteVolume float64
+	// PrevDay is the price 24 hours ago, or at the start of the day on the exchangers
+	// not reporting it (Kraken).
+	PrevDay float64
+	// Time is the time the ticker was fetched.
+	Time time.Time
+}
+
+// TickerFunc fetches the tickers of several pairs of an exchanger at once. Pairs not
+// listed by the exchanger are missing from the result.
+type TickerFunc func(pairs []Pair) ([]*Ticker, error)
+
+// Float decodes the prices and volumes of the APIs, sent as JSON numbers or decimal
+// strings. Null and empty strings are zero.
+type Float float64
+
+func (f *Float) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("cannot parse `%s` - %s", b, err)
+	}
+	*f = Float(v)
+	return nil
+}
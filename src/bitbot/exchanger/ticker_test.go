@@ -0,0 +1,23 @@
+package exchanger
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFloat(t *testing.T) {
+	var v struct {
+		A, B, C, D Float
+	}
+
+	if err := json.Unmarshal([]byte(`{"a": 0.5, "b": "1.25", "c": null, "d": ""}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != 0.5 || v.B != 1.25 || v.C != 0 || v.D != 0 {
+		t.Errorf("wrong values %+v", v)
+	}
+
+	if err := json.Unmarshal([]byte(`{"a": "x"}`), &v); err == nil {
+		t.Error("an invalid decimal should fail")
+	}
+}
@@ -0,0 +1,62 @@
+package exchanger
+
+import (
+	"time"
+)
+
+// Trade sides.
+const (
+	Buy  = "buy"
+	Sell = "sell"
+)
+
+// Trade is a fill as reported by the trade history of an exchanger.
+type Trade struct {
+	// ID is the exchanger reference of the trade.
+	ID string
+	// OrderID is the reference of the order filled, as returned when it was placed.
+	OrderID string
+	Pair    Pair
+	Side    string
+	Price   float64
+	Volume  float64
+	Fee     float64
+	// FeeCurrency is the currency the fee was charged in.
+	FeeCurrency string
+	Time        time.Time
+}
+
+// TradeHistorian is implemented by the exchanger clients able to list the trades of the
+// account, including the ones not placed by the bot.
+type TradeHistorian interface {
+	// Trades returns the trades of pair following cursor in chronological order, and the
+	// cursor to pass on the next call. The cursor is opaque and specific to each
+	// exchanger, an empty cursor starts from the oldest trades available. Trades may be
+	// returned more than once around the cursor.
+	Trades(pair Pair, cursor string) ([]*Trade, string, error)
+}
+
+// ByTime sorts trades in chronological order.
+type ByTime []*Trade
+
+func (s ByTime) Len() int           { return len(s) }
+func (s ByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s ByTime) Less(i, j int) bool { return s[i].Time.Before(s[j].Time) }
+
+// OpenOrder is an order of the account resting on the book of an exchanger.
+type OpenOrder struct {
+	// ID is the reference of the order, as returned when it was placed.
+	ID   string
+	Pair Pair
+	Side string
+	// Volume is the volume left to fill.
+	Volume float64
+	Price  float64
+	Time   time.Time
+}
+
+// OrderLister is implemented by the exchanger clients able to list the open orders of
+// the account.
+type OrderLister interface {
+	OpenOrders(pair Pair) ([]*OpenOrder, error)
+}
@@ -0,0 +1,43 @@
+package exchanger
+
+import (
+	"time"
+)
+
+// Transfer kinds.
+const (
+	Deposit    = "deposit"
+	Withdrawal = "withdrawal"
+)
+
+// Transfer statuses.
+const (
+	TransferPending   = "pending"
+	TransferCompleted = "completed"
+	TransferFailed    = "failed"
+)
+
+// Transfer is a deposit or a withdrawal as reported by the history of an exchanger.
+type Transfer struct {
+	// ID is the exchanger reference of the transfer.
+	ID       string
+	Kind     string
+	Currency string
+	Amount   float64
+	Fee      float64
+	Address  string
+	// TxID is the blockchain transaction hash (empty until broadcast).
+	TxID string
+	// Status is TransferPending, TransferCompleted or TransferFailed.
+	Status string
+	// RawStatus is the status as reported by the exchanger.
+	RawStatus string
+	Time      time.Time
+}
+
+// TransferHistorian is implemented by the exchanger clients able to list the deposits and
+// withdrawals of a currency.
+type TransferHistorian interface {
+	Deposits(cur string) ([]*Transfer, error)
+	Withdrawals(cur string) ([]*Transfer, error)
+}
@@ -11,6 +11,19 @@ import (
 	"net/http"
 )
 
+// StatusError is returned when the server answers with another status than 200, 201 or
+// 204.
+type StatusError struct {
+	URL    string
+	Code   int
+	Status string
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Request error: %s - %d %s\n%s", e.URL, e.Code, e.Status, e.Body)
+}
+
 func Get(url string, h http.Header, v interface{}) error {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -20,6 +33,15 @@ func Get(url string, h http.Header, v interface{}) error {
 	return doRequest(req, h, v)
 }
 
+func Delete(url string, h http.Header, v interface{}) error {
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	return doRequest(req, h, v)
+}
+
 func Post(url string, h http.Header, body string, v interface{}) error {
 	b := bytes.NewReader([]byte(body))
 
@@ -52,6 +74,10 @@ func doRequest(req *http.Request, h http.Header, v interface{}) error {
 
 	// TODO: is it the right thing to do? How to handle 403 (like Hitbtc {"code":"NotAuthorized","message":"Wrong signature"})
 	// or 522 (like CEX maintenance)
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		status := http.StatusText(resp.StatusCode)
 
@@ -60,7 +86,7 @@ func doRequest(req *http.Request, h http.Header, v interface{}) error {
 			limit = len(respBody)
 		}
 
-		return fmt.Errorf("Request error: %s - %d %s\n%s", req.URL.String(), resp.StatusCode, status, respBody[:limit])
+		return &StatusError{req.URL.String(), resp.StatusCode, status, string(respBody[:limit])}
 	}
 
 	return json.Unmarshal(respBody, v)
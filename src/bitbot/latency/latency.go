@@ -0,0 +1,115 @@
+/*
+Package latency collects the time taken to fetch the order books of each exchanger and
+summarizes it with percentiles for monitoring.
+*/
+package latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"bitbot/stats"
+)
+
+// Stats summarizes the latencies of an exchanger.
+type Stats struct {
+	Exchanger string
+	Count     int
+	// Errors counts the failed fetches.
+	Errors int
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// Recorder collects latencies. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	errors  map[string]int
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{samples: map[string][]time.Duration{}, errors: map[string]int{}}
+}
+
+// Add records the latency of a successful fetch.
+func (r *Recorder) Add(ex string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples[ex] = append(r.samples[ex], d)
+}
+
+// AddError records a failed fetch.
+func (r *Recorder) AddError(ex string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors[ex]++
+}
+
+// Flush returns the statistics of the latencies recorded since the last flush, sorted by
+// exchanger, and forgets them.
+func (r *Recorder) Flush() []*Stats {
+	r.mu.Lock()
+	samples, errors := r.samples, r.errors
+	r.samples, r.errors = map[string][]time.Duration{}, map[string]int{}
+	r.mu.Unlock()
+
+	names := []string{}
+	for ex := range samples {
+		names = append(names, ex)
+	}
+	for ex := range errors {
+		if _, ok := samples[ex]; !ok {
+			names = append(names, ex)
+		}
+	}
+	sort.Strings(names)
+
+	stats := []*Stats{}
+	for _, ex := range names {
+		s := Summarize(samples[ex])
+		s.Exchanger = ex
+		s.Errors = errors[ex]
+		stats = append(stats, s)
+	}
+
+	return stats
+}
+
+// Summarize returns the percentiles of latencies.
+func Summarize(latencies []time.Duration) *Stats {
+	s := &Stats{Count: len(latencies)}
+	if len(latencies) == 0 {
+		return s
+	}
+
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Sort(durations(sorted))
+
+	s.P50 = percentile(sorted, 0.5)
+	s.P90 = percentile(sorted, 0.9)
+	s.P99 = percentile(sorted, 0.99)
+	s.Max = sorted[len(sorted)-1]
+	return s
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies (see
+// stats.Percentile).
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	values := make([]float64, len(sorted))
+	for i, d := range sorted {
+		values[i] = float64(d)
+	}
+	return time.Duration(stats.Percentile(values, p))
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
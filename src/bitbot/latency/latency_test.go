@@ -0,0 +1,39 @@
+package latency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	for i := 1; i <= 100; i++ {
+		r.Add("A", time.Duration(i)*time.Millisecond)
+	}
+	r.Add("B", time.Second)
+	r.AddError("B")
+	r.AddError("C")
+
+	stats := r.Flush()
+	if len(stats) != 3 {
+		t.Fatalf("3 exchangers expected, got %d", len(stats))
+	}
+
+	a := stats[0]
+	if a.Exchanger != "A" || a.Count != 100 || a.P50 != 50*time.Millisecond || a.P90 != 90*time.Millisecond ||
+		a.P99 != 99*time.Millisecond || a.Max != 100*time.Millisecond {
+		t.Errorf("unexpected stats %+v", a)
+	}
+
+	if b := stats[1]; b.Count != 1 || b.Errors != 1 || b.P50 != time.Second {
+		t.Errorf("unexpected stats %+v", b)
+	}
+
+	if c := stats[2]; c.Exchanger != "C" || c.Count != 0 || c.Errors != 1 {
+		t.Errorf("unexpected stats %+v", c)
+	}
+
+	if stats := r.Flush(); len(stats) != 0 {
+		t.Errorf("the recorder should be empty after a flush, got %v", stats)
+	}
+}
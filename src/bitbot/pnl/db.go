@@ -0,0 +1,139 @@
+package pnl
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"bitbot/database"
+	"bitbot/exchanger"
+)
+
+// LoadTrades returns the trades of the `trade` table executed before to.
+func LoadTrades(db *sql.DB, to time.Time) ([]*Trade, error) {
+	const query = `
+		select
+			trade_id,
+			exchanger,
+			coalesce(arbitrage_id, ''),
+			pair,
+			side,
+			price,
+			quantity,
+			fee,
+			fee_currency,
+			ts
+		from
+			trade
+		where
+			ts < ?
+		order by
+			ts
+	`
+
+	rows, err := db.Query(query, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := []*Trade{}
+	for rows.Next() {
+		t := &Trade{}
+		var pair string
+		var ts database.Timestamp
+
+		err := rows.Scan(&t.ID, &t.Exchanger, &t.Arbitrage, &pair, &t.Side, &t.Price, &t.Volume, &t.Fee, &t.FeeCurrency, &ts)
+		if err != nil {
+			return nil, err
+		}
+
+		t.Pair = exchanger.NewPair(pair)
+		t.Time = ts.Time
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+// LoadTransfers returns the rebalancing transfers of the `transfers` table completed
+// before to.
+func LoadTransfers(db *sql.DB, to time.Time) ([]*Transfer, error) {
+	const query = `
+		select
+			transfer_id,
+			currency,
+			from_ex,
+			to_ex,
+			fee,
+			updated_at
+		from
+			transfers
+		where
+			status = 'completed'
+			and updated_at < ?
+		order by
+			updated_at
+	`
+
+	rows, err := db.Query(query, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []*Transfer{}
+	for rows.Next() {
+		t := &Transfer{}
+		var ts database.Timestamp
+		if err := rows.Scan(&t.ID, &t.Currency, &t.From, &t.To, &t.Fee, &ts); err != nil {
+			return nil, err
+		}
+		t.Time = ts.Time
+		transfers = append(transfers, t)
+	}
+
+	return transfers, rows.Err()
+}
+
+// RecordedBooks is a PriceSource reading the mid prices of the `orderbooks` table.
+type RecordedBooks struct {
+	DB *sql.DB
+}
+
+func (r *RecordedBooks) Price(pair exchanger.Pair, t time.Time, maxAge time.Duration) (float64, time.Time, bool, error) {
+	const query = `
+		select ts, bids, asks
+		from orderbooks
+		where pair = ? and ts between ? and ?
+		order by ts desc
+		limit 1
+	`
+
+	var ts database.Timestamp
+	var bidsJSON, asksJSON []byte
+
+	err := r.DB.QueryRow(query, pair.String(), t.Add(-maxAge), t).Scan(&ts, &bidsJSON, &asksJSON)
+	if err == sql.ErrNoRows {
+		return 0, ts.Time, false, nil
+	} else if err != nil {
+		return 0, ts.Time, false, fmt.Errorf("cannot read %s orderbook - %s", pair, err)
+	}
+
+	at := ts.Time
+
+	var bids, asks []*exchanger.Order
+	if err := json.Unmarshal(bidsJSON, &bids); err != nil {
+		return 0, at, false, fmt.Errorf("cannot parse %s bids - %s", pair, err)
+	}
+	if err := json.Unmarshal(asksJSON, &asks); err != nil {
+		return 0, at, false, fmt.Errorf("cannot parse %s asks - %s", pair, err)
+	}
+
+	if len(bids) == 0 || len(asks) == 0 {
+		return 0, at, false, nil
+	}
+
+	return (bids[0].Price + asks[0].Price) / 2, at, true, nil
+}
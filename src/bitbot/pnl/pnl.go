@@ -0,0 +1,300 @@
+/*
+Package pnl computes the realized profit and loss of the trades and transfers of the bot
+in a reporting currency.
+
+Every trade disposes of a currency and acquires another one. Acquisitions open lots
+valued at their market value in the reporting currency at trade time. Disposals consume
+the oldest lots first (FIFO) and realize the difference between their proceeds and the
+cost basis of the lots consumed. Fees are disposals without proceeds, whatever their
+currency, and so are the fees of the rebalancing transfers.
+
+The Ledger records one Entry per lot consumed: it is the cost basis ledger used for tax
+reporting and the summaries per arbitrage, day, exchanger or pair are built from it.
+*/
+package pnl
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Entry kinds.
+const (
+	TradeEntry    = "trade"
+	FeeEntry      = "fee"
+	TransferEntry = "transfer"
+)
+
+// epsilon is the quantity under which a lot is considered consumed.
+const epsilon = 1e-12
+
+// Trade is a fill of the `trade` table.
+type Trade struct {
+	ID        string
+	Exchanger string
+	// Arbitrage is empty for the trades placed outside of the bot.
+	Arbitrage   string
+	Pair        exchanger.Pair
+	Side        string
+	Price       float64
+	Volume      float64
+	Fee         float64
+	FeeCurrency string
+	Time        time.Time
+}
+
+// Transfer is a completed rebalancing transfer. Its fee is the only cost accounted.
+type Transfer struct {
+	ID       string
+	Currency string
+	From     string
+	To       string
+	Fee      float64
+	Time     time.Time
+}
+
+// Rates converts currencies into the reporting currency.
+type Rates interface {
+	// Rate returns the value of one unit of cur in the reporting currency at t.
+	Rate(cur string, t time.Time) (float64, error)
+}
+
+// Lot is a quantity of currency acquired at once.
+type Lot struct {
+	Currency string
+	Quantity float64
+	// Cost is the cost basis of the remaining quantity.
+	Cost      float64
+	Acquired  time.Time
+	Exchanger string
+	Ref       string
+}
+
+// Entry is the disposal of (part of) a lot.
+type Entry struct {
+	Kind string
+	// Ref is the id of the trade or of the transfer.
+	Ref       string
+	Arbitrage string
+	Exchanger string
+	Pair      string
+	Currency  string
+	Quantity  float64
+	Acquired  time.Time
+	Disposed  time.Time
+	Cost      float64
+	Proceeds  float64
+	// Unmatched is set when no lot was left to cover the quantity (funds deposited
+	// before the history starts): the cost basis is the market value at disposal.
+	Unmatched bool
+}
+
+// Gain is the realized profit (or loss) of the entry.
+func (e *Entry) Gain() float64 {
+	return e.Proceeds - e.Cost
+}
+
+// Ledger tracks the lots of each currency and the disposals. Events must be added in
+// chronological order, see Compute.
+type Ledger struct {
+	// Currency is the reporting currency.
+	Currency string
+	Entries  []*Entry
+
+	rates Rates
+	lots  map[string][]*Lot
+}
+
+func NewLedger(currency string, rates Rates) *Ledger {
+	return &Ledger{
+		Currency: currency,
+		Entries:  []*Entry{},
+		rates:    rates,
+		lots:     map[string][]*Lot{},
+	}
+}
+
+// Lots returns the open lots of cur, oldest first.
+func (l *Ledger) Lots(cur string) []*Lot {
+	return l.lots[cur]
+}
+
+// AddTrade accounts the two legs of a trade and its fee.
+func (l *Ledger) AddTrade(t *Trade) error {
+	rate, err := l.rates.Rate(t.Pair.Quote, t.Time)
+	if err != nil {
+		return fmt.Errorf("trade %s: %s", t.ID, err)
+	}
+
+	quantity := t.Price * t.Volume
+	value := quantity * rate
+
+	e := &Entry{
+		Kind:      TradeEntry,
+		Ref:       t.ID,
+		Arbitrage: t.Arbitrage,
+		Exchanger: t.Exchanger,
+		Pair:      t.Pair.String(),
+		Disposed:  t.Time,
+	}
+
+	switch t.Side {
+	case exchanger.Buy:
+		l.acquire(t.Pair.Base, t.Volume, value, e)
+		err = l.dispose(t.Pair.Quote, quantity, value, e)
+	case exchanger.Sell:
+		err = l.dispose(t.Pair.Base, t.Volume, value, e)
+		l.acquire(t.Pair.Quote, quantity, value, e)
+	default:
+		err = fmt.Errorf("unknown side `%s`", t.Side)
+	}
+
+	if err != nil {
+		return fmt.Errorf("trade %s: %s", t.ID, err)
+	}
+
+	if t.Fee == 0 {
+		return nil
+	}
+
+	fee := *e
+	fee.Kind = FeeEntry
+	if err := l.dispose(t.FeeCurrency, t.Fee, 0, &fee); err != nil {
+		return fmt.Errorf("trade %s: %s", t.ID, err)
+	}
+
+	return nil
+}
+
+// AddTransfer accounts the fee of a transfer.
+func (l *Ledger) AddTransfer(t *Transfer) error {
+	if t.Fee == 0 {
+		return nil
+	}
+
+	e := &Entry{
+		Kind:      TransferEntry,
+		Ref:       t.ID,
+		Exchanger: t.From,
+		Disposed:  t.Time,
+	}
+
+	if err := l.dispose(t.Currency, t.Fee, 0, e); err != nil {
+		return fmt.Errorf("transfer %s: %s", t.ID, err)
+	}
+	return nil
+}
+
+func (l *Ledger) acquire(cur string, quantity, cost float64, e *Entry) {
+	if cur == l.Currency {
+		return
+	}
+
+	l.lots[cur] = append(l.lots[cur], &Lot{
+		Currency:  cur,
+		Quantity:  quantity,
+		Cost:      cost,
+		Acquired:  e.Disposed,
+		Exchanger: e.Exchanger,
+		Ref:       e.Ref,
+	})
+}
+
+// dispose consumes quantity of cur for proceeds. Disposals of the reporting currency
+// only matter when they have no proceeds (fees).
+func (l *Ledger) dispose(cur string, quantity, proceeds float64, e *Entry) error {
+	if cur == l.Currency {
+		if proceeds == 0 {
+			l.record(e, cur, quantity, e.Disposed, quantity, 0, false)
+		}
+		return nil
+	}
+
+	left := quantity
+	lots := l.lots[cur]
+
+	for len(lots) > 0 && left > epsilon {
+		lot := lots[0]
+		q := lot.Quantity
+		if q > left {
+			q = left
+		}
+
+		cost := lot.Cost * q / lot.Quantity
+		l.record(e, cur, q, lot.Acquired, cost, proceeds*q/quantity, false)
+
+		lot.Quantity -= q
+		lot.Cost -= cost
+		left -= q
+
+		if lot.Quantity <= epsilon {
+			lots = lots[1:]
+		}
+	}
+	l.lots[cur] = lots
+
+	if left > epsilon {
+		rate, err := l.rates.Rate(cur, e.Disposed)
+		if err != nil {
+			return err
+		}
+		l.record(e, cur, left, e.Disposed, left*rate, proceeds*left/quantity, true)
+	}
+
+	return nil
+}
+
+func (l *Ledger) record(e *Entry, cur string, quantity float64, acquired time.Time, cost, proceeds float64, unmatched bool) {
+	entry := *e
+	entry.Currency = cur
+	entry.Quantity = quantity
+	entry.Acquired = acquired
+	entry.Cost = cost
+	entry.Proceeds = proceeds
+	entry.Unmatched = unmatched
+	l.Entries = append(l.Entries, &entry)
+}
+
+// Compute returns the ledger of the trades and transfers, accounted in chronological
+// order.
+func Compute(currency string, rates Rates, trades []*Trade, transfers []*Transfer) (*Ledger, error) {
+	events := events{}
+	for _, t := range trades {
+		events = append(events, event{t.Time, t, nil})
+	}
+	for _, t := range transfers {
+		events = append(events, event{t.Time, nil, t})
+	}
+	sort.Stable(events)
+
+	l := NewLedger(currency, rates)
+	for _, ev := range events {
+		var err error
+		if ev.trade != nil {
+			err = l.AddTrade(ev.trade)
+		} else {
+			err = l.AddTransfer(ev.transfer)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+type event struct {
+	time     time.Time
+	trade    *Trade
+	transfer *Transfer
+}
+
+type events []event
+
+func (e events) Len() int           { return len(e) }
+func (e events) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e events) Less(i, j int) bool { return e[i].time.Before(e[j].time) }
@@ -0,0 +1,150 @@
+package pnl
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+var t0 = time.Date(2017, 7, 17, 10, 0, 0, 0, time.UTC)
+
+func equals(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestArbitrage(t *testing.T) {
+	trades := []*Trade{
+		{ID: "1", Exchanger: "A", Arbitrage: "arb", Pair: exchanger.ZEC_BTC, Side: "buy", Price: 0.01, Volume: 10, Fee: 0.0002, FeeCurrency: "BTC", Time: t0},
+		{ID: "2", Exchanger: "B", Arbitrage: "arb", Pair: exchanger.ZEC_BTC, Side: "sell", Price: 0.012, Volume: 10, Fee: 0.00024, FeeCurrency: "BTC", Time: t0.Add(time.Second)},
+	}
+
+	transfers := []*Transfer{
+		{ID: "t", Currency: "ZEC", From: "B", To: "A", Fee: 0.001, Time: t0.Add(time.Minute)},
+	}
+
+	prices := NewPrices("BTC", time.Hour)
+	prices.AddTrades(trades)
+
+	l, err := Compute("BTC", prices, trades, transfers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arb := Summarize(l.Entries, ByArbitrage, time.Time{}, time.Time{})
+	if len(arb) != 2 || arb[1].Key != "arb" {
+		t.Fatalf("arbitrage and transfer summaries expected, got %d", len(arb))
+	}
+
+	s := arb[1]
+	if !equals(s.Gains, 0.02) || !equals(s.Fees, 0.00044) || !equals(s.Realized, 0.01956) {
+		t.Errorf("unexpected arbitrage summary %+v", s)
+	}
+
+	// the lots are consumed: the transfer fee is valued at the last price
+	transfer := arb[0]
+	if !equals(transfer.Transfers, 0.000012) || transfer.Unmatched != 1 {
+		t.Errorf("unexpected transfer summary %+v", transfer)
+	}
+
+	venues := Summarize(l.Entries, ByExchanger, time.Time{}, time.Time{})
+	if len(venues) != 2 || !equals(venues[0].Realized, -0.0002) || !equals(venues[1].Realized, 0.02-0.00024-0.000012) {
+		t.Errorf("unexpected venue summaries %+v %+v", venues[0], venues[1])
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	prices := NewPrices("BTC", time.Hour)
+	l := NewLedger("BTC", prices)
+
+	for i, price := range []float64{0.01, 0.02} {
+		trade := &Trade{ID: "buy", Pair: exchanger.ZEC_BTC, Side: "buy", Price: price, Volume: 5, Time: t0.Add(time.Duration(i) * time.Hour)}
+		if err := l.AddTrade(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sell := &Trade{ID: "sell", Pair: exchanger.ZEC_BTC, Side: "sell", Price: 0.03, Volume: 7, Time: t0.Add(2 * time.Hour)}
+	if err := l.AddTrade(sell); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.Entries) != 2 {
+		t.Fatalf("the sell should consume 2 lots, got %d entries", len(l.Entries))
+	}
+
+	first, second := l.Entries[0], l.Entries[1]
+	if !equals(first.Quantity, 5) || !equals(first.Cost, 0.05) || !equals(first.Proceeds, 0.15) || !first.Acquired.Equal(t0) {
+		t.Errorf("unexpected first entry %+v", first)
+	}
+	if !equals(second.Quantity, 2) || !equals(second.Cost, 0.04) || !equals(second.Proceeds, 0.06) {
+		t.Errorf("unexpected second entry %+v", second)
+	}
+
+	lots := l.Lots("ZEC")
+	if len(lots) != 1 || !equals(lots[0].Quantity, 3) || !equals(lots[0].Cost, 0.06) {
+		t.Errorf("3 ZEC should be left at a cost of 0.06")
+	}
+}
+
+func TestFeeInBase(t *testing.T) {
+	prices := NewPrices("BTC", time.Hour)
+	l := NewLedger("BTC", prices)
+
+	buy := &Trade{ID: "1", Pair: exchanger.ZEC_BTC, Side: "buy", Price: 0.01, Volume: 10, Fee: 0.02, FeeCurrency: "ZEC", Time: t0}
+	if err := l.AddTrade(buy); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.Entries) != 1 || l.Entries[0].Kind != FeeEntry || !equals(l.Entries[0].Gain(), -0.0002) {
+		t.Fatalf("the fee should be a disposal at cost of 0.0002")
+	}
+
+	if lots := l.Lots("ZEC"); !equals(lots[0].Quantity, 9.98) {
+		t.Errorf("the fee should be taken from the lot, %f left", lots[0].Quantity)
+	}
+}
+
+func TestReportingCurrency(t *testing.T) {
+	prices := NewPrices("EUR", time.Hour)
+	prices.Add(exchanger.ZEC_BTC, 0.01, t0)
+	prices.Add(exchanger.BTC_EUR, 2000, t0.Add(-time.Minute))
+	prices.Add(exchanger.BTC_EUR, 2100, t0.Add(2*time.Hour))
+
+	rate, err := prices.Rate("ZEC", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equals(rate, 20) {
+		t.Errorf("ZEC should be worth 20 EUR, got %f", rate)
+	}
+
+	if _, err := prices.Rate("ZEC", t0.Add(3*time.Hour)); err == nil {
+		t.Errorf("ZEC price is too old")
+	}
+
+	prices = NewPrices("BTC", time.Hour)
+	prices.Add(exchanger.BTC_USD, 2000, t0)
+	if rate, err := prices.Rate("USD", t0); err != nil || !equals(rate, 0.0005) {
+		t.Errorf("USD should be converted with the inverse pair, got %f (%v)", rate, err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	entries := []*Entry{
+		{Kind: TradeEntry, Ref: "2", Currency: "ZEC", Quantity: 1, Cost: 0.01, Proceeds: 0.012, Acquired: t0, Disposed: t0},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteCSV(buf, "BTC", entries); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "gain_BTC") || !strings.Contains(lines[1], "0.00200000") {
+		t.Errorf("unexpected CSV\n%s", buf.String())
+	}
+}
@@ -0,0 +1,150 @@
+package pnl
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// PriceSource looks up recorded prices when no observation is close enough.
+type PriceSource interface {
+	// Price returns the price of pair the closest to t within maxAge. found is false
+	// when there is none.
+	Price(pair exchanger.Pair, t time.Time, maxAge time.Duration) (price float64, at time.Time, found bool, err error)
+}
+
+// Prices implements Rates with price observations of pairs. Currencies are converted
+// directly when a pair with the reporting currency is observed, through BTC otherwise.
+type Prices struct {
+	Currency string
+	// MaxAge is the maximum time between an observation and the time of a conversion.
+	MaxAge time.Duration
+	// Source is queried for the observations missing (optional).
+	Source PriceSource
+
+	observations map[exchanger.Pair]observations
+}
+
+type observation struct {
+	time  time.Time
+	price float64
+}
+
+type observations []observation
+
+func (o observations) Len() int           { return len(o) }
+func (o observations) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o observations) Less(i, j int) bool { return o[i].time.Before(o[j].time) }
+
+func NewPrices(currency string, maxAge time.Duration) *Prices {
+	return &Prices{
+		Currency:     currency,
+		MaxAge:       maxAge,
+		observations: map[exchanger.Pair]observations{},
+	}
+}
+
+// Add records the price of pair at t.
+func (p *Prices) Add(pair exchanger.Pair, price float64, t time.Time) {
+	obs := append(p.observations[pair], observation{t, price})
+
+	// observations are mostly added in order
+	if n := len(obs); n > 1 && obs[n-1].time.Before(obs[n-2].time) {
+		sort.Sort(obs)
+	}
+	p.observations[pair] = obs
+}
+
+// AddTrades records the prices of trades.
+func (p *Prices) AddTrades(trades []*Trade) {
+	for _, t := range trades {
+		p.Add(t.Pair, t.Price, t.Time)
+	}
+}
+
+func (p *Prices) Rate(cur string, t time.Time) (float64, error) {
+	if cur == p.Currency {
+		return 1, nil
+	}
+
+	rate, found, err := p.convert(cur, p.Currency, t)
+	if err != nil || found {
+		return rate, err
+	}
+
+	if cur != "BTC" && p.Currency != "BTC" {
+		toBTC, found, err := p.convert(cur, "BTC", t)
+		if err != nil {
+			return 0, err
+		}
+
+		if found {
+			fromBTC, found, err := p.convert("BTC", p.Currency, t)
+			if err != nil || found {
+				return toBTC * fromBTC, err
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no %s/%s price around %s", cur, p.Currency, t.Format(time.RFC3339))
+}
+
+// convert returns the value of one unit of from in to.
+func (p *Prices) convert(from, to string, t time.Time) (float64, bool, error) {
+	price, found, err := p.price(exchanger.NewPair(from+"_"+to), t)
+	if err != nil || found {
+		return price, found, err
+	}
+
+	price, found, err = p.price(exchanger.NewPair(to+"_"+from), t)
+	if err != nil || !found || price == 0 {
+		return 0, false, err
+	}
+	return 1 / price, true, nil
+}
+
+func (p *Prices) price(pair exchanger.Pair, t time.Time) (float64, bool, error) {
+	if price, found := p.closest(pair, t); found {
+		return price, true, nil
+	}
+
+	if p.Source == nil {
+		return 0, false, nil
+	}
+
+	price, at, found, err := p.Source.Price(pair, t, p.MaxAge)
+	if err != nil || !found {
+		return 0, false, err
+	}
+
+	p.Add(pair, price, at)
+	return price, true, nil
+}
+
+// closest returns the observation the closest to t within MaxAge.
+func (p *Prices) closest(pair exchanger.Pair, t time.Time) (float64, bool) {
+	obs := p.observations[pair]
+	i := sort.Search(len(obs), func(i int) bool { return !obs[i].time.Before(t) })
+
+	best, found := time.Duration(0), false
+	var price float64
+
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(obs) {
+			continue
+		}
+
+		d := obs[j].time.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+
+		if d <= p.MaxAge && (!found || d < best) {
+			best, found, price = d, true, obs[j].price
+		}
+	}
+
+	return price, found
+}
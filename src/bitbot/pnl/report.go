@@ -0,0 +1,125 @@
+package pnl
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Summary aggregates the entries sharing a key.
+type Summary struct {
+	Key string
+	// Gains is the result of the trades, before fees.
+	Gains float64
+	// Fees are the trading fees and Transfers the transfer fees.
+	Fees      float64
+	Transfers float64
+	// Realized is Gains minus the fees.
+	Realized float64
+	// Unmatched counts the entries without cost basis.
+	Unmatched int
+}
+
+// KeyFunc returns the key an entry is aggregated under.
+type KeyFunc func(*Entry) string
+
+// Summary keys.
+var (
+	ByArbitrage KeyFunc = func(e *Entry) string { return e.Arbitrage }
+	ByDay       KeyFunc = func(e *Entry) string { return e.Disposed.UTC().Format("2006-01-02") }
+	ByExchanger KeyFunc = func(e *Entry) string { return e.Exchanger }
+	ByPair      KeyFunc = func(e *Entry) string { return e.Pair }
+)
+
+// Summarize aggregates the entries disposed within [from, to) by key. A zero time
+// leaves its side of the range open. Summaries are sorted by key.
+func Summarize(entries []*Entry, key KeyFunc, from, to time.Time) []*Summary {
+	summaries := map[string]*Summary{}
+	keys := []string{}
+
+	for _, e := range Filter(entries, from, to) {
+		k := key(e)
+		s, ok := summaries[k]
+		if !ok {
+			s = &Summary{Key: k}
+			summaries[k] = s
+			keys = append(keys, k)
+		}
+
+		switch e.Kind {
+		case TradeEntry:
+			s.Gains += e.Gain()
+		case FeeEntry:
+			s.Fees -= e.Gain()
+		case TransferEntry:
+			s.Transfers -= e.Gain()
+		}
+
+		s.Realized += e.Gain()
+		if e.Unmatched {
+			s.Unmatched++
+		}
+	}
+
+	sort.Strings(keys)
+	out := []*Summary{}
+	for _, k := range keys {
+		out = append(out, summaries[k])
+	}
+	return out
+}
+
+// Filter returns the entries disposed within [from, to).
+func Filter(entries []*Entry, from, to time.Time) []*Entry {
+	out := []*Entry{}
+	for _, e := range entries {
+		if !from.IsZero() && e.Disposed.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.Disposed.Before(to) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// WriteCSV exports the entries, one line per disposal.
+func WriteCSV(w io.Writer, currency string, entries []*Entry) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{
+		"disposed", "acquired", "kind", "currency", "quantity",
+		"cost_" + currency, "proceeds_" + currency, "gain_" + currency,
+		"exchanger", "pair", "arbitrage", "ref", "unmatched",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		record := []string{
+			e.Disposed.UTC().Format(time.RFC3339),
+			e.Acquired.UTC().Format(time.RFC3339),
+			e.Kind,
+			e.Currency,
+			fmt.Sprintf("%.8f", e.Quantity),
+			fmt.Sprintf("%.8f", e.Cost),
+			fmt.Sprintf("%.8f", e.Proceeds),
+			fmt.Sprintf("%.8f", e.Gain()),
+			e.Exchanger,
+			e.Pair,
+			e.Arbitrage,
+			e.Ref,
+			fmt.Sprint(e.Unmatched),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
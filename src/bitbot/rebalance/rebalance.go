@@ -0,0 +1,371 @@
+/*
+Package rebalance plans the fund movements needed to restore target allocations of a
+currency across exchangers.
+
+Each venue declares a target share of the total balance and the costs of moving funds
+out of it: a fixed withdrawal fee, a minimum withdrawal amount and a confirmation time.
+A venue can also be topped up by trading the counter currency on the venue itself. The
+Planner searches the cheapest combination of transfers and trades and returns a Plan
+that can be reviewed before it is executed.
+*/
+package rebalance
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Step kinds.
+const (
+	Transfer = "transfer"
+	Trade    = "trade"
+)
+
+// Venue describes the balance of one exchanger for a currency and what it costs to
+// move funds out of it.
+type Venue struct {
+	Name    string
+	Balance float64
+	// Target is the share of the total balance the venue should hold. When no venue has
+	// a target the total is split equally.
+	Target float64
+	// WithdrawFee is the fixed fee charged on each withdrawal (in the currency).
+	WithdrawFee float64
+	// MinWithdraw is the minimum amount of a withdrawal.
+	MinWithdraw float64
+	// Confirmation is the time needed for a withdrawal to be credited.
+	Confirmation time.Duration
+	// TradeFee is the cost rate of buying the currency on the venue (fees and spread).
+	TradeFee float64
+	// Tradable is the amount of currency that can be bought on the venue with the
+	// counter currency. Zero disables on-venue rebalancing.
+	Tradable float64
+}
+
+// Step is a transfer between two venues or a trade on a venue (From == To).
+type Step struct {
+	Kind string
+	From string
+	To   string
+	// Amount is debited from From.
+	Amount float64
+	// Received is credited to To.
+	Received     float64
+	Cost         float64
+	Confirmation time.Duration
+}
+
+func (s *Step) String() string {
+	if s.Kind == Trade {
+		return fmt.Sprintf("trade    %-16s buy %f (cost %f)", s.To, s.Received, s.Cost)
+	}
+	return fmt.Sprintf("transfer %-16s -> %-16s send %f receive %f (cost %f, %s)",
+		s.From, s.To, s.Amount, s.Received, s.Cost, s.Confirmation)
+}
+
+// Plan is the outcome of the planner.
+type Plan struct {
+	Currency string
+	Total    float64
+	Steps    []*Step
+	Cost     float64
+	// Before and After are the balances before and after the plan is executed.
+	Before map[string]float64
+	After  map[string]float64
+	// Targets are the target balances.
+	Targets map[string]float64
+	// Unresolved lists the venues that can't be brought back to their target.
+	Unresolved []string
+}
+
+// Empty reports whether the plan has nothing to execute.
+func (p *Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// String formats the plan for review.
+func (p *Plan) String() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Rebalancing plan for %s (total %f, cost %f)\n", p.Currency, p.Total, p.Cost)
+
+	names := []string{}
+	for name := range p.Before {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(buf, "  %-16s %f -> %f (target %f)\n", name, p.Before[name], p.After[name], p.Targets[name])
+	}
+
+	for _, s := range p.Steps {
+		fmt.Fprintf(buf, "  %s\n", s)
+	}
+
+	for _, name := range p.Unresolved {
+		fmt.Fprintf(buf, "  unresolved: %s\n", name)
+	}
+
+	return buf.String()
+}
+
+// Planner computes rebalancing plans.
+type Planner struct {
+	// Threshold is the share of the total below which a venue is rebalanced, whatever
+	// the number of venues: 0.05 rebalances a venue holding less than 5% of the funds.
+	// Venues whose target is lower are rebalanced below their target.
+	Threshold float64
+	// TimeCost is the cost of immobilizing one unit of currency for one hour.
+	TimeCost float64
+}
+
+type deficit struct {
+	venue *Venue
+	// need brings the venue back to its target, min brings it back above the threshold.
+	need float64
+	min  float64
+}
+
+// Plan returns the cheapest plan restoring the targets of the venues below Threshold.
+// Venues in surplus are drawn down to their target at most. When the target can't be
+// fully restored, bringing the venue back above the threshold is enough.
+func (p *Planner) Plan(cur string, venues []*Venue) (*Plan, error) {
+	if len(venues) == 0 {
+		return nil, fmt.Errorf("rebalance: no venue for %s", cur)
+	}
+
+	plan := &Plan{
+		Currency: cur,
+		Before:   map[string]float64{},
+		After:    map[string]float64{},
+		Targets:  map[string]float64{},
+	}
+
+	var totalWeight float64
+	for _, v := range venues {
+		plan.Total += v.Balance
+		totalWeight += v.Target
+	}
+
+	if plan.Total <= 0 {
+		return nil, fmt.Errorf("rebalance: no %s balance", cur)
+	}
+
+	surplus := map[string]float64{}
+	deficits := []*deficit{}
+
+	for _, v := range venues {
+		weight := 1 / float64(len(venues))
+		if totalWeight > 0 {
+			weight = v.Target / totalWeight
+		}
+
+		target := weight * plan.Total
+		plan.Targets[v.Name] = target
+		plan.Before[v.Name] = v.Balance
+
+		floor := math.Min(p.Threshold, weight)
+		if v.Balance/plan.Total < floor {
+			deficits = append(deficits, &deficit{v, target - v.Balance, floor*plan.Total - v.Balance})
+		} else if v.Balance > target {
+			surplus[v.Name] = v.Balance - target
+		}
+	}
+
+	// largest needs first: they constrain the search the most.
+	sort.Sort(byNeed(deficits))
+
+	s := &search{planner: p, venues: venues, best: math.Inf(1)}
+	s.run(deficits, surplus, nil, 0, nil)
+
+	plan.Steps = s.bestSteps
+	plan.Unresolved = s.bestUnresolved
+	if !math.IsInf(s.best, 1) {
+		plan.Cost = s.best
+	}
+
+	for _, v := range venues {
+		plan.After[v.Name] = v.Balance
+	}
+	for _, step := range plan.Steps {
+		if step.Kind == Transfer {
+			plan.After[step.From] -= step.Amount
+		}
+		plan.After[step.To] += step.Received
+	}
+
+	return plan, nil
+}
+
+type byNeed []*deficit
+
+func (d byNeed) Len() int           { return len(d) }
+func (d byNeed) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byNeed) Less(i, j int) bool { return d[i].need > d[j].need }
+
+// search is an exhaustive branch and bound search. Each deficit is covered either by a
+// trade on the venue, by a single transfer or by transfers split across the cheapest
+// sources. A deficit no option can cover is left unresolved.
+type search struct {
+	planner *Planner
+	venues  []*Venue
+
+	best           float64
+	bestSteps      []*Step
+	bestUnresolved []string
+	bestMissing    int
+	bestReceived   float64
+}
+
+func (s *search) run(deficits []*deficit, surplus map[string]float64, steps []*Step, cost float64, unresolved []string) {
+	// plans leaving fewer venues unresolved always win over cheaper ones.
+	if !math.IsInf(s.best, 1) {
+		if len(unresolved) > s.bestMissing || len(unresolved) == s.bestMissing && cost > s.best {
+			return
+		}
+	}
+
+	if len(deficits) == 0 {
+		// among plans of the same cost, the one delivering the most wins: a transfer
+		// only restoring the threshold costs as much as a complete one.
+		var received float64
+		for _, step := range steps {
+			received += step.Received
+		}
+
+		if !math.IsInf(s.best, 1) && len(unresolved) == s.bestMissing && cost == s.best && received <= s.bestReceived {
+			return
+		}
+
+		s.best = cost
+		s.bestSteps = append([]*Step{}, steps...)
+		s.bestUnresolved = append([]string{}, unresolved...)
+		s.bestMissing = len(unresolved)
+		s.bestReceived = received
+		return
+	}
+
+	d := deficits[0]
+	rest := deficits[1:]
+	found := false
+
+	for _, option := range s.options(d, surplus) {
+		found = true
+		next := copySurplus(surplus)
+		var c float64
+		for _, step := range option {
+			if step.Kind == Transfer {
+				next[step.From] -= step.Amount
+			}
+			c += step.Cost
+		}
+		s.run(rest, next, append(steps, option...), cost+c, unresolved)
+	}
+
+	if !found {
+		s.run(rest, surplus, steps, cost, append(unresolved, d.venue.Name))
+	}
+}
+
+// options returns the candidate step sets covering d.
+func (s *search) options(d *deficit, surplus map[string]float64) [][]*Step {
+	options := [][]*Step{}
+
+	if amount := math.Min(d.need, d.venue.Tradable); amount >= d.min && amount > 0 {
+		options = append(options, []*Step{{
+			Kind:     Trade,
+			From:     d.venue.Name,
+			To:       d.venue.Name,
+			Amount:   amount,
+			Received: amount,
+			Cost:     amount * d.venue.TradeFee,
+		}})
+	}
+
+	sources := []*Venue{}
+	for _, v := range s.venues {
+		if surplus[v.Name] > 0 && v.Name != d.venue.Name {
+			sources = append(sources, v)
+		}
+	}
+
+	for _, v := range sources {
+		if step := s.transfer(v, d.venue, d.need, surplus[v.Name]); step != nil && step.Received >= d.min {
+			options = append(options, []*Step{step})
+		}
+	}
+
+	// split across the cheapest sources
+	sort.Sort(&byUnitCost{sources, s.planner})
+	split := []*Step{}
+	remaining := d.need
+	for _, v := range sources {
+		if remaining <= 0 {
+			break
+		}
+		step := s.transfer(v, d.venue, remaining, surplus[v.Name])
+		if step == nil {
+			continue
+		}
+		split = append(split, step)
+		remaining -= step.Received
+	}
+	if len(split) > 1 && d.need-remaining >= d.min {
+		options = append(options, split)
+	}
+
+	return options
+}
+
+// transfer returns the transfer delivering up to `need` from src to dest without taking
+// more than `available` from src, or nil when the minimum withdrawal can't be met.
+func (s *search) transfer(src, dest *Venue, need, available float64) *Step {
+	amount := math.Min(need+src.WithdrawFee, available)
+	if amount < src.MinWithdraw {
+		if src.MinWithdraw > available {
+			return nil
+		}
+		amount = src.MinWithdraw
+	}
+
+	received := amount - src.WithdrawFee
+	if received <= 0 {
+		return nil
+	}
+
+	return &Step{
+		Kind:         Transfer,
+		From:         src.Name,
+		To:           dest.Name,
+		Amount:       amount,
+		Received:     received,
+		Cost:         src.WithdrawFee + s.planner.TimeCost*amount*src.Confirmation.Hours(),
+		Confirmation: src.Confirmation,
+	}
+}
+
+type byUnitCost struct {
+	venues  []*Venue
+	planner *Planner
+}
+
+func (b *byUnitCost) Len() int      { return len(b.venues) }
+func (b *byUnitCost) Swap(i, j int) { b.venues[i], b.venues[j] = b.venues[j], b.venues[i] }
+func (b *byUnitCost) Less(i, j int) bool {
+	return b.unitCost(b.venues[i]) < b.unitCost(b.venues[j])
+}
+
+func (b *byUnitCost) unitCost(v *Venue) float64 {
+	return v.WithdrawFee + b.planner.TimeCost*v.Confirmation.Hours()
+}
+
+func copySurplus(m map[string]float64) map[string]float64 {
+	out := map[string]float64{}
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package rebalance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanSplit(t *testing.T) {
+	venues := []*Venue{
+		{Name: "A", Balance: 1},
+		{Name: "B", Balance: 20, WithdrawFee: 0.5},
+		{Name: "C", Balance: 19, WithdrawFee: 0.01, Confirmation: time.Hour},
+	}
+
+	p := &Planner{Threshold: 0.3, TimeCost: 0.001}
+	plan, err := p.Plan("ZEC", venues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no single venue can cover A: the cheapest source (C) comes first
+	if len(plan.Steps) != 2 || plan.Steps[0].From != "C" || plan.Steps[1].From != "B" {
+		t.Fatalf("transfers from C and B expected\n%s", plan)
+	}
+
+	for _, name := range []string{"B", "C"} {
+		if plan.After[name] < plan.Targets[name]-1e-9 {
+			t.Errorf("%s is drawn below its target\n%s", name, plan)
+		}
+	}
+
+	if plan.After["A"]/plan.Total < p.Threshold {
+		t.Errorf("A should be back above the threshold\n%s", plan)
+	}
+
+	if expected := 0.5 + 0.01 + 0.001*(19-40.0/3); plan.Cost < expected-1e-9 || plan.Cost > expected+1e-9 {
+		t.Errorf("cost should be %f, got %f", expected, plan.Cost)
+	}
+}
+
+func TestPlanPrefersTrade(t *testing.T) {
+	venues := []*Venue{
+		{Name: "A", Balance: 0, Target: 1, TradeFee: 0.001, Tradable: 100},
+		{Name: "B", Balance: 10, Target: 1, WithdrawFee: 0.1},
+	}
+
+	plan, err := (&Planner{Threshold: 0.05}).Plan("BTC", venues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Steps) != 1 || plan.Steps[0].Kind != Trade {
+		t.Fatalf("a trade on A is cheaper than the transfer\n%s", plan)
+	}
+}
+
+func TestPlanMinWithdraw(t *testing.T) {
+	venues := []*Venue{
+		{Name: "A", Balance: 1, Target: 3},
+		{Name: "B", Balance: 9, Target: 7, MinWithdraw: 5},
+	}
+
+	plan, err := (&Planner{Threshold: 0.2}).Plan("BTC", venues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Steps) != 0 || len(plan.Unresolved) != 1 {
+		t.Errorf("B can't withdraw less than 5 without going below its target\n%s", plan)
+	}
+}
+
+func TestPlanAboveThreshold(t *testing.T) {
+	venues := []*Venue{
+		{Name: "A", Balance: 9},
+		{Name: "B", Balance: 11},
+	}
+
+	plan, err := (&Planner{Threshold: 0.05}).Plan("BTC", venues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		t.Errorf("nothing should be moved\n%s", plan)
+	}
+}
+
+func TestPlanThresholdIgnoresVenueCount(t *testing.T) {
+	// 4 venues: each targets 25%, A holds 10%
+	venues := []*Venue{
+		{Name: "A", Balance: 10},
+		{Name: "B", Balance: 30},
+		{Name: "C", Balance: 30},
+		{Name: "D", Balance: 30},
+	}
+
+	plan, err := (&Planner{Threshold: 0.05}).Plan("BTC", venues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		t.Errorf("A holds more than 5%%, nothing should be moved\n%s", plan)
+	}
+
+	venues[0].Balance = 4
+	plan, err = (&Planner{Threshold: 0.05}).Plan("BTC", venues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Empty() {
+		t.Errorf("A holds less than 5%%, it should be rebalanced\n%s", plan)
+	}
+}
+
+func TestPlanCompleteTransfer(t *testing.T) {
+	// C can restore the threshold of A for free, but only B can bring A to its target
+	venues := []*Venue{
+		{Name: "A", Balance: 1},
+		{Name: "B", Balance: 19},
+		{Name: "C", Balance: 11},
+		{Name: "D", Balance: 9},
+	}
+
+	for i := 0; i < 10; i++ {
+		// the order of the venues doesn't matter
+		venues[1], venues[2] = venues[2], venues[1]
+
+		plan, err := (&Planner{Threshold: 0.05}).Plan("BTC", venues)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.After["A"] != 10 {
+			t.Fatalf("A should get back to its target of 10, got %f (%v)", plan.After["A"], plan.Steps)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Package reconcile explains the balance changes between two snapshots with the movements
+recorded in between: trades, trading fees, deposits and withdrawals.
+
+Differences left unexplained beyond a tolerance raise alerts, and so do funds staying in
+holding accounts that they should only transit through (the Hitbtc main account, when
+the transfer back to the trading account failed after a withdrawal).
+*/
+package reconcile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Movement kinds.
+const (
+	Trade      = "trade"
+	Fee        = "fee"
+	Deposit    = "deposit"
+	Withdrawal = "withdrawal"
+)
+
+// Alert kinds.
+const (
+	Unexplained = "unexplained"
+	Stuck       = "stuck"
+)
+
+// Balance is the balance of a currency on an account.
+type Balance struct {
+	Exchanger string
+	Account   string
+	Currency  string
+	Amount    float64
+}
+
+// Snapshot holds the balances of all the accounts at a time.
+type Snapshot struct {
+	Time     time.Time
+	Balances []*Balance
+}
+
+// Movement is a balance change recorded by the bot.
+type Movement struct {
+	Kind      string
+	Ref       string
+	Exchanger string
+	Currency  string
+	// Amount is positive when credited.
+	Amount float64
+	Time   time.Time
+}
+
+// TradeMovements returns the movements of a trade: both legs and the fee.
+func TradeMovements(ex, ref string, pair exchanger.Pair, side string, price, volume, fee float64, feeCurrency string, t time.Time) []*Movement {
+	sign := 1.0
+	if side == exchanger.Sell {
+		sign = -1
+	}
+
+	movements := []*Movement{
+		{Trade, ref, ex, pair.Base, sign * volume, t},
+		{Trade, ref, ex, pair.Quote, -sign * volume * price, t},
+	}
+
+	if fee != 0 {
+		movements = append(movements, &Movement{Fee, ref, ex, feeCurrency, -fee, t})
+	}
+	return movements
+}
+
+// Difference is the change of the balance of a currency on an exchanger (all accounts).
+type Difference struct {
+	Exchanger string
+	Currency  string
+	Before    float64
+	After     float64
+	// Explained is the sum of the movements.
+	Explained float64
+	Movements []*Movement
+}
+
+// Unexplained is the part of the change not explained by the movements.
+func (d *Difference) Unexplained() float64 {
+	return d.After - d.Before - d.Explained
+}
+
+type Alert struct {
+	Kind      string
+	Exchanger string
+	Currency  string
+	Message   string
+}
+
+// Report is the outcome of a reconciliation.
+type Report struct {
+	From        time.Time
+	To          time.Time
+	Differences []*Difference
+	Alerts      []*Alert
+}
+
+// Reconciler compares snapshots.
+type Reconciler struct {
+	// Tolerance maps currencies to the absolute difference tolerated.
+	Tolerance map[string]float64
+	// DefaultTolerance applies to the other currencies.
+	DefaultTolerance float64
+	// HoldingAccounts are the accounts that shouldn't hold funds for long.
+	HoldingAccounts []string
+}
+
+func (r *Reconciler) tolerance(cur string) float64 {
+	if tol, ok := r.Tolerance[cur]; ok {
+		return tol
+	}
+	return r.DefaultTolerance
+}
+
+// Reconcile explains the differences between before and after with the movements that
+// happened in between. Only the exchangers of the snapshots are reconciled.
+func (r *Reconciler) Reconcile(before, after *Snapshot, movements []*Movement) *Report {
+	report := &Report{From: before.Time, To: after.Time, Differences: []*Difference{}, Alerts: []*Alert{}}
+
+	exchangers := map[string]bool{}
+	diffs := map[string]*Difference{}
+
+	diff := func(ex, cur string) *Difference {
+		key := ex + "/" + cur
+		d, ok := diffs[key]
+		if !ok {
+			d = &Difference{Exchanger: ex, Currency: cur, Movements: []*Movement{}}
+			diffs[key] = d
+			report.Differences = append(report.Differences, d)
+		}
+		return d
+	}
+
+	for _, b := range before.Balances {
+		exchangers[b.Exchanger] = true
+		diff(b.Exchanger, b.Currency).Before += b.Amount
+	}
+
+	for _, b := range after.Balances {
+		exchangers[b.Exchanger] = true
+		diff(b.Exchanger, b.Currency).After += b.Amount
+	}
+
+	for _, m := range movements {
+		if !exchangers[m.Exchanger] || !m.Time.After(before.Time) || m.Time.After(after.Time) {
+			continue
+		}
+
+		d := diff(m.Exchanger, m.Currency)
+		d.Explained += m.Amount
+		d.Movements = append(d.Movements, m)
+	}
+
+	sort.Sort(byVenue(report.Differences))
+
+	for _, d := range report.Differences {
+		if u := d.Unexplained(); math.Abs(u) > r.tolerance(d.Currency) {
+			msg := fmt.Sprintf("unexplained %+f %s on %s (from %f to %f, %f explained by %d movements)",
+				u, d.Currency, d.Exchanger, d.Before, d.After, d.Explained, len(d.Movements))
+			report.Alerts = append(report.Alerts, &Alert{Unexplained, d.Exchanger, d.Currency, msg})
+		}
+	}
+
+	report.Alerts = append(report.Alerts, r.stuck(before, after)...)
+	return report
+}
+
+// stuck reports the funds that were already held by a holding account in the previous
+// snapshot: funds in transit are only seen by one snapshot.
+func (r *Reconciler) stuck(before, after *Snapshot) []*Alert {
+	holding := map[string]bool{}
+	for _, account := range r.HoldingAccounts {
+		holding[account] = true
+	}
+
+	held := map[string]bool{}
+	for _, b := range before.Balances {
+		if holding[b.Account] && b.Amount > r.tolerance(b.Currency) {
+			held[b.Exchanger+"/"+b.Account+"/"+b.Currency] = true
+		}
+	}
+
+	alerts := []*Alert{}
+	for _, b := range after.Balances {
+		if !held[b.Exchanger+"/"+b.Account+"/"+b.Currency] || b.Amount <= r.tolerance(b.Currency) {
+			continue
+		}
+
+		msg := fmt.Sprintf("%f %s stuck in the %s account of %s since %s",
+			b.Amount, b.Currency, b.Account, b.Exchanger, before.Time.Format(time.RFC3339))
+		alerts = append(alerts, &Alert{Stuck, b.Exchanger, b.Currency, msg})
+	}
+
+	return alerts
+}
+
+type byVenue []*Difference
+
+func (d byVenue) Len() int      { return len(d) }
+func (d byVenue) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byVenue) Less(i, j int) bool {
+	if d[i].Exchanger != d[j].Exchanger {
+		return d[i].Exchanger < d[j].Exchanger
+	}
+	return d[i].Currency < d[j].Currency
+}
@@ -0,0 +1,77 @@
+package reconcile
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+var t0 = time.Date(2017, 7, 17, 10, 0, 0, 0, time.UTC)
+
+func TestReconcile(t *testing.T) {
+	before := &Snapshot{t0, []*Balance{
+		{"A", "trading", "BTC", 1},
+		{"A", "trading", "ZEC", 0},
+		{"B", "trading", "BTC", 1},
+		{"B", "trading", "ZEC", 20},
+	}}
+
+	after := &Snapshot{t0.Add(time.Hour), []*Balance{
+		{"A", "trading", "BTC", 0.8998},
+		{"A", "trading", "ZEC", 10},
+		{"B", "trading", "BTC", 1.12},
+		{"B", "trading", "ZEC", 9},
+	}}
+
+	movements := TradeMovements("A", "1", exchanger.ZEC_BTC, "buy", 0.01, 10, 0.0002, "BTC", t0.Add(time.Minute))
+	movements = append(movements, TradeMovements("B", "2", exchanger.ZEC_BTC, "sell", 0.012, 10, 0, "BTC", t0.Add(time.Minute))...)
+
+	// out of range
+	movements = append(movements, &Movement{Deposit, "3", "A", "BTC", 5, t0.Add(2 * time.Hour)})
+
+	r := &Reconciler{DefaultTolerance: 1e-8}
+	report := r.Reconcile(before, after, movements)
+
+	if len(report.Differences) != 4 {
+		t.Fatalf("4 differences expected, got %d", len(report.Differences))
+	}
+
+	// 1 ZEC is missing on B
+	if len(report.Alerts) != 1 || report.Alerts[0].Exchanger != "B" || report.Alerts[0].Currency != "ZEC" {
+		t.Fatalf("one alert expected for B ZEC, got %v", report.Alerts)
+	}
+
+	d := report.Differences[3]
+	if math.Abs(d.Unexplained()+1) > 1e-9 || len(d.Movements) != 1 {
+		t.Errorf("-1 ZEC should be unexplained, got %f", d.Unexplained())
+	}
+
+	r.Tolerance = map[string]float64{"ZEC": 1}
+	if report := r.Reconcile(before, after, movements); len(report.Alerts) != 0 {
+		t.Errorf("the difference is within tolerance: %s", report.Alerts[0].Message)
+	}
+}
+
+func TestStuck(t *testing.T) {
+	r := &Reconciler{DefaultTolerance: 1e-8, HoldingAccounts: []string{"main"}}
+
+	snapshots := []*Snapshot{
+		{t0, []*Balance{{"Hitbtc", "trading", "ZEC", 10}}},
+		// withdrawal in progress
+		{t0.Add(time.Hour), []*Balance{{"Hitbtc", "main", "ZEC", 10}}},
+		// the transfer back to the trading account failed
+		{t0.Add(2 * time.Hour), []*Balance{{"Hitbtc", "main", "ZEC", 10}}},
+	}
+
+	movements := []*Movement{}
+	if report := r.Reconcile(snapshots[0], snapshots[1], movements); len(report.Alerts) != 0 {
+		t.Errorf("funds in transit shouldn't raise alerts: %s", report.Alerts[0].Message)
+	}
+
+	report := r.Reconcile(snapshots[1], snapshots[2], movements)
+	if len(report.Alerts) != 1 || report.Alerts[0].Kind != Stuck {
+		t.Errorf("stuck funds should raise an alert, got %v", report.Alerts)
+	}
+}
@@ -0,0 +1,304 @@
+package retention
+
+import (
+	"sort"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+// DepthBands are the distances to the mid price, in percent, within which the depth of
+// the books is aggregated.
+var DepthBands = []float64{0.5, 1, 2, 5}
+
+// BookAggregate summarizes the books of an exchanger over a period.
+type BookAggregate struct {
+	Exchanger  string
+	Pair       exchanger.Pair
+	Start      time.Time
+	Resolution time.Duration
+	Samples    int
+	// Bid and Ask are the best prices.
+	Bid OHLC
+	Ask OHLC
+	// Mid is the average mid price.
+	Mid float64
+	// Spreads are relative to the mid price, in percent.
+	SpreadAvg float64
+	SpreadMin float64
+	SpreadMax float64
+	// BidDepth and AskDepth are the average volumes within each of the DepthBands.
+	BidDepth []float64
+	AskDepth []float64
+}
+
+func (a *BookAggregate) add(b *storage.Book) {
+	first := a.Samples == 0
+	bid, ask := b.Bids[0].Price, b.Asks[0].Price
+	mid := (bid + ask) / 2
+	spread := 100 * (ask - bid) / mid
+
+	a.Bid.add(bid, first)
+	a.Ask.add(ask, first)
+	a.Mid = weighted(a.Mid, a.Samples, mid, 1)
+	a.SpreadAvg = weighted(a.SpreadAvg, a.Samples, spread, 1)
+	if first || spread < a.SpreadMin {
+		a.SpreadMin = spread
+	}
+	if first || spread > a.SpreadMax {
+		a.SpreadMax = spread
+	}
+
+	if first {
+		a.BidDepth = make([]float64, len(DepthBands))
+		a.AskDepth = make([]float64, len(DepthBands))
+	}
+
+	for i, band := range DepthBands {
+		var bidVol, askVol float64
+		for _, o := range b.Bids {
+			if o.Price >= mid*(1-band/100) {
+				bidVol += o.Volume
+			}
+		}
+		for _, o := range b.Asks {
+			if o.Price <= mid*(1+band/100) {
+				askVol += o.Volume
+			}
+		}
+
+		a.BidDepth[i] = weighted(a.BidDepth[i], a.Samples, bidVol, 1)
+		a.AskDepth[i] = weighted(a.AskDepth[i], a.Samples, askVol, 1)
+	}
+
+	a.Samples++
+}
+
+func (a *BookAggregate) merge(n *BookAggregate) {
+	first := a.Samples == 0
+
+	a.Bid.merge(n.Bid, first)
+	a.Ask.merge(n.Ask, first)
+	a.Mid = weighted(a.Mid, a.Samples, n.Mid, n.Samples)
+	a.SpreadAvg = weighted(a.SpreadAvg, a.Samples, n.SpreadAvg, n.Samples)
+	if first || n.SpreadMin < a.SpreadMin {
+		a.SpreadMin = n.SpreadMin
+	}
+	if first || n.SpreadMax > a.SpreadMax {
+		a.SpreadMax = n.SpreadMax
+	}
+
+	if first {
+		a.BidDepth = make([]float64, len(n.BidDepth))
+		a.AskDepth = make([]float64, len(n.AskDepth))
+	}
+	for i := range a.BidDepth {
+		a.BidDepth[i] = weighted(a.BidDepth[i], a.Samples, n.BidDepth[i], n.Samples)
+		a.AskDepth[i] = weighted(a.AskDepth[i], a.Samples, n.AskDepth[i], n.Samples)
+	}
+
+	a.Samples += n.Samples
+}
+
+// AggregateBooks aggregates books by exchanger, pair and period of width resolution.
+// Books with an empty side are skipped.
+func AggregateBooks(books []*storage.Book, resolution time.Duration) []*BookAggregate {
+	sorted := make([]*storage.Book, len(books))
+	copy(sorted, books)
+	sort.Stable(booksByTime(sorted))
+
+	index := map[string]*BookAggregate{}
+	aggs := []*BookAggregate{}
+
+	for _, b := range sorted {
+		if len(b.Bids) == 0 || len(b.Asks) == 0 {
+			continue
+		}
+
+		start := bucket(b.Time, resolution)
+		k := b.Exchanger + "/" + b.Pair.String() + "/" + start.String()
+
+		a, ok := index[k]
+		if !ok {
+			a = &BookAggregate{Exchanger: b.Exchanger, Pair: b.Pair, Start: start, Resolution: resolution}
+			index[k] = a
+			aggs = append(aggs, a)
+		}
+		a.add(b)
+	}
+
+	sort.Stable(bookAggregatesByStart(aggs))
+	return aggs
+}
+
+// MergeBooks downsamples aggregates to a coarser resolution.
+func MergeBooks(aggs []*BookAggregate, resolution time.Duration) []*BookAggregate {
+	sorted := make([]*BookAggregate, len(aggs))
+	copy(sorted, aggs)
+	sort.Stable(bookAggregatesByStart(sorted))
+
+	index := map[string]*BookAggregate{}
+	merged := []*BookAggregate{}
+
+	for _, n := range sorted {
+		start := bucket(n.Start, resolution)
+		k := n.Exchanger + "/" + n.Pair.String() + "/" + start.String()
+
+		a, ok := index[k]
+		if !ok {
+			a = &BookAggregate{Exchanger: n.Exchanger, Pair: n.Pair, Start: start, Resolution: resolution}
+			index[k] = a
+			merged = append(merged, a)
+		}
+		a.merge(n)
+	}
+
+	return merged
+}
+
+type booksByTime []*storage.Book
+
+func (s booksByTime) Len() int           { return len(s) }
+func (s booksByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s booksByTime) Less(i, j int) bool { return s[i].Time.Before(s[j].Time) }
+
+type bookAggregatesByStart []*BookAggregate
+
+func (s bookAggregatesByStart) Len() int           { return len(s) }
+func (s bookAggregatesByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bookAggregatesByStart) Less(i, j int) bool { return s[i].Start.Before(s[j].Start) }
+
+// SummaryAggregate summarizes the Bittrex summaries of a market over a period.
+type SummaryAggregate struct {
+	MarketName string
+	Start      time.Time
+	Resolution time.Duration
+	Samples    int
+	Last       OHLC
+	// Bid, Ask, Volume and BaseVolume are the ones of the last summary of the period.
+	Bid        float64
+	Ask        float64
+	Volume     float64
+	BaseVolume float64
+}
+
+func (a *SummaryAggregate) merge(n *SummaryAggregate) {
+	a.Last.merge(n.Last, a.Samples == 0)
+	a.Bid, a.Ask, a.Volume, a.BaseVolume = n.Bid, n.Ask, n.Volume, n.BaseVolume
+	a.Samples += n.Samples
+}
+
+// AggregateSummaries aggregates summaries by market and period of width resolution.
+func AggregateSummaries(summaries []*storage.MarketSummary, resolution time.Duration) []*SummaryAggregate {
+	aggs := make([]*SummaryAggregate, len(summaries))
+	for i, m := range summaries {
+		aggs[i] = &SummaryAggregate{
+			MarketName: m.MarketName,
+			Start:      m.Time,
+			Samples:    1,
+			Last:       OHLC{m.Last, m.Last, m.Last, m.Last},
+			Bid:        m.Bid,
+			Ask:        m.Ask,
+			Volume:     m.Volume,
+			BaseVolume: m.BaseVolume,
+		}
+	}
+	return MergeSummaries(aggs, resolution)
+}
+
+// MergeSummaries downsamples aggregates to a coarser resolution.
+func MergeSummaries(aggs []*SummaryAggregate, resolution time.Duration) []*SummaryAggregate {
+	sorted := make([]*SummaryAggregate, len(aggs))
+	copy(sorted, aggs)
+	sort.Stable(summaryAggregatesByStart(sorted))
+
+	index := map[string]*SummaryAggregate{}
+	merged := []*SummaryAggregate{}
+
+	for _, n := range sorted {
+		start := bucket(n.Start, resolution)
+		k := n.MarketName + "/" + start.String()
+
+		a, ok := index[k]
+		if !ok {
+			a = &SummaryAggregate{MarketName: n.MarketName, Start: start, Resolution: resolution}
+			index[k] = a
+			merged = append(merged, a)
+		}
+		a.merge(n)
+	}
+
+	return merged
+}
+
+type summaryAggregatesByStart []*SummaryAggregate
+
+func (s summaryAggregatesByStart) Len() int           { return len(s) }
+func (s summaryAggregatesByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s summaryAggregatesByStart) Less(i, j int) bool { return s[i].Start.Before(s[j].Start) }
+
+// ArbitrageAggregate summarizes the arbitrages of two venues over a period.
+type ArbitrageAggregate struct {
+	Pair       exchanger.Pair
+	BuyEx      string
+	SellEx     string
+	Start      time.Time
+	Resolution time.Duration
+	Count      int
+	SpreadAvg  float64
+	SpreadMax  float64
+	// Volume is the total volume of the arbitrages.
+	Volume float64
+}
+
+func (a *ArbitrageAggregate) merge(n *ArbitrageAggregate) {
+	a.SpreadAvg = weighted(a.SpreadAvg, a.Count, n.SpreadAvg, n.Count)
+	if a.Count == 0 || n.SpreadMax > a.SpreadMax {
+		a.SpreadMax = n.SpreadMax
+	}
+	a.Volume += n.Volume
+	a.Count += n.Count
+}
+
+// AggregateArbitrages aggregates arbitrages by pair, venues and period of width
+// resolution.
+func AggregateArbitrages(arbitrages []*storage.Arbitrage, resolution time.Duration) []*ArbitrageAggregate {
+	aggs := make([]*ArbitrageAggregate, len(arbitrages))
+	for i, a := range arbitrages {
+		aggs[i] = &ArbitrageAggregate{Pair: a.Pair, BuyEx: a.BuyEx, SellEx: a.SellEx, Start: a.Time, Count: 1,
+			SpreadAvg: a.Spread, SpreadMax: a.Spread, Volume: a.Volume}
+	}
+	return MergeArbitrages(aggs, resolution)
+}
+
+// MergeArbitrages downsamples aggregates to a coarser resolution.
+func MergeArbitrages(aggs []*ArbitrageAggregate, resolution time.Duration) []*ArbitrageAggregate {
+	sorted := make([]*ArbitrageAggregate, len(aggs))
+	copy(sorted, aggs)
+	sort.Stable(arbitrageAggregatesByStart(sorted))
+
+	index := map[string]*ArbitrageAggregate{}
+	merged := []*ArbitrageAggregate{}
+
+	for _, n := range sorted {
+		start := bucket(n.Start, resolution)
+		k := n.Pair.String() + "/" + n.BuyEx + "/" + n.SellEx + "/" + start.String()
+
+		a, ok := index[k]
+		if !ok {
+			a = &ArbitrageAggregate{Pair: n.Pair, BuyEx: n.BuyEx, SellEx: n.SellEx, Start: start, Resolution: resolution}
+			index[k] = a
+			merged = append(merged, a)
+		}
+		a.merge(n)
+	}
+
+	return merged
+}
+
+type arbitrageAggregatesByStart []*ArbitrageAggregate
+
+func (s arbitrageAggregatesByStart) Len() int           { return len(s) }
+func (s arbitrageAggregatesByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s arbitrageAggregatesByStart) Less(i, j int) bool { return s[i].Start.Before(s[j].Start) }
@@ -0,0 +1,110 @@
+/*
+Package retention downsamples the recorded market data.
+
+A list of policies tells how long the data is kept at each resolution: the raw rows
+first, then aggregates of increasing width. Each level is aggregated from the previous
+one, and a level is only purged once the next one covers it, so that no data is lost
+between two resolutions.
+*/
+package retention
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy keeps the data at a resolution for a duration.
+type Policy struct {
+	// Resolution is the width of the aggregates, zero for the raw rows.
+	Resolution time.Duration
+	// Keep is the time the data is kept, zero to keep it forever.
+	Keep time.Duration
+}
+
+func (p Policy) String() string {
+	res := "raw"
+	if p.Resolution > 0 {
+		res = p.Resolution.String()
+	}
+
+	keep := "forever"
+	if p.Keep > 0 {
+		keep = p.Keep.String()
+	}
+	return res + " for " + keep
+}
+
+// DefaultPolicies keep the raw rows for 7 days, 1 minute aggregates for 90 days and
+// hourly aggregates forever.
+var DefaultPolicies = []Policy{
+	{0, 7 * 24 * time.Hour},
+	{time.Minute, 90 * 24 * time.Hour},
+	{time.Hour, 0},
+}
+
+// Validate checks that the policies start with the raw rows, that each resolution is a
+// multiple of the previous one and that the coarser data is kept longer.
+func Validate(policies []Policy) error {
+	if len(policies) == 0 || policies[0].Resolution != 0 {
+		return fmt.Errorf("the first policy must be the raw one")
+	}
+
+	for i, p := range policies[1:] {
+		prev := policies[i]
+
+		if p.Resolution <= prev.Resolution || prev.Resolution > 0 && p.Resolution%prev.Resolution != 0 {
+			return fmt.Errorf("%s: the resolution must be a multiple of the previous one", p)
+		}
+
+		if prev.Keep == 0 {
+			return fmt.Errorf("%s: the previous data is kept forever", p)
+		}
+
+		if p.Keep != 0 && p.Keep <= prev.Keep {
+			return fmt.Errorf("%s: the data must be kept longer than the previous one", p)
+		}
+	}
+	return nil
+}
+
+// OHLC are the open, high, low and close values of a period.
+type OHLC struct {
+	Open  float64
+	High  float64
+	Low   float64
+	Close float64
+}
+
+// add records the next value of the period. first is set for the first one.
+func (o *OHLC) add(v float64, first bool) {
+	o.merge(OHLC{v, v, v, v}, first)
+}
+
+// merge records the next sub-period.
+func (o *OHLC) merge(n OHLC, first bool) {
+	if first {
+		*o = n
+		return
+	}
+
+	if n.High > o.High {
+		o.High = n.High
+	}
+	if n.Low < o.Low {
+		o.Low = n.Low
+	}
+	o.Close = n.Close
+}
+
+// bucket returns the start of the period of width resolution containing t.
+func bucket(t time.Time, resolution time.Duration) time.Time {
+	return t.Truncate(resolution)
+}
+
+// weighted returns the average of a and b, weighted by na and nb.
+func weighted(a float64, na int, b float64, nb int) float64 {
+	if na+nb == 0 {
+		return 0
+	}
+	return (a*float64(na) + b*float64(nb)) / float64(na+nb)
+}
@@ -0,0 +1,107 @@
+package retention
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Validate(DefaultPolicies); err != nil {
+		t.Errorf("default policies should be valid - %s", err)
+	}
+
+	invalid := [][]Policy{
+		{},
+		{{time.Minute, time.Hour}},
+		{{0, time.Hour}, {90 * time.Second, 2 * time.Hour}, {2 * time.Minute, 0}},
+		{{0, 0}, {time.Minute, 0}},
+		{{0, 2 * time.Hour}, {time.Minute, time.Hour}},
+	}
+
+	for _, policies := range invalid {
+		if err := Validate(policies); err == nil {
+			t.Errorf("%v should be invalid", policies)
+		}
+	}
+}
+
+func TestAggregateBooks(t *testing.T) {
+	t0 := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	book := func(ts time.Time, bid, ask float64) *storage.Book {
+		return &storage.Book{Pair: exchanger.ZEC_BTC, Time: ts, OrderBook: &exchanger.OrderBook{
+			Exchanger: "Kraken",
+			Bids:      []*exchanger.Order{{Price: bid, Volume: 1}, {Price: bid * 0.99, Volume: 2}},
+			Asks:      []*exchanger.Order{{Price: ask, Volume: 1}, {Price: ask * 1.03, Volume: 4}},
+		}}
+	}
+
+	books := []*storage.Book{}
+	for i := 0; i < 120; i++ {
+		bid := 0.1 + 0.001*math.Sin(float64(i))
+		books = append(books, book(t0.Add(time.Duration(i)*30*time.Second), bid, bid+0.0002))
+	}
+	// an empty book is skipped
+	books = append(books, &storage.Book{Pair: exchanger.ZEC_BTC, Time: t0,
+		OrderBook: &exchanger.OrderBook{Exchanger: "Kraken"}})
+
+	minutes := AggregateBooks(books, time.Minute)
+	if len(minutes) != 60 {
+		t.Fatalf("60 aggregates expected, got %d", len(minutes))
+	}
+
+	a := minutes[0]
+	if !a.Start.Equal(t0) || a.Samples != 2 || a.Bid.Open != books[0].Bids[0].Price || a.Bid.Close != books[1].Bids[0].Price {
+		t.Errorf("wrong first aggregate %+v", a)
+	}
+
+	// the second bids are within 2% of the mid, the second asks within 5%
+	if a.BidDepth[1] != 1 || a.BidDepth[2] != 3 || a.AskDepth[2] != 1 || a.AskDepth[3] != 5 {
+		t.Errorf("wrong depths %v %v", a.BidDepth, a.AskDepth)
+	}
+
+	hour := AggregateBooks(books, time.Hour)
+	merged := MergeBooks(minutes, time.Hour)
+	if len(hour) != 1 || len(merged) != 1 {
+		t.Fatalf("1 hourly aggregate expected, got %d and %d", len(hour), len(merged))
+	}
+
+	h, m := hour[0], merged[0]
+	if h.Samples != m.Samples || h.Bid != m.Bid || h.Ask != m.Ask || h.SpreadMin != m.SpreadMin ||
+		h.SpreadMax != m.SpreadMax || math.Abs(h.Mid-m.Mid) > 1e-12 || math.Abs(h.SpreadAvg-m.SpreadAvg) > 1e-9 {
+		t.Errorf("merged minutes %+v should equal the hourly aggregate %+v", m, h)
+	}
+	for i := range DepthBands {
+		if math.Abs(h.BidDepth[i]-m.BidDepth[i]) > 1e-9 || math.Abs(h.AskDepth[i]-m.AskDepth[i]) > 1e-9 {
+			t.Errorf("wrong merged depths %v %v", m.BidDepth, m.AskDepth)
+		}
+	}
+}
+
+func TestAggregateArbitrages(t *testing.T) {
+	t0 := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	arbitrage := func(ts time.Time, spread, vol float64) *storage.Arbitrage {
+		return &storage.Arbitrage{Pair: exchanger.ZEC_BTC, BuyEx: "Kraken", SellEx: "Poloniex", Time: ts,
+			Spread: spread, Volume: vol}
+	}
+
+	aggs := AggregateArbitrages([]*storage.Arbitrage{
+		arbitrage(t0.Add(90*time.Second), 1, 2),
+		arbitrage(t0, 0.5, 1),
+		arbitrage(t0.Add(30*time.Second), 1.5, 1),
+	}, time.Minute)
+
+	if len(aggs) != 2 {
+		t.Fatalf("2 aggregates expected, got %d", len(aggs))
+	}
+
+	a := MergeArbitrages(aggs, time.Hour)[0]
+	if a.Count != 3 || a.SpreadAvg != 1 || a.SpreadMax != 1.5 || a.Volume != 4 || !a.Start.Equal(t0) {
+		t.Errorf("wrong aggregate %+v", a)
+	}
+}
@@ -0,0 +1,18 @@
+// Package stats holds the statistics shared by the reports of the bot.
+package stats
+
+import (
+	"math"
+)
+
+// Percentile returns the nearest-rank percentile p (0.9 for the 90th) of sorted values.
+// sorted must not be empty.
+func Percentile(sorted []float64, p float64) float64 {
+	n := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if n < 0 {
+		n = 0
+	} else if n >= len(sorted) {
+		n = len(sorted) - 1
+	}
+	return sorted[n]
+}
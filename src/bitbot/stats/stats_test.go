@@ -0,0 +1,15 @@
+package stats
+
+import (
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	for p, expected := range map[float64]float64{0: 1, 0.5: 5, 0.9: 9, 0.99: 10, 1: 10, 1.5: 10} {
+		if v := Percentile(values, p); v != expected {
+			t.Errorf("percentile %.2f should be %f, got %f", p, expected, v)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Kinds of records, as named by the encoders and the files of the directory stores.
+const (
+	Books           = "books"
+	Arbitrages      = "arbitrages"
+	Episodes        = "episodes"
+	Latencies       = "latencies"
+	MarketSummaries = "market_summaries"
+	Orders          = "orders"
+	Trades          = "trades"
+	Balances        = "balances"
+	PublicTrades    = "public_trades"
+)
+
+func kindOf(name string) (*kind, error) {
+	for _, k := range []*kind{booksKind, arbitragesKind, episodesKind, latenciesKind, summariesKind, ordersKind, tradesKind, balancesKind, publicTradesKind} {
+		if k.name == name {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown kind of record `%s`", name)
+}
+
+// Encoder writes records of a kind, in the JSONL or CSV format, one at a time.
+type Encoder struct {
+	kind *kind
+	json *json.Encoder
+	csv  *csv.Writer
+	// header is set once the CSV header is written.
+	header bool
+}
+
+// NewEncoder returns an encoder of records of kind to w. CSV files start with a header.
+func NewEncoder(w io.Writer, kind, format string) (*Encoder, error) {
+	k, err := kindOf(kind)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoder(w, k, format, true)
+}
+
+// newEncoder returns an encoder, writing the CSV header when header is set.
+func newEncoder(w io.Writer, k *kind, format string, header bool) (*Encoder, error) {
+	switch format {
+	case JSONL:
+		return &Encoder{kind: k, json: json.NewEncoder(w)}, nil
+	case CSV:
+		return &Encoder{kind: k, csv: csv.NewWriter(w), header: !header}, nil
+	default:
+		return nil, fmt.Errorf("unknown format `%s`", format)
+	}
+}
+
+// Encode writes a record: a *Book for the books, a *Trade for the trades, an
+// *exchanger.PublicTrade for the public trades...
+func (e *Encoder) Encode(r interface{}) error {
+	if e.json != nil {
+		if err := e.json.Encode(r); err != nil {
+			return fmt.Errorf("cannot encode %s - %s", e.kind.name, err)
+		}
+		return nil
+	}
+
+	if !e.header {
+		if err := e.csv.Write(e.kind.header); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	row, err := e.kind.row(r)
+	if err != nil {
+		return fmt.Errorf("cannot encode %s - %s", e.kind.name, err)
+	}
+	return e.csv.Write(row)
+}
+
+// Flush writes the buffered CSV rows.
+func (e *Encoder) Flush() error {
+	if e.csv == nil {
+		return nil
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+// Decoder reads records of a kind, in the JSONL or CSV format, one at a time.
+type Decoder struct {
+	kind *kind
+	json *json.Decoder
+	csv  *csv.Reader
+	line int
+}
+
+// NewDecoder returns a decoder of records of kind read from r. CSV files must start with
+// a header.
+func NewDecoder(r io.Reader, kind, format string) (*Decoder, error) {
+	k, err := kindOf(kind)
+	if err != nil {
+		return nil, err
+	}
+	return newDecoder(r, k, format)
+}
+
+func newDecoder(r io.Reader, k *kind, format string) (*Decoder, error) {
+	switch format {
+	case JSONL:
+		return &Decoder{kind: k, json: json.NewDecoder(r)}, nil
+	case CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = len(k.header)
+		return &Decoder{kind: k, csv: cr}, nil
+	default:
+		return nil, fmt.Errorf("unknown format `%s`", format)
+	}
+}
+
+// Decode returns the next record, io.EOF after the last one.
+func (d *Decoder) Decode() (interface{}, error) {
+	r := d.kind.new()
+
+	if d.json != nil {
+		if err := d.json.Decode(r); err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot decode %s - %s", d.kind.name, err)
+		}
+		return r, nil
+	}
+
+	for {
+		fields, err := d.csv.Read()
+		if err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read %s - %s", d.kind.name, err)
+		}
+
+		d.line++
+		if d.line == 1 {
+			// header
+			continue
+		}
+
+		row := &csvRow{fields: fields}
+		d.kind.parse(r, row)
+		if row.err != nil {
+			return nil, fmt.Errorf("cannot parse %s line %d - %s", d.kind.name, d.line, row.err)
+		}
+		return r, nil
+	}
+}
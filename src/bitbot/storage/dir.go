@@ -0,0 +1,676 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"bitbot/database"
+	"bitbot/exchanger"
+)
+
+// Formats of the directory stores and of the encoders.
+const (
+	JSONL = "jsonl"
+	CSV   = "csv"
+)
+
+// dirStore appends the records to one file per kind: books.jsonl, trades.jsonl... The
+// files are never rewritten: the duplicates are dropped when loading, the first snapshot
+// of a book or market summary and the last version of a trade winning.
+type dirStore struct {
+	dir    string
+	format string
+
+	mu sync.Mutex
+}
+
+// OpenDir returns a store on the files of dir, in the JSONL or CSV format. The directory
+// is created if needed.
+func OpenDir(dir, format string) (Store, error) {
+	if format != JSONL && format != CSV {
+		return nil, fmt.Errorf("unknown format `%s`", format)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create %s - %s", dir, err)
+	}
+
+	return &dirStore{dir: dir, format: format}, nil
+}
+
+// kind describes the files of a kind of record.
+type kind struct {
+	name   string
+	header []string
+	new    func() interface{}
+	time   func(interface{}) time.Time
+	// key identifies the duplicates, nil when they are kept. The last duplicate wins when
+	// replace is set, the first one otherwise.
+	key     func(interface{}) string
+	replace bool
+	// row and parse convert the records to and from CSV rows.
+	row   func(interface{}) ([]string, error)
+	parse func(interface{}, *csvRow)
+}
+
+func (s *dirStore) path(k *kind) string {
+	return filepath.Join(s.dir, k.name+"."+s.format)
+}
+
+func (s *dirStore) append(k *kind, records []interface{}) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path(k), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc, err := newEncoder(w, k, s.format, stat.Size() == 0)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// load returns the records kept by filter, without duplicates and in chronological order.
+func (s *dirStore) load(k *kind, filter func(interface{}) bool) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path(k))
+	if os.IsNotExist(err) {
+		return []interface{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []interface{}{}
+	index := map[string]int{}
+
+	add := func(r interface{}) {
+		if !filter(r) {
+			return
+		}
+
+		if k.key != nil {
+			key := k.key(r)
+			if i, ok := index[key]; ok {
+				if k.replace {
+					records[i] = r
+				}
+				return
+			}
+			index[key] = len(records)
+		}
+		records = append(records, r)
+	}
+
+	dec, err := newDecoder(bufio.NewReader(f), k, s.format)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		r, err := dec.Decode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", s.path(k), err)
+		}
+		add(r)
+	}
+
+	sort.Stable(&byRecordTime{records, k.time})
+	return records, nil
+}
+
+func (s *dirStore) Close() error {
+	return nil
+}
+
+type byRecordTime struct {
+	records []interface{}
+	time    func(interface{}) time.Time
+}
+
+func (s *byRecordTime) Len() int      { return len(s.records) }
+func (s *byRecordTime) Swap(i, j int) { s.records[i], s.records[j] = s.records[j], s.records[i] }
+func (s *byRecordTime) Less(i, j int) bool {
+	return s.time(s.records[i]).Before(s.time(s.records[j]))
+}
+
+// csvRow parses the fields of a CSV row in order. The first error is kept.
+type csvRow struct {
+	fields []string
+	i      int
+	err    error
+}
+
+func (r *csvRow) str() string {
+	s := r.fields[r.i]
+	r.i++
+	return s
+}
+
+func (r *csvRow) float() float64 {
+	s := r.str()
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid number `%s`", s)
+	}
+	return v
+}
+
+func (r *csvRow) int() int {
+	s := r.str()
+	v, err := strconv.Atoi(s)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid integer `%s`", s)
+	}
+	return v
+}
+
+func (r *csvRow) time() time.Time {
+	t, err := database.ParseTime(r.str())
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return t
+}
+
+func (r *csvRow) pair() exchanger.Pair {
+	return exchanger.NewPair(r.str())
+}
+
+func (r *csvRow) json(v interface{}) {
+	if err := json.Unmarshal([]byte(r.str()), v); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var booksKind = &kind{
+	name:   Books,
+	header: []string{"ts", "pair", "exchanger", "bids", "asks", "sent_at", "received_at", "exchange_ts"},
+	new:    func() interface{} { return &Book{} },
+	time:   func(r interface{}) time.Time { return r.(*Book).Time },
+	key: func(r interface{}) string {
+		b := r.(*Book)
+		return b.Exchanger + "/" + b.Pair.String() + "/" + formatTime(b.Time)
+	},
+	row: func(r interface{}) ([]string, error) {
+		b := r.(*Book)
+
+		bids, err := json.Marshal(b.Bids)
+		if err != nil {
+			return nil, err
+		}
+
+		asks, err := json.Marshal(b.Asks)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{formatTime(b.Time), b.Pair.String(), b.Exchanger, string(bids), string(asks),
+			formatTime(b.Sent), formatTime(b.Received), formatTime(b.ExchangeTime)}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		b := r.(*Book)
+		b.OrderBook = &exchanger.OrderBook{}
+		b.Time = row.time()
+		b.Pair = row.pair()
+		b.Exchanger = row.str()
+		row.json(&b.Bids)
+		row.json(&b.Asks)
+		b.Sent, b.Received, b.ExchangeTime = row.time(), row.time(), row.time()
+	},
+}
+
+func (s *dirStore) SaveBooks(books []*Book) error {
+	records := make([]interface{}, len(books))
+	for i, b := range books {
+		records[i] = b
+	}
+	return s.append(booksKind, records)
+}
+
+func (s *dirStore) Books(pair exchanger.Pair, from, to time.Time) ([]*Book, error) {
+	records, err := s.load(booksKind, func(r interface{}) bool {
+		b := r.(*Book)
+		return b.Pair == pair && inRange(b.Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	books := make([]*Book, len(records))
+	for i, r := range records {
+		books[i] = r.(*Book)
+	}
+	return books, nil
+}
+
+var arbitragesKind = &kind{
+	name:   Arbitrages,
+	header: []string{"buy_ex", "sell_ex", "pair", "ts", "buy_price", "sell_price", "vol", "spread"},
+	new:    func() interface{} { return &Arbitrage{} },
+	time:   func(r interface{}) time.Time { return r.(*Arbitrage).Time },
+	row: func(r interface{}) ([]string, error) {
+		a := r.(*Arbitrage)
+		return []string{a.BuyEx, a.SellEx, a.Pair.String(), formatTime(a.Time), formatFloat(a.BuyPrice),
+			formatFloat(a.SellPrice), formatFloat(a.Volume), formatFloat(a.Spread)}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		a := r.(*Arbitrage)
+		a.BuyEx, a.SellEx = row.str(), row.str()
+		a.Pair = row.pair()
+		a.Time = row.time()
+		a.BuyPrice, a.SellPrice, a.Volume, a.Spread = row.float(), row.float(), row.float(), row.float()
+	},
+}
+
+func (s *dirStore) SaveArbitrages(arbitrages []*Arbitrage) error {
+	records := make([]interface{}, len(arbitrages))
+	for i, a := range arbitrages {
+		records[i] = a
+	}
+	return s.append(arbitragesKind, records)
+}
+
+func (s *dirStore) Arbitrages(pair exchanger.Pair, from, to time.Time) ([]*Arbitrage, error) {
+	records, err := s.load(arbitragesKind, func(r interface{}) bool {
+		a := r.(*Arbitrage)
+		return a.Pair == pair && inRange(a.Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	arbitrages := make([]*Arbitrage, len(records))
+	for i, r := range records {
+		arbitrages[i] = r.(*Arbitrage)
+	}
+	return arbitrages, nil
+}
+
+var episodesKind = &kind{
+	name: Episodes,
+	header: []string{"pair", "buy_ex", "sell_ex", "start_ts", "end_ts", "peak_spread", "avg_vol",
+		"snapshots"},
+	new:  func() interface{} { return &Episode{} },
+	time: func(r interface{}) time.Time { return r.(*Episode).Start },
+	row: func(r interface{}) ([]string, error) {
+		e := r.(*Episode)
+		return []string{e.Pair.String(), e.BuyEx, e.SellEx, formatTime(e.Start), formatTime(e.End),
+			formatFloat(e.PeakSpread), formatFloat(e.AvgVolume), strconv.Itoa(e.Snapshots)}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		e := r.(*Episode)
+		e.Pair = row.pair()
+		e.BuyEx, e.SellEx = row.str(), row.str()
+		e.Start, e.End = row.time(), row.time()
+		e.PeakSpread, e.AvgVolume = row.float(), row.float()
+		e.Snapshots = row.int()
+	},
+}
+
+func (s *dirStore) SaveEpisodes(episodes []*Episode) error {
+	records := make([]interface{}, len(episodes))
+	for i, e := range episodes {
+		records[i] = e
+	}
+	return s.append(episodesKind, records)
+}
+
+func (s *dirStore) Episodes(pair exchanger.Pair, from, to time.Time) ([]*Episode, error) {
+	records, err := s.load(episodesKind, func(r interface{}) bool {
+		e := r.(*Episode)
+		return e.Pair == pair && inRange(e.Start, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	episodes := make([]*Episode, len(records))
+	for i, r := range records {
+		episodes[i] = r.(*Episode)
+	}
+	return episodes, nil
+}
+
+// The latencies of the CSV files are in milliseconds, as in the database.
+var latenciesKind = &kind{
+	name:   Latencies,
+	header: []string{"ts", "exchanger", "samples", "errors", "p50", "p90", "p99", "max"},
+	new:    func() interface{} { return &Latency{} },
+	time:   func(r interface{}) time.Time { return r.(*Latency).Time },
+	key: func(r interface{}) string {
+		l := r.(*Latency)
+		return l.Exchanger + "/" + formatTime(l.Time)
+	},
+	row: func(r interface{}) ([]string, error) {
+		l := r.(*Latency)
+		return []string{formatTime(l.Time), l.Exchanger, strconv.Itoa(l.Samples), strconv.Itoa(l.Errors),
+			formatFloat(millis(l.P50)), formatFloat(millis(l.P90)), formatFloat(millis(l.P99)),
+			formatFloat(millis(l.Max))}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		l := r.(*Latency)
+		l.Time = row.time()
+		l.Exchanger = row.str()
+		l.Samples, l.Errors = row.int(), row.int()
+		l.P50, l.P90 = fromMillis(row.float()), fromMillis(row.float())
+		l.P99, l.Max = fromMillis(row.float()), fromMillis(row.float())
+	},
+}
+
+func (s *dirStore) SaveLatencies(latencies []*Latency) error {
+	records := make([]interface{}, len(latencies))
+	for i, l := range latencies {
+		records[i] = l
+	}
+	return s.append(latenciesKind, records)
+}
+
+func (s *dirStore) Latencies(from, to time.Time) ([]*Latency, error) {
+	records, err := s.load(latenciesKind, func(r interface{}) bool {
+		return inRange(r.(*Latency).Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	latencies := make([]*Latency, len(records))
+	for i, r := range records {
+		latencies[i] = r.(*Latency)
+	}
+	return latencies, nil
+}
+
+var summariesKind = &kind{
+	name: MarketSummaries,
+	header: []string{"market_name", "high", "low", "ask", "bid", "open_buy_orders", "open_sell_orders",
+		"volume", "last", "base_volume", "prev_day", "creation_date"},
+	new:  func() interface{} { return &MarketSummary{} },
+	time: func(r interface{}) time.Time { return r.(*MarketSummary).Time },
+	key: func(r interface{}) string {
+		m := r.(*MarketSummary)
+		return m.MarketName + "/" + formatTime(m.Time)
+	},
+	row: func(r interface{}) ([]string, error) {
+		m := r.(*MarketSummary)
+		return []string{m.MarketName, formatFloat(m.High), formatFloat(m.Low), formatFloat(m.Ask),
+			formatFloat(m.Bid), strconv.Itoa(m.OpenBuyOrders), strconv.Itoa(m.OpenSellOrders),
+			formatFloat(m.Volume), formatFloat(m.Last), formatFloat(m.BaseVolume), formatFloat(m.PrevDay),
+			formatTime(m.Time)}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		m := r.(*MarketSummary)
+		m.MarketName = row.str()
+		m.High, m.Low, m.Ask, m.Bid = row.float(), row.float(), row.float(), row.float()
+		m.OpenBuyOrders, m.OpenSellOrders = row.int(), row.int()
+		m.Volume, m.Last, m.BaseVolume, m.PrevDay = row.float(), row.float(), row.float(), row.float()
+		m.Time = row.time()
+	},
+}
+
+func (s *dirStore) SaveMarketSummaries(summaries []*MarketSummary) error {
+	records := make([]interface{}, len(summaries))
+	for i, m := range summaries {
+		records[i] = m
+	}
+	return s.append(summariesKind, records)
+}
+
+func (s *dirStore) MarketSummaries(market string, from, to time.Time) ([]*MarketSummary, error) {
+	records, err := s.load(summariesKind, func(r interface{}) bool {
+		m := r.(*MarketSummary)
+		return m.MarketName == market && inRange(m.Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*MarketSummary, len(records))
+	for i, r := range records {
+		summaries[i] = r.(*MarketSummary)
+	}
+	return summaries, nil
+}
+
+var ordersKind = &kind{
+	name:   Orders,
+	header: []string{"arbitrage_id", "external_id", "pair", "exchanger", "side"},
+	new:    func() interface{} { return &Order{} },
+	time:   func(r interface{}) time.Time { return time.Time{} },
+	row: func(r interface{}) ([]string, error) {
+		o := r.(*Order)
+		return []string{o.ArbitrageID, o.ExternalID, o.Pair.String(), o.Exchanger, o.Side}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		o := r.(*Order)
+		o.ArbitrageID, o.ExternalID = row.str(), row.str()
+		o.Pair = row.pair()
+		o.Exchanger, o.Side = row.str(), row.str()
+	},
+}
+
+func (s *dirStore) SaveOrders(orders []*Order) error {
+	records := make([]interface{}, len(orders))
+	for i, o := range orders {
+		records[i] = o
+	}
+	return s.append(ordersKind, records)
+}
+
+func (s *dirStore) Orders(ex string) ([]*Order, error) {
+	records, err := s.load(ordersKind, func(r interface{}) bool {
+		return ex == "" || r.(*Order).Exchanger == ex
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]*Order, len(records))
+	for i, r := range records {
+		orders[i] = r.(*Order)
+	}
+	return orders, nil
+}
+
+var tradesKind = &kind{
+	name: Trades,
+	header: []string{"exchanger", "trade_id", "arbitrage_id", "order_id", "price", "quantity", "pair", "side",
+		"fee", "fee_currency", "ts"},
+	new:  func() interface{} { return &Trade{} },
+	time: func(r interface{}) time.Time { return r.(*Trade).Time },
+	key: func(r interface{}) string {
+		t := r.(*Trade)
+		return t.Exchanger + "/" + t.ID
+	},
+	replace: true,
+	row: func(r interface{}) ([]string, error) {
+		t := r.(*Trade)
+		return []string{t.Exchanger, t.ID, t.ArbitrageID, t.OrderID, formatFloat(t.Price), formatFloat(t.Volume),
+			t.Pair.String(), t.Side, formatFloat(t.Fee), t.FeeCurrency, formatTime(t.Time)}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		t := r.(*Trade)
+		t.Exchanger, t.ID, t.ArbitrageID, t.OrderID = row.str(), row.str(), row.str(), row.str()
+		t.Price, t.Volume = row.float(), row.float()
+		t.Pair = row.pair()
+		t.Side = row.str()
+		t.Fee = row.float()
+		t.FeeCurrency = row.str()
+		t.Time = row.time()
+	},
+}
+
+func (s *dirStore) SaveTrades(trades []*Trade) error {
+	records := make([]interface{}, len(trades))
+	for i, t := range trades {
+		records[i] = t
+	}
+	return s.append(tradesKind, records)
+}
+
+func (s *dirStore) Trades(ex string, pair exchanger.Pair, from, to time.Time) ([]*Trade, error) {
+	// the filter is applied after the duplicates are dropped: the last version of a trade
+	// may have moved out of the range
+	records, err := s.load(tradesKind, func(r interface{}) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	trades := []*Trade{}
+	for _, r := range records {
+		t := r.(*Trade)
+		if (ex == "" || t.Exchanger == ex) && t.Pair == pair && inRange(t.Time, from, to) {
+			trades = append(trades, t)
+		}
+	}
+	return trades, nil
+}
+
+var balancesKind = &kind{
+	name:   Balances,
+	header: []string{"ts", "exchanger", "account", "currency", "balance", "value_btc", "value_usd", "value_eur"},
+	new:    func() interface{} { return &Balance{} },
+	time:   func(r interface{}) time.Time { return r.(*Balance).Time },
+	row: func(r interface{}) ([]string, error) {
+		b := r.(*Balance)
+		row := []string{formatTime(b.Time), b.Exchanger, b.Account, b.Currency, formatFloat(b.Balance)}
+		for _, cur := range valuationCurrencies {
+			if v, ok := b.Values[cur]; ok {
+				row = append(row, formatFloat(v))
+			} else {
+				row = append(row, "")
+			}
+		}
+		return row, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		b := r.(*Balance)
+		b.Time = row.time()
+		b.Exchanger, b.Account, b.Currency = row.str(), row.str(), row.str()
+		b.Balance = row.float()
+
+		b.Values = map[string]float64{}
+		for _, cur := range valuationCurrencies {
+			if row.fields[row.i] == "" {
+				row.i++
+				continue
+			}
+			b.Values[cur] = row.float()
+		}
+	},
+}
+
+func (s *dirStore) SaveBalances(balances []*Balance) error {
+	records := make([]interface{}, len(balances))
+	for i, b := range balances {
+		records[i] = b
+	}
+	return s.append(balancesKind, records)
+}
+
+func (s *dirStore) Balances(from, to time.Time) ([]*Balance, error) {
+	records, err := s.load(balancesKind, func(r interface{}) bool {
+		return inRange(r.(*Balance).Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make([]*Balance, len(records))
+	for i, r := range records {
+		balances[i] = r.(*Balance)
+	}
+	return balances, nil
+}
+
+var publicTradesKind = &kind{
+	name:   PublicTrades,
+	header: []string{"exchanger", "pair", "trade_id", "price", "volume", "side", "ts"},
+	new:    func() interface{} { return &exchanger.PublicTrade{} },
+	time:   func(r interface{}) time.Time { return r.(*exchanger.PublicTrade).Time },
+	key: func(r interface{}) string {
+		t := r.(*exchanger.PublicTrade)
+		return t.Exchanger + "/" + t.Pair.String() + "/" + t.ID
+	},
+	row: func(r interface{}) ([]string, error) {
+		t := r.(*exchanger.PublicTrade)
+		return []string{t.Exchanger, t.Pair.String(), t.ID, formatFloat(t.Price), formatFloat(t.Volume), t.Side,
+			formatTime(t.Time)}, nil
+	},
+	parse: func(r interface{}, row *csvRow) {
+		t := r.(*exchanger.PublicTrade)
+		t.Exchanger = row.str()
+		t.Pair = row.pair()
+		t.ID = row.str()
+		t.Price, t.Volume = row.float(), row.float()
+		t.Side = row.str()
+		t.Time = row.time()
+	},
+}
+
+func (s *dirStore) SavePublicTrades(trades []*exchanger.PublicTrade) error {
+	records := make([]interface{}, len(trades))
+	for i, t := range trades {
+		records[i] = t
+	}
+	return s.append(publicTradesKind, records)
+}
+
+func (s *dirStore) PublicTrades(ex string, pair exchanger.Pair, from, to time.Time) ([]*exchanger.PublicTrade, error) {
+	records, err := s.load(publicTradesKind, func(r interface{}) bool {
+		t := r.(*exchanger.PublicTrade)
+		return (ex == "" || t.Exchanger == ex) && t.Pair == pair && inRange(t.Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]*exchanger.PublicTrade, len(records))
+	for i, r := range records {
+		trades[i] = r.(*exchanger.PublicTrade)
+	}
+	return trades, nil
+}
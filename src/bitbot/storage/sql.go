@@ -0,0 +1,567 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"bitbot/database"
+	"bitbot/exchanger"
+)
+
+// dialect holds the statements that differ between MySQL and SQLite.
+type dialect struct {
+	insertIgnore string
+	// upsertTrade replaces a trade already saved.
+	upsertTrade string
+	// time converts a time to a statement parameter.
+	time func(time.Time) interface{}
+}
+
+var mysqlDialect = &dialect{
+	insertIgnore: "insert ignore into",
+	upsertTrade: `
+		on duplicate key update
+			arbitrage_id = values(arbitrage_id),
+			order_id = values(order_id),
+			price = values(price),
+			quantity = values(quantity),
+			fee = values(fee),
+			fee_currency = values(fee_currency)
+	`,
+	time: func(t time.Time) interface{} {
+		if t.IsZero() {
+			return nil
+		}
+		return t.UTC()
+	},
+}
+
+// SQLite has no time type: times are saved as sortable UTC strings.
+var sqliteDialect = &dialect{
+	insertIgnore: "insert or ignore into",
+	upsertTrade: `
+		on conflict (exchanger, trade_id) do update set
+			arbitrage_id = excluded.arbitrage_id,
+			order_id = excluded.order_id,
+			price = excluded.price,
+			quantity = excluded.quantity,
+			fee = excluded.fee,
+			fee_currency = excluded.fee_currency
+	`,
+	time: func(t time.Time) interface{} {
+		if t.IsZero() {
+			return nil
+		}
+		return formatTime(t)
+	},
+}
+
+// sqlStore stores the records in the tables of the migrations (see bitbot/database).
+type sqlStore struct {
+	db *sql.DB
+	d  *dialect
+}
+
+// OpenMySQL returns a store on the MySQL database of the services.
+func OpenMySQL(db *sql.DB) Store {
+	return &sqlStore{db, mysqlDialect}
+}
+
+// exec runs stmt once per row of params in a transaction.
+func (s *sqlStore) exec(stmt string, params [][]interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("db.Begin() failed - %s", err)
+	}
+
+	for _, p := range params {
+		if _, err := tx.Exec(stmt, p...); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("tx.Exec() failed - %s", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveBooks(books []*Book) error {
+	stmt := s.d.insertIgnore + `
+		orderbooks
+			(ts, pair, exchanger, bids, asks, sent_at, received_at, exchange_ts)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, b := range books {
+		bids, err := json.Marshal(b.Bids)
+		if err != nil {
+			return fmt.Errorf("cannot marshal bids - %s", err)
+		}
+
+		asks, err := json.Marshal(b.Asks)
+		if err != nil {
+			return fmt.Errorf("cannot marshal asks - %s", err)
+		}
+
+		params = append(params, []interface{}{s.d.time(b.Time), b.Pair.String(), b.Exchanger,
+			string(bids), string(asks), s.d.time(b.Sent), s.d.time(b.Received), s.d.time(b.ExchangeTime)})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) Books(pair exchanger.Pair, from, to time.Time) ([]*Book, error) {
+	const query = `
+		select ts, exchanger, bids, asks, sent_at, received_at, exchange_ts
+		from orderbooks
+		where pair = ? and ts >= ? and ts < ?
+		order by ts, exchanger
+	`
+
+	rows, err := s.db.Query(query, pair.String(), s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+	for rows.Next() {
+		b := &Book{Pair: pair, OrderBook: &exchanger.OrderBook{}}
+		var ts, sent, received, exchangeTime database.Timestamp
+		var bids, asks []byte
+
+		if err := rows.Scan(&ts, &b.Exchanger, &bids, &asks, &sent, &received, &exchangeTime); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(bids, &b.Bids); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal bids - %s", err)
+		}
+		if err := json.Unmarshal(asks, &b.Asks); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal asks - %s", err)
+		}
+
+		b.Time = ts.Time
+		b.Sent, b.Received, b.ExchangeTime = sent.Time, received.Time, exchangeTime.Time
+		books = append(books, b)
+	}
+
+	return books, rows.Err()
+}
+
+func (s *sqlStore) SaveArbitrages(arbitrages []*Arbitrage) error {
+	const stmt = `
+		insert into arbitrages
+			(buy_ex, sell_ex, pair, ts, buy_price, sell_price, vol, spread)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, a := range arbitrages {
+		params = append(params, []interface{}{a.BuyEx, a.SellEx, a.Pair.String(), s.d.time(a.Time),
+			a.BuyPrice, a.SellPrice, a.Volume, a.Spread})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) Arbitrages(pair exchanger.Pair, from, to time.Time) ([]*Arbitrage, error) {
+	const query = `
+		select buy_ex, sell_ex, ts, buy_price, sell_price, vol, spread
+		from arbitrages
+		where pair = ? and ts >= ? and ts < ?
+		order by ts
+	`
+
+	rows, err := s.db.Query(query, pair.String(), s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	arbitrages := []*Arbitrage{}
+	for rows.Next() {
+		a := &Arbitrage{Pair: pair}
+		var ts database.Timestamp
+
+		if err := rows.Scan(&a.BuyEx, &a.SellEx, &ts, &a.BuyPrice, &a.SellPrice, &a.Volume, &a.Spread); err != nil {
+			return nil, err
+		}
+
+		a.Time = ts.Time
+		arbitrages = append(arbitrages, a)
+	}
+
+	return arbitrages, rows.Err()
+}
+
+func (s *sqlStore) SaveEpisodes(episodes []*Episode) error {
+	const stmt = `
+		insert into episodes
+			(pair, buy_ex, sell_ex, start_ts, end_ts, peak_spread, avg_vol, snapshots)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, e := range episodes {
+		params = append(params, []interface{}{e.Pair.String(), e.BuyEx, e.SellEx, s.d.time(e.Start), s.d.time(e.End),
+			e.PeakSpread, e.AvgVolume, e.Snapshots})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) Episodes(pair exchanger.Pair, from, to time.Time) ([]*Episode, error) {
+	const query = `
+		select buy_ex, sell_ex, start_ts, end_ts, peak_spread, avg_vol, snapshots
+		from episodes
+		where pair = ? and start_ts >= ? and start_ts < ?
+		order by start_ts
+	`
+
+	rows, err := s.db.Query(query, pair.String(), s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	episodes := []*Episode{}
+	for rows.Next() {
+		e := &Episode{Pair: pair}
+		var start, end database.Timestamp
+
+		err := rows.Scan(&e.BuyEx, &e.SellEx, &start, &end, &e.PeakSpread, &e.AvgVolume, &e.Snapshots)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Start, e.End = start.Time, end.Time
+		episodes = append(episodes, e)
+	}
+
+	return episodes, rows.Err()
+}
+
+// SaveLatencies saves the latencies in milliseconds.
+func (s *sqlStore) SaveLatencies(latencies []*Latency) error {
+	stmt := s.d.insertIgnore + `
+		book_latency
+			(ts, exchanger, samples, errors, p50, p90, p99, max)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, l := range latencies {
+		params = append(params, []interface{}{s.d.time(l.Time), l.Exchanger, l.Samples, l.Errors, millis(l.P50),
+			millis(l.P90), millis(l.P99), millis(l.Max)})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) Latencies(from, to time.Time) ([]*Latency, error) {
+	const query = `
+		select ts, exchanger, samples, errors, p50, p90, p99, max
+		from book_latency
+		where ts >= ? and ts < ?
+		order by ts, exchanger
+	`
+
+	rows, err := s.db.Query(query, s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latencies := []*Latency{}
+	for rows.Next() {
+		l := &Latency{}
+		var ts database.Timestamp
+		var p50, p90, p99, max float64
+
+		if err := rows.Scan(&ts, &l.Exchanger, &l.Samples, &l.Errors, &p50, &p90, &p99, &max); err != nil {
+			return nil, err
+		}
+
+		l.Time = ts.Time
+		l.P50, l.P90, l.P99, l.Max = fromMillis(p50), fromMillis(p90), fromMillis(p99), fromMillis(max)
+		latencies = append(latencies, l)
+	}
+
+	return latencies, rows.Err()
+}
+
+func (s *sqlStore) SaveMarketSummaries(summaries []*MarketSummary) error {
+	stmt := s.d.insertIgnore + `
+		market_summary
+			(market_name, high, low, ask, bid, open_buy_orders, open_sell_orders,
+			volume, last, base_volume, prev_day, creation_date)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, m := range summaries {
+		params = append(params, []interface{}{m.MarketName, m.High, m.Low, m.Ask, m.Bid,
+			m.OpenBuyOrders, m.OpenSellOrders, m.Volume, m.Last, m.BaseVolume, m.PrevDay, s.d.time(m.Time)})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) MarketSummaries(market string, from, to time.Time) ([]*MarketSummary, error) {
+	const query = `
+		select high, low, ask, bid, open_buy_orders, open_sell_orders, volume, last,
+			base_volume, prev_day, creation_date
+		from market_summary
+		where market_name = ? and creation_date >= ? and creation_date < ?
+		order by creation_date
+	`
+
+	rows, err := s.db.Query(query, market, s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []*MarketSummary{}
+	for rows.Next() {
+		m := &MarketSummary{MarketName: market}
+		var ts database.Timestamp
+
+		err := rows.Scan(&m.High, &m.Low, &m.Ask, &m.Bid, &m.OpenBuyOrders, &m.OpenSellOrders,
+			&m.Volume, &m.Last, &m.BaseVolume, &m.PrevDay, &ts)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Time = ts.Time
+		summaries = append(summaries, m)
+	}
+
+	return summaries, rows.Err()
+}
+
+func (s *sqlStore) SaveOrders(orders []*Order) error {
+	const stmt = `
+		insert into order_ack
+			(arbitrage_id, external_id, pair, exchanger, side)
+		values
+			(?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, o := range orders {
+		params = append(params, []interface{}{o.ArbitrageID, o.ExternalID, o.Pair.String(), o.Exchanger, o.Side})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) Orders(ex string) ([]*Order, error) {
+	const query = `
+		select arbitrage_id, external_id, pair, coalesce(exchanger, ''), coalesce(side, '')
+		from order_ack
+		where ? = '' or exchanger = ?
+	`
+
+	rows, err := s.db.Query(query, ex, ex)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []*Order{}
+	for rows.Next() {
+		o := &Order{}
+		var pair string
+
+		if err := rows.Scan(&o.ArbitrageID, &o.ExternalID, &pair, &o.Exchanger, &o.Side); err != nil {
+			return nil, err
+		}
+
+		o.Pair = exchanger.NewPair(pair)
+		orders = append(orders, o)
+	}
+
+	return orders, rows.Err()
+}
+
+func (s *sqlStore) SaveTrades(trades []*Trade) error {
+	stmt := `
+		insert into trade
+			(exchanger, trade_id, arbitrage_id, order_id, price, quantity, pair, side, fee, fee_currency, ts)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	` + s.d.upsertTrade
+
+	params := [][]interface{}{}
+	for _, t := range trades {
+		var arbitrage interface{}
+		if t.ArbitrageID != "" {
+			arbitrage = t.ArbitrageID
+		}
+
+		params = append(params, []interface{}{t.Exchanger, t.ID, arbitrage, t.OrderID, t.Price, t.Volume,
+			t.Pair.String(), t.Side, t.Fee, t.FeeCurrency, s.d.time(t.Time)})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) Trades(ex string, pair exchanger.Pair, from, to time.Time) ([]*Trade, error) {
+	const query = `
+		select exchanger, trade_id, coalesce(arbitrage_id, ''), order_id, price, quantity, side,
+			fee, fee_currency, ts
+		from trade
+		where (? = '' or exchanger = ?) and pair = ? and ts >= ? and ts < ?
+		order by ts
+	`
+
+	rows, err := s.db.Query(query, ex, ex, pair.String(), s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := []*Trade{}
+	for rows.Next() {
+		t := &Trade{}
+		var ts database.Timestamp
+
+		err := rows.Scan(&t.Exchanger, &t.ID, &t.ArbitrageID, &t.OrderID, &t.Price, &t.Volume, &t.Side,
+			&t.Fee, &t.FeeCurrency, &ts)
+		if err != nil {
+			return nil, err
+		}
+
+		t.Pair = pair
+		t.Time = ts.Time
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+func (s *sqlStore) SaveBalances(balances []*Balance) error {
+	stmt := s.d.insertIgnore + `
+		balance_snapshot
+			(ts, exchanger, account, currency, balance, value_btc, value_usd, value_eur)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, b := range balances {
+		p := []interface{}{s.d.time(b.Time), b.Exchanger, b.Account, b.Currency, b.Balance}
+		for _, cur := range valuationCurrencies {
+			if v, ok := b.Values[cur]; ok {
+				p = append(p, v)
+			} else {
+				p = append(p, nil)
+			}
+		}
+		params = append(params, p)
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) Balances(from, to time.Time) ([]*Balance, error) {
+	const query = `
+		select ts, exchanger, account, currency, balance, value_btc, value_usd, value_eur
+		from balance_snapshot
+		where ts >= ? and ts < ?
+		order by ts, exchanger, account, currency
+	`
+
+	rows, err := s.db.Query(query, s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []*Balance{}
+	for rows.Next() {
+		b := &Balance{Values: map[string]float64{}}
+		var ts database.Timestamp
+		values := make([]sql.NullFloat64, len(valuationCurrencies))
+
+		err := rows.Scan(&ts, &b.Exchanger, &b.Account, &b.Currency, &b.Balance, &values[0], &values[1], &values[2])
+		if err != nil {
+			return nil, err
+		}
+
+		for i, v := range values {
+			if v.Valid {
+				b.Values[valuationCurrencies[i]] = v.Float64
+			}
+		}
+
+		b.Time = ts.Time
+		balances = append(balances, b)
+	}
+
+	return balances, rows.Err()
+}
+
+func (s *sqlStore) SavePublicTrades(trades []*exchanger.PublicTrade) error {
+	stmt := s.d.insertIgnore + `
+		public_trades
+			(exchanger, pair, trade_id, price, volume, side, ts)
+		values
+			(?, ?, ?, ?, ?, ?, ?)
+	`
+
+	params := [][]interface{}{}
+	for _, t := range trades {
+		params = append(params, []interface{}{t.Exchanger, t.Pair.String(), t.ID, t.Price, t.Volume, t.Side,
+			s.d.time(t.Time)})
+	}
+
+	return s.exec(stmt, params)
+}
+
+func (s *sqlStore) PublicTrades(ex string, pair exchanger.Pair, from, to time.Time) ([]*exchanger.PublicTrade, error) {
+	const query = `
+		select exchanger, trade_id, price, volume, side, ts
+		from public_trades
+		where (? = '' or exchanger = ?) and pair = ? and ts >= ? and ts < ?
+		order by ts
+	`
+
+	rows, err := s.db.Query(query, ex, ex, pair.String(), s.d.time(from), s.d.time(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := []*exchanger.PublicTrade{}
+	for rows.Next() {
+		t := &exchanger.PublicTrade{Pair: pair}
+		var ts database.Timestamp
+
+		if err := rows.Scan(&t.Exchanger, &t.ID, &t.Price, &t.Volume, &t.Side, &ts); err != nil {
+			return nil, err
+		}
+
+		t.Time = ts.Time
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
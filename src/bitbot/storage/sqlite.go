@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqliteSchema is the SQLite version of the MySQL tables used by the store (see
+// bitbot/database/migrations.go).
+const sqliteSchema = `
+	create table if not exists orderbooks (
+		exchanger text not null,
+		pair text not null,
+		ts text not null,
+		bids text,
+		asks text,
+		sent_at text,
+		received_at text,
+		exchange_ts text,
+		primary key (exchanger, pair, ts)
+	);
+	create index if not exists orderbooks_pair_ts on orderbooks (pair, ts);
+
+	create table if not exists arbitrages (
+		buy_ex text,
+		sell_ex text,
+		pair text not null,
+		ts text not null,
+		buy_price real,
+		sell_price real,
+		vol real,
+		spread real
+	);
+	create index if not exists arbitrages_pair_ts on arbitrages (pair, ts);
+
+	create table if not exists episodes (
+		id integer primary key autoincrement,
+		pair text not null,
+		buy_ex text not null,
+		sell_ex text not null,
+		start_ts text not null,
+		end_ts text not null,
+		peak_spread real not null,
+		avg_vol real not null,
+		snapshots integer not null
+	);
+	create index if not exists episodes_pair_start_ts on episodes (pair, start_ts);
+
+	create table if not exists book_latency (
+		ts text not null,
+		exchanger text not null,
+		samples integer not null,
+		errors integer not null,
+		p50 real not null,
+		p90 real not null,
+		p99 real not null,
+		max real not null,
+		primary key (exchanger, ts)
+	);
+
+	create table if not exists market_summary (
+		market_name text not null,
+		high real not null,
+		low real not null,
+		ask real not null,
+		bid real not null,
+		open_buy_orders integer not null,
+		open_sell_orders integer not null,
+		volume real not null,
+		last real not null,
+		base_volume real not null,
+		prev_day real not null,
+		creation_date text not null,
+		primary key (market_name, creation_date)
+	);
+
+	create table if not exists order_ack (
+		arbitrage_id text not null,
+		external_id text not null,
+		pair text not null,
+		exchanger text,
+		side text
+	);
+
+	create table if not exists trade (
+		exchanger text not null,
+		trade_id text not null,
+		arbitrage_id text,
+		order_id text not null,
+		price real not null,
+		quantity real not null,
+		pair text not null,
+		side text not null,
+		fee real not null,
+		fee_currency text not null,
+		ts text not null,
+		primary key (exchanger, trade_id)
+	);
+
+	create table if not exists balance_snapshot (
+		ts text not null,
+		exchanger text not null,
+		account text not null,
+		currency text not null,
+		balance real not null,
+		value_btc real,
+		value_usd real,
+		value_eur real,
+		primary key (ts, exchanger, account, currency)
+	);
+
+	create table if not exists public_trades (
+		exchanger text not null,
+		pair text not null,
+		trade_id text not null,
+		price real not null,
+		volume real not null,
+		side text not null,
+		ts text not null,
+		primary key (exchanger, pair, trade_id)
+	);
+	create index if not exists public_trades_pair_ts on public_trades (pair, ts);
+`
+
+// OpenSQLite returns a store on the SQLite file at path, creating the tables if needed.
+// The "sqlite3" driver must be registered (see the package documentation).
+func OpenSQLite(path string) (Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s - %s", path, err)
+	}
+
+	// the file is locked by the writers
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("cannot create the tables of %s - %s", path, err)
+	}
+
+	return &sqlStore{db, sqliteDialect}, nil
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"bitbot/database"
+)
+
+var (
+	createTable = regexp.MustCompile(`(?i)create table (?:if not exists )?(\w+) \(`)
+	sqlComment  = regexp.MustCompile(`--[^\n]*`)
+)
+
+// mysqlColumns returns the columns of the tables created by the migrations.
+func mysqlColumns(t *testing.T) map[string][]string {
+	tables := map[string][]string{}
+	for _, m := range database.Migrations {
+		for _, stmt := range m.Up {
+			stmt = sqlComment.ReplaceAllString(stmt, "")
+			loc := createTable.FindStringSubmatchIndex(stmt)
+			if loc == nil {
+				continue
+			}
+
+			table := stmt[loc[2]:loc[3]]
+			columns := []string{}
+			for _, def := range splitDefinitions(t, stmt[loc[1]:]) {
+				name := strings.Fields(def)[0]
+				switch strings.ToLower(name) {
+				case "primary", "key", "unique", "index", "constraint", "foreign":
+					continue
+				}
+				columns = append(columns, name)
+			}
+			tables[table] = columns
+		}
+	}
+	return tables
+}
+
+// splitDefinitions splits the body of a create table statement, after its opening
+// parenthesis, on the commas outside of the column types.
+func splitDefinitions(t *testing.T, body string) []string {
+	defs := []string{}
+	depth, start := 0, 0
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return append(defs, strings.TrimSpace(body[start:i]))
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	t.Fatalf("unterminated create table statement: %s", body)
+	return nil
+}
+
+// TestSQLiteSchema checks that the SQLite tables have the columns of their MySQL
+// version, in the same order.
+func TestSQLiteSchema(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("select name from sqlite_master where type = 'table' and name not like 'sqlite_%' order by name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	mysql := mysqlColumns(t)
+	for _, table := range tables {
+		rows, err := db.Query("pragma table_info(" + table + ")")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the rows are cid, name, type, notnull, dflt_value, pk
+		columns := []string{}
+		for rows.Next() {
+			var (
+				cid, notNull, pk int
+				name, typ        string
+				def              sql.NullString
+			)
+			if err := rows.Scan(&cid, &name, &typ, &notNull, &def, &pk); err != nil {
+				t.Fatal(err)
+			}
+			columns = append(columns, name)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+
+		expected, found := mysql[table]
+		if !found {
+			t.Errorf("table %s isn't created by the migrations", table)
+			continue
+		}
+		if !reflect.DeepEqual(columns, expected) {
+			t.Errorf("table %s: expected the columns %v of the migrations, got %v", table, expected, columns)
+		}
+	}
+}
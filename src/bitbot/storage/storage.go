@@ -0,0 +1,190 @@
+/*
+Package storage saves and loads the market and trading records of the bot through a
+common interface, whatever the backend.
+
+Three backends are available:
+
+	OpenMySQL   the MySQL database of the services (see bitbot/database/migrations.go)
+	OpenSQLite  a SQLite file, created with its schema on the first use
+	OpenDir     a directory of append-only JSONL or CSV files, one per kind of record
+
+The SQLite backend uses the "sqlite3" database/sql driver, which the binaries opening
+it must register. The services register it through services.OpenStore:
+
+	import _ "github.com/mattn/go-sqlite3"
+
+The local backends let the recorder, the backtests and the tests run without a MySQL
+server.
+*/
+package storage
+
+import (
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Book is an order book snapshot.
+type Book struct {
+	Pair exchanger.Pair
+	// Time is the time of the snapshot (see exchanger.OrderBook.Time).
+	Time time.Time
+	*exchanger.OrderBook
+}
+
+// Arbitrage is an opportunity seen by the recorder: the ask of BuyEx below the bid of
+// SellEx.
+type Arbitrage struct {
+	BuyEx     string
+	SellEx    string
+	Pair      exchanger.Pair
+	Time      time.Time
+	BuyPrice  float64
+	SellPrice float64
+	Volume    float64
+	Spread    float64
+}
+
+// Episode is a sequence of crossings of the same venues seen by the recorder (see
+// bitbot/episode).
+type Episode struct {
+	Pair   exchanger.Pair
+	BuyEx  string
+	SellEx string
+	// Start and End are the times of the first and the last crossings.
+	Start      time.Time
+	End        time.Time
+	PeakSpread float64
+	AvgVolume  float64
+	Snapshots  int
+}
+
+// Latency summarizes the fetch latencies of the books of an exchanger over the period
+// ending at Time (see bitbot/latency).
+type Latency struct {
+	Time      time.Time
+	Exchanger string
+	Samples   int
+	// Errors counts the failed fetches.
+	Errors int
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// MarketSummary is the 24h summary of a Bittrex market.
+type MarketSummary struct {
+	MarketName     string
+	High           float64
+	Low            float64
+	Ask            float64
+	Bid            float64
+	OpenBuyOrders  int
+	OpenSellOrders int
+	Volume         float64
+	Last           float64
+	BaseVolume     float64
+	PrevDay        float64
+	Time           time.Time
+}
+
+// Order is the acknowledgement of an order placed by the bot.
+type Order struct {
+	ArbitrageID string
+	// ExternalID is the order id returned by the exchanger, or a trade id for the
+	// exchangers filling market orders at once.
+	ExternalID string
+	Exchanger  string
+	Pair       exchanger.Pair
+	Side       string
+}
+
+// Trade is a trade of the account. ArbitrageID is empty for the trades not attributed
+// to an order of the bot.
+type Trade struct {
+	Exchanger   string
+	ArbitrageID string
+	exchanger.Trade
+}
+
+// Balance is the balance of a currency in an account at the time of a snapshot.
+type Balance struct {
+	Time      time.Time
+	Exchanger string
+	// Account is "main" or "trading".
+	Account  string
+	Currency string
+	Balance  float64
+	// Values maps the valuation currencies (BTC, USD, EUR) to the value of the balance.
+	Values map[string]float64
+}
+
+// Store saves and loads the records. Time ranges include from and exclude to, and the
+// records are returned in chronological order.
+type Store interface {
+	// SaveBooks ignores the snapshots already saved (same exchanger, pair and time).
+	SaveBooks(books []*Book) error
+	Books(pair exchanger.Pair, from, to time.Time) ([]*Book, error)
+
+	SaveArbitrages(arbitrages []*Arbitrage) error
+	Arbitrages(pair exchanger.Pair, from, to time.Time) ([]*Arbitrage, error)
+
+	SaveEpisodes(episodes []*Episode) error
+	// Episodes returns the episodes of a pair started in the range.
+	Episodes(pair exchanger.Pair, from, to time.Time) ([]*Episode, error)
+
+	// SaveLatencies ignores the statistics already saved (same exchanger and time).
+	SaveLatencies(latencies []*Latency) error
+	Latencies(from, to time.Time) ([]*Latency, error)
+
+	// SaveMarketSummaries ignores the summaries already saved (same market and time).
+	SaveMarketSummaries(summaries []*MarketSummary) error
+	MarketSummaries(market string, from, to time.Time) ([]*MarketSummary, error)
+
+	SaveOrders(orders []*Order) error
+	// Orders returns the orders of an exchanger, of every exchanger if empty.
+	Orders(exchanger string) ([]*Order, error)
+
+	// SaveTrades replaces the trades already saved (same exchanger and id).
+	SaveTrades(trades []*Trade) error
+	// Trades returns the trades of an exchanger, of every exchanger if empty.
+	Trades(exchanger string, pair exchanger.Pair, from, to time.Time) ([]*Trade, error)
+
+	SaveBalances(balances []*Balance) error
+	Balances(from, to time.Time) ([]*Balance, error)
+
+	// SavePublicTrades ignores the trades already saved (same exchanger, pair and id).
+	SavePublicTrades(trades []*exchanger.PublicTrade) error
+	// PublicTrades returns the tape of an exchanger, of every exchanger if empty.
+	PublicTrades(exchanger string, pair exchanger.Pair, from, to time.Time) ([]*exchanger.PublicTrade, error)
+
+	Close() error
+}
+
+// valuationCurrencies are the currencies balances are valued in.
+var valuationCurrencies = []string{"BTC", "USD", "EUR"}
+
+// timeLayout is the format of the times in text: SQLite columns and CSV files.
+const timeLayout = "2006-01-02 15:04:05.000000"
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+// inRange reports whether t is in [from, to).
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+// millis converts a duration to milliseconds, the unit of the latency columns.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func fromMillis(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"bitbot/exchanger"
+)
+
+func TestDirStore(t *testing.T) {
+	for _, format := range []string{JSONL, CSV} {
+		dir, err := ioutil.TempDir("", "storage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		s, err := OpenDir(dir, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testStore(t, format, s)
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenSQLite(filepath.Join(dir, "bitbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	testStore(t, "sqlite", s)
+}
+
+// testStore checks a store with every kind of record.
+func testStore(t *testing.T, name string, s Store) {
+	t0 := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	t2 := t0.Add(time.Hour)
+
+	book := func(ex string, ts time.Time, price float64) *Book {
+		return &Book{Pair: exchanger.ZEC_BTC, Time: ts, OrderBook: &exchanger.OrderBook{
+			Exchanger: ex,
+			Bids:      []*exchanger.Order{{Price: price, Volume: 1}},
+			Asks:      []*exchanger.Order{{Price: price + 0.001, Volume: 2}},
+			Sent:      ts.Add(-time.Second),
+			Received:  ts.Add(time.Second),
+		}}
+	}
+
+	// saved out of order, with a duplicate snapshot
+	if err := s.SaveBooks([]*Book{book("Kraken", t1, 0.02), book("Kraken", t0, 0.01)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveBooks([]*Book{book("Kraken", t1, 0.03), book("Poloniex", t2, 0.01)}); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := s.Books(exchanger.ZEC_BTC, t0, t2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(books) != 2 {
+		t.Fatalf("%s: 2 books expected, got %d", name, len(books))
+	}
+	if !books[0].Time.Equal(t0) || books[1].Bids[0].Price != 0.02 {
+		t.Errorf("%s: books should be sorted without duplicates, got %v %v", name, books[0], books[1])
+	}
+	if !books[1].Sent.Equal(t1.Add(-time.Second)) || !books[1].ExchangeTime.IsZero() {
+		t.Errorf("%s: wrong book times %v %v", name, books[1].Sent, books[1].ExchangeTime)
+	}
+
+	episodes := []*Episode{
+		{Pair: exchanger.ZEC_BTC, BuyEx: "Kraken", SellEx: "Poloniex", Start: t0, End: t1, PeakSpread: 0.5,
+			AvgVolume: 1.5, Snapshots: 3},
+		{Pair: exchanger.ZEC_BTC, BuyEx: "Poloniex", SellEx: "Kraken", Start: t2, End: t2, PeakSpread: 0.2,
+			AvgVolume: 1, Snapshots: 1},
+	}
+	if err := s.SaveEpisodes(episodes); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded, err := s.Episodes(exchanger.ZEC_BTC, t0, t2); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(loaded, episodes[:1]) {
+		t.Errorf("%s: expected episodes %v, got %v", name, episodes[:1], loaded)
+	}
+
+	latency := func(ex string, ts time.Time, samples int) *Latency {
+		return &Latency{Time: ts, Exchanger: ex, Samples: samples, Errors: 1, P50: 120 * time.Millisecond,
+			P90: 300 * time.Millisecond, P99: 1500 * time.Millisecond, Max: 2 * time.Second}
+	}
+
+	// a duplicate of the statistics of t0
+	if err := s.SaveLatencies([]*Latency{latency("Kraken", t0, 10), latency("Poloniex", t0, 5)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveLatencies([]*Latency{latency("Kraken", t0, 12), latency("Kraken", t2, 8)}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLatencies := []*Latency{latency("Kraken", t0, 10), latency("Poloniex", t0, 5)}
+	if loaded, err := s.Latencies(t0, t2); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(loaded, expectedLatencies) {
+		t.Errorf("%s: expected latencies %v, got %v", name, expectedLatencies, loaded)
+	}
+
+	trade := func(id string, ts time.Time, arbitrage string) *Trade {
+		return &Trade{Exchanger: "Kraken", ArbitrageID: arbitrage, Trade: exchanger.Trade{ID: id, OrderID: "o" + id,
+			Pair: exchanger.ZEC_BTC, Side: exchanger.Buy, Price: 0.01, Volume: 1.5, Fee: 0.0001, FeeCurrency: "BTC", Time: ts}}
+	}
+
+	// the second version of t1 is attributed
+	if err := s.SaveTrades([]*Trade{trade("t1", t1, ""), trade("t2", t0, "")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveTrades([]*Trade{trade("t1", t1, "a1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	trades, err := s.Trades("", exchanger.ZEC_BTC, t0, t2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Trade{trade("t2", t0, ""), trade("t1", t1, "a1")}
+	if !reflect.DeepEqual(trades, expected) {
+		t.Errorf("%s: expected trades %v, got %v", name, expected, trades)
+	}
+
+	balances := []*Balance{
+		{Time: t0, Exchanger: "Kraken", Account: "main", Currency: "ZEC", Balance: 10,
+			Values: map[string]float64{"BTC": 0.1}},
+		{Time: t2, Exchanger: "Kraken", Account: "main", Currency: "ZEC", Balance: 8, Values: map[string]float64{}},
+	}
+	if err := s.SaveBalances(balances); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := s.Balances(t0, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, balances[:1]) {
+		t.Errorf("%s: expected balances %v, got %v", name, balances[:1], loaded)
+	}
+
+	if err := s.SaveOrders([]*Order{{ArbitrageID: "a1", ExternalID: "ot1", Exchanger: "Kraken",
+		Pair: exchanger.ZEC_BTC, Side: exchanger.Buy}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if orders, err := s.Orders("Poloniex"); err != nil || len(orders) != 0 {
+		t.Errorf("%s: no Poloniex order expected, got %v (%v)", name, orders, err)
+	}
+	if orders, err := s.Orders(""); err != nil || len(orders) != 1 || orders[0].Pair != exchanger.ZEC_BTC {
+		t.Errorf("%s: 1 order expected, got %v (%v)", name, orders, err)
+	}
+
+	tape := func(ex, id string, ts time.Time) *exchanger.PublicTrade {
+		return &exchanger.PublicTrade{Exchanger: ex, Pair: exchanger.ZEC_BTC, ID: id, Price: 0.01, Volume: 2,
+			Side: exchanger.Sell, Time: ts}
+	}
+
+	// a page overlapping the previous one
+	if err := s.SavePublicTrades([]*exchanger.PublicTrade{tape("Kraken", "p1", t0), tape("Kraken", "p2", t1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SavePublicTrades([]*exchanger.PublicTrade{tape("Kraken", "p2", t1), tape("Poloniex", "p2", t1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if tapes, err := s.PublicTrades("Kraken", exchanger.ZEC_BTC, t0, t2); err != nil || len(tapes) != 2 {
+		t.Errorf("%s: 2 Kraken public trades expected, got %v (%v)", name, tapes, err)
+	}
+	if tapes, err := s.PublicTrades("", exchanger.ZEC_BTC, t1, t2); err != nil || len(tapes) != 2 {
+		t.Errorf("%s: 2 public trades expected, got %v (%v)", name, tapes, err)
+	} else if !reflect.DeepEqual(tapes[0], tape("Kraken", "p2", t1)) {
+		t.Errorf("%s: expected %v, got %v", name, tape("Kraken", "p2", t1), tapes[0])
+	}
+}
@@ -0,0 +1,171 @@
+package strategy
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Opportunity is a crossing between the best ask of an exchanger and the best bid
+// of another one.
+type Opportunity struct {
+	ID     string
+	Time   time.Time
+	Pair   exchanger.Pair
+	BuyEx  *exchanger.OrderBook
+	SellEx *exchanger.OrderBook
+	Vol    float64
+	Spread float64
+}
+
+func (o *Opportunity) String() string {
+	return fmt.Sprintf("Buy %s at %2f and Sell %s at %2f | pair: %s | spread: %2.2f%% | vol: %f",
+		o.BuyEx.Exchanger,
+		o.BuyEx.Asks[0].Price,
+		o.SellEx.Exchanger,
+		o.SellEx.Bids[0].Price,
+		o.Pair,
+		o.Spread,
+		o.Vol,
+	)
+}
+
+// FindOpportunity returns the opportunity of buying on buyEx and selling on sellEx,
+// or nil if the books don't cross.
+func FindOpportunity(pair exchanger.Pair, buyEx, sellEx *exchanger.OrderBook, ts time.Time) *Opportunity {
+	buyOrder := buyEx.Asks[0]
+	sellOrder := sellEx.Bids[0]
+
+	if buyOrder.Price >= sellOrder.Price {
+		return nil
+	}
+
+	return &Opportunity{
+		ID:     opportunityID(ts, pair, buyEx.Exchanger, sellEx.Exchanger),
+		Time:   ts,
+		Pair:   pair,
+		BuyEx:  buyEx,
+		SellEx: sellEx,
+		Vol:    math.Min(buyOrder.Volume, sellOrder.Volume),
+		Spread: 100 * (sellOrder.Price/buyOrder.Price - 1),
+	}
+}
+
+func opportunityID(ts time.Time, pair exchanger.Pair, buyEx, sellEx string) string {
+	key := fmt.Sprintf("%d-%s-%s-%s", ts.UnixNano(), pair.String(), buyEx, sellEx)
+	h := md5.New()
+	h.Write([]byte(key))
+	b := h.Sum(nil)
+	return hex.EncodeToString(b)
+}
+
+// Arbitrage is the cross-exchange arbitrage strategy. It keeps the last book of each
+// exchanger and, each time a book arrives, looks for crossings with the other books.
+// Each opportunity yields a market buy and a market sell sharing the same Group.
+type Arbitrage struct {
+	Pair exchanger.Pair
+	// MinSpread is the minimum spread in percent.
+	MinSpread float64
+	// MinVolume is the minimum volume available at the top of both books.
+	MinVolume float64
+	// MaxBookAge discards books taken too long ago (0 keeps them forever).
+	MaxBookAge time.Duration
+	// MaxBookSkew is the maximum time between the snapshots of two books compared
+	// (0 disables the check).
+	MaxBookSkew time.Duration
+
+	books map[string]*BookEvent
+}
+
+// NewArbitrage returns a new Arbitrage strategy.
+func NewArbitrage(pair exchanger.Pair, minSpread, minVolume float64) *Arbitrage {
+	return &Arbitrage{
+		Pair:      pair,
+		MinSpread: minSpread,
+		MinVolume: minVolume,
+		books:     map[string]*BookEvent{},
+	}
+}
+
+func (a *Arbitrage) Name() string {
+	return "arbitrage"
+}
+
+func (a *Arbitrage) OnEvent(ev Event) []*Intent {
+	e, ok := ev.(*BookEvent)
+	if !ok || e.Pair != a.Pair {
+		return nil
+	}
+
+	// a book slow to come is already stale
+	if a.MaxBookAge > 0 && e.Time.Sub(e.BookTime()) > a.MaxBookAge {
+		log.Printf("Arbitrage: %s book discarded, fetched in %s\n", e.Book.Exchanger, e.Book.Latency())
+		return nil
+	}
+
+	intents := []*Intent{}
+	for ex, other := range a.books {
+		if ex == e.Book.Exchanger {
+			continue
+		}
+
+		if a.MaxBookAge > 0 && e.Time.Sub(other.BookTime()) > a.MaxBookAge {
+			delete(a.books, ex)
+			continue
+		}
+
+		if a.MaxBookSkew > 0 && exchanger.Skew(e.Book, other.Book) > a.MaxBookSkew {
+			continue
+		}
+
+		for _, o := range []*Opportunity{
+			FindOpportunity(a.Pair, e.Book, other.Book, e.Time),
+			FindOpportunity(a.Pair, other.Book, e.Book, e.Time),
+		} {
+			if o == nil || o.Spread < a.MinSpread || o.Vol < a.MinVolume {
+				continue
+			}
+
+			log.Println(o)
+			intents = append(intents, a.intents(o)...)
+		}
+	}
+
+	a.books[e.Book.Exchanger] = e
+	return intents
+}
+
+func (a *Arbitrage) intents(o *Opportunity) []*Intent {
+	buy := &Intent{
+		ID:        o.ID + "-buy",
+		Group:     o.ID,
+		Strategy:  a.Name(),
+		Time:      o.Time,
+		Exchanger: o.BuyEx.Exchanger,
+		Pair:      o.Pair,
+		Side:      Buy,
+		Type:      Market,
+		Price:     o.BuyEx.Asks[0].Price,
+		Volume:    o.Vol,
+	}
+
+	sell := &Intent{
+		ID:        o.ID + "-sell",
+		Group:     o.ID,
+		Strategy:  a.Name(),
+		Time:      o.Time,
+		Exchanger: o.SellEx.Exchanger,
+		Pair:      o.Pair,
+		Side:      Sell,
+		Type:      Market,
+		Price:     o.SellEx.Bids[0].Price,
+		Volume:    o.Vol,
+	}
+
+	return []*Intent{buy, sell}
+}
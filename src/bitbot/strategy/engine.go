@@ -0,0 +1,195 @@
+package strategy
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// A Feed produces the events of one engine cycle. The returned channel is closed
+// when the cycle is over.
+type Feed interface {
+	Events() <-chan Event
+}
+
+// A Risk check validates the intents returned by a strategy before they are executed.
+// It may drop or resize intents. Intents sharing a Group are passed together.
+type Risk interface {
+	Check(intents []*Intent, balances Balances) ([]*Intent, error)
+}
+
+// An Executor sends intents to the exchangers.
+type Executor interface {
+	Execute(intents []*Intent) []*Execution
+}
+
+// An Observer is an Executor that needs to see market data (a paper executor matching
+// resting orders against the books for instance). Observe returns the resulting fills.
+type Observer interface {
+	Observe(ev Event) []*Fill
+}
+
+// A Store persists intents and their executions. SaveIntents is called before the
+// intents are executed.
+type Store interface {
+	SaveIntents(intents []*Intent) error
+	SaveExecutions(execs []*Execution) error
+}
+
+// Execution is the outcome of an intent.
+type Execution struct {
+	Intent *Intent
+	// OrderIDs are the identifiers returned by the exchanger.
+	OrderIDs []string
+	Fills    []*Fill
+	Err      error
+}
+
+// Engine drives a Strategy. It pulls events from the Feed, runs intents through the Risk
+// check, persists them in the Store and executes them with the Executor.
+type Engine struct {
+	Strategy Strategy
+	Feed     Feed
+	Risk     Risk
+	Executor Executor
+	// Store is optional.
+	Store Store
+
+	balances Balances
+}
+
+// NewEngine returns a new Engine.
+func NewEngine(s Strategy, f Feed, r Risk, x Executor, st Store) *Engine {
+	return &Engine{s, f, r, x, st, Balances{}}
+}
+
+// RunOnce consumes one cycle of the feed and returns the executions it triggered.
+func (e *Engine) RunOnce() []*Execution {
+	execs := []*Execution{}
+	for ev := range e.Feed.Events() {
+		execs = append(execs, e.dispatch(ev)...)
+	}
+	return execs
+}
+
+// Run calls RunOnce forever and waits `period` between two cycles.
+func (e *Engine) Run(period time.Duration) {
+	for {
+		e.RunOnce()
+		log.Printf("Waiting %s before next cycle...\n", period)
+		time.Sleep(period)
+	}
+}
+
+func (e *Engine) dispatch(ev Event) []*Execution {
+	if b, ok := ev.(*BalanceEvent); ok {
+		e.balances = b.Balances.Copy()
+	}
+
+	execs := []*Execution{}
+
+	if o, ok := e.Executor.(Observer); ok {
+		for _, f := range o.Observe(ev) {
+			execs = append(execs, e.dispatch(&FillEvent{ev.EventTime(), f})...)
+		}
+	}
+
+	intents := e.Strategy.OnEvent(ev)
+	if len(intents) == 0 {
+		return execs
+	}
+
+	for _, group := range groupIntents(intents) {
+		execs = append(execs, e.execute(group)...)
+	}
+
+	return execs
+}
+
+func (e *Engine) execute(intents []*Intent) []*Execution {
+	if e.Risk != nil {
+		var err error
+		intents, err = e.Risk.Check(intents, e.balances)
+		if err != nil {
+			log.Printf("Engine: intents rejected by risk check - %s\n", err)
+			return nil
+		}
+	}
+
+	if len(intents) == 0 {
+		return nil
+	}
+
+	for _, i := range intents {
+		log.Println(i)
+	}
+
+	// intents are persisted before being sent so that a restarted trader can find the
+	// orders it may have placed. Nothing is sent when they can't be: the strategy gets
+	// failed executions instead.
+	var execs []*Execution
+	if e.Store != nil {
+		if err := e.Store.SaveIntents(intents); err != nil {
+			err = fmt.Errorf("Engine: SaveIntents failed, intents not sent - %s", err)
+			execs = failed(intents, err)
+		}
+	}
+
+	if execs == nil {
+		execs = e.Executor.Execute(intents)
+
+		if e.Store != nil {
+			if err := e.Store.SaveExecutions(execs); err != nil {
+				log.Printf("Engine: SaveExecutions failed - %s\n", err)
+			}
+		}
+	}
+
+	out := execs
+	for _, x := range execs {
+		out = append(out, e.dispatch(&OrderEvent{x.Intent.Time, x})...)
+
+		if x.Err != nil {
+			log.Printf("Engine: cannot execute %s - %s\n", x.Intent, x.Err)
+			continue
+		}
+
+		for _, f := range x.Fills {
+			out = append(out, e.dispatch(&FillEvent{x.Intent.Time, f})...)
+		}
+	}
+
+	return out
+}
+
+// failed returns an execution failing with err for each intent.
+func failed(intents []*Intent, err error) []*Execution {
+	execs := make([]*Execution, len(intents))
+	for i, intent := range intents {
+		execs[i] = &Execution{Intent: intent, Err: err}
+	}
+	return execs
+}
+
+// groupIntents splits intents by Group while preserving their order.
+func groupIntents(intents []*Intent) [][]*Intent {
+	groups := [][]*Intent{}
+	index := map[string]int{}
+
+	for _, i := range intents {
+		if i.Group == "" {
+			groups = append(groups, []*Intent{i})
+			continue
+		}
+
+		n, ok := index[i.Group]
+		if !ok {
+			n = len(groups)
+			index[i.Group] = n
+			groups = append(groups, nil)
+		}
+		groups[n] = append(groups[n], i)
+	}
+
+	return groups
+}
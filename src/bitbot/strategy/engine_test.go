@@ -0,0 +1,204 @@
+package strategy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+func book(ex string, bid, ask, vol float64) *exchanger.OrderBook {
+	return &exchanger.OrderBook{
+		Exchanger: ex,
+		Bids:      []*exchanger.Order{{Price: bid, Volume: vol}},
+		Asks:      []*exchanger.Order{{Price: ask, Volume: vol}},
+	}
+}
+
+func TestArbitrageBacktest(t *testing.T) {
+	pair := exchanger.ZEC_BTC
+	now := time.Now()
+
+	balances := Balances{
+		"A": {"ZEC": 10, "BTC": 1},
+		"B": {"ZEC": 10, "BTC": 1},
+	}
+
+	cycles := [][]Event{
+		{
+			&BalanceEvent{now, balances},
+			&BookEvent{now, pair, book("A", 0.099, 0.100, 5)},
+			&BookEvent{now, pair, book("B", 0.102, 0.103, 2)},
+		},
+		{
+			&BookEvent{now.Add(time.Minute), pair, book("A", 0.099, 0.100, 5)},
+		},
+	}
+
+	arb := NewArbitrage(pair, 0.8, 0.1)
+	arb.MaxBookAge = 30 * time.Second
+	arb.MaxBookSkew = 30 * time.Second
+	paper := NewPaperExecutor(balances, 0)
+	feed := NewReplayFeed(cycles)
+	engine := NewEngine(arb, feed, &BalanceRisk{}, paper, nil)
+
+	execs := engine.RunOnce()
+	if len(execs) != 2 {
+		t.Fatalf("2 executions expected, got %d", len(execs))
+	}
+
+	for _, x := range execs {
+		if x.Err != nil {
+			t.Fatal(x.Err)
+		}
+		if x.Intent.Volume != 2 {
+			t.Errorf("volume should be capped to 2, got %f", x.Intent.Volume)
+		}
+	}
+
+	b, _ := paper.Balances()
+	if b["A"]["ZEC"] != 12 || b["B"]["ZEC"] != 8 {
+		t.Errorf("unexpected ZEC balances %v", b)
+	}
+
+	// the book of B is now stale
+	if execs := engine.RunOnce(); len(execs) != 0 {
+		t.Errorf("stale books should be ignored, got %d executions", len(execs))
+	}
+
+	if !feed.Done() {
+		t.Error("feed should be done")
+	}
+
+	// the replayed books are stamped with the time of their event
+	if skew := exchanger.Skew(cycles[1][0].(*BookEvent).Book, cycles[0][2].(*BookEvent).Book); skew != time.Minute {
+		t.Errorf("replayed books should be a minute apart, got %s", skew)
+	}
+}
+
+func TestStoreReplayFeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := storage.OpenDir(dir, storage.JSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	pair := exchanger.ZEC_BTC
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	err = store.SaveBooks([]*storage.Book{
+		{Pair: pair, Time: now, OrderBook: book("A", 0.099, 0.100, 5)},
+		{Pair: pair, Time: now.Add(2 * time.Second), OrderBook: book("B", 0.102, 0.103, 2)},
+		{Pair: pair, Time: now.Add(time.Minute), OrderBook: book("A", 0.099, 0.100, 5)},
+		{Pair: exchanger.BTC_USD, Time: now, OrderBook: book("A", 2500, 2510, 1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := NewStoreReplayFeed(store, pair, now, now.Add(time.Hour), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the books of a same poll are replayed in a same cycle
+	for _, expected := range []int{2, 1} {
+		n := 0
+		for ev := range feed.Events() {
+			if e := ev.(*BookEvent); e.Pair != pair || !e.Book.Time().Equal(e.Time) {
+				t.Errorf("unexpected event %+v", e)
+			}
+			n++
+		}
+		if n != expected {
+			t.Errorf("%d books expected in the cycle, got %d", expected, n)
+		}
+	}
+
+	if !feed.Done() {
+		t.Error("feed should be done")
+	}
+}
+
+func TestArbitrageBookTimes(t *testing.T) {
+	pair := exchanger.ZEC_BTC
+	now := time.Now()
+
+	timed := func(b *exchanger.OrderBook, sent time.Time, latency time.Duration) *exchanger.OrderBook {
+		b.Sent = sent
+		b.Received = sent.Add(latency)
+		return b
+	}
+
+	a := NewArbitrage(pair, 0.8, 0.1)
+	a.MaxBookAge = 20 * time.Second
+	a.MaxBookSkew = 5 * time.Second
+
+	// the book took 50 seconds to come: it is discarded
+	a.OnEvent(&BookEvent{now, pair, timed(book("C", 0.102, 0.103, 5), now.Add(-50*time.Second), 50*time.Second)})
+
+	// the books cross but were taken 10 seconds apart
+	a.OnEvent(&BookEvent{now, pair, timed(book("A", 0.099, 0.100, 5), now.Add(-10*time.Second), time.Second)})
+	if intents := a.OnEvent(&BookEvent{now, pair, timed(book("B", 0.102, 0.103, 5), now, time.Second)}); len(intents) != 0 {
+		t.Errorf("skewed books shouldn't be arbitraged, got %v", intents)
+	}
+
+	// only B is arbitraged with the fresh A book
+	if intents := a.OnEvent(&BookEvent{now, pair, timed(book("A", 0.099, 0.100, 5), now.Add(-2*time.Second), time.Second)}); len(intents) != 2 {
+		t.Errorf("one arbitrage was expected, got %v", intents)
+	}
+}
+
+// failingStore fails to save the intents.
+type failingStore struct{}
+
+func (failingStore) SaveIntents(intents []*Intent) error {
+	return errors.New("connection lost")
+}
+
+func (failingStore) SaveExecutions(execs []*Execution) error {
+	return nil
+}
+
+func TestEngineSaveIntentsFailure(t *testing.T) {
+	pair := exchanger.ZEC_BTC
+	now := time.Now()
+
+	mm := NewMarketMaker("A", pair, nil)
+	mm.QuoteSize = 1
+
+	paper := NewPaperExecutor(Balances{"A": {"ZEC": 10, "BTC": 10}}, 0)
+	feed := NewReplayFeed([][]Event{
+		{
+			&BalanceEvent{now, Balances{"A": {"ZEC": 10, "BTC": 10}}},
+			&BookEvent{now, pair, book("A", 0.99, 1.01, 10)},
+		},
+	})
+	engine := NewEngine(mm, feed, nil, paper, failingStore{})
+
+	execs := engine.RunOnce()
+	if len(execs) != 2 {
+		t.Fatalf("two failed executions were expected, got %d", len(execs))
+	}
+	for _, x := range execs {
+		if x.Err == nil {
+			t.Errorf("%s shouldn't have been executed", x.Intent)
+		}
+	}
+
+	if len(paper.open) != 0 {
+		t.Errorf("no order should be sent, got %d", len(paper.open))
+	}
+	if len(mm.quotes) != 0 {
+		t.Errorf("no quote should be live, got %d", len(mm.quotes))
+	}
+}
@@ -0,0 +1,126 @@
+package strategy
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"bitbot/errorutils"
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+// BookFunc fetches the order book of a pair.
+type BookFunc func(exchanger.Pair) (*exchanger.OrderBook, error)
+
+// LiveFeed fetches balances and then order books from the exchangers. Books are
+// fetched concurrently and delivered as soon as they arrive.
+type LiveFeed struct {
+	Pair      exchanger.Pair
+	BookFuncs map[string]BookFunc
+	// Balances is optional. When it fails the cycle is skipped.
+	Balances func() (Balances, error)
+}
+
+// NewLiveFeed returns a new LiveFeed.
+func NewLiveFeed(pair exchanger.Pair, bookFuncs map[string]BookFunc, balances func() (Balances, error)) *LiveFeed {
+	return &LiveFeed{pair, bookFuncs, balances}
+}
+
+func (f *LiveFeed) Events() <-chan Event {
+	c := make(chan Event)
+
+	go func() {
+		defer close(c)
+
+		if f.Balances != nil {
+			b, err := f.Balances()
+			if err != nil {
+				log.Printf("LiveFeed: cannot retrieve balances - %s\n", err)
+				return
+			}
+			c <- &BalanceEvent{time.Now(), b}
+		}
+
+		var wg sync.WaitGroup
+		for ex, bookFunc := range f.BookFuncs {
+			wg.Add(1)
+			go func(ex string, bookFunc BookFunc) {
+				defer wg.Done()
+				defer errorutils.LogPanic()
+
+				log.Printf("Fetching %s orderbook for pair %s...", ex, f.Pair)
+				book, err := exchanger.Fetch(bookFunc, f.Pair)
+				if err != nil {
+					log.Printf("LiveFeed: failed to retrieve %s orderbook for pair %s - %s\n", ex, f.Pair, err)
+					return
+				}
+				c <- &BookEvent{time.Now(), f.Pair, book}
+			}(ex, bookFunc)
+		}
+		wg.Wait()
+	}()
+
+	return c
+}
+
+// ReplayFeed replays recorded cycles of events. It is used to backtest strategies.
+type ReplayFeed struct {
+	cycles [][]Event
+	next   int
+}
+
+// NewReplayFeed returns a feed delivering one element of cycles per engine cycle.
+func NewReplayFeed(cycles [][]Event) *ReplayFeed {
+	return &ReplayFeed{cycles, 0}
+}
+
+// NewStoreReplayFeed returns a feed replaying the books of pair recorded in store between
+// from and to. A cycle holds the books snapshotted within period of its first one, so
+// period is usually the polling interval of the recorder.
+func NewStoreReplayFeed(store storage.Store, pair exchanger.Pair, from, to time.Time, period time.Duration) (*ReplayFeed, error) {
+	books, err := store.Books(pair, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s books - %s", pair, err)
+	}
+
+	cycles := [][]Event{}
+	var start time.Time
+	for _, b := range books {
+		if len(cycles) == 0 || !b.Time.Before(start.Add(period)) {
+			cycles = append(cycles, []Event{})
+			start = b.Time
+		}
+		last := len(cycles) - 1
+		cycles[last] = append(cycles[last], &BookEvent{b.Time, pair, b.OrderBook})
+	}
+
+	return NewReplayFeed(cycles), nil
+}
+
+// Done reports whether all cycles were replayed.
+func (f *ReplayFeed) Done() bool {
+	return f.next >= len(f.cycles)
+}
+
+func (f *ReplayFeed) Events() <-chan Event {
+	var events []Event
+	if !f.Done() {
+		events = f.cycles[f.next]
+		f.next++
+	}
+
+	c := make(chan Event, len(events))
+	for _, ev := range events {
+		// like Fetch for live books, stamp the books lacking timestamps so that they
+		// can be compared with exchanger.Skew
+		if e, ok := ev.(*BookEvent); ok && e.Book.Received.IsZero() {
+			e.Book.Sent = e.Time
+			e.Book.Received = e.Time
+		}
+		c <- ev
+	}
+	close(c)
+	return c
+}
@@ -0,0 +1,320 @@
+package strategy
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// MarketMaker quotes both sides of a single exchanger around a fair price.
+//
+// The fair price is the mid price of the consolidated book of the Reference exchangers
+// (the quoted exchanger's own book is used when Reference is empty). Quotes are skewed
+// against the inventory: when holding more than TargetInventory both quotes move down
+// so that the ask is more likely to be hit, and conversely. Quotes are replaced when
+// the fair price moves by more than RefreshThreshold and they are cancelled as soon as
+// the market data becomes stale.
+type MarketMaker struct {
+	Exchanger string
+	Pair      exchanger.Pair
+	Reference []string
+
+	// HalfSpread is the distance between the fair price and each quote (0.002 for 0.2%).
+	HalfSpread float64
+	// Skew is the fraction of the fair price the quotes move by when the inventory is at
+	// its limit.
+	Skew float64
+	// RefreshThreshold is the relative move of a quote price that triggers a replacement.
+	RefreshThreshold float64
+	// MaxDataAge is the age past which books are considered stale.
+	MaxDataAge time.Duration
+	// MaxDataSkew is the maximum time between the snapshot of a reference book and the
+	// snapshot of the quoted exchanger's book (0 disables the check).
+	MaxDataSkew time.Duration
+
+	// QuoteSize is the maximum volume of each quote.
+	QuoteSize float64
+	// MinQuoteSize is the volume under which no quote is placed.
+	MinQuoteSize float64
+	// TargetInventory is the base currency position the strategy tries to hold.
+	TargetInventory float64
+	// MaxInventory is the maximum distance between the inventory and TargetInventory.
+	MaxInventory float64
+
+	seq       int
+	books     map[string]*BookEvent
+	inventory float64
+	quotes    map[string]*quote
+	// cancelling holds the quotes being cancelled by order ID. They are forgotten once
+	// the cancellation succeeds or after maxCancelAttempts failures.
+	cancelling map[string]*quote
+}
+
+// maxCancelAttempts is the number of failed cancellations after which a quote is assumed
+// to be already filled or cancelled.
+const maxCancelAttempts = 3
+
+type quote struct {
+	orderID  string
+	side     string
+	price    float64
+	volume   float64
+	attempts int
+}
+
+// NewMarketMaker returns a MarketMaker quoting pair on ex.
+func NewMarketMaker(ex string, pair exchanger.Pair, reference []string) *MarketMaker {
+	return &MarketMaker{
+		Exchanger:        ex,
+		Pair:             pair,
+		Reference:        reference,
+		HalfSpread:       0.003,
+		Skew:             0.002,
+		RefreshThreshold: 0.001,
+		MaxDataAge:       time.Minute,
+		books:            map[string]*BookEvent{},
+		quotes:           map[string]*quote{},
+		cancelling:       map[string]*quote{},
+	}
+}
+
+func (m *MarketMaker) Name() string {
+	return "marketmaking"
+}
+
+func (m *MarketMaker) OnEvent(ev Event) []*Intent {
+	switch e := ev.(type) {
+	case *BookEvent:
+		if e.Pair == m.Pair {
+			m.books[e.Book.Exchanger] = e
+		}
+	case *BalanceEvent:
+		m.inventory = e.Balances[m.Exchanger][m.Pair.Base]
+	case *FillEvent:
+		m.onFill(e.Fill)
+		return nil
+	case *OrderEvent:
+		return m.onOrder(e.Execution)
+	default:
+		return nil
+	}
+
+	return m.requote(ev.EventTime())
+}
+
+func (m *MarketMaker) onFill(f *Fill) {
+	if f.Exchanger != m.Exchanger || f.Pair != m.Pair {
+		return
+	}
+
+	if f.Side == Buy {
+		m.inventory += f.Volume
+	} else {
+		m.inventory -= f.Volume
+	}
+
+	if q, ok := m.cancelling[f.OrderID]; ok {
+		q.volume -= f.Volume
+		if q.volume <= 0 {
+			delete(m.cancelling, f.OrderID)
+		}
+		return
+	}
+
+	q, ok := m.quotes[f.Side]
+	if ok && q.orderID == f.OrderID {
+		q.volume -= f.Volume
+		if q.volume <= 0 {
+			delete(m.quotes, f.Side)
+		}
+	}
+}
+
+func (m *MarketMaker) onOrder(x *Execution) []*Intent {
+	i := x.Intent
+	if i.Strategy != m.Name() || i.Exchanger != m.Exchanger {
+		return nil
+	}
+
+	if i.Type == Cancel {
+		return m.onCancel(x)
+	}
+
+	if x.Err != nil || len(x.OrderIDs) == 0 {
+		return nil
+	}
+
+	m.quotes[i.Side] = &quote{orderID: x.OrderIDs[0], side: i.Side, price: i.Price, volume: i.Volume}
+	return nil
+}
+
+// onCancel forgets the quote once its cancellation succeeded and issues the cancellation
+// again when it failed: the order may still be live on the exchanger.
+func (m *MarketMaker) onCancel(x *Execution) []*Intent {
+	q, ok := m.cancelling[x.Intent.OrderID]
+	if !ok {
+		return nil
+	}
+
+	if x.Err == nil {
+		delete(m.cancelling, q.orderID)
+		return nil
+	}
+
+	if q.attempts >= maxCancelAttempts {
+		log.Printf("MarketMaker: cannot cancel order %s after %d attempts, forgetting it - %s\n",
+			q.orderID, q.attempts, x.Err)
+		delete(m.cancelling, q.orderID)
+		return nil
+	}
+
+	return []*Intent{m.cancel(x.Intent.Time, q)}
+}
+
+// FairPrice returns the mid price of the consolidated book of the reference exchangers.
+// ok is false when no fresh book is available.
+func (m *MarketMaker) FairPrice(now time.Time) (price float64, ok bool) {
+	refs := m.Reference
+	if len(refs) == 0 {
+		refs = []string{m.Exchanger}
+	}
+
+	bid := 0.0
+	ask := math.Inf(1)
+	own := m.books[m.Exchanger]
+
+	for _, ex := range refs {
+		e, found := m.books[ex]
+		if !found || m.stale(e, now) {
+			continue
+		}
+
+		if m.MaxDataSkew > 0 && own != nil && exchanger.Skew(e.Book, own.Book) > m.MaxDataSkew {
+			continue
+		}
+		bid = math.Max(bid, e.Book.Bids[0].Price)
+		ask = math.Min(ask, e.Book.Asks[0].Price)
+	}
+
+	if bid == 0 || math.IsInf(ask, 1) {
+		return 0, false
+	}
+
+	return (bid + ask) / 2, true
+}
+
+func (m *MarketMaker) stale(e *BookEvent, now time.Time) bool {
+	return m.MaxDataAge > 0 && now.Sub(e.BookTime()) > m.MaxDataAge
+}
+
+func (m *MarketMaker) requote(now time.Time) []*Intent {
+	own, found := m.books[m.Exchanger]
+	fair, ok := m.FairPrice(now)
+
+	if !found || m.stale(own, now) || !ok {
+		if len(m.quotes) > 0 {
+			log.Printf("MarketMaker: stale market data on %s, cancelling quotes\n", m.Exchanger)
+		}
+		return m.cancelAll(now)
+	}
+
+	// skew is in [-1, 1]: positive when holding too much base currency.
+	skew := 0.0
+	if m.MaxInventory > 0 {
+		skew = math.Max(-1, math.Min(1, (m.inventory-m.TargetInventory)/m.MaxInventory))
+	}
+
+	center := fair * (1 - m.Skew*skew)
+	bidPrice := center * (1 - m.HalfSpread)
+	askPrice := center * (1 + m.HalfSpread)
+
+	bidVol := m.QuoteSize
+	askVol := math.Min(m.QuoteSize, m.inventory)
+	if m.MaxInventory > 0 {
+		bidVol = math.Min(bidVol, m.TargetInventory+m.MaxInventory-m.inventory)
+		askVol = math.Min(askVol, m.inventory-(m.TargetInventory-m.MaxInventory))
+	}
+
+	// never cross the book: the quotes must rest.
+	if bidPrice >= own.Book.Asks[0].Price {
+		bidVol = 0
+	}
+	if askPrice <= own.Book.Bids[0].Price {
+		askVol = 0
+	}
+
+	intents := []*Intent{}
+	intents = append(intents, m.quote(now, Buy, bidPrice, bidVol)...)
+	intents = append(intents, m.quote(now, Sell, askPrice, askVol)...)
+	return intents
+}
+
+// quote returns the intents needed to move the quote of the given side to price and vol.
+func (m *MarketMaker) quote(now time.Time, side string, price, vol float64) []*Intent {
+	intents := []*Intent{}
+	q, live := m.quotes[side]
+
+	if vol < m.MinQuoteSize || vol <= 0 {
+		if live {
+			intents = append(intents, m.cancel(now, q))
+		}
+		return intents
+	}
+
+	if live {
+		// partially filled quotes are kept until the price moves, oversized ones are
+		// replaced right away to honor the inventory limits.
+		if math.Abs(price/q.price-1) <= m.RefreshThreshold && q.volume <= vol {
+			return intents
+		}
+		intents = append(intents, m.cancel(now, q))
+	}
+
+	m.seq++
+	return append(intents, &Intent{
+		ID:        fmt.Sprintf("mm-%d-%d", now.UnixNano(), m.seq),
+		Strategy:  m.Name(),
+		Time:      now,
+		Exchanger: m.Exchanger,
+		Pair:      m.Pair,
+		Side:      side,
+		Type:      Limit,
+		Price:     price,
+		Volume:    vol,
+	})
+}
+
+// cancel moves q from the live quotes to the quotes being cancelled and returns the
+// cancellation intent.
+func (m *MarketMaker) cancel(now time.Time, q *quote) *Intent {
+	if m.quotes[q.side] == q {
+		delete(m.quotes, q.side)
+	}
+	m.cancelling[q.orderID] = q
+	q.attempts++
+	m.seq++
+
+	return &Intent{
+		ID:        fmt.Sprintf("mm-%d-%d", now.UnixNano(), m.seq),
+		Strategy:  m.Name(),
+		Time:      now,
+		Exchanger: m.Exchanger,
+		Pair:      m.Pair,
+		Side:      q.side,
+		Type:      Cancel,
+		OrderID:   q.orderID,
+	}
+}
+
+func (m *MarketMaker) cancelAll(now time.Time) []*Intent {
+	intents := []*Intent{}
+	for _, side := range []string{Buy, Sell} {
+		if q, ok := m.quotes[side]; ok {
+			intents = append(intents, m.cancel(now, q))
+		}
+	}
+	return intents
+}
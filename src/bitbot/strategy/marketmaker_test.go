@@ -0,0 +1,151 @@
+package strategy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+func TestMarketMaker(t *testing.T) {
+	pair := exchanger.ZEC_BTC
+	now := time.Now()
+
+	mm := NewMarketMaker("A", pair, []string{"B"})
+	mm.HalfSpread = 0.01
+	mm.Skew = 0.01
+	mm.QuoteSize = 1
+	mm.TargetInventory = 5
+	mm.MaxInventory = 5
+	mm.MaxDataAge = time.Minute
+
+	paper := NewPaperExecutor(Balances{"A": {"ZEC": 10, "BTC": 10}}, 0)
+	feed := NewReplayFeed([][]Event{
+		{
+			&BalanceEvent{now, Balances{"A": {"ZEC": 10, "BTC": 10}}},
+			&BookEvent{now, pair, book("A", 0.90, 1.10, 10)},
+			&BookEvent{now, pair, book("B", 0.99, 1.01, 10)},
+		},
+		{
+			&BookEvent{now.Add(2 * time.Minute), pair, book("A", 0.90, 1.10, 10)},
+		},
+	})
+	engine := NewEngine(mm, feed, &BalanceRisk{}, paper, nil)
+
+	engine.RunOnce()
+	if len(mm.quotes) != 1 {
+		t.Fatalf("only the ask should be quoted at max inventory, got %d quotes", len(mm.quotes))
+	}
+
+	ask, ok := mm.quotes[Sell]
+	if !ok {
+		t.Fatal("missing ask quote")
+	}
+
+	// fair price is 1, skewed down by 1% at max inventory
+	if expected := 0.99 * 1.01; ask.price < expected-1e-9 || ask.price > expected+1e-9 {
+		t.Errorf("ask should be %f, got %f", expected, ask.price)
+	}
+
+	// the reference book is now stale
+	engine.RunOnce()
+	if len(mm.quotes) != 0 {
+		t.Errorf("quotes should be cancelled on stale data, got %d", len(mm.quotes))
+	}
+	if len(paper.open) != 0 {
+		t.Errorf("paper orders should be cancelled, got %d", len(paper.open))
+	}
+}
+
+// failingCancels fails the first `failures` cancellations it is given.
+type failingCancels struct {
+	*PaperExecutor
+	failures int
+}
+
+func (f *failingCancels) Execute(intents []*Intent) []*Execution {
+	execs := []*Execution{}
+	for _, i := range intents {
+		if i.Type == Cancel && f.failures > 0 {
+			f.failures--
+			execs = append(execs, &Execution{Intent: i, Err: fmt.Errorf("timeout")})
+			continue
+		}
+		execs = append(execs, f.PaperExecutor.Execute([]*Intent{i})...)
+	}
+	return execs
+}
+
+func TestMarketMakerFailedCancel(t *testing.T) {
+	pair := exchanger.ZEC_BTC
+	now := time.Now()
+
+	mm := NewMarketMaker("A", pair, []string{"B"})
+	mm.QuoteSize = 1
+
+	executor := &failingCancels{NewPaperExecutor(Balances{"A": {"ZEC": 10, "BTC": 10}}, 0), 1}
+	feed := NewReplayFeed([][]Event{
+		{
+			&BalanceEvent{now, Balances{"A": {"ZEC": 10, "BTC": 10}}},
+			&BookEvent{now, pair, book("A", 0.90, 1.10, 10)},
+			&BookEvent{now, pair, book("B", 0.99, 1.01, 10)},
+		},
+		{
+			&BookEvent{now.Add(2 * time.Minute), pair, book("A", 0.90, 1.10, 10)},
+		},
+	})
+	engine := NewEngine(mm, feed, nil, executor, nil)
+
+	engine.RunOnce()
+	if len(mm.quotes) != 2 {
+		t.Fatalf("both sides should be quoted, got %d quotes", len(mm.quotes))
+	}
+
+	// the first cancellation fails and is issued again
+	engine.RunOnce()
+	if executor.failures != 0 {
+		t.Fatal("a cancellation should have failed")
+	}
+	if len(mm.quotes) != 0 || len(mm.cancelling) != 0 {
+		t.Errorf("quotes should be cancelled, got %d quotes and %d cancelling", len(mm.quotes),
+			len(mm.cancelling))
+	}
+	if len(executor.open) != 0 {
+		t.Errorf("paper orders should be cancelled, got %d", len(executor.open))
+	}
+}
+
+func TestMarketMakerLostCancel(t *testing.T) {
+	pair := exchanger.ZEC_BTC
+	now := time.Now()
+
+	mm := NewMarketMaker("A", pair, []string{"B"})
+	mm.QuoteSize = 1
+
+	executor := &failingCancels{NewPaperExecutor(Balances{"A": {"ZEC": 10, "BTC": 10}}, 0), 10}
+	feed := NewReplayFeed([][]Event{
+		{
+			&BalanceEvent{now, Balances{"A": {"ZEC": 10, "BTC": 10}}},
+			&BookEvent{now, pair, book("A", 0.90, 1.10, 10)},
+			&BookEvent{now, pair, book("B", 0.99, 1.01, 10)},
+		},
+		{
+			&BookEvent{now.Add(2 * time.Minute), pair, book("A", 0.90, 1.10, 10)},
+		},
+	})
+	engine := NewEngine(mm, feed, nil, executor, nil)
+
+	engine.RunOnce()
+
+	// the reference book is stale: the quotes are given up after maxCancelAttempts failures
+	engine.RunOnce()
+	if expected := 10 - 2*maxCancelAttempts; executor.failures != expected {
+		t.Errorf("%d cancellations should have been issued, got %d", 2*maxCancelAttempts,
+			10-executor.failures)
+	}
+	if len(mm.quotes) != 0 || len(mm.cancelling) != 0 {
+		t.Errorf("quotes should be forgotten, got %d quotes and %d cancelling", len(mm.quotes),
+			len(mm.cancelling))
+	}
+}
@@ -0,0 +1,191 @@
+package strategy
+
+import (
+	"fmt"
+	"sync"
+
+	"bitbot/exchanger"
+)
+
+// PaperExecutor simulates order execution against the last order books seen by the
+// engine. Market orders walk the book, limit orders fill the crossing part and the
+// remainder rests until a later book crosses it. Balances are updated accordingly.
+type PaperExecutor struct {
+	// Fee is the fraction of the quote amount charged on each fill.
+	Fee float64
+
+	mu       sync.Mutex
+	seq      int
+	balances Balances
+	books    map[string]*exchanger.OrderBook
+	open     map[string]*paperOrder
+}
+
+type paperOrder struct {
+	intent    *Intent
+	remaining float64
+}
+
+// NewPaperExecutor returns a PaperExecutor starting with the given balances.
+func NewPaperExecutor(balances Balances, fee float64) *PaperExecutor {
+	return &PaperExecutor{
+		Fee:      fee,
+		balances: balances.Copy(),
+		books:    map[string]*exchanger.OrderBook{},
+		open:     map[string]*paperOrder{},
+	}
+}
+
+// Balances returns the simulated balances. It has the signature expected by LiveFeed.
+func (p *PaperExecutor) Balances() (Balances, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.balances.Copy(), nil
+}
+
+func (p *PaperExecutor) Observe(ev Event) []*Fill {
+	e, ok := ev.(*BookEvent)
+	if !ok {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.books[bookKey(e.Book.Exchanger, e.Pair)] = e.Book
+
+	fills := []*Fill{}
+	for id, o := range p.open {
+		if o.intent.Exchanger != e.Book.Exchanger || o.intent.Pair != e.Pair {
+			continue
+		}
+
+		fs := p.match(o.intent, id, o.remaining, e.Book)
+		for _, f := range fs {
+			o.remaining -= f.Volume
+		}
+		if o.remaining <= 0 {
+			delete(p.open, id)
+		}
+		fills = append(fills, fs...)
+	}
+
+	return fills
+}
+
+func (p *PaperExecutor) Execute(intents []*Intent) []*Execution {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	execs := []*Execution{}
+	for _, i := range intents {
+		execs = append(execs, p.execute(i))
+	}
+	return execs
+}
+
+func (p *PaperExecutor) execute(i *Intent) *Execution {
+	x := &Execution{Intent: i}
+
+	if i.Type == Cancel {
+		if _, ok := p.open[i.OrderID]; !ok {
+			x.Err = fmt.Errorf("Paper: unknown order %s", i.OrderID)
+		} else {
+			delete(p.open, i.OrderID)
+		}
+		return x
+	}
+
+	book, ok := p.books[bookKey(i.Exchanger, i.Pair)]
+	if !ok && i.Type == Market {
+		x.Err = fmt.Errorf("Paper: no %s orderbook for pair %s", i.Exchanger, i.Pair)
+		return x
+	}
+
+	p.seq++
+	id := fmt.Sprintf("paper-%d", p.seq)
+	x.OrderIDs = []string{id}
+
+	var filled float64
+	if ok {
+		x.Fills = p.match(i, id, i.Volume, book)
+		for _, f := range x.Fills {
+			filled += f.Volume
+		}
+	}
+
+	if i.Type == Limit && filled < i.Volume {
+		p.open[id] = &paperOrder{i, i.Volume - filled}
+	}
+
+	return x
+}
+
+// match fills up to vol against the book and updates balances. It must be called with
+// p.mu held.
+func (p *PaperExecutor) match(i *Intent, orderID string, vol float64, book *exchanger.OrderBook) []*Fill {
+	levels := book.Asks
+	if i.Side == Sell {
+		levels = book.Bids
+	}
+
+	fills := []*Fill{}
+	for _, level := range levels {
+		if vol <= 0 {
+			break
+		}
+
+		if i.Type == Limit {
+			if i.Side == Buy && level.Price > i.Price {
+				break
+			}
+			if i.Side == Sell && level.Price < i.Price {
+				break
+			}
+		}
+
+		v := level.Volume
+		if v > vol {
+			v = vol
+		}
+		vol -= v
+
+		p.seq++
+		f := &Fill{
+			IntentID:    i.ID,
+			OrderID:     orderID,
+			TradeID:     fmt.Sprintf("paper-%d", p.seq),
+			Exchanger:   i.Exchanger,
+			Pair:        i.Pair,
+			Side:        i.Side,
+			Price:       level.Price,
+			Volume:      v,
+			Fee:         level.Price * v * p.Fee,
+			FeeCurrency: i.Pair.Quote,
+		}
+		p.settle(f)
+		fills = append(fills, f)
+	}
+
+	return fills
+}
+
+func (p *PaperExecutor) settle(f *Fill) {
+	bal, ok := p.balances[f.Exchanger]
+	if !ok {
+		bal = map[string]float64{}
+		p.balances[f.Exchanger] = bal
+	}
+
+	if f.Side == Buy {
+		bal[f.Pair.Base] += f.Volume
+		bal[f.Pair.Quote] -= f.Price*f.Volume + f.Fee
+	} else {
+		bal[f.Pair.Base] -= f.Volume
+		bal[f.Pair.Quote] += f.Price*f.Volume - f.Fee
+	}
+}
+
+func bookKey(ex string, pair exchanger.Pair) string {
+	return ex + "/" + pair.String()
+}
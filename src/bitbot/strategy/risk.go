@@ -0,0 +1,52 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+)
+
+// BalanceRisk resizes intents so that they can be covered by the available balances.
+// Intents of the same group are resized to the same volume so that both legs of an
+// arbitrage stay balanced.
+type BalanceRisk struct {
+	// QuoteReserve is the fraction of the quote balance kept aside on buy orders to pay
+	// fees and absorb slippage (0.05 keeps 5%).
+	QuoteReserve float64
+}
+
+func (r *BalanceRisk) Check(intents []*Intent, balances Balances) ([]*Intent, error) {
+	vol := math.Inf(1)
+
+	for _, i := range intents {
+		if i.Type == Cancel {
+			continue
+		}
+
+		bal := balances[i.Exchanger]
+		var available float64
+
+		if i.Side == Sell {
+			available = bal[i.Pair.Base]
+		} else if i.Price > 0 {
+			available = (1 - r.QuoteReserve) * bal[i.Pair.Quote] / i.Price
+		}
+
+		vol = math.Min(vol, math.Min(i.Volume, available))
+	}
+
+	if math.IsInf(vol, 1) {
+		return intents, nil
+	}
+
+	if vol <= 0 {
+		return nil, fmt.Errorf("not enough balance to execute %s", intents[0])
+	}
+
+	for _, i := range intents {
+		if i.Type != Cancel {
+			i.Volume = vol
+		}
+	}
+
+	return intents, nil
+}
@@ -0,0 +1,167 @@
+/*
+Package strategy decouples trading decisions from the machinery that runs them.
+
+A Strategy receives market data events (order book updates, ticker updates, fills and
+balance changes) and answers with order intents. The Engine owns everything else: it pulls
+events from a Feed, runs the intents through a Risk check, persists them in a Store and
+hands them to an Executor. Swapping the Feed and the Executor is enough to run the same
+strategy live, in paper mode or against recorded data:
+
+	feed := strategy.NewReplayFeed(cycles)
+	paper := strategy.NewPaperExecutor(balances, 0.002)
+	engine := strategy.NewEngine(strategy.NewArbitrage(pair, 0.8, 0.1), feed, &strategy.BalanceRisk{}, paper, nil)
+
+	for !feed.Done() {
+		engine.RunOnce()
+	}
+
+NewStoreReplayFeed builds the cycles from the books recorded in a storage.Store.
+*/
+package strategy
+
+import (
+	"fmt"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+// Order sides.
+const (
+	Buy  = "buy"
+	Sell = "sell"
+)
+
+// Intent types.
+const (
+	Market = "market"
+	Limit  = "limit"
+	Cancel = "cancel"
+)
+
+// A Strategy turns market data events into order intents.
+type Strategy interface {
+	// Name identifies the strategy in logs and in the database.
+	Name() string
+
+	// OnEvent is called by the engine for every event. The returned intents are sent to
+	// the risk check and then executed. OnEvent is never called concurrently.
+	OnEvent(ev Event) []*Intent
+}
+
+// Balances maps exchanger names to currency balances.
+type Balances map[string]map[string]float64
+
+// Copy returns a deep copy of b.
+func (b Balances) Copy() Balances {
+	out := Balances{}
+	for ex, bal := range b {
+		out[ex] = map[string]float64{}
+		for cur, v := range bal {
+			out[ex][cur] = v
+		}
+	}
+	return out
+}
+
+// An Event is delivered by the engine to the strategy.
+type Event interface {
+	EventTime() time.Time
+}
+
+// BookEvent is emitted each time an order book is fetched.
+type BookEvent struct {
+	Time time.Time
+	Pair exchanger.Pair
+	Book *exchanger.OrderBook
+}
+
+func (e *BookEvent) EventTime() time.Time { return e.Time }
+
+// BookTime is the time of the book snapshot, or the time of the event when the book
+// carries no timestamps.
+func (e *BookEvent) BookTime() time.Time {
+	if t := e.Book.Time(); !t.IsZero() {
+		return t
+	}
+	return e.Time
+}
+
+// TickerEvent is emitted each time a ticker is fetched.
+type TickerEvent struct {
+	Time      time.Time
+	Exchanger string
+	Pair      exchanger.Pair
+	Bid       float64
+	Ask       float64
+	Last      float64
+}
+
+func (e *TickerEvent) EventTime() time.Time { return e.Time }
+
+// FillEvent is emitted when an order placed by the engine is (partially) filled.
+type FillEvent struct {
+	Time time.Time
+	Fill *Fill
+}
+
+func (e *FillEvent) EventTime() time.Time { return e.Time }
+
+// OrderEvent is emitted once an intent was sent to an exchanger. It carries the
+// exchanger order ids or the error.
+type OrderEvent struct {
+	Time      time.Time
+	Execution *Execution
+}
+
+func (e *OrderEvent) EventTime() time.Time { return e.Time }
+
+// BalanceEvent is emitted when account balances are refreshed.
+type BalanceEvent struct {
+	Time     time.Time
+	Balances Balances
+}
+
+func (e *BalanceEvent) EventTime() time.Time { return e.Time }
+
+// An Intent describes an order the strategy wants to place or cancel.
+type Intent struct {
+	// ID uniquely identifies the intent.
+	ID string
+	// Group ties together intents that must be executed together (the two legs
+	// of an arbitrage for instance).
+	Group     string
+	Strategy  string
+	Time      time.Time
+	Exchanger string
+	Pair      exchanger.Pair
+	// Side is Buy or Sell.
+	Side string
+	// Type is Market, Limit or Cancel.
+	Type   string
+	Price  float64
+	Volume float64
+	// OrderID is the exchanger order to cancel (Cancel intents only).
+	OrderID string
+}
+
+func (i *Intent) String() string {
+	if i.Type == Cancel {
+		return fmt.Sprintf("%s: cancel %s | pair: %s", i.Exchanger, i.OrderID, i.Pair)
+	}
+	return fmt.Sprintf("%s: %s %s | pair: %s | price: %f | vol: %f", i.Exchanger, i.Type, i.Side, i.Pair, i.Price, i.Volume)
+}
+
+// A Fill is a trade resulting from an executed intent.
+type Fill struct {
+	IntentID    string
+	OrderID     string
+	TradeID     string
+	Exchanger   string
+	Pair        exchanger.Pair
+	Side        string
+	Price       float64
+	Volume      float64
+	Fee         float64
+	FeeCurrency string
+}
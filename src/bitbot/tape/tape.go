@@ -0,0 +1,93 @@
+/*
+Package tape collects the public trades of the exchangers: the executed trades that
+explain the moves of the books.
+
+The exchangers page their tape with a cursor (see exchanger.TapeFunc). Collect follows
+it page after page and saves the trades, the duplicates returned around the cursor being
+dropped by the stores. The cursor of a time starts a backfill; Bittrex only lists its
+most recent trades and can't be backfilled.
+*/
+package tape
+
+import (
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/exchanger/bitfinex"
+	"bitbot/exchanger/bittrex"
+	"bitbot/exchanger/kraken"
+	"bitbot/exchanger/poloniex"
+	"bitbot/storage"
+)
+
+// Venue is an exchanger with a public tape.
+type Venue struct {
+	Name string
+	// Pairs are the pairs supported, nil when any pair is.
+	Pairs  map[exchanger.Pair]string
+	Trades exchanger.TapeFunc
+	Cursor exchanger.TapeCursorFunc
+}
+
+// Supports reports whether the tape of pair is available.
+func (v *Venue) Supports(pair exchanger.Pair) bool {
+	if v.Pairs == nil {
+		return true
+	}
+	_, ok := v.Pairs[pair]
+	return ok
+}
+
+// Venues are the exchangers with a public tape.
+var Venues = map[string]*Venue{
+	bitfinex.ExchangerName: {bitfinex.ExchangerName, bitfinex.Pairs, bitfinex.PublicTrades, bitfinex.TapeCursor},
+	bittrex.ExchangerName:  {bittrex.ExchangerName, nil, bittrex.PublicTrades, bittrex.TapeCursor},
+	kraken.ExchangerName:   {kraken.ExchangerName, kraken.Pairs, kraken.PublicTrades, kraken.TapeCursor},
+	poloniex.ExchangerName: {poloniex.ExchangerName, poloniex.Pairs, poloniex.PublicTrades, poloniex.TapeCursor},
+}
+
+// PagePause is the time between two pages, for the rate limits of the APIs.
+var PagePause = time.Second
+
+// Collect saves the trades of pair following cursor, page after page, until the cursor
+// stops moving or the trades reach until (zero for no limit). It returns the cursor of
+// the next collection, the one of until once reached, and the number of trades saved,
+// duplicates included.
+//
+// Without limit, it also stops on the first empty page: the tape is caught up.
+func Collect(store storage.Store, v *Venue, pair exchanger.Pair, cursor string, until time.Time) (string, int, error) {
+	n := 0
+
+	for {
+		trades, next, err := v.Trades(pair, cursor)
+		if err != nil {
+			return cursor, n, err
+		}
+
+		done := next == cursor || (len(trades) == 0 && until.IsZero())
+
+		kept := []*exchanger.PublicTrade{}
+		for _, t := range trades {
+			if !until.IsZero() && !t.Time.Before(until) {
+				// the next collection starts with the trades dropped
+				done, next = true, v.Cursor(until)
+				continue
+			}
+			kept = append(kept, t)
+		}
+
+		if len(kept) > 0 {
+			if err := store.SavePublicTrades(kept); err != nil {
+				return cursor, n, err
+			}
+		}
+
+		n += len(kept)
+		cursor = next
+		if done {
+			return cursor, n, nil
+		}
+
+		time.Sleep(PagePause)
+	}
+}
@@ -0,0 +1,86 @@
+package tape
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+func TestCollect(t *testing.T) {
+	PagePause = 0
+
+	dir, err := ioutil.TempDir("", "tape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := storage.OpenDir(dir, storage.JSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a trade every minute, pages of 3 trades from the cursor included, a time in seconds
+	t0 := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	tape := []*exchanger.PublicTrade{}
+	for i := 0; i < 10; i++ {
+		tape = append(tape, &exchanger.PublicTrade{Exchanger: "Test", Pair: exchanger.ZEC_BTC, ID: strconv.Itoa(i),
+			Price: 0.01, Volume: 1, Side: exchanger.Buy, Time: t0.Add(time.Duration(i) * time.Minute)})
+	}
+
+	cursorOf := func(ts time.Time) string { return strconv.FormatInt(ts.Unix(), 10) }
+	v := &Venue{
+		Name:   "Test",
+		Cursor: cursorOf,
+		Trades: func(pair exchanger.Pair, cursor string) ([]*exchanger.PublicTrade, string, error) {
+			sec, _ := strconv.ParseInt(cursor, 10, 64)
+			page := []*exchanger.PublicTrade{}
+			for _, tr := range tape {
+				if !tr.Time.Before(time.Unix(sec, 0)) && len(page) < 3 {
+					page = append(page, tr)
+				}
+			}
+			if len(page) == 0 {
+				return page, cursor, nil
+			}
+			return page, cursorOf(page[len(page)-1].Time), nil
+		},
+	}
+
+	// backfill of the first 5 minutes
+	cursor, _, err := Collect(store, v, exchanger.ZEC_BTC, v.Cursor(t0), t0.Add(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trades, err := store.PublicTrades("Test", exchanger.ZEC_BTC, t0, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 5 {
+		t.Fatalf("5 trades expected, got %d", len(trades))
+	}
+
+	// then the rest of the tape, the pages overlap on the cursor
+	if _, _, err := Collect(store, v, exchanger.ZEC_BTC, cursor, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	trades, err = store.PublicTrades("Test", exchanger.ZEC_BTC, t0, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 10 {
+		t.Fatalf("10 trades expected, got %d", len(trades))
+	}
+	for i, tr := range trades {
+		if tr.ID != strconv.Itoa(i) {
+			t.Errorf("trade %d expected at position %d, got %s", i, i, tr.ID)
+		}
+	}
+}
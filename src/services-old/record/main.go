@@ -10,8 +10,10 @@ import (
 	"time"
 
 	"bitbot/database"
+	"bitbot/episode"
 	"bitbot/errorutils"
 	"bitbot/exchanger"
+	"bitbot/latency"
 
 	"bitbot/exchanger/bitfinex"
 	"bitbot/exchanger/btce"
@@ -23,10 +25,8 @@ import (
 	"bitbot/exchanger/therocktrading"
 )
 
-// NOTE: use Ticker endpoint to retrieve bid/ask info for several pairs at the same time?
-// - https://api.kraken.com/0/public/Ticker?pair=XXBTZUSD,XXBTZEUR,XXBTXLTC
-// - https://cex.io/api/tickers/BTC/BTC/USD/EUR
-// - https://api.hitbtc.com/api/1/public/ticker
+// NOTE: the bid/ask info of several pairs at the same time is polled from the ticker
+// endpoints by services/trader (see exchanger.Ticker), into the `tickers` table.
 
 var (
 	dbName      = flag.String("d", "bitbot", "MySQL database.")
@@ -35,6 +35,8 @@ var (
 	dbUser      = flag.String("u", "bitbot", "MySQL user.")
 	dbPwd       = flag.String("w", "password", "MySQL user's password.")
 	periodicity = flag.Int64("t", 10, "Wait t seconds between each pair.")
+	maxSkew     = flag.Duration("s", 5*time.Second, "Maximum time between the snapshots of two books compared for arbitrage.")
+	statsPeriod = flag.Duration("l", 5*time.Minute, "Period of the latency statistics.")
 )
 
 type Exchanger struct {
@@ -63,6 +65,12 @@ var pairs = []exchanger.Pair{
 	exchanger.ZEC_BTC,
 }
 
+// tracker links the crossings of consecutive snapshots into episodes.
+var tracker *episode.Tracker
+
+// latencies collects the fetch latencies of the order books.
+var latencies = latency.NewRecorder()
+
 func main() {
 	log.Println("Start recording...")
 	flag.Parse()
@@ -70,6 +78,16 @@ func main() {
 	db := database.Open(*dbName, *dbHost, *dbPort, *dbUser, *dbPwd)
 	defer db.Close()
 
+	if err := database.CheckSchema(db.DB); err != nil {
+		log.Panic(err)
+	}
+
+	// each pair is fetched once per cycle, an episode survives two missed snapshots
+	cycle := time.Duration(int64(len(pairs))**periodicity) * time.Second
+	tracker = episode.NewTracker(3 * cycle)
+
+	go saveLatencies(db, *statsPeriod)
+
 	for {
 		for _, pair := range pairs {
 			go work(db, pair)
@@ -82,6 +100,7 @@ func work(db *database.DB, pair exchanger.Pair) {
 	defer errorutils.LogPanic()
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	obs := []*exchanger.OrderBook{}
 	start := time.Now()
 
@@ -89,16 +108,18 @@ func work(db *database.DB, pair exchanger.Pair) {
 		defer wg.Done()
 
 		log.Printf("Fetching %s for pair %s...", e.name, pair)
-		book, err := e.f(pair)
-		// end := time.Now()
-		// duration := int64(time.Since(start) / time.Microsecond)
-
+		book, err := exchanger.Fetch(e.f, pair)
 		if err != nil {
+			latencies.AddError(e.name)
 			log.Println(err)
 			return
 		}
 
+		latencies.Add(e.name, book.Latency())
+
+		mu.Lock()
 		obs = append(obs, book)
+		mu.Unlock()
 	}
 
 	for _, e := range exchangers {
@@ -115,7 +136,13 @@ func work(db *database.DB, pair exchanger.Pair) {
 	}
 
 	saveOrderbooks(db, pair, start, obs)
-	computeAndSaveArbitrage(db, pair, start, obs)
+	crossings := computeAndSaveArbitrage(db, pair, start, obs)
+
+	venues := []string{}
+	for _, ob := range obs {
+		venues = append(venues, ob.Exchanger)
+	}
+	saveEpisodes(db, tracker.Observe(pair, start, venues, crossings))
 }
 
 func saveOrderbooks(db *database.DB, pair exchanger.Pair, start time.Time, obs []*exchanger.OrderBook) {
@@ -145,17 +172,25 @@ func saveOrderbooks(db *database.DB, pair exchanger.Pair, start time.Time, obs [
 		params = append(params, ob.Exchanger)
 		params = append(params, bids)
 		params = append(params, asks)
-		placeholders = append(placeholders, "(?, ?, ?, ?, ?)")
+		params = append(params, ob.Sent)
+		params = append(params, ob.Received)
+		if ob.ExchangeTime.IsZero() {
+			params = append(params, nil)
+		} else {
+			params = append(params, ob.ExchangeTime)
+		}
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
 	}
 
-	stmt := "insert into orderbooks (ts, pair, exchanger, bids, asks) values " + strings.Join(placeholders, ",")
+	stmt := "insert into orderbooks (ts, pair, exchanger, bids, asks, sent_at, received_at, exchange_ts) values " + strings.Join(placeholders, ",")
 	_, err := db.Exec(stmt, params...)
 	errorutils.PanicOnError(err)
 }
 
-func computeAndSaveArbitrage(db *database.DB, pair exchanger.Pair, start time.Time, obs []*exchanger.OrderBook) {
+func computeAndSaveArbitrage(db *database.DB, pair exchanger.Pair, start time.Time, obs []*exchanger.OrderBook) []*episode.Crossing {
 	placeholders := []string{}
 	params := []interface{}{}
+	crossings := []*episode.Crossing{}
 
 	for _, buyOb := range obs {
 		for _, sellOb := range obs {
@@ -163,6 +198,11 @@ func computeAndSaveArbitrage(db *database.DB, pair exchanger.Pair, start time.Ti
 				continue
 			}
 
+			// books fetched too far apart don't show a real opportunity
+			if exchanger.Skew(buyOb, sellOb) > *maxSkew {
+				continue
+			}
+
 			buyOrder := buyOb.Asks[0]
 			sellOrder := sellOb.Bids[0]
 
@@ -182,14 +222,81 @@ func computeAndSaveArbitrage(db *database.DB, pair exchanger.Pair, start time.Ti
 			params = append(params, vol)
 			params = append(params, spread)
 			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+
+			crossings = append(crossings, &episode.Crossing{BuyEx: buyOb.Exchanger, SellEx: sellOb.Exchanger, Spread: spread, Volume: vol})
 		}
 	}
 
 	if len(params) == 0 {
-		return
+		return crossings
 	}
 
 	stmt := "insert into arbitrages (buy_ex, sell_ex, pair, ts, buy_price, sell_price, vol, spread) values " + strings.Join(placeholders, ",")
 	_, err := db.Exec(stmt, params...)
 	errorutils.PanicOnError(err)
+	return crossings
+}
+
+func saveEpisodes(db *database.DB, episodes []*episode.Episode) {
+	placeholders := []string{}
+	params := []interface{}{}
+
+	for _, e := range episodes {
+		params = append(params, e.Pair.String())
+		params = append(params, e.BuyEx)
+		params = append(params, e.SellEx)
+		params = append(params, e.Start)
+		params = append(params, e.End)
+		params = append(params, e.PeakSpread)
+		params = append(params, e.AvgVolume())
+		params = append(params, e.Snapshots)
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+	}
+
+	if len(params) == 0 {
+		return
+	}
+
+	stmt := "insert into episodes (pair, buy_ex, sell_ex, start_ts, end_ts, peak_spread, avg_vol, snapshots) values " + strings.Join(placeholders, ",")
+	_, err := db.Exec(stmt, params...)
+	errorutils.PanicOnError(err)
+}
+
+// saveLatencies saves the latency statistics of each exchanger every period.
+func saveLatencies(db *database.DB, period time.Duration) {
+	for {
+		time.Sleep(period)
+		saveStats(db, time.Now(), latencies.Flush())
+	}
+}
+
+func saveStats(db *database.DB, t time.Time, stats []*latency.Stats) {
+	defer errorutils.LogPanic()
+
+	placeholders := []string{}
+	params := []interface{}{}
+
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	for _, s := range stats {
+		params = append(params, t)
+		params = append(params, s.Exchanger)
+		params = append(params, s.Count)
+		params = append(params, s.Errors)
+		params = append(params, ms(s.P50))
+		params = append(params, ms(s.P90))
+		params = append(params, ms(s.P99))
+		params = append(params, ms(s.Max))
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+	}
+
+	if len(params) == 0 {
+		return
+	}
+
+	stmt := "insert into book_latency (ts, exchanger, samples, errors, p50, p90, p99, max) values " + strings.Join(placeholders, ",")
+	_, err := db.Exec(stmt, params...)
+	errorutils.PanicOnError(err)
 }
@@ -3,175 +3,193 @@ package main
 import (
 	"fmt"
 	"log"
-	"strings"
-	"sync"
+	"math"
 	"time"
 
 	"bitbot/exchanger"
+	"bitbot/rebalance"
+	"bitbot/strategy"
 )
 
-type transaction struct {
-	orig   string
-	dest   string
-	amount float64
+// rebalancer moves funds between exchangers to restore target allocations after
+// arbitrages moved them. Transfers are handed to the transfer worker so that the
+// trading loop doesn't wait for them. Trades are saved as intents in store before
+// being sent, as the orders of the strategies.
+type rebalancer struct {
+	withdrawers map[string]Withdrawer
+	traders     map[string]Trader
+	transfers   *transferWorker
+	store       strategy.Store
+	planner     *rebalance.Planner
+	conf        RebalanceConfig
 }
 
-const threshold = 0.05
-
-func rebalance(withdrawers map[string]Withdrawer, pair exchanger.Pair) {
-	wg := sync.WaitGroup{}
-
-	f := func(cur string) {
-		wg.Add(1)
-		defer wg.Done()
-		execRebalanceTransactions(withdrawers, cur)
+func newRebalancer(withdrawers map[string]Withdrawer, traders map[string]Trader, transfers *transferWorker, conf RebalanceConfig) *rebalancer {
+	if conf.Threshold == 0 {
+		conf.Threshold = defaultThreshold
 	}
 
-	// execRebalanceTransactions triggers several API requests. With latency issues, the exchanger
-	// could receive requests in a different order than what we sent. This involves that the nounce
-	// will be invalid and a "Kraken errors: [EAPI:Invalid nonce]" can occur. To fix this quickly
-	// we just wait 10 seconds here...
-	go f(pair.Base)
-	time.Sleep(10 * time.Second)
-	go f(pair.Quote)
-	wg.Wait()
+	planner := &rebalance.Planner{Threshold: conf.Threshold, TimeCost: conf.TimeCost}
+	return &rebalancer{withdrawers: withdrawers, traders: traders, transfers: transfers, planner: planner, conf: conf}
 }
 
-func execRebalanceTransactions(withdrawers map[string]Withdrawer, cur string) {
-	curBal, err := getCurrencyBalances(cur, withdrawers)
-	if err != nil {
-		log.Printf("execRebalanceTransactions: call to getCurrencyBalances() failed - %s (%s)\n", err, cur)
-		return
-	}
+// defaultThreshold rebalances a venue once it holds less than 5% of a currency, as the
+// trader always did.
+const defaultThreshold = 0.05
+
+// rebalance rebalances both currencies of pair. price is used to value on-venue trades.
+func (r *rebalancer) rebalance(pair exchanger.Pair, price float64) {
+	r.execRebalanceTransactions(pair.Base, pair, price)
+	r.execRebalanceTransactions(pair.Quote, pair, price)
+}
 
-	rebalanced := map[string]bool{}
+// plan returns the rebalancing plan of cur given the balances of all exchangers.
+func (r *rebalancer) plan(cur string, pair exchanger.Pair, price float64, balances map[string]map[string]float64) (*rebalance.Plan, error) {
+	venues := []*rebalance.Venue{}
 
-	for _, t := range findRebalanceTransactions(curBal) {
-		err := execTransaction(withdrawers[t.orig], withdrawers[t.dest], cur, t.amount)
-		if err != nil {
-			log.Printf("execRebalanceTransactions: call to execTransaction() failed - %s (%s)\n", err, cur)
-		} else {
-			rebalanced[t.dest] = true
-		}
+	counter := pair.Quote
+	if cur == pair.Quote {
+		counter = pair.Base
 	}
+	spare := r.surplus(counter, balances)
 
-	for len(rebalanced) > 0 {
-		log.Printf("execRebalanceTransactions: waiting for %s transfer to complete\n", cur)
-		time.Sleep(1 * time.Minute)
-
-		curBal, err := getCurrencyBalances(cur, withdrawers)
-		if err != nil {
-			log.Printf("execRebalanceTransactions: call to getCurrencyBalances() failed - %s (%s)\n", err, cur)
-			// TODO: hack
-			return
+	for ex, bal := range balances {
+		conf := r.conf.Venues[ex]
+		fees := conf.Currencies[cur]
+
+		v := &rebalance.Venue{
+			Name:         ex,
+			Balance:      bal[cur],
+			Target:       conf.Target,
+			WithdrawFee:  fees.Fee,
+			MinWithdraw:  fees.Min,
+			Confirmation: time.Duration(fees.Confirmation) * time.Minute,
+			TradeFee:     conf.TradeFee,
 		}
 
-		total := sumBalance(curBal)
-		for ex, _ := range rebalanced {
-			err := withdrawers[ex].AfterWithdraw(cur)
-			if err != nil {
-				log.Printf("execRebalanceTransactions: call to AfterWithdraw() failed - %s (%s)\n", err, cur)
-				continue
-			}
-
-			alloc := curBal[ex] / total
-			if alloc >= threshold {
-				delete(rebalanced, ex)
+		// only the counter currency above its own target is spent: buying with the rest
+		// would unbalance the counter currency.
+		if conf.TradeFee > 0 && price > 0 {
+			if cur == pair.Base {
+				v.Tradable = spare[ex] / price * (1 - conf.TradeFee)
+			} else if cur == pair.Quote {
+				v.Tradable = spare[ex] * price * (1 - conf.TradeFee)
 			}
 		}
+
+		venues = append(venues, v)
 	}
-}
 
-func findRebalanceTransactions(balances map[string]float64) []*transaction {
-	total := sumBalance(balances)
-	targetBal := total / float64(len(balances))
-	positives := map[string]float64{}
-	negatives := map[string]float64{}
+	return r.planner.Plan(cur, venues)
+}
 
-	for exchanger, balance := range balances {
-		alloc := balance / total
-		delta := balance - targetBal
+// surplus returns the balance of cur each exchanger holds above its target, computed as
+// the planner does.
+func (r *rebalancer) surplus(cur string, balances map[string]map[string]float64) map[string]float64 {
+	var total, totalWeight float64
+	for ex, bal := range balances {
+		total += bal[cur]
+		totalWeight += r.conf.Venues[ex].Target
+	}
 
-		if alloc < threshold {
-			negatives[exchanger] = -delta
-		} else if delta > 0 {
-			positives[exchanger] = delta
+	out := map[string]float64{}
+	for ex, bal := range balances {
+		weight := 1 / float64(len(balances))
+		if totalWeight > 0 {
+			weight = r.conf.Venues[ex].Target / totalWeight
 		}
+		out[ex] = math.Max(0, bal[cur]-weight*total)
 	}
+	return out
+}
 
-	var amount float64
-	transactions := []*transaction{}
-
-	for dest, negDelta := range negatives {
-		for orig, posDelta := range positives {
-			if posDelta <= 0 || negDelta == 0 {
-				continue
-			} else if posDelta > negDelta {
-				amount = negDelta
-				positives[orig] -= amount
-			} else {
-				amount = posDelta
-				negDelta -= posDelta
-				delete(positives, orig)
-			}
+// execRebalanceTransactions executes the trades of the cur rebalancing plan and requests
+// its transfers. Currencies with transfers in flight are skipped: their balances don't
+// reflect the funds on their way.
+func (r *rebalancer) execRebalanceTransactions(cur string, pair exchanger.Pair, price float64) {
+	pending, err := r.transfers.inFlight(cur)
+	if err != nil {
+		log.Printf("execRebalanceTransactions: call to inFlight() failed - %s (%s)\n", err, cur)
+		return
+	} else if pending {
+		log.Printf("execRebalanceTransactions: %s transfers in flight, skipping\n", cur)
+		return
+	}
 
-			t := &transaction{orig, dest, amount}
-			transactions = append(transactions, t)
-		}
+	balances, err := getBalances(r.withdrawers)
+	if err != nil {
+		log.Printf("execRebalanceTransactions: call to getBalances() failed - %s (%s)\n", err, cur)
+		return
 	}
 
-	return transactions
-}
+	plan, err := r.plan(cur, pair, price, balances)
+	if err != nil {
+		log.Printf("execRebalanceTransactions: call to plan() failed - %s (%s)\n", err, cur)
+		return
+	}
 
-func sumBalance(balances map[string]float64) float64 {
-	var total float64
-	for _, balance := range balances {
-		total += balance
+	if plan.Empty() {
+		return
 	}
-	return total
-}
 
-func execTransaction(org, dest Withdrawer, cur string, vol float64) error {
-	log.Printf("Starting transfert of %f %s from %s to %s\n", vol, cur, org.Exchanger(), dest.Exchanger())
+	log.Print(plan)
 
-	var address string
-	var err error
+	for _, s := range plan.Steps {
+		var err error
+		if s.Kind == rebalance.Trade {
+			err = r.execTrade(s.To, cur, pair, price, s.Received)
+		} else {
+			_, err = r.transfers.request(s.From, s.To, cur, s.Amount)
+		}
 
-	if org.Exchanger() == "Kraken" {
-		// Kraken requires to input the withdrawal addresses in the UI and to
-		// give them unique name. The convention is ExchangerName + "-" + cur.
-		// Example: Poloniex-ZEC
-		exName := strings.Replace(dest.Exchanger(), " ", "-", -1)
-		address = fmt.Sprintf("%s-%s", exName, cur)
-	} else {
-		address, err = dest.PaymentAddress(cur)
 		if err != nil {
-			return err
+			log.Printf("execRebalanceTransactions: %s failed - %s (%s)\n", s.Kind, err, cur)
 		}
 	}
+}
 
-	ack, err := org.Withdraw(vol, cur, address)
-	if err != nil {
-		return fmt.Errorf("Cannot withdraw `%s` from %s: %s\n", cur, err, org.Exchanger())
-	} else {
-		log.Printf("Transfer registered: %s\n", ack)
+// rebalanceStrategy is the strategy of the intents of the rebalancing trades.
+const rebalanceStrategy = "rebalance"
+
+// execTrade buys `amount` of cur on ex by trading the other currency of pair. The order
+// is saved as an intent first: nothing is sent when it can't be.
+func (r *rebalancer) execTrade(ex, cur string, pair exchanger.Pair, price, amount float64) error {
+	if _, ok := r.traders[ex]; !ok {
+		return fmt.Errorf("Missing trader for %s", ex)
+	}
+	if r.store == nil {
+		return fmt.Errorf("no intent store, order not sent")
 	}
 
-	return nil
-}
+	side, vol := strategy.Buy, amount
+	if cur == pair.Quote {
+		side, vol = strategy.Sell, amount/price
+	}
 
-func getCurrencyBalances(cur string, withdrawers map[string]Withdrawer) (map[string]float64, error) {
-	masterBal, err := getBalances(withdrawers)
-	if err != nil {
-		return nil, fmt.Errorf("getCurrencyBalances: call to getBalances() failed - %s (%s)", err, cur)
+	now := time.Now()
+	i := &strategy.Intent{
+		ID:        fmt.Sprintf("%s-%d", rebalanceStrategy, now.UnixNano()),
+		Strategy:  rebalanceStrategy,
+		Time:      now,
+		Exchanger: ex,
+		Pair:      pair,
+		Side:      side,
+		Type:      strategy.Market,
+		Price:     price,
+		Volume:    vol,
 	}
 
-	curBal := map[string]float64{}
-	for ex, bal := range masterBal {
-		curBal[ex] = bal[cur]
+	if err := r.store.SaveIntents([]*strategy.Intent{i}); err != nil {
+		return fmt.Errorf("cannot save intent, order not sent - %s", err)
 	}
 
-	return curBal, nil
+	log.Printf("Rebalancing %s on %s: %s %f %s\n", cur, ex, side, vol, pair)
+	x := (&liveExecutor{r.traders}).execute(i)
+
+	if err := r.store.SaveExecutions([]*strategy.Execution{x}); err != nil {
+		log.Printf("execTrade: SaveExecutions failed - %s\n", err)
+	}
+	return x.Err
 }
 
 func getBalances(withdrawers map[string]Withdrawer) (map[string]map[string]float64, error) {
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"fmt"
 	"testing"
 	"time"
+
+	"bitbot/address"
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+	"bitbot/rebalance"
+	"bitbot/strategy"
 )
 
+// TestWithdrawer moves funds instantly. The history of all the test withdrawers is kept
+// in a shared map indexed by exchanger and transfer kind, owners maps addresses to
+// exchangers.
 type TestWithdrawer struct {
 	exchangerName string
+	address       string
 	balances      map[string]map[string]float64
+	history       map[string][]*exchanger.Transfer
+	owners        map[string]string
 }
 
 func (t *TestWithdrawer) Exchanger() string {
@@ -19,24 +32,100 @@ func (t *TestWithdrawer) TradingBalances() (map[string]float64, error) {
 }
 
 func (t *TestWithdrawer) PaymentAddress(cur string) (string, error) {
-	return t.exchangerName, nil
+	return t.address, nil
 }
 
 func (t *TestWithdrawer) Withdraw(vol float64, cur, address string) (string, error) {
+	id := fmt.Sprintf("%s-%d", t.exchangerName, len(t.history[t.exchangerName+exchanger.Withdrawal]))
+	now := time.Now()
+
+	dest := t.owners[address]
 	t.balances[t.exchangerName][cur] -= vol
-	go func() {
-		time.Sleep(1 * time.Second)
-		t.balances[address][cur] += vol
-	}()
-	return "", nil
+	t.balances[dest][cur] += vol
+
+	t.history[t.exchangerName+exchanger.Withdrawal] = append(t.history[t.exchangerName+exchanger.Withdrawal], &exchanger.Transfer{
+		ID: id, Kind: exchanger.Withdrawal, Currency: cur, Amount: vol, Address: address,
+		TxID: "tx-" + id, Status: exchanger.TransferCompleted, Time: now,
+	})
+	t.history[dest+exchanger.Deposit] = append(t.history[dest+exchanger.Deposit], &exchanger.Transfer{
+		ID: "deposit-" + id, Kind: exchanger.Deposit, Currency: cur, Amount: vol, Address: address,
+		TxID: "tx-" + id, Status: exchanger.TransferCompleted, Time: now,
+	})
+
+	return id, nil
 }
 
 func (t *TestWithdrawer) AfterWithdraw(cur string) error {
 	return nil
 }
 
-func TestexecRebalanceTransactions(t *testing.T) {
-	const cur = "CUR-1"
+func (t *TestWithdrawer) Deposits(cur string) ([]*exchanger.Transfer, error) {
+	return t.history[t.exchangerName+exchanger.Deposit], nil
+}
+
+func (t *TestWithdrawer) Withdrawals(cur string) ([]*exchanger.Transfer, error) {
+	return t.history[t.exchangerName+exchanger.Withdrawal], nil
+}
+
+type memTransferStore struct {
+	transfers []*transfer
+	audits    []*auditEntry
+}
+
+func (s *memTransferStore) insertTransfer(t *transfer) error {
+	s.transfers = append(s.transfers, t)
+	return nil
+}
+
+func (s *memTransferStore) updateTransfer(t *transfer) error {
+	return nil
+}
+
+func (s *memTransferStore) pendingTransfers() ([]*transfer, error) {
+	out := []*transfer{}
+	for _, t := range s.transfers {
+		if t.status != transferCompleted && t.status != transferFailed {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (s *memTransferStore) withdrawnSince(cur string, since time.Time) (float64, error) {
+	var total float64
+	for _, t := range s.transfers {
+		if t.currency == cur && t.status != transferRequested && t.status != transferFailed {
+			total += t.amount
+		}
+	}
+	return total, nil
+}
+
+func (s *memTransferStore) audit(a *auditEntry) error {
+	s.audits = append(s.audits, a)
+	return nil
+}
+
+func (s *memTransferStore) depositClaimed(ex, depositId string) (bool, error) {
+	for _, t := range s.transfers {
+		if t.to == ex && t.depositId == depositId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memTransferStore) withdrawalClaimed(ex, withdrawalId string) (bool, error) {
+	for _, t := range s.transfers {
+		if t.from == ex && t.withdrawalId == withdrawalId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestExecRebalanceTransactions(t *testing.T) {
+	const cur = "BTC"
 
 	balances := map[string]map[string]float64{
 		"market1": map[string]float64{cur: 1},
@@ -44,21 +133,297 @@ func TestexecRebalanceTransactions(t *testing.T) {
 		"market3": map[string]float64{cur: 11},
 		"market4": map[string]float64{cur: 9},
 	}
+	history := map[string][]*exchanger.Transfer{}
+	owners := map[string]string{
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa":         "market1",
+		"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy":         "market2",
+		"112D2adLM3UKy4Z4giRbReR6gjWuvHUqB":          "market3",
+		"bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq": "market4",
+	}
 
-	w1 := &TestWithdrawer{"market1", balances}
-	w2 := &TestWithdrawer{"market2", balances}
-	w3 := &TestWithdrawer{"market3", balances}
-	w4 := &TestWithdrawer{"market4", balances}
-
+	book := address.NewBook()
 	Withdrawers := map[string]Withdrawer{}
-	for _, w := range []Withdrawer{w1, w2, w3, w4} {
-		Withdrawers[w.Exchanger()] = w
+	for addr, ex := range owners {
+		Withdrawers[ex] = &TestWithdrawer{ex, addr, balances, history, owners}
+		if err := book.Add(&address.Entry{Exchanger: ex, Currency: cur, Address: addr}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w1 := Withdrawers["market1"]
+
+	store := &memTransferStore{}
+	policy := &withdrawalPolicy{map[string]WithdrawalLimit{cur: {Max: 10, Daily: 20}}}
+	worker := newTransferWorker(store, Withdrawers, book, policy)
+	r := newRebalancer(Withdrawers, nil, worker, RebalanceConfig{})
+	r.execRebalanceTransactions(cur, exchanger.Pair{}, 0)
+
+	if len(store.transfers) != 1 || store.transfers[0].status != transferRequested {
+		t.Fatalf("one requested transfer expected, got %d", len(store.transfers))
+	}
+
+	// transfers in flight block the rebalancing of the currency
+	r.execRebalanceTransactions(cur, exchanger.Pair{}, 0)
+	if len(store.transfers) != 1 {
+		t.Fatalf("no transfer should be requested while one is in flight, got %d", len(store.transfers))
 	}
 
-	execRebalanceTransactions(Withdrawers, cur)
+	worker.processAll()
+
+	tr := store.transfers[0]
+	if tr.status != transferCompleted {
+		t.Fatalf("transfer should be completed, got %s (%s)", tr.status, tr.err)
+	}
+	if tr.txId == "" || tr.depositId == "" {
+		t.Errorf("transfer should have a tx id and a deposit id, got %q and %q", tr.txId, tr.depositId)
+	}
+	if len(store.audits) != 1 || store.audits[0].decision != decisionAllowed {
+		t.Errorf("the withdrawal decision should be audited, got %d entries", len(store.audits))
+	}
 
 	b1, _ := w1.TradingBalances()
 	if amount := b1[cur]; amount != 10 {
 		t.Errorf("Trader balance not correct - 10 expected got %f", amount)
 	}
 }
+
+func TestTransferRecovery(t *testing.T) {
+	now := time.Now()
+	tr := &transfer{
+		currency: "BTC",
+		from:     "market1",
+		to:       "market2",
+		address:  "addr",
+		amount:   1,
+		status:   transferWithdrawing,
+		created:  now,
+	}
+
+	// the withdrawal was sent before the restart, without the id being saved
+	history := []*exchanger.Transfer{
+		{ID: "old", Amount: 1, Address: "addr", Time: now.Add(-time.Hour)},
+		{ID: "other", Amount: 1, Address: "other-addr", Time: now},
+		{ID: "sent", Amount: 1, Address: "addr", Time: now, Fee: 0.001},
+	}
+
+	wd := matchWithdrawal(tr, history)
+	if wd == nil || wd.ID != "sent" {
+		t.Fatalf("withdrawal `sent` expected, got %v", wd)
+	}
+
+	tr.fee = wd.Fee
+	deposits := []*exchanger.Transfer{
+		{ID: "too-small", Amount: 0.9, Time: now},
+		{ID: "received", Amount: 0.999, Time: now},
+	}
+
+	if d := matchDeposit(tr, deposits); d == nil || d.ID != "received" {
+		t.Errorf("deposit `received` expected, got %v", d)
+	}
+}
+
+func TestClaimedWithdrawal(t *testing.T) {
+	now := time.Now()
+	history := map[string][]*exchanger.Transfer{
+		"market1" + exchanger.Withdrawal: {
+			{ID: "first", Amount: 1, Address: "addr", Time: now, TxID: "tx-first"},
+			{ID: "second", Amount: 1, Address: "addr", Time: now, TxID: "tx-second"},
+		},
+	}
+	from := &TestWithdrawer{exchangerName: "market1", history: history}
+
+	// two identical transfers were interrupted, the first one was already matched
+	store := &memTransferStore{}
+	for i, id := range []string{"first", ""} {
+		store.transfers = append(store.transfers, &transfer{id: fmt.Sprint(i), currency: "BTC", from: "market1",
+			to: "market2", address: "addr", amount: 1, status: transferWithdrawing, withdrawalId: id,
+			created: now, updated: now})
+	}
+
+	w := newTransferWorker(store, nil, nil, nil)
+	tr := store.transfers[1]
+	if err := w.checkWithdrawal(tr, from); err != nil {
+		t.Fatal(err)
+	}
+	if tr.withdrawalId != "second" || tr.txId != "tx-second" {
+		t.Errorf("withdrawal `second` expected, got %s", tr.withdrawalId)
+	}
+}
+
+func TestWithdrawalDestination(t *testing.T) {
+	const addr = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	balances := map[string]map[string]float64{}
+
+	book := address.NewBook()
+	book.Add(&address.Entry{Exchanger: "Poloniex", Currency: "BTC", Address: addr})
+
+	kraken := &TestWithdrawer{"Kraken", "", balances, nil, nil}
+	hitbtc := &TestWithdrawer{"Hitbtc", "", balances, nil, nil}
+	poloniex := &TestWithdrawer{"Poloniex", addr, balances, nil, nil}
+
+	if e, err := withdrawalDestination(book, hitbtc, poloniex, "BTC"); err != nil || e.Address != addr {
+		t.Errorf("%s expected, got %v (%v)", addr, e, err)
+	}
+
+	if _, err := withdrawalDestination(book, poloniex, hitbtc, "BTC"); err == nil {
+		t.Error("unknown destinations should be refused")
+	}
+
+	if _, err := withdrawalDestination(book, kraken, poloniex, "BTC"); err == nil {
+		t.Error("Kraken withdrawals without key should be refused")
+	}
+
+	// the deposit address of the destination changed
+	poloniex.address = "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	if _, err := withdrawalDestination(book, hitbtc, poloniex, "BTC"); err == nil {
+		t.Error("addresses that aren't approved should be refused")
+	}
+}
+
+// failingWithdrawer returns err on each withdrawal.
+type failingWithdrawer struct {
+	*TestWithdrawer
+	err error
+}
+
+func (f *failingWithdrawer) Withdraw(vol float64, cur, address string) (string, error) {
+	return "", f.err
+}
+
+func TestWithdrawalErrors(t *testing.T) {
+	const cur = "BTC"
+	const addr = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+	tests := []struct {
+		err    error
+		status string
+	}{
+		// the withdrawal may have been accepted: it is looked up in the history
+		{fmt.Errorf("read tcp: i/o timeout"), transferWithdrawing},
+		{&httpreq.StatusError{Code: 502, Status: "Bad Gateway"}, transferWithdrawing},
+		{&httpreq.StatusError{Code: 400, Status: "Bad Request"}, transferFailed},
+		{&rejectedError{fmt.Errorf("insufficient funds")}, transferFailed},
+	}
+
+	for _, test := range tests {
+		balances := map[string]map[string]float64{"market1": {cur: 10}, "market2": {cur: 10}}
+		book := address.NewBook()
+		book.Add(&address.Entry{Exchanger: "market2", Currency: cur, Address: addr})
+
+		withdrawers := map[string]Withdrawer{
+			"market1": &failingWithdrawer{&TestWithdrawer{"market1", "", balances, nil, nil}, test.err},
+			"market2": &TestWithdrawer{"market2", addr, balances, nil, nil},
+		}
+
+		store := &memTransferStore{}
+		policy := &withdrawalPolicy{map[string]WithdrawalLimit{cur: {Max: 10, Daily: 20}}}
+		worker := newTransferWorker(store, withdrawers, book, policy)
+		if _, err := worker.request("market1", "market2", cur, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		worker.processAll()
+
+		tr := store.transfers[0]
+		if tr.status != test.status {
+			t.Errorf("%s: status %s expected, got %s", test.err, test.status, tr.status)
+		}
+
+		if pending, _ := worker.inFlight(cur); pending != (test.status == transferWithdrawing) {
+			t.Errorf("%s: the transfer should be in flight until its outcome is known", test.err)
+		}
+	}
+}
+
+// recordingStore records the calls of the engine store, saved is set by SaveIntents.
+type recordingStore struct {
+	saved []*strategy.Intent
+	execs []*strategy.Execution
+	err   error
+}
+
+func (s *recordingStore) SaveIntents(intents []*strategy.Intent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.saved = append(s.saved, intents...)
+	return nil
+}
+
+func (s *recordingStore) SaveExecutions(execs []*strategy.Execution) error {
+	s.execs = append(s.execs, execs...)
+	return nil
+}
+
+// orderTrader checks that the orders it receives were saved first.
+type orderTrader struct {
+	store  *recordingStore
+	orders int
+	t      *testing.T
+}
+
+func (o *orderTrader) PlaceOrder(side string, pair exchanger.Pair, price, vol float64) ([]string, error) {
+	if len(o.store.saved) == o.orders {
+		o.t.Error("order sent before its intent was saved")
+	}
+	o.orders++
+	return []string{"order-1"}, nil
+}
+
+func TestRebalancingTradeIntents(t *testing.T) {
+	store := &recordingStore{}
+	trader := &orderTrader{store: store, t: t}
+
+	r := newRebalancer(nil, map[string]Trader{"market1": trader}, nil, RebalanceConfig{})
+	r.store = store
+
+	if err := r.execTrade("market1", "ZEC", exchanger.ZEC_BTC, 0.01, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.saved) != 1 || store.saved[0].Strategy != rebalanceStrategy || store.saved[0].Side != strategy.Buy {
+		t.Fatalf("one rebalancing buy intent expected, got %v", store.saved)
+	}
+	if len(store.execs) != 1 || len(store.execs[0].OrderIDs) != 1 {
+		t.Errorf("the execution of the intent should be saved, got %v", store.execs)
+	}
+
+	// nothing is sent when the intent can't be saved
+	store.err = fmt.Errorf("db down")
+	if err := r.execTrade("market1", "BTC", exchanger.ZEC_BTC, 0.01, 0.02); err == nil || trader.orders != 1 {
+		t.Errorf("the order should not be sent, %d orders", trader.orders)
+	}
+}
+
+func TestTradableSurplus(t *testing.T) {
+	// transfers are expensive: trades are preferred when possible
+	venue := VenueConfig{Target: 1, TradeFee: 0.01, Currencies: map[string]WithdrawalConfig{"ZEC": {Fee: 10}}}
+	r := newRebalancer(nil, nil, nil, RebalanceConfig{Venues: map[string]VenueConfig{"A": venue, "B": venue}})
+
+	trades := func(btc float64) int {
+		balances := map[string]map[string]float64{
+			"A": {"ZEC": 100, "BTC": 20 - btc},
+			"B": {"ZEC": 1, "BTC": btc},
+		}
+
+		plan, err := r.plan("ZEC", exchanger.ZEC_BTC, 0.1, balances)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := 0
+		for _, s := range plan.Steps {
+			if s.Kind == rebalance.Trade && s.To == "B" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// B holds less BTC than its target: it can't spend it on ZEC
+	if n := trades(5); n != 0 {
+		t.Errorf("no trade expected below the BTC target, got %d", n)
+	}
+	if n := trades(15); n != 1 {
+		t.Errorf("a trade expected with surplus BTC, got %d", n)
+	}
+}
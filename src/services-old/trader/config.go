@@ -10,6 +10,14 @@ type Config struct {
 	Poloniex       Credential
 	Kraken         Credential
 	TheRockTrading Credential `json:"The Rock Trading"`
+	// Bittrex isn't traded, its credentials are used to sync the transfer history.
+	Bittrex     Credential
+	MarketMaker MarketMakerConfig
+	Rebalance   RebalanceConfig
+	// WithdrawalLimits maps currencies to their limits. Currencies without limits can't
+	// be withdrawn.
+	WithdrawalLimits map[string]WithdrawalLimit
+	Reconciliation   ReconciliationConfig
 }
 
 type Credential struct {
@@ -18,6 +26,63 @@ type Credential struct {
 	Addresses map[string]string
 }
 
+// MarketMakerConfig holds the parameters of the market making strategy (see
+// strategy.MarketMaker). Prices are relative, MaxDataAge and MaxDataSkew are in seconds.
+type MarketMakerConfig struct {
+	Exchanger        string
+	Reference        []string
+	HalfSpread       float64
+	Skew             float64
+	RefreshThreshold float64
+	MaxDataAge       int
+	MaxDataSkew      int
+	QuoteSize        float64
+	MinQuoteSize     float64
+	TargetInventory  float64
+	MaxInventory     float64
+}
+
+// RebalanceConfig holds the rebalancing settings (see rebalance.Planner). Venues maps
+// exchanger names to their settings. When no venue has a target, funds are split equally.
+// Threshold is the share of the total below which a venue is rebalanced (5% by default).
+type RebalanceConfig struct {
+	Threshold float64
+	TimeCost  float64
+	Venues    map[string]VenueConfig
+}
+
+// VenueConfig holds the rebalancing settings of an exchanger. Target is the share of the
+// funds the venue should hold and TradeFee the cost rate of trading on the venue (0
+// disables on-venue rebalancing).
+type VenueConfig struct {
+	Target     float64
+	TradeFee   float64
+	Currencies map[string]WithdrawalConfig
+}
+
+// WithdrawalConfig holds the withdrawal costs of a currency. Confirmation is in minutes.
+type WithdrawalConfig struct {
+	Fee          float64
+	Min          float64
+	Confirmation int
+}
+
+// WithdrawalLimit holds the withdrawal policy of a currency. Max caps each withdrawal and
+// Daily the amount withdrawn over 24 hours. Withdrawals above ApprovalAbove wait for a
+// manual approval. Zero disables a limit.
+type WithdrawalLimit struct {
+	Max           float64
+	Daily         float64
+	ApprovalAbove float64
+}
+
+// ReconciliationConfig holds the differences tolerated between the balance changes and
+// the recorded movements. Tolerance maps currencies to absolute amounts.
+type ReconciliationConfig struct {
+	Tolerance        map[string]float64
+	DefaultTolerance float64
+}
+
 func LoadConfig(path string) (*Config, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -4,8 +4,15 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+
+	"bitbot/database"
+	"bitbot/exchanger"
+	"bitbot/strategy"
 )
 
 var (
@@ -16,22 +23,219 @@ var (
 	dbPwd  = flag.String("db-password", "password", "MySQL user's password.")
 )
 
+// OpenMysql opens the database of the flags. It fails unless the schema is current.
 func OpenMysql() (*sql.DB, error) {
-	source := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8", *dbUser, *dbPwd, *dbHost, *dbPort, *dbName)
-	return sql.Open("mysql", source)
+	source := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=true", *dbUser, *dbPwd, *dbHost, *dbPort, *dbName)
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.CheckSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// dbStore persists the engine intents in the `intents` table, and the arbitrages and
+// order acks in the `arbitrage` and `order_ack` tables.
+type dbStore struct {
+	db *sql.DB
+}
+
+// SaveIntents saves the intents as pending, and their arbitrage if they form one, in a
+// single transaction: if the trader stops before they are acknowledged, they are
+// reconciled with the exchangers on the next start.
+func (s *dbStore) SaveIntents(intents []*strategy.Intent) error {
+	const stmt = `
+		insert into intents
+			(intent_id, group_id, strategy, exchanger, pair, side, type, price, volume,
+			 target_id, order_ids, status, error, created_at, updated_at)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', ?, '', ?, ?)
+	`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("db.Begin() failed - %s", err)
+	}
+
+	now := time.Now()
+	for _, i := range intents {
+		_, err := tx.Exec(stmt, i.ID, i.Group, i.Strategy, i.Exchanger, i.Pair.String(), i.Side, i.Type,
+			i.Price, i.Volume, i.OrderID, intentPending, now, now)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("cannot save intent %s - %s", i.ID, err)
+		}
+	}
+
+	var buy, sell *strategy.Intent
+	for _, i := range intents {
+		if i.Side == strategy.Buy {
+			buy = i
+		} else {
+			sell = i
+		}
+	}
+
+	if buy != nil && sell != nil && buy.Group != "" {
+		if err := saveArbitrage(tx, buy, sell); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("cannot save arbitrage %s - %s", buy.Group, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SaveExecutions records the outcome of the intents and the order acks of the orders
+// placed.
+func (s *dbStore) SaveExecutions(execs []*strategy.Execution) error {
+	for _, x := range execs {
+		i := x.Intent
+
+		r := &intentRecord{Intent: i, orderIDs: x.OrderIDs, status: intentDone}
+		switch {
+		case x.Err != nil:
+			r.status = intentFailed
+			r.err = x.Err.Error()
+		case i.Type == strategy.Limit:
+			r.status = intentOpen
+		}
+
+		if err := s.updateIntent(r); err != nil {
+			log.Printf("updateIntent failed - %s\n", err)
+		}
+
+		if i.Type == strategy.Cancel && x.Err == nil {
+			err := s.cancelIntent(i.Exchanger, i.OrderID)
+			if err != nil {
+				log.Printf("cancelIntent failed - %s\n", err)
+			}
+		}
+
+		// intents executed alone (quotes for instance) belong to no arbitrage: their
+		// acks have an empty arbitrage_id.
+		for _, id := range x.OrderIDs {
+			err := saveOrderAck(s.db, i.Group, id, i.Pair.String(), i.Exchanger, i.Side)
+			if err != nil {
+				log.Printf("saveOrderAck failed - %s\n", err)
+			}
+		}
+	}
+	return nil
 }
 
-func saveArbitrage(db *sql.DB, arb *arbitrage) error {
+func (s *dbStore) updateIntent(r *intentRecord) error {
+	const stmt = `
+		update intents
+		set order_ids = ?, status = ?, error = ?, updated_at = ?
+		where intent_id = ?
+	`
+	_, err := s.db.Exec(stmt, strings.Join(r.orderIDs, ","), r.status, r.err, time.Now(), r.ID)
+	return err
+}
+
+// cancelIntent settles the open limit intent of an order cancelled.
+func (s *dbStore) cancelIntent(ex, orderID string) error {
+	const stmt = `
+		update intents
+		set status = ?, updated_at = ?
+		where exchanger = ? and type = ? and order_ids = ? and status = ?
+	`
+	_, err := s.db.Exec(stmt, intentCancelled, time.Now(), ex, strategy.Limit, orderID, intentOpen)
+	return err
+}
+
+func (s *dbStore) unsettledIntents() ([]*intentRecord, error) {
+	const query = `
+		select
+			intent_id, group_id, strategy, exchanger, pair, side, type, price, volume,
+			target_id, order_ids, status, error, created_at
+		from intents
+		where status in (?, ?)
+		order by created_at
+	`
+	rows, err := s.db.Query(query, intentPending, intentOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*intentRecord{}
+	for rows.Next() {
+		r := &intentRecord{Intent: &strategy.Intent{}}
+		var pair, ids string
+
+		err := rows.Scan(&r.ID, &r.Group, &r.Strategy, &r.Exchanger, &pair, &r.Side, &r.Type, &r.Price,
+			&r.Volume, &r.OrderID, &ids, &r.status, &r.err, &r.Time)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Pair = exchanger.NewPair(pair)
+		if ids != "" {
+			r.orderIDs = strings.Split(ids, ",")
+		}
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+func (s *dbStore) tradesSince(ex string, pair exchanger.Pair, t time.Time) ([]*exchanger.Trade, error) {
+	const query = `
+		select trade_id, order_id, side, price, quantity, fee, fee_currency, ts
+		from trade
+		where exchanger = ? and pair = ? and ts >= ?
+		order by ts
+	`
+	rows, err := s.db.Query(query, ex, pair.String(), t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := []*exchanger.Trade{}
+	for rows.Next() {
+		tr := &exchanger.Trade{Pair: pair}
+		err := rows.Scan(&tr.ID, &tr.OrderID, &tr.Side, &tr.Price, &tr.Volume, &tr.Fee, &tr.FeeCurrency, &tr.Time)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, tr)
+	}
+
+	return trades, rows.Err()
+}
+
+func (s *dbStore) orderClaimed(ex string, ids []string) (bool, error) {
+	query := "select count(*) from order_ack where exchanger = ? and external_id in (?" +
+		strings.Repeat(", ?", len(ids)-1) + ")"
+
+	params := []interface{}{ex}
+	for _, id := range ids {
+		params = append(params, id)
+	}
+
+	var n int
+	err := s.db.QueryRow(query, params...).Scan(&n)
+	return n > 0, err
+}
+
+func saveArbitrage(tx *sql.Tx, buy, sell *strategy.Intent) error {
 	params := []interface{}{}
-	params = append(params, arb.id)
-	params = append(params, arb.buyEx.Exchanger)
-	params = append(params, arb.sellEx.Exchanger)
-	params = append(params, arb.pair.String())
-	params = append(params, arb.ts)
-	params = append(params, arb.buyEx.Asks[0].Price)
-	params = append(params, arb.sellEx.Bids[0].Price)
-	params = append(params, arb.vol)
-	params = append(params, arb.spread)
+	params = append(params, buy.Group)
+	params = append(params, buy.Exchanger)
+	params = append(params, sell.Exchanger)
+	params = append(params, buy.Pair.String())
+	params = append(params, buy.Time)
+	params = append(params, buy.Price)
+	params = append(params, sell.Price)
+	params = append(params, buy.Volume)
+	params = append(params, 100*(sell.Price/buy.Price-1))
 
 	const stmt = `
 		insert into arbitrage
@@ -39,7 +243,7 @@ func saveArbitrage(db *sql.DB, arb *arbitrage) error {
 		values
 			(?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := db.Exec(stmt, params...)
+	_, err := tx.Exec(stmt, params...)
 	return err
 }
 
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"bitbot/strategy"
+)
+
+// liveExecutor sends intents to the exchangers. Intents are executed concurrently so
+// that both legs of an arbitrage hit the books at the same time.
+type liveExecutor struct {
+	traders map[string]Trader
+}
+
+func (e *liveExecutor) Execute(intents []*strategy.Intent) []*strategy.Execution {
+	var wg sync.WaitGroup
+	execs := make([]*strategy.Execution, len(intents))
+
+	for n, i := range intents {
+		wg.Add(1)
+		go func(n int, i *strategy.Intent) {
+			defer wg.Done()
+			execs[n] = e.execute(i)
+		}(n, i)
+	}
+
+	wg.Wait()
+	return execs
+}
+
+func (e *liveExecutor) execute(i *strategy.Intent) *strategy.Execution {
+	x := &strategy.Execution{Intent: i}
+
+	t, ok := e.traders[i.Exchanger]
+	if !ok {
+		x.Err = fmt.Errorf("Missing trader for %s", i.Exchanger)
+		return x
+	}
+
+	if i.Type == strategy.Market {
+		x.OrderIDs, x.Err = t.PlaceOrder(i.Side, i.Pair, i.Price, i.Volume)
+		if x.Err == nil {
+			log.Printf("Order sent successfully on %s\n", i.Exchanger)
+		}
+		return x
+	}
+
+	lt, ok := t.(LimitTrader)
+	if !ok {
+		x.Err = fmt.Errorf("%s: limit orders and cancellation are not supported", i.Exchanger)
+		return x
+	}
+
+	switch i.Type {
+	case strategy.Limit:
+		var id string
+		id, x.Err = lt.PlaceLimitOrder(i.Side, i.Pair, i.Price, i.Volume)
+		if x.Err == nil {
+			x.OrderIDs = []string{id}
+		}
+	case strategy.Cancel:
+		x.Err = lt.CancelOrder(i.Side, i.Pair, i.OrderID)
+	default:
+		x.Err = fmt.Errorf("%s: unknown intent type %s", i.Exchanger, i.Type)
+	}
+
+	return x
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"database/sql"
 	"flag"
+	"fmt"
 	"log"
 	"time"
 
+	"bitbot/address"
+	"bitbot/database"
 	"bitbot/exchanger"
+	"bitbot/strategy"
 
+	"bitbot/exchanger/bitfinex"
+	"bitbot/exchanger/bittrex"
+	"bitbot/exchanger/cex"
 	"bitbot/exchanger/hitbtc"
 	"bitbot/exchanger/kraken"
 	"bitbot/exchanger/poloniex"
@@ -17,6 +24,13 @@ import (
 var (
 	p          = flag.String("p", "zec_btc", "Currency pair.")
 	configPath = flag.String("config", "ansible/secrets/trader.json", "JSON file that stores exchanger credentials.")
+	paper      = flag.Bool("paper", false, "Simulate orders against live orderbooks instead of sending them.")
+	strat      = flag.String("strategy", "arbitrage", "Strategy to run: `arbitrage` or `marketmaking`.")
+	planOnly   = flag.Bool("plan", false, "Print the rebalancing plan of the pair currencies and exit.")
+	snapshot   = flag.Duration("snapshot", 15*time.Minute, "Period of the balance snapshots.")
+	maxAge     = flag.Duration("max-book-age", periodicity*time.Second, "Age past which order books are discarded.")
+	maxSkew    = flag.Duration("max-book-skew", 5*time.Second, "Maximum time between the snapshots of two books arbitraged.")
+	leaseTTL   = flag.Duration("lease-ttl", 30*time.Second, "Time after which the trading lease of a dead process expires.")
 )
 
 var pairs = map[string]exchanger.Pair{
@@ -32,9 +46,20 @@ const (
 )
 
 func main() {
-	log.Println("Start trader...")
 	flag.Parse()
 
+	cmd := flag.Arg(0)
+	switch cmd {
+	case "", "trade", "portfolio":
+	case "approvals", "approve", "reject":
+		review(cmd, flag.Arg(1))
+		return
+	default:
+		log.Fatal("first argument must be `trade`, `portfolio`, `approvals`, `approve` or `reject`")
+	}
+
+	log.Println("Start trader...")
+
 	config, err := LoadConfig(*configPath)
 	if err != nil {
 		log.Panic(err)
@@ -45,11 +70,14 @@ func main() {
 		log.Panicf("Unsupported pair %s\n", *p)
 	}
 
-	bookFuncs := map[string]bookFunc{
+	// Bitfinex and Cex are not traded but their books can be used as reference prices.
+	bookFuncs := map[string]strategy.BookFunc{
 		hitbtc.ExchangerName:         hitbtc.OrderBook,
 		poloniex.ExchangerName:       poloniex.OrderBook,
 		kraken.ExchangerName:         kraken.OrderBook,
 		therocktrading.ExchangerName: therocktrading.OrderBook,
+		bitfinex.ExchangerName:       bitfinex.OrderBook,
+		cex.ExchangerName:            cex.OrderBook,
 	}
 
 	traders := map[string]Trader{
@@ -66,96 +94,233 @@ func main() {
 		"The Rock Trading": NewTheRockWithdrawer(config.TheRockTrading),
 	}
 
-	go startSyncTrades(config)
+	// portfolio only snapshots the balances, for instance when the trader isn't running
+	// live.
+	if cmd == "portfolio" {
+		db, err := OpenMysql()
+		if err != nil {
+			log.Panic(err)
+		}
+		defer db.Close()
 
-	for {
-		work(pair, bookFuncs, traders, withdrawers)
-		log.Printf("Waiting %d seconds before fetching orderbooks...\n", periodicity)
-		time.Sleep(time.Duration(periodicity) * time.Second)
+		// balance queries use the API keys as well
+		acquireLease(db)
+
+		log.Println("Start balance snapshots...")
+		startSnapshotBalances(db, withdrawers, newReconciliation(config.Reconciliation), *snapshot)
 	}
-}
 
-func work(pair exchanger.Pair, bookFuncs map[string]bookFunc, traders map[string]Trader, withdrawers map[string]Withdrawer) {
-	balances, err := getBalances(withdrawers)
-	if err != nil {
-		log.Printf("Cannot retrieve balances: %s", err)
+	rebalancer := newRebalancer(withdrawers, traders, nil, config.Rebalance)
+
+	if *planOnly {
+		printPlans(rebalancer, pair, bookFuncs)
 		return
 	}
 
-	printBalances(balances, pair)
+	balances := func() (strategy.Balances, error) {
+		b, err := getBalances(withdrawers)
+		if err != nil {
+			return nil, err
+		}
+		printBalances(b, pair)
+		return b, nil
+	}
 
-	for arb := range findArbitages(pair, bookFuncs) {
-		_, ok := traders[arb.buyEx.Exchanger]
-		if !ok {
-			log.Printf("Missing trader for %s\n", arb.buyEx.Exchanger)
-			continue
+	strategyBooks := map[string]strategy.BookFunc{}
+	var s strategy.Strategy
+
+	switch *strat {
+	case "arbitrage":
+		arb := strategy.NewArbitrage(pair, minSpread, minVol)
+		arb.MaxBookAge = *maxAge
+		arb.MaxBookSkew = *maxSkew
+		s = arb
+
+		for ex := range traders {
+			strategyBooks[ex] = bookFuncs[ex]
 		}
+	case "marketmaking":
+		mm, err := newMarketMaker(config.MarketMaker, pair, traders)
+		if err != nil {
+			log.Panic(err)
+		}
+		s = mm
 
-		_, ok = traders[arb.sellEx.Exchanger]
-		if !ok {
-			log.Printf("Missing trader for %s\n", arb.sellEx.Exchanger)
-			continue
+		for _, ex := range append([]string{mm.Exchanger}, mm.Reference...) {
+			f, ok := bookFuncs[ex]
+			if !ok {
+				log.Panicf("No orderbook for %s\n", ex)
+			}
+			strategyBooks[ex] = f
+		}
+	default:
+		log.Panicf("Unknown strategy %s\n", *strat)
+	}
+
+	risk := &strategy.BalanceRisk{QuoteReserve: 0.05}
+
+	var engine *strategy.Engine
+	var lease *database.Lease
+
+	if *paper {
+		log.Println("Paper mode: orders are simulated")
+		initial, err := balances()
+		if err != nil {
+			log.Panic(err)
 		}
 
-		if arb.spread < minSpread || arb.vol < minVol {
+		executor := strategy.NewPaperExecutor(initial, 0.0025)
+		feed := strategy.NewLiveFeed(pair, strategyBooks, executor.Balances)
+		engine = strategy.NewEngine(s, feed, risk, executor, nil)
+	} else {
+		db, err := OpenMysql()
+		if err != nil {
+			log.Panic(err)
+		}
+		defer db.Close()
+
+		lease = acquireLease(db)
+
+		feed := strategy.NewLiveFeed(pair, strategyBooks, balances)
+		engine = strategy.NewEngine(s, feed, risk, &liveExecutor{traders}, &dbStore{db})
+
+		book, err := address.LoadBook(db)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		policy := &withdrawalPolicy{config.WithdrawalLimits}
+		rebalancer.transfers = newTransferWorker(&dbTransferStore{db}, withdrawers, book, policy)
+		rebalancer.store = &dbStore{db}
+
+		historians := map[string]exchanger.TransferHistorian{}
+		for ex, w := range withdrawers {
+			historians[ex] = w
+		}
+		if config.Bittrex.Key != "" {
+			historians[bittrex.ExchangerName] = bittrex.NewClient(config.Bittrex.Key, config.Bittrex.Secret)
+		}
+		go startSyncTransfers(db, historians, currencies())
+
+		tradeHistorians := map[string]exchanger.TradeHistorian{}
+		for ex, t := range traders {
+			if h, ok := t.(exchanger.TradeHistorian); ok {
+				tradeHistorians[ex] = h
+			}
+		}
+
+		// orders and transfers interrupted by the last stop are settled before trading
+		recoverState(db, traders, tradeHistorians, withdrawers, rebalancer.transfers)
+
+		go rebalancer.transfers.run(time.Minute)
+		go startSyncTrades(db, tradeHistorians, []exchanger.Pair{pair})
+		go startSnapshotBalances(db, withdrawers, newReconciliation(config.Reconciliation), *snapshot)
+	}
+
+	for {
+		if lease != nil && !lease.Held() {
+			log.Println("Trading lease not renewed, skipping cycle...")
+			time.Sleep(time.Duration(periodicity) * time.Second)
 			continue
 		}
 
-		availableSellVol := balances[arb.sellEx.Exchanger][pair.Base]
-		availableBuyVol := 0.95 * (balances[arb.buyEx.Exchanger][pair.Quote] / arb.buyEx.Asks[0].Price)
-		arb.vol = minFloat64(arb.vol, availableSellVol, availableBuyVol)
-		arbitre(traders, arb)
-		rebalance(withdrawers, pair)
+		if execs := engine.RunOnce(); len(execs) > 0 && !*paper && *strat == "arbitrage" {
+			rebalancer.rebalance(pair, execs[0].Intent.Price)
+		}
+
+		log.Printf("Waiting %d seconds before fetching orderbooks...\n", periodicity)
+		time.Sleep(time.Duration(periodicity) * time.Second)
 	}
 }
 
-func arbitre(traders map[string]Trader, arb *arbitrage) {
-	log.Println(arb)
+func newMarketMaker(conf MarketMakerConfig, pair exchanger.Pair, traders map[string]Trader) (*strategy.MarketMaker, error) {
+	t, ok := traders[conf.Exchanger]
+	if !ok {
+		return nil, fmt.Errorf("Missing trader for %s", conf.Exchanger)
+	}
 
-	db, err := OpenMysql()
-	if err != nil {
-		log.Printf("executeOrder: cannot open db %s\n", err)
-		return
+	if _, ok := t.(LimitTrader); !ok {
+		return nil, fmt.Errorf("%s doesn't support limit orders and cancellation", conf.Exchanger)
 	}
 
-	ex1 := arb.buyEx.Exchanger
-	go executeOrder(db, traders[ex1], arb.id, ex1, "buy", arb.pair, arb.buyEx.Asks[0].Price, arb.vol)
+	mm := strategy.NewMarketMaker(conf.Exchanger, pair, conf.Reference)
+	mm.HalfSpread = conf.HalfSpread
+	mm.Skew = conf.Skew
+	mm.RefreshThreshold = conf.RefreshThreshold
+	mm.MaxDataAge = time.Duration(conf.MaxDataAge) * time.Second
+	mm.MaxDataSkew = time.Duration(conf.MaxDataSkew) * time.Second
+	mm.QuoteSize = conf.QuoteSize
+	mm.MinQuoteSize = conf.MinQuoteSize
+	mm.TargetInventory = conf.TargetInventory
+	mm.MaxInventory = conf.MaxInventory
+	return mm, nil
+}
 
-	ex2 := arb.sellEx.Exchanger
-	go executeOrder(db, traders[ex2], arb.id, ex2, "sell", arb.pair, arb.sellEx.Bids[0].Price, arb.vol)
+// tradingLease is the lease held by the process trading and withdrawing with the API
+// keys of the config.
+const tradingLease = "trading"
 
-	err = saveArbitrage(db, arb)
+// acquireLease takes the trading lease and keeps it in the background. The process
+// exits when another one holds it, or once it lost it: two processes using the same API
+// keys place duplicate orders and collide on nonces.
+func acquireLease(db *sql.DB) *database.Lease {
+	lease := database.NewLease(db, tradingLease, database.HolderID(), *leaseTTL)
+
+	ok, err := lease.Acquire()
 	if err != nil {
-		log.Printf("saveArbitrage failed - %s\n", err)
+		log.Panic(err)
+	} else if !ok {
+		log.Fatalf("The %s lease is held by another process\n", tradingLease)
 	}
+
+	log.Printf("Lease %s acquired by %s (token %d)\n", tradingLease, lease.Holder, lease.Token())
+
+	go func() {
+		err := lease.Keep()
+		log.Fatalf("Lease %s lost, exiting - %s\n", tradingLease, err)
+	}()
+
+	return lease
 }
 
-func executeOrder(db *sql.DB, t Trader, arbId, ex, side string, pair exchanger.Pair, price, vol float64) {
-	log.Printf("%s: side: %s | pair: %s | price: %f | vol: %f\n", ex, side, pair, price, vol)
+// currencies returns the currencies of the supported pairs.
+func currencies() []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, pair := range pairs {
+		for _, cur := range []string{pair.Base, pair.Quote} {
+			if !seen[cur] {
+				seen[cur] = true
+				out = append(out, cur)
+			}
+		}
+	}
+	return out
+}
 
-	ids, err := t.PlaceOrder(side, pair, price, vol)
+// printPlans prints the rebalancing plans of both currencies of pair. The first orderbook
+// available gives the price of on-venue trades.
+func printPlans(r *rebalancer, pair exchanger.Pair, bookFuncs map[string]strategy.BookFunc) {
+	balances, err := getBalances(r.withdrawers)
 	if err != nil {
-		log.Printf("Cannot execute %s order on %s: %s\n", side, ex, err)
-		return
-	} else {
-		log.Printf("Order sent successfully on %s\n", ex)
+		log.Panic(err)
 	}
 
-	// TODO: batch this operation with one insert
-	for _, id := range ids {
-		err = saveOrderAck(db, arbId, id, pair.String(), ex, side)
-		if err != nil {
-			log.Printf("saveOrderAck failed - %s\n", err)
+	var price float64
+	for ex := range r.traders {
+		book, err := bookFuncs[ex](pair)
+		if err == nil {
+			price = (book.Bids[0].Price + book.Asks[0].Price) / 2
+			break
 		}
 	}
-}
 
-func minFloat64(vols ...float64) float64 {
-	var m float64 = vols[0]
-	for _, v := range vols[1:] {
-		if v < m {
-			m = v
+	for _, cur := range []string{pair.Base, pair.Quote} {
+		plan, err := r.plan(cur, pair, price, balances)
+		if err != nil {
+			log.Printf("Cannot plan %s rebalancing - %s\n", cur, err)
+			continue
 		}
+		fmt.Print(plan)
 	}
-	return m
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Withdrawal decisions as written in the audit trail.
+const (
+	decisionAllowed          = "allowed"
+	decisionRejected         = "rejected"
+	decisionApprovalRequired = "approval_required"
+	decisionApproved         = "approved"
+	decisionManualRejection  = "manually_rejected"
+)
+
+// decision is the outcome of the withdrawal policy for a transfer.
+type decision struct {
+	verdict string
+	reason  string
+}
+
+// withdrawalPolicy enforces the withdrawal limits of the configuration. Currencies
+// without limits can't be withdrawn.
+type withdrawalPolicy struct {
+	limits map[string]WithdrawalLimit
+}
+
+// venueLimiter is implemented by the withdrawers of exchangers that cap withdrawals.
+type venueLimiter interface {
+	// AvailableWithdrawal returns the amount of cur that can still be withdrawn today.
+	AvailableWithdrawal(cur string) (float64, error)
+}
+
+// evaluate returns the decision for t. withdrawn is the amount of currency sent during
+// the last 24 hours and available the venue limit (negative when the venue has none).
+// approved is true when t was manually approved.
+func (p *withdrawalPolicy) evaluate(t *transfer, withdrawn, available float64, approved bool) decision {
+	l, ok := p.limits[t.currency]
+	if !ok {
+		return decision{decisionRejected, fmt.Sprintf("no withdrawal limit for %s", t.currency)}
+	}
+
+	switch {
+	case l.Max > 0 && t.amount > l.Max:
+		return decision{decisionRejected, fmt.Sprintf("%f exceeds the %f %s limit per withdrawal", t.amount, l.Max, t.currency)}
+	case l.Daily > 0 && withdrawn+t.amount > l.Daily:
+		return decision{decisionRejected, fmt.Sprintf("%f %s already withdrawn today, the daily limit is %f", withdrawn, t.currency, l.Daily)}
+	case available >= 0 && t.amount > available:
+		return decision{decisionRejected, fmt.Sprintf("%s only allows %f %s more today", t.from, available, t.currency)}
+	case !approved && l.ApprovalAbove > 0 && t.amount > l.ApprovalAbove:
+		return decision{decisionApprovalRequired, fmt.Sprintf("%f is above the %f %s approval threshold", t.amount, l.ApprovalAbove, t.currency)}
+	}
+
+	if approved {
+		return decision{decisionAllowed, "manually approved"}
+	}
+	return decision{decisionAllowed, "within limits"}
+}
+
+// auditEntry is a row of the `withdrawal_audit` table.
+type auditEntry struct {
+	transferId string
+	time       time.Time
+	decision   string
+	reason     string
+	// actor is the worker or the user behind the decision.
+	actor    string
+	currency string
+	from     string
+	to       string
+	address  string
+	amount   float64
+}
+
+// authorize runs the policy and writes the decision to the audit trail. No decision is
+// returned when it can't be recorded.
+func (w *transferWorker) authorize(t *transfer, from Withdrawer) (*decision, error) {
+	withdrawn, err := w.store.withdrawnSince(t.currency, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	available := -1.0
+	if v, ok := from.(venueLimiter); ok {
+		available, err = v.AvailableWithdrawal(t.currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d := w.policy.evaluate(t, withdrawn, available, t.status == transferApproved)
+	err = w.store.audit(&auditEntry{t.id, time.Now(), d.verdict, d.reason, "trader", t.currency, t.from, t.to, t.address, t.amount})
+	if err != nil {
+		return nil, fmt.Errorf("cannot write audit trail - %s", err)
+	}
+
+	return &d, nil
+}
+
+// AvailableWithdrawal implements venueLimiter.
+func (w *TheRockWithdrawer) AvailableWithdrawal(cur string) (float64, error) {
+	l, err := w.Client.WithdrawLimit(cur)
+	if err != nil {
+		return 0, fmt.Errorf("The Rock Trading: call to WithdrawLimit failed - %s", err)
+	}
+	return l.Available, nil
+}
+
+// reviewTransfer approves or rejects a transfer awaiting approval.
+func reviewTransfer(store transferStore, id string, approve bool) error {
+	transfers, err := store.pendingTransfers()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range transfers {
+		if t.id != id {
+			continue
+		}
+
+		if t.status != transferAwaitingApproval {
+			return fmt.Errorf("transfer %s isn't awaiting approval (%s)", id, t.status)
+		}
+
+		d, status := decisionApproved, transferApproved
+		if !approve {
+			d, status = decisionManualRejection, transferFailed
+			t.err = "manually rejected"
+		}
+
+		err := store.audit(&auditEntry{t.id, time.Now(), d, "manual review", currentUser(), t.currency, t.from, t.to, t.address, t.amount})
+		if err != nil {
+			return fmt.Errorf("cannot write audit trail - %s", err)
+		}
+
+		t.status = status
+		t.updated = time.Now()
+		return store.updateTransfer(t)
+	}
+
+	return fmt.Errorf("unknown transfer %s", id)
+}
+
+// printApprovals prints the transfers awaiting approval.
+func printApprovals(store transferStore) error {
+	transfers, err := store.pendingTransfers()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range transfers {
+		if t.status == transferAwaitingApproval {
+			fmt.Printf("%s\t%f %s\t%s -> %s\t%s\t%s\n", t.id, t.amount, t.currency, t.from, t.to, t.address, t.created.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// review runs the review subcommands: `approvals` lists the transfers awaiting approval,
+// `approve <id>` and `reject <id>` decide on one of them.
+func review(cmd, id string) {
+	db, err := OpenMysql()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	store := &dbTransferStore{db}
+
+	switch cmd {
+	case "approvals":
+		err = printApprovals(store)
+	case "approve", "reject":
+		if id == "" {
+			log.Fatalf("usage: trader %s <transfer id>\n", cmd)
+		}
+		err = reviewTransfer(store, id, cmd == "approve")
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func currentUser() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	return "unknown"
+}
+
+func (s *dbTransferStore) withdrawnSince(cur string, since time.Time) (float64, error) {
+	// withdrawals are counted once they may have been sent
+	const query = `
+		select coalesce(sum(amount), 0)
+		from transfers
+		where currency = ? and created_at >= ? and status in (?, ?, ?, ?, ?)
+	`
+	var total float64
+	err := s.db.QueryRow(query, cur, since, transferWithdrawing, transferAcknowledged, transferOnChain,
+		transferCredited, transferCompleted).Scan(&total)
+	return total, err
+}
+
+func (s *dbTransferStore) audit(a *auditEntry) error {
+	const stmt = `
+		insert into withdrawal_audit
+			(transfer_id, ts, decision, reason, actor, currency, from_ex, to_ex, address, amount)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.db.Exec(stmt, a.transferId, a.time, a.decision, a.reason, a.actor, a.currency, a.from, a.to, a.address, a.amount)
+	if err == nil {
+		log.Printf("Withdrawal audit: %s %s (%s) by %s\n", a.transferId, a.decision, a.reason, a.actor)
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"bitbot/address"
+	"bitbot/exchanger"
+)
+
+func TestWithdrawalPolicy(t *testing.T) {
+	p := &withdrawalPolicy{map[string]WithdrawalLimit{"BTC": {Max: 2, Daily: 3, ApprovalAbove: 1}}}
+
+	tests := []struct {
+		cur       string
+		amount    float64
+		withdrawn float64
+		available float64
+		approved  bool
+		verdict   string
+	}{
+		{"BTC", 0.5, 0, -1, false, decisionAllowed},
+		{"ZEC", 0.5, 0, -1, false, decisionRejected},
+		{"BTC", 2.5, 0, -1, true, decisionRejected},
+		{"BTC", 0.5, 2.8, -1, false, decisionRejected},
+		{"BTC", 0.5, 0, 0.4, false, decisionRejected},
+		{"BTC", 1.5, 0, -1, false, decisionApprovalRequired},
+		{"BTC", 1.5, 0, -1, true, decisionAllowed},
+	}
+
+	for _, test := range tests {
+		tr := &transfer{currency: test.cur, amount: test.amount}
+		if d := p.evaluate(tr, test.withdrawn, test.available, test.approved); d.verdict != test.verdict {
+			t.Errorf("%f %s: %s expected, got %s (%s)", test.amount, test.cur, test.verdict, d.verdict, d.reason)
+		}
+	}
+}
+
+func TestManualApproval(t *testing.T) {
+	const (
+		addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+		addr2 = "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	)
+
+	balances := map[string]map[string]float64{"market1": {"BTC": 5}, "market2": {"BTC": 0}}
+	history := map[string][]*exchanger.Transfer{}
+	owners := map[string]string{addr1: "market1", addr2: "market2"}
+
+	book := address.NewBook()
+	withdrawers := map[string]Withdrawer{}
+	for addr, ex := range owners {
+		withdrawers[ex] = &TestWithdrawer{ex, addr, balances, history, owners}
+		book.Add(&address.Entry{Exchanger: ex, Currency: "BTC", Address: addr})
+	}
+
+	store := &memTransferStore{}
+	policy := &withdrawalPolicy{map[string]WithdrawalLimit{"BTC": {ApprovalAbove: 1}}}
+	worker := newTransferWorker(store, withdrawers, book, policy)
+
+	tr, err := worker.request("market1", "market2", "BTC", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker.processAll()
+	if tr.status != transferAwaitingApproval || balances["market1"]["BTC"] != 5 {
+		t.Fatalf("the transfer should wait for approval, got %s", tr.status)
+	}
+
+	if err := reviewTransfer(store, tr.id, true); err != nil {
+		t.Fatal(err)
+	}
+
+	worker.processAll()
+	if tr.status != transferCompleted || balances["market2"]["BTC"] != 2 {
+		t.Fatalf("the approved transfer should be completed, got %s (%s)", tr.status, tr.err)
+	}
+
+	decisions := []string{}
+	for _, a := range store.audits {
+		decisions = append(decisions, a.decision)
+	}
+	expected := []string{decisionApprovalRequired, decisionApproved, decisionAllowed}
+	if len(decisions) != len(expected) {
+		t.Fatalf("audit trail should be %v, got %v", expected, decisions)
+	}
+	for i := range expected {
+		if decisions[i] != expected[i] {
+			t.Errorf("audit trail should be %v, got %v", expected, decisions)
+			break
+		}
+	}
+}
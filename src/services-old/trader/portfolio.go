@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"bitbot/errorutils"
+	"bitbot/pnl"
+)
+
+// Account names.
+const (
+	mainAccount    = "main"
+	tradingAccount = "trading"
+)
+
+// valuationCurrencies are the currencies the snapshots are valued in.
+var valuationCurrencies = []string{"BTC", "USD", "EUR"}
+
+// maxPriceAge is the maximum age of the prices used to value the balances.
+const maxPriceAge = time.Hour
+
+// An accountLister is a Withdrawer holding funds on several accounts (Hitbtc main and
+// trading accounts). The other withdrawers only have a trading account.
+type accountLister interface {
+	// AccountBalances maps account names to balances.
+	AccountBalances() (map[string]map[string]float64, error)
+}
+
+// balanceSnapshot is the balance of a currency on an account at the time of a snapshot.
+type balanceSnapshot struct {
+	exchanger string
+	account   string
+	currency  string
+	balance   float64
+	// values maps the valuation currencies to the value of the balance. Currencies
+	// without price are missing.
+	values map[string]float64
+}
+
+type balanceSnapshots []*balanceSnapshot
+
+func (s balanceSnapshots) Len() int      { return len(s) }
+func (s balanceSnapshots) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s balanceSnapshots) Less(i, j int) bool {
+	if s[i].exchanger != s[j].exchanger {
+		return s[i].exchanger < s[j].exchanger
+	}
+	if s[i].account != s[j].account {
+		return s[i].account < s[j].account
+	}
+	return s[i].currency < s[j].currency
+}
+
+// takeSnapshot returns the non-zero balances of every account of the withdrawers valued
+// at t. It fails when any venue can't be read so that snapshots are always complete.
+func takeSnapshot(withdrawers map[string]Withdrawer, rates map[string]pnl.Rates, t time.Time) ([]*balanceSnapshot, error) {
+	snapshots := balanceSnapshots{}
+
+	for ex, w := range withdrawers {
+		accounts := map[string]map[string]float64{}
+
+		if l, ok := w.(accountLister); ok {
+			var err error
+			if accounts, err = l.AccountBalances(); err != nil {
+				return nil, fmt.Errorf("cannot get %s balances - %s", ex, err)
+			}
+		} else {
+			b, err := w.TradingBalances()
+			if err != nil {
+				return nil, fmt.Errorf("cannot get %s balances - %s", ex, err)
+			}
+			accounts[tradingAccount] = b
+		}
+
+		for account, balances := range accounts {
+			for cur, balance := range balances {
+				if balance == 0 {
+					continue
+				}
+
+				s := &balanceSnapshot{ex, account, cur, balance, map[string]float64{}}
+				for _, valuation := range valuationCurrencies {
+					rate, err := rates[valuation].Rate(cur, t)
+					if err != nil {
+						log.Printf("takeSnapshot: cannot value %s in %s - %s\n", cur, valuation, err)
+						continue
+					}
+					s.values[valuation] = balance * rate
+				}
+
+				snapshots = append(snapshots, s)
+			}
+		}
+	}
+
+	sort.Sort(snapshots)
+	return snapshots, nil
+}
+
+// startSnapshotBalances periodically saves the balances of all the accounts in the
+// `balance_snapshot` table. Each snapshot is reconciled with the previous one once its
+// movements are synced (see reconcileLag).
+func startSnapshotBalances(db *sql.DB, withdrawers map[string]Withdrawer, rc *reconciliation, period time.Duration) {
+	for {
+		snapshotBalances(db, withdrawers, rc)
+		time.Sleep(period)
+	}
+}
+
+func snapshotBalances(db *sql.DB, withdrawers map[string]Withdrawer, rc *reconciliation) {
+	defer errorutils.LogPanic()
+
+	rates := map[string]pnl.Rates{}
+	for _, cur := range valuationCurrencies {
+		prices := pnl.NewPrices(cur, maxPriceAge)
+		prices.Source = &pnl.RecordedBooks{DB: db}
+		rates[cur] = prices
+	}
+
+	// timestamps are stored with a millisecond precision and the snapshot is read back
+	// by its time
+	t := time.Now().Truncate(time.Millisecond)
+	snapshots, err := takeSnapshot(withdrawers, rates, t)
+	if err != nil {
+		log.Printf("snapshotBalances: %s\n", err)
+		return
+	}
+
+	if err := saveSnapshot(db, t, snapshots); err != nil {
+		log.Printf("snapshotBalances: saveSnapshot() failed - %s\n", err)
+		return
+	}
+
+	log.Printf("snapshotBalances: %d balances saved\n", len(snapshots))
+
+	if err := rc.run(db, t); err != nil {
+		log.Printf("snapshotBalances: reconciliation failed - %s\n", err)
+	}
+}
+
+func saveSnapshot(db *sql.DB, t time.Time, snapshots []*balanceSnapshot) error {
+	const stmt = `
+		insert into balance_snapshot
+			(ts, exchanger, account, currency, balance, value_btc, value_usd, value_eur)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("db.Begin() failed - %s", err)
+	}
+
+	for _, s := range snapshots {
+		params := []interface{}{t, s.exchanger, s.account, s.currency, s.balance}
+		for _, cur := range valuationCurrencies {
+			if v, ok := s.values[cur]; ok {
+				params = append(params, v)
+			} else {
+				params = append(params, nil)
+			}
+		}
+
+		if _, err := tx.Exec(stmt, params...); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("tx.Exec() failed - %s %s - %s", s.exchanger, s.currency, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/pnl"
+)
+
+// testAccounts is a withdrawer with main and trading accounts.
+type testAccounts struct {
+	*TestWithdrawer
+	main map[string]float64
+}
+
+func (t *testAccounts) AccountBalances() (map[string]map[string]float64, error) {
+	trading, _ := t.TradingBalances()
+	return map[string]map[string]float64{mainAccount: t.main, tradingAccount: trading}, nil
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	now := time.Now()
+
+	balances := map[string]map[string]float64{
+		"A": {"BTC": 1, "ZEC": 10},
+		"B": {"BTC": 0.5, "ZEC": 0},
+	}
+
+	withdrawers := map[string]Withdrawer{
+		"A": &TestWithdrawer{exchangerName: "A", balances: balances},
+		"B": &testAccounts{&TestWithdrawer{exchangerName: "B", balances: balances}, map[string]float64{"ZEC": 2}},
+	}
+
+	rates := map[string]pnl.Rates{}
+	for _, cur := range valuationCurrencies {
+		rates[cur] = pnl.NewPrices(cur, time.Hour)
+	}
+	rates["BTC"].(*pnl.Prices).Add(exchanger.ZEC_BTC, 0.01, now)
+	rates["EUR"].(*pnl.Prices).Add(exchanger.ZEC_BTC, 0.01, now)
+	rates["EUR"].(*pnl.Prices).Add(exchanger.BTC_EUR, 2000, now)
+
+	snapshots, err := takeSnapshot(withdrawers, rates, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// zero balances are skipped
+	expected := []string{"A trading BTC", "A trading ZEC", "B main ZEC", "B trading BTC"}
+	if len(snapshots) != len(expected) {
+		t.Fatalf("%d balances expected, got %d", len(expected), len(snapshots))
+	}
+
+	for i, s := range snapshots {
+		if key := s.exchanger + " " + s.account + " " + s.currency; key != expected[i] {
+			t.Errorf("%s expected at %d, got %s", expected[i], i, key)
+		}
+	}
+
+	zec := snapshots[2]
+	if zec.values["BTC"] != 0.02 || zec.values["EUR"] != 40 {
+		t.Errorf("2 ZEC should be worth 0.02 BTC and 40 EUR, got %v", zec.values)
+	}
+
+	if _, ok := zec.values["USD"]; ok {
+		t.Errorf("no USD price is recorded")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/reconcile"
+)
+
+// defaultReconciliationTolerance applies when no tolerance is configured.
+const defaultReconciliationTolerance = 1e-6
+
+func newReconciler(conf ReconciliationConfig) *reconcile.Reconciler {
+	tol := conf.DefaultTolerance
+	if tol == 0 {
+		tol = defaultReconciliationTolerance
+	}
+
+	return &reconcile.Reconciler{
+		Tolerance:        conf.Tolerance,
+		DefaultTolerance: tol,
+		HoldingAccounts:  []string{mainAccount},
+	}
+}
+
+// reconcileLag is the age of the snapshots reconciled. The trades and the transfers of a
+// period are synced every 10 and 30 minutes (see startSyncTrades and startSyncTransfers):
+// a snapshot reconciled right away would miss them and raise false alerts.
+const reconcileLag = time.Hour
+
+// reconciliation reconciles the snapshots once the movements of their period are synced.
+type reconciliation struct {
+	r *reconcile.Reconciler
+	// last is the time of the last snapshot reconciled. The snapshots taken within
+	// reconcileLag before a restart are not reconciled: the snapshots after them are
+	// reconciled with the last one of them instead.
+	last time.Time
+}
+
+func newReconciliation(conf ReconciliationConfig) *reconciliation {
+	return &reconciliation{r: newReconciler(conf), last: time.Now().Add(-reconcileLag)}
+}
+
+// run reconciles the snapshots taken since the last one reconciled and older than
+// reconcileLag, each with the previous one.
+func (rc *reconciliation) run(db *sql.DB, now time.Time) error {
+	const query = "select distinct ts from balance_snapshot where ts > ? and ts <= ? order by ts"
+
+	rows, err := db.Query(query, rc.last, now.Add(-reconcileLag))
+	if err != nil {
+		return fmt.Errorf("cannot list snapshots - %s", err)
+	}
+	defer rows.Close()
+
+	times := []time.Time{}
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return err
+		}
+		times = append(times, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range times {
+		if err := reconcileSnapshot(db, rc.r, t); err != nil {
+			return err
+		}
+		rc.last = t
+	}
+	return nil
+}
+
+// reconcileSnapshot reconciles the snapshot taken at t with the previous one and saves
+// the alerts raised.
+func reconcileSnapshot(db *sql.DB, r *reconcile.Reconciler, t time.Time) error {
+	var prev *time.Time
+	err := db.QueryRow("select max(ts) from balance_snapshot where ts < ?", t).Scan(&prev)
+	if err != nil {
+		return fmt.Errorf("cannot find previous snapshot - %s", err)
+	} else if prev == nil {
+		return nil
+	}
+
+	before, err := loadSnapshot(db, *prev)
+	if err != nil {
+		return err
+	}
+
+	after, err := loadSnapshot(db, t)
+	if err != nil {
+		return err
+	}
+
+	movements, err := loadMovements(db, *prev, t)
+	if err != nil {
+		return err
+	}
+
+	report := r.Reconcile(before, after, movements)
+	for _, a := range report.Alerts {
+		log.Printf("ALERT reconciliation: %s\n", a.Message)
+	}
+
+	return saveAlerts(db, "reconciliation", report.To, report.Alerts)
+}
+
+func loadSnapshot(db *sql.DB, t time.Time) (*reconcile.Snapshot, error) {
+	const query = "select exchanger, account, currency, balance from balance_snapshot where ts = ?"
+
+	rows, err := db.Query(query, t)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load snapshot - %s", err)
+	}
+	defer rows.Close()
+
+	s := &reconcile.Snapshot{Time: t, Balances: []*reconcile.Balance{}}
+	for rows.Next() {
+		b := &reconcile.Balance{}
+		if err := rows.Scan(&b.Exchanger, &b.Account, &b.Currency, &b.Amount); err != nil {
+			return nil, err
+		}
+		s.Balances = append(s.Balances, b)
+	}
+
+	return s, rows.Err()
+}
+
+// loadMovements returns the trades and the transfers recorded within (from, to].
+// Withdrawals are debited with their fee when requested, deposits are credited once
+// completed.
+func loadMovements(db *sql.DB, from, to time.Time) ([]*reconcile.Movement, error) {
+	const tradeQuery = `
+		select exchanger, trade_id, pair, side, price, quantity, fee, fee_currency, ts
+		from trade
+		where ts > ? and ts <= ?
+	`
+
+	const transferQuery = `
+		select exchanger, kind, transfer_id, currency, amount, fee, ts
+		from transfer_history
+		where
+			ts > ? and ts <= ?
+			and ((kind = 'deposit' and status = 'completed') or (kind = 'withdrawal' and status <> 'failed'))
+	`
+
+	movements := []*reconcile.Movement{}
+
+	rows, err := db.Query(tradeQuery, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load trades - %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ex, id, pair, side, feeCur string
+		var price, vol, fee float64
+		var ts time.Time
+
+		if err := rows.Scan(&ex, &id, &pair, &side, &price, &vol, &fee, &feeCur, &ts); err != nil {
+			return nil, err
+		}
+		movements = append(movements, reconcile.TradeMovements(ex, id, exchanger.NewPair(pair), side, price, vol, fee, feeCur, ts)...)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(transferQuery, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load transfers - %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &reconcile.Movement{}
+		var fee float64
+
+		if err := rows.Scan(&m.Exchanger, &m.Kind, &m.Ref, &m.Currency, &m.Amount, &fee, &m.Time); err != nil {
+			return nil, err
+		}
+
+		if m.Kind == exchanger.Withdrawal {
+			m.Amount = -(m.Amount + fee)
+		}
+		movements = append(movements, m)
+	}
+
+	return movements, rows.Err()
+}
+
+// saveAlerts records alerts in the `alerts` table.
+func saveAlerts(db *sql.DB, source string, t time.Time, alerts []*reconcile.Alert) error {
+	const stmt = `
+		insert into alerts
+			(ts, source, kind, exchanger, currency, message)
+		values
+			(?, ?, ?, ?, ?, ?)
+	`
+
+	for _, a := range alerts {
+		if _, err := db.Exec(stmt, t, source, a.Kind, a.Exchanger, a.Currency, a.Message); err != nil {
+			return fmt.Errorf("cannot save alert - %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/reconcile"
+	"bitbot/strategy"
+)
+
+// Intent statuses. An intent is saved as pending right before being sent. Once the
+// exchanger answered it is done (market orders and cancellations), open (limit orders
+// resting on the book) or failed. Open intents are cancelled by a later cancel intent.
+// Pending and open intents found at startup were interrupted by a restart, they are
+// reconciled with the state of the exchangers and flagged when it can't be done safely.
+const (
+	intentPending   = "pending"
+	intentOpen      = "open"
+	intentDone      = "done"
+	intentCancelled = "cancelled"
+	intentFailed    = "failed"
+	intentFlagged   = "flagged"
+)
+
+// Alert kinds raised by the recovery.
+const (
+	alertInterrupted = "interrupted"
+	alertUnbalanced  = "unbalanced"
+)
+
+// volumeTolerance is the relative difference tolerated between the volume of an intent
+// and the volume of an order found on the exchanger.
+const volumeTolerance = 0.01
+
+// intentRecord is an intent as stored in the `intents` table.
+type intentRecord struct {
+	*strategy.Intent
+	orderIDs []string
+	status   string
+	err      string
+}
+
+// intentStore persists the intents.
+type intentStore interface {
+	// unsettledIntents returns the pending and open intents.
+	unsettledIntents() ([]*intentRecord, error)
+	updateIntent(r *intentRecord) error
+	// tradesSince returns the synced trades of pair on ex since t.
+	tradesSince(ex string, pair exchanger.Pair, t time.Time) ([]*exchanger.Trade, error)
+	// orderClaimed reports whether one of the ids was acknowledged to an intent.
+	orderClaimed(ex string, ids []string) (bool, error)
+}
+
+// intentRecovery settles the intents interrupted by a restart:
+//   - pending intents are looked up in the trades and the open orders of the exchanger
+//     (their order ids are unknown). An order matching the side and the volume of the
+//     intent is adopted, no order at all means the intent was never sent.
+//   - the open orders of interrupted intents are cancelled since the strategy lost track
+//     of them. Interrupted cancellations are sent again.
+//   - the intents that can't be settled are flagged and raise an alert, and so do the
+//     arbitrages with one leg executed and the other one failed.
+type intentRecovery struct {
+	store   intentStore
+	traders map[string]Trader
+	// open caches the open orders by exchanger and pair.
+	open map[string][]*exchanger.OpenOrder
+	// adopted holds the orders matched with a pending intent, by exchanger and id.
+	adopted map[string]bool
+}
+
+func newIntentRecovery(store intentStore, traders map[string]Trader) *intentRecovery {
+	return &intentRecovery{store, traders, map[string][]*exchanger.OpenOrder{}, map[string]bool{}}
+}
+
+// run settles the records and returns the alerts raised.
+func (rc *intentRecovery) run(records []*intentRecord) ([]*reconcile.Alert, error) {
+	alerts := []*reconcile.Alert{}
+	for _, r := range records {
+		before := r.status
+		rc.resolve(r)
+
+		log.Printf("intentRecovery: %s %s -> %s %s\n", r.ID, before, r.status, r.err)
+		if err := rc.store.updateIntent(r); err != nil {
+			return alerts, fmt.Errorf("call to updateIntent() failed - %s", err)
+		}
+
+		if r.status == intentFlagged {
+			msg := fmt.Sprintf("interrupted order needs review: %s - %s", r.Intent, r.err)
+			alerts = append(alerts, &reconcile.Alert{Kind: alertInterrupted, Exchanger: r.Exchanger, Currency: r.Pair.Base, Message: msg})
+		}
+	}
+
+	return append(alerts, unbalancedGroups(records)...), nil
+}
+
+func (rc *intentRecovery) resolve(r *intentRecord) {
+	t, ok := rc.traders[r.Exchanger]
+	if !ok {
+		rc.flag(r, fmt.Sprintf("missing trader for %s", r.Exchanger))
+		return
+	}
+
+	switch {
+	case r.Type == strategy.Cancel:
+		rc.resolveCancel(r, t)
+	case r.status == intentPending:
+		rc.resolvePending(r, t)
+	default:
+		rc.resolveOpen(r, t)
+	}
+}
+
+// resolveCancel sends again the cancellation of an order still open.
+func (rc *intentRecovery) resolveCancel(r *intentRecord, t Trader) {
+	orders, err := rc.openOrders(r.Exchanger, r.Pair, t)
+	if err != nil {
+		rc.flag(r, err.Error())
+		return
+	}
+
+	if findOrder(orders, r.OrderID) == nil {
+		r.status = intentDone
+		return
+	}
+
+	lt, ok := t.(LimitTrader)
+	if !ok {
+		rc.flag(r, fmt.Sprintf("order %s is open and can't be cancelled", r.OrderID))
+		return
+	}
+
+	if err := lt.CancelOrder(r.Side, r.Pair, r.OrderID); err != nil {
+		rc.flag(r, fmt.Sprintf("cannot cancel order %s - %s", r.OrderID, err))
+		return
+	}
+	r.status = intentDone
+}
+
+// resolvePending looks for the order of an intent that may have been sent.
+func (rc *intentRecovery) resolvePending(r *intentRecord, t Trader) {
+	since := r.Time.Add(-clockSkew)
+
+	trades, err := rc.store.tradesSince(r.Exchanger, r.Pair, since)
+	if err != nil {
+		rc.flag(r, fmt.Sprintf("cannot load trades - %s", err))
+		return
+	}
+
+	orders, err := rc.openOrders(r.Exchanger, r.Pair, t)
+	if err != nil {
+		// market orders don't rest on the book, their trades are enough
+		if r.Type == strategy.Limit {
+			rc.flag(r, err.Error())
+			return
+		}
+		orders = []*exchanger.OpenOrder{}
+	}
+
+	// volume filled or resting of each order
+	volumes := map[string]float64{}
+	tradeIDs := map[string][]string{}
+
+	for _, tr := range trades {
+		if tr.Side == r.Side {
+			volumes[tr.OrderID] += tr.Volume
+			tradeIDs[tr.OrderID] = append(tradeIDs[tr.OrderID], tr.ID)
+		}
+	}
+
+	for _, o := range orders {
+		if o.Side == r.Side && !o.Time.Before(since) {
+			volumes[o.ID] += o.Volume
+		}
+	}
+
+	matches, others := []string{}, []string{}
+	for id, vol := range volumes {
+		if rc.adopted[r.Exchanger+"/"+id] {
+			continue
+		}
+
+		claimed, err := rc.store.orderClaimed(r.Exchanger, append([]string{id}, tradeIDs[id]...))
+		if err != nil {
+			rc.flag(r, fmt.Sprintf("cannot check order %s - %s", id, err))
+			return
+		} else if claimed {
+			continue
+		}
+
+		if math.Abs(vol-r.Volume) <= r.Volume*volumeTolerance {
+			matches = append(matches, id)
+		} else {
+			others = append(others, id)
+		}
+	}
+
+	sort.Strings(matches)
+	sort.Strings(others)
+
+	switch {
+	case len(matches) == 1:
+		r.orderIDs = matches
+		rc.adopted[r.Exchanger+"/"+matches[0]] = true
+		rc.resolveOpen(r, t)
+	case len(matches) > 1:
+		rc.flag(r, fmt.Sprintf("several orders match: %v", matches))
+	case len(others) > 0:
+		rc.flag(r, fmt.Sprintf("orders partially matching: %v", others))
+	default:
+		r.status = intentFailed
+		r.err = "no order found on the exchanger after restart"
+	}
+}
+
+// resolveOpen cancels the orders of an intent still resting on the book.
+func (rc *intentRecovery) resolveOpen(r *intentRecord, t Trader) {
+	orders, err := rc.openOrders(r.Exchanger, r.Pair, t)
+	if err != nil {
+		if r.Type == strategy.Market {
+			r.status = intentDone
+			return
+		}
+		rc.flag(r, err.Error())
+		return
+	}
+
+	r.status = intentDone
+	for _, id := range r.orderIDs {
+		if findOrder(orders, id) == nil {
+			continue
+		}
+
+		lt, ok := t.(LimitTrader)
+		if !ok {
+			rc.flag(r, fmt.Sprintf("order %s is open and can't be cancelled", id))
+			return
+		}
+
+		if err := lt.CancelOrder(r.Side, r.Pair, id); err != nil {
+			rc.flag(r, fmt.Sprintf("cannot cancel order %s - %s", id, err))
+			return
+		}
+		r.status = intentCancelled
+	}
+}
+
+func (rc *intentRecovery) flag(r *intentRecord, reason string) {
+	r.status = intentFlagged
+	r.err = reason
+}
+
+// openOrders returns the open orders of pair on ex. Open orders are fetched once.
+func (rc *intentRecovery) openOrders(ex string, pair exchanger.Pair, t Trader) ([]*exchanger.OpenOrder, error) {
+	key := ex + "/" + pair.String()
+	if orders, ok := rc.open[key]; ok {
+		return orders, nil
+	}
+
+	l, ok := t.(exchanger.OrderLister)
+	if !ok {
+		return nil, fmt.Errorf("%s can't list open orders", ex)
+	}
+
+	orders, err := l.OpenOrders(pair)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get open orders - %s", err)
+	}
+
+	rc.open[key] = orders
+	return orders, nil
+}
+
+func findOrder(orders []*exchanger.OpenOrder, id string) *exchanger.OpenOrder {
+	for _, o := range orders {
+		if o.ID == id {
+			return o
+		}
+	}
+	return nil
+}
+
+// unbalancedGroups raises an alert for each group with an intent done and another one
+// failed: the position taken by the arbitrage is not hedged.
+func unbalancedGroups(records []*intentRecord) []*reconcile.Alert {
+	done, failed := map[string]*intentRecord{}, map[string]*intentRecord{}
+	seen := map[string]bool{}
+	groups := []string{}
+
+	for _, r := range records {
+		if r.Group == "" {
+			continue
+		}
+
+		if !seen[r.Group] {
+			seen[r.Group] = true
+			groups = append(groups, r.Group)
+		}
+
+		switch r.status {
+		case intentDone:
+			done[r.Group] = r
+		case intentFailed:
+			failed[r.Group] = r
+		}
+	}
+
+	alerts := []*reconcile.Alert{}
+	for _, g := range groups {
+		if done[g] == nil || failed[g] == nil {
+			continue
+		}
+
+		d := done[g]
+		msg := fmt.Sprintf("arbitrage %s interrupted with one leg executed: %s", g, d.Intent)
+		alerts = append(alerts, &reconcile.Alert{Kind: alertUnbalanced, Exchanger: d.Exchanger, Currency: d.Pair.Base, Message: msg})
+	}
+
+	return alerts
+}
+
+// recoverState settles the intents interrupted by the last stop and moves back the
+// funds left in holding accounts. The trade history of the pairs involved is synced
+// first so that the orders placed before the stop can be found.
+func recoverState(db *sql.DB, traders map[string]Trader, historians map[string]exchanger.TradeHistorian,
+	withdrawers map[string]Withdrawer, w *transferWorker) {
+	store := &dbStore{db}
+
+	records, err := store.unsettledIntents()
+	if err != nil {
+		log.Printf("recoverState: call to unsettledIntents() failed - %s\n", err)
+		return
+	}
+
+	if len(records) > 0 {
+		seen := map[exchanger.Pair]bool{}
+		pairs := []exchanger.Pair{}
+		for _, r := range records {
+			if !seen[r.Pair] {
+				seen[r.Pair] = true
+				pairs = append(pairs, r.Pair)
+			}
+		}
+		syncTrades(db, historians, pairs)
+
+		alerts, err := newIntentRecovery(store, traders).run(records)
+		if err != nil {
+			log.Printf("recoverState: %s\n", err)
+		}
+
+		for _, a := range alerts {
+			log.Printf("ALERT recovery: %s\n", a.Message)
+		}
+
+		if err := saveAlerts(db, "recovery", time.Now(), alerts); err != nil {
+			log.Printf("recoverState: saveAlerts() failed - %s\n", err)
+		}
+	}
+
+	resumeAccountTransfers(withdrawers, w)
+}
+
+// resumeAccountTransfers moves back to the trading accounts the funds left in holding
+// accounts (Hitbtc main account) by an interrupted transfer. The currencies with
+// transfers in flight are left to the transfer worker.
+func resumeAccountTransfers(withdrawers map[string]Withdrawer, w *transferWorker) {
+	for ex, wd := range withdrawers {
+		l, ok := wd.(accountLister)
+		if !ok {
+			continue
+		}
+
+		accounts, err := l.AccountBalances()
+		if err != nil {
+			log.Printf("resumeAccountTransfers: cannot get %s balances - %s\n", ex, err)
+			continue
+		}
+
+		for cur, balance := range accounts[mainAccount] {
+			if balance <= 0 {
+				continue
+			}
+
+			busy, err := w.inFlight(cur)
+			if err != nil {
+				log.Printf("resumeAccountTransfers: call to inFlight() failed - %s\n", err)
+				continue
+			} else if busy {
+				continue
+			}
+
+			log.Printf("resumeAccountTransfers: moving %f %s to the %s trading account\n", balance, cur, ex)
+			if err := wd.AfterWithdraw(cur); err != nil {
+				log.Printf("resumeAccountTransfers: %s\n", err)
+			}
+		}
+	}
+}
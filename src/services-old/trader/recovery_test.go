@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/strategy"
+)
+
+// memIntentStore keeps intents in memory.
+type memIntentStore struct {
+	records []*intentRecord
+	trades  []*exchanger.Trade
+	acks    map[string]bool
+}
+
+func (s *memIntentStore) unsettledIntents() ([]*intentRecord, error) {
+	return s.records, nil
+}
+
+func (s *memIntentStore) updateIntent(r *intentRecord) error {
+	return nil
+}
+
+func (s *memIntentStore) tradesSince(ex string, pair exchanger.Pair, t time.Time) ([]*exchanger.Trade, error) {
+	return s.trades, nil
+}
+
+func (s *memIntentStore) orderClaimed(ex string, ids []string) (bool, error) {
+	for _, id := range ids {
+		if s.acks[id] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// testLimitTrader rests orders on a fake book.
+type testLimitTrader struct {
+	open      []*exchanger.OpenOrder
+	cancelled []string
+}
+
+func (t *testLimitTrader) PlaceOrder(side string, pair exchanger.Pair, price, vol float64) ([]string, error) {
+	return nil, nil
+}
+
+func (t *testLimitTrader) PlaceLimitOrder(side string, pair exchanger.Pair, price, vol float64) (string, error) {
+	return "", nil
+}
+
+func (t *testLimitTrader) CancelOrder(side string, pair exchanger.Pair, orderId string) error {
+	t.cancelled = append(t.cancelled, orderId)
+	return nil
+}
+
+func (t *testLimitTrader) OpenOrders(pair exchanger.Pair) ([]*exchanger.OpenOrder, error) {
+	return t.open, nil
+}
+
+func TestIntentRecovery(t *testing.T) {
+	t0 := time.Now().Add(-time.Hour)
+
+	intent := func(id, group, ex, side, typ string, vol float64) *strategy.Intent {
+		return &strategy.Intent{ID: id, Group: group, Time: t0, Exchanger: ex, Pair: exchanger.ZEC_BTC,
+			Side: side, Type: typ, Price: 0.01, Volume: vol}
+	}
+
+	store := &memIntentStore{
+		records: []*intentRecord{
+			// both legs of an arbitrage: the buy was filled, the sell never sent
+			{Intent: intent("1", "arb", "A", strategy.Buy, strategy.Market, 2), status: intentPending},
+			{Intent: intent("2", "arb", "B", strategy.Sell, strategy.Market, 2), status: intentPending},
+			// a quote resting on the book
+			{Intent: intent("3", "", "A", strategy.Sell, strategy.Limit, 1), status: intentPending},
+			// a quote acknowledged before the stop and filled since
+			{Intent: intent("4", "", "A", strategy.Buy, strategy.Limit, 1), orderIDs: []string{"o3"}, status: intentOpen},
+		},
+		trades: []*exchanger.Trade{
+			{ID: "t1", OrderID: "o1", Side: exchanger.Buy, Volume: 1.5, Time: t0},
+			{ID: "t2", OrderID: "o1", Side: exchanger.Buy, Volume: 0.5, Time: t0},
+			// acknowledged to an older intent
+			{ID: "t3", OrderID: "o0", Side: exchanger.Buy, Volume: 2, Time: t0},
+		},
+		acks: map[string]bool{"o0": true},
+	}
+
+	a := &testLimitTrader{open: []*exchanger.OpenOrder{{ID: "o2", Side: exchanger.Sell, Volume: 1, Time: t0}}}
+	b := &testLimitTrader{}
+
+	alerts, err := newIntentRecovery(store, map[string]Trader{"A": a, "B": b}).run(store.records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{intentDone, intentFailed, intentCancelled, intentDone}
+	for i, r := range store.records {
+		if r.status != expected[i] {
+			t.Errorf("intent %s should be %s, got %s (%s)", r.ID, expected[i], r.status, r.err)
+		}
+	}
+
+	if ids := store.records[0].orderIDs; len(ids) != 1 || ids[0] != "o1" {
+		t.Errorf("order o1 should be adopted, got %v", ids)
+	}
+
+	if len(a.cancelled) != 1 || a.cancelled[0] != "o2" {
+		t.Errorf("order o2 should be cancelled, got %v", a.cancelled)
+	}
+
+	if len(alerts) != 1 || alerts[0].Kind != alertUnbalanced {
+		t.Errorf("the arbitrage should be reported unbalanced, got %v", alerts)
+	}
+}
+
+func TestIntentRecoveryFlags(t *testing.T) {
+	t0 := time.Now().Add(-time.Hour)
+
+	store := &memIntentStore{
+		records: []*intentRecord{
+			{Intent: &strategy.Intent{ID: "1", Time: t0, Exchanger: "A", Pair: exchanger.ZEC_BTC,
+				Side: strategy.Buy, Type: strategy.Market, Volume: 2}, status: intentPending},
+		},
+		// partial fill of an IOC order
+		trades: []*exchanger.Trade{{ID: "t1", OrderID: "o1", Side: exchanger.Buy, Volume: 1, Time: t0}},
+	}
+
+	alerts, err := newIntentRecovery(store, map[string]Trader{"A": &testLimitTrader{}}).run(store.records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := store.records[0]; r.status != intentFlagged {
+		t.Errorf("a partial match should be flagged, got %s", r.status)
+	}
+
+	if len(alerts) != 1 || alerts[0].Kind != alertInterrupted {
+		t.Errorf("the flagged intent should raise an alert, got %v", alerts)
+	}
+}
@@ -4,302 +4,124 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"time"
 
 	"bitbot/errorutils"
 	"bitbot/exchanger"
-	"bitbot/exchanger/hitbtc"
-	"bitbot/exchanger/kraken"
-	"bitbot/exchanger/poloniex"
 )
 
-type getTradesFunc func(*Config, *OrderAck) ([]*Trade, error)
-
-type OrderAck struct {
-	arbitrageId string
-	externalId  string
-	exchanger   string
-	pair        exchanger.Pair
-	side        string
-}
-
-type Trade struct {
-	tradeId     string
-	price       float64
-	quantity    float64
-	fee         float64
-	feeCurrency string
-}
-
-var getTradesFuncs = map[string]getTradesFunc{
-	"Kraken":   getKrakenTrades,
-	"Poloniex": getPoloniexTrades,
-	"Hitbtc":   getHitbtcTrades,
-}
-
-func startSyncTrades(conf *Config) {
+// startSyncTrades periodically stores the trade history of the exchangers in the `trade`
+// table. Each exchanger history is read incrementally from the cursor saved in
+// `trade_cursor`.
+func startSyncTrades(db *sql.DB, historians map[string]exchanger.TradeHistorian, pairs []exchanger.Pair) {
 	for {
-		syncTrades(conf)
+		syncTrades(db, historians, pairs)
 		time.Sleep(10 * time.Minute)
 	}
 }
 
-func syncTrades(conf *Config) {
+func syncTrades(db *sql.DB, historians map[string]exchanger.TradeHistorian, pairs []exchanger.Pair) {
 	defer errorutils.LogPanic()
 
-	db, err := OpenMysql()
-	if err != nil {
-		log.Printf("syncTrades: cannot open db %s\n", err)
-		return
-	}
-
-	acks, err := getOrderAcks(db)
-	if err != nil {
-		log.Printf("syncTrades: getOrderAcks() failed - %s\n", err)
-		return
-	}
-
-	for _, ack := range acks {
-		log.Printf("syncTrades: start sync of %s trade for arbId %s\n", ack.exchanger, ack.arbitrageId)
-
-		f, ok := getTradesFuncs[ack.exchanger]
-		if !ok {
-			log.Printf("syncTrades: Missing `getTradesFunc` for %s\n", ack.exchanger)
-			continue
-		}
-
-		trades, err := f(conf, ack)
-		if err != nil {
-			log.Printf("syncTrades: call getTradesFunc() failed for %s - %s\n", ack.exchanger, err)
-			continue
-		}
-
-		err = saveTrades(db, ack, trades)
-		if err != nil {
-			log.Printf("syncTrades: saveTrades failed - %s\n", err)
-			continue
-		}
-
-		// throttle queries (we're using the same API keys than the trader)
-		log.Printf("syncTrades: completed sync of arbId %s\n", ack.arbitrageId)
-		time.Sleep(10 * time.Second)
-	}
-}
-
-func getHitbtcTrades(conf *Config, ack *OrderAck) ([]*Trade, error) {
-	api := hitbtc.NewClient(conf.Hitbtc.Key, conf.Hitbtc.Secret)
-	resp, err := api.TradesByOrder(ack.externalId)
-	if err != nil {
-		return nil, err
-	}
-
-	trades := []*Trade{}
-	for _, item := range resp {
-		idFloat := int64(item["tradeId"].(float64))
-
-		lotSize, ok := hitbtc.LotSizes[ack.pair]
-		if !ok {
-			return nil, fmt.Errorf("getHitbtcTrades: Cannot find lot size for pair %s", ack.pair)
-		}
-
-		price, err := strconv.ParseFloat(item["execPrice"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getHitbtcTrades: parsing `execPrice` failed - %s", err)
-		}
-
-		fee, err := strconv.ParseFloat(item["fee"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getHitbtcTrades: parsing `fee` failed - %s", err)
-		}
-
-		trades = append(trades, &Trade{
-			tradeId:     strconv.FormatInt(idFloat, 10),
-			price:       price,
-			quantity:    item["execQuantity"].(float64) * lotSize,
-			fee:         fee,
-			feeCurrency: ack.pair.Quote,
-		})
-	}
-
-	return trades, nil
-}
-
-func getKrakenTrades(conf *Config, ack *OrderAck) ([]*Trade, error) {
-	api := kraken.NewClient(conf.Kraken.Key, conf.Kraken.Secret)
-
-	resp, err := api.OrdersInfo(ack.externalId, true)
-	if err != nil {
-		return nil, err
-	}
-
-	tradeIds := []string{}
-	ids := resp[ack.externalId].(map[string]interface{})["trades"].([]interface{})
-	for _, id := range ids {
-		tradeIds = append(tradeIds, id.(string))
-	}
-
-	resp, err = api.TradesInfo(strings.Join(tradeIds, ","))
-	if err != nil {
-		return nil, err
-	}
+	for ex, h := range historians {
+		for _, pair := range pairs {
+			cursor, err := tradeCursor(db, ex, pair)
+			if err != nil {
+				log.Printf("syncTrades: tradeCursor() failed for %s - %s\n", ex, err)
+				continue
+			}
 
-	trades := []*Trade{}
-	for _, tradeId := range tradeIds {
-		item := resp[tradeId].(map[string]interface{})
+			trades, next, err := h.Trades(pair, cursor)
+			if err != nil {
+				log.Printf("syncTrades: call to Trades() failed for %s - %s\n", ex, err)
+				continue
+			}
 
-		price, err := strconv.ParseFloat(item["price"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getKrakenTrades: parsing `price` failed - %s", err)
-		}
+			err = saveTrades(db, ex, pair, trades, next)
+			if err != nil {
+				log.Printf("syncTrades: saveTrades failed - %s\n", err)
+				continue
+			}
 
-		vol, err := strconv.ParseFloat(item["vol"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getKrakenTrades: parsing `vol` failed - %s", err)
-		}
+			log.Printf("syncTrades: %d %s trades synced on %s\n", len(trades), pair, ex)
 
-		fee, err := strconv.ParseFloat(item["fee"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getKrakenTrades: parsing `fee` failed - %s", err)
+			// throttle queries (we're using the same API keys than the trader)
+			time.Sleep(10 * time.Second)
 		}
-
-		trades = append(trades, &Trade{
-			tradeId:     tradeId,
-			price:       price,
-			quantity:    vol,
-			fee:         fee,
-			feeCurrency: ack.pair.Quote,
-		})
 	}
-
-	return trades, nil
 }
 
-func getPoloniexTrades(conf *Config, ack *OrderAck) ([]*Trade, error) {
-	api := poloniex.NewClient(conf.Poloniex.Key, conf.Poloniex.Secret)
-
-	resp, err := api.OrderTrades(ack.externalId)
-	if err != nil {
-		return nil, fmt.Errorf("getPoloniexTrades: OrderTrades() failed - %s", err)
-	}
-
-	var feeCurrency string
-	var feeAmount float64
-	trades := []*Trade{}
-
-	for _, item := range resp {
-		id := item["tradeID"].(float64)
-		tradeId := strconv.FormatFloat(id, 'f', 0, 64)
-
-		rate, err := strconv.ParseFloat(item["rate"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getPoloniexTrades: parsing `rate` failed - %s", err)
-		}
-
-		amount, err := strconv.ParseFloat(item["amount"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getPoloniexTrades: parsing `amount` failed - %s", err)
-		}
-
-		feePercent, err := strconv.ParseFloat(item["fee"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getPoloniexTrades: parsing `fee` failed - %s", err)
-		}
-
-		total, err := strconv.ParseFloat(item["total"].(string), 64)
-		if err != nil {
-			return nil, fmt.Errorf("getPoloniexTrades: parsing `fee` failed - %s", err)
-		}
-
-		// Not so sure about the fee computation.
-		// TODO: only take X significant digit
-		if ack.side == "buy" {
-			feeCurrency = ack.pair.Base
-			feeAmount = amount * feePercent
-		} else {
-			feeCurrency = ack.pair.Quote
-			feeAmount = total * feePercent
-		}
+func tradeCursor(db *sql.DB, ex string, pair exchanger.Pair) (string, error) {
+	const query = "select position from trade_cursor where exchanger = ? and pair = ?"
 
-		trades = append(trades, &Trade{
-			tradeId:     tradeId,
-			price:       rate,
-			quantity:    amount,
-			fee:         feeAmount,
-			feeCurrency: feeCurrency,
-		})
+	var cursor string
+	err := db.QueryRow(query, ex, pair.String()).Scan(&cursor)
+	if err == sql.ErrNoRows {
+		return "", nil
 	}
-
-	return trades, nil
+	return cursor, err
 }
 
-func getOrderAcks(db *sql.DB) ([]*OrderAck, error) {
-	const sql = `
-		select
-			arbitrage_id,
-			external_id,
-			exchanger,
-			pair,
-			side
-		from
-			order_ack
-		where
-			arbitrage_id not in (select arbitrage_id from trade)
+// saveTrades upserts the trades, attributes them to the orders of the bot and moves the
+// cursor forward in a single transaction. Trades that match no order ack (placed outside
+// of the bot or acked later) keep a null arbitrage_id until an ack matches.
+func saveTrades(db *sql.DB, ex string, pair exchanger.Pair, trades []*exchanger.Trade, cursor string) error {
+	const insertTrade = `
+		insert into trade
+			(exchanger, trade_id, order_id, price, quantity, pair, side, fee, fee_currency, ts)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on duplicate key update
+			order_id = values(order_id),
+			price = values(price),
+			quantity = values(quantity),
+			fee = values(fee),
+			fee_currency = values(fee_currency)
 	`
 
-	rows, err := db.Query(sql)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var arbId, externalId, ex, pair, side string
-	acks := []*OrderAck{}
-
-	for rows.Next() {
-		err = rows.Scan(&arbId, &externalId, &ex, &pair, &side)
-		if err != nil {
-			return nil, err
-		}
-
-		acks = append(acks, &OrderAck{arbId, externalId, ex, exchanger.NewPair(pair), side})
-	}
-
-	err = rows.Err()
-	if err != nil {
-		return nil, err
-	}
-
-	return acks, nil
-}
+	// external ids are order ids, or trade ids for some market orders (see order_ack)
+	const attribute = `
+		update trade t
+		join order_ack a on
+			a.exchanger = t.exchanger
+			and a.pair = t.pair
+			and (a.external_id = t.order_id or a.external_id = t.trade_id)
+		set t.arbitrage_id = a.arbitrage_id
+		where t.exchanger = ? and t.arbitrage_id is null
+	`
 
-func saveTrades(db *sql.DB, ack *OrderAck, trades []*Trade) error {
-	const sql = `
-		insert into trade
-			(arbitrage_id, trade_id, price, quantity, pair, side, fee, fee_currency)
+	const saveCursor = `
+		insert into trade_cursor
+			(exchanger, pair, position, updated_at)
 		values
-			(?, ?, ?, ?, ?, ?, ?, ?)
+			(?, ?, ?, ?)
+		on duplicate key update
+			position = values(position),
+			updated_at = values(updated_at)
 	`
 
 	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("saveTrades: db.Begin() failed - %s\n", err)
+		return fmt.Errorf("saveTrades: db.Begin() failed - %s", err)
 	}
 
 	for _, t := range trades {
-		params := []interface{}{ack.arbitrageId, t.tradeId, t.price, t.quantity, ack.pair.String(), ack.side, t.fee, t.feeCurrency}
-		_, err := tx.Exec(sql, params...)
-
-		if err != nil {
+		params := []interface{}{ex, t.ID, t.OrderID, t.Price, t.Volume, pair.String(), t.Side, t.Fee, t.FeeCurrency, t.Time}
+		if _, err := tx.Exec(insertTrade, params...); err != nil {
 			_ = tx.Rollback()
-			return fmt.Errorf("saveTrades: tx.Exec() failed - %s - %s\n", arbId, err)
+			return fmt.Errorf("saveTrades: tx.Exec() failed - %s %s - %s", ex, t.ID, err)
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		log.Printf("syncTrades: tx.Commit() failed - %s\n", err)
+	if _, err := tx.Exec(attribute, ex); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("saveTrades: cannot attribute %s trades - %s", ex, err)
+	}
+
+	if _, err := tx.Exec(saveCursor, ex, pair.String(), cursor, time.Now()); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("saveTrades: cannot save %s cursor - %s", ex, err)
 	}
 
-	return nil
+	return tx.Commit()
 }
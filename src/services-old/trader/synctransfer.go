@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"bitbot/errorutils"
+	"bitbot/exchanger"
+)
+
+// startSyncTransfers periodically stores the deposit and withdrawal history of the
+// exchangers in the `transfer_history` table.
+func startSyncTransfers(db *sql.DB, historians map[string]exchanger.TransferHistorian, currencies []string) {
+	for {
+		syncTransfers(db, historians, currencies)
+		time.Sleep(30 * time.Minute)
+	}
+}
+
+func syncTransfers(db *sql.DB, historians map[string]exchanger.TransferHistorian, currencies []string) {
+	defer errorutils.LogPanic()
+
+	for ex, h := range historians {
+		for _, cur := range currencies {
+			deposits, err := h.Deposits(cur)
+			if err != nil {
+				log.Printf("syncTransfers: call to Deposits() failed for %s - %s\n", ex, err)
+				continue
+			}
+
+			withdrawals, err := h.Withdrawals(cur)
+			if err != nil {
+				log.Printf("syncTransfers: call to Withdrawals() failed for %s - %s\n", ex, err)
+				continue
+			}
+
+			err = saveTransferHistory(db, ex, append(deposits, withdrawals...))
+			if err != nil {
+				log.Printf("syncTransfers: saveTransferHistory failed - %s\n", err)
+				continue
+			}
+
+			// throttle queries (we're using the same API keys than the trader)
+			time.Sleep(10 * time.Second)
+		}
+
+		log.Printf("syncTransfers: completed sync of %s\n", ex)
+	}
+}
+
+// saveTransferHistory upserts the transfers: statuses, fees and tx hashes of pending
+// transfers are updated until they complete.
+func saveTransferHistory(db *sql.DB, ex string, transfers []*exchanger.Transfer) error {
+	const sql = `
+		insert into transfer_history
+			(exchanger, kind, transfer_id, currency, amount, fee, address, tx_id, status, raw_status, ts)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on duplicate key update
+			fee = values(fee),
+			tx_id = values(tx_id),
+			status = values(status),
+			raw_status = values(raw_status)
+	`
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("saveTransferHistory: db.Begin() failed - %s", err)
+	}
+
+	for _, t := range transfers {
+		if t.ID == "" {
+			log.Printf("saveTransferHistory: skipping %s %s without id on %s\n", t.Kind, t.Currency, ex)
+			continue
+		}
+
+		params := []interface{}{ex, t.Kind, t.ID, t.Currency, t.Amount, t.Fee, t.Address, t.TxID, t.Status, t.RawStatus, t.Time}
+		if _, err := tx.Exec(sql, params...); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("saveTransferHistory: tx.Exec() failed - %s %s - %s", ex, t.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
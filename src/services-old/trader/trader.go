@@ -15,6 +15,14 @@ type Trader interface {
 	PlaceOrder(side string, pair exchanger.Pair, price, vol float64) ([]string, error)
 }
 
+// A LimitTrader is a Trader that can rest limit orders on the book and cancel them.
+// Market making requires it.
+type LimitTrader interface {
+	Trader
+	PlaceLimitOrder(side string, pair exchanger.Pair, price, vol float64) (string, error)
+	CancelOrder(side string, pair exchanger.Pair, orderId string) error
+}
+
 // Hitbtc trader
 type HitbtcTrader struct {
 	*hitbtc.Client
@@ -41,6 +49,29 @@ func (t *HitbtcTrader) PlaceOrder(side string, pair exchanger.Pair, price, vol f
 	return []string{clientOrderId.(string)}, nil
 }
 
+func (t *HitbtcTrader) PlaceLimitOrder(side string, pair exchanger.Pair, price, vol float64) (string, error) {
+	resp, err := t.Client.PlaceOrder(side, pair, price, vol, "limit")
+	if err != nil {
+		return "", err
+	}
+
+	if status, _ := resp["orderStatus"].(string); status == "rejected" {
+		return "", fmt.Errorf("Hitbtc: PlaceLimitOrder rejected - %s", resp["orderRejectReason"])
+	}
+
+	clientOrderId, ok := resp["clientOrderId"].(string)
+	if !ok {
+		return "", fmt.Errorf("Hitbtc: PlaceLimitOrder failed - no client order id")
+	}
+
+	return clientOrderId, nil
+}
+
+func (t *HitbtcTrader) CancelOrder(side string, pair exchanger.Pair, orderId string) error {
+	_, err := t.Client.CancelOrder(orderId, pair, side)
+	return err
+}
+
 // Poloniex trader
 type PoloniexTrader struct {
 	*poloniex.Client
@@ -63,6 +94,18 @@ func (t *PoloniexTrader) PlaceOrder(side string, pair exchanger.Pair, price, vol
 	return []string{orderNumber}, nil
 }
 
+func (t *PoloniexTrader) PlaceLimitOrder(side string, pair exchanger.Pair, price, vol float64) (string, error) {
+	ids, err := t.PlaceOrder(side, pair, price, vol)
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+func (t *PoloniexTrader) CancelOrder(side string, pair exchanger.Pair, orderId string) error {
+	return t.Client.CancelOrder(orderId)
+}
+
 // Kraken Trader
 type KrakenTrader struct {
 	*kraken.Client
@@ -90,6 +133,25 @@ func (t *KrakenTrader) PlaceOrder(side string, pair exchanger.Pair, price, vol f
 	return ids, nil
 }
 
+func (t *KrakenTrader) PlaceLimitOrder(side string, pair exchanger.Pair, price, vol float64) (string, error) {
+	resp, err := t.Client.AddOrder(side, pair, price, vol, "limit")
+	if err != nil {
+		return "", err
+	}
+
+	txids, ok := resp["txid"].([]interface{})
+	if !ok || len(txids) == 0 {
+		return "", fmt.Errorf("Kraken: PlaceLimitOrder failed - no txid")
+	}
+
+	return txids[0].(string), nil
+}
+
+func (t *KrakenTrader) CancelOrder(side string, pair exchanger.Pair, orderId string) error {
+	_, err := t.Client.CancelOrder(orderId)
+	return err
+}
+
 // The Rock Trading Trader
 type TheRockTrader struct {
 	*therocktrading.Client
@@ -115,3 +177,15 @@ func (t *TheRockTrader) PlaceOrder(side string, pair exchanger.Pair, price, vol
 
 	return ids, nil
 }
+
+func (t *TheRockTrader) PlaceLimitOrder(side string, pair exchanger.Pair, price, vol float64) (string, error) {
+	order, err := t.Client.PlaceOrder(side, pair, price, vol)
+	if err != nil {
+		return "", fmt.Errorf("The Rock Trading: PlaceLimitOrder failed - %s", err)
+	}
+	return fmt.Sprint(order.Id), nil
+}
+
+func (t *TheRockTrader) CancelOrder(side string, pair exchanger.Pair, orderId string) error {
+	return t.Client.CancelOrder(pair, orderId)
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"bitbot/address"
+	"bitbot/errorutils"
+	"bitbot/exchanger"
+	"bitbot/httpreq"
+)
+
+// Transfer statuses. A transfer moves forward from requested to completed, failed is
+// terminal. Transfers needing a manual approval wait in awaiting_approval until they are
+// approved or rejected. withdrawing is set right before the withdrawal is sent: a
+// transfer found in this state was interrupted, or its withdrawal failed without the
+// exchanger refusing it, and is reconciled against the withdrawal history.
+const (
+	transferRequested        = "requested"
+	transferAwaitingApproval = "awaiting_approval"
+	transferApproved         = "approved"
+	transferWithdrawing      = "withdrawing"
+	transferAcknowledged     = "withdrawal_acknowledged"
+	transferOnChain          = "on_chain"
+	transferCredited         = "credited"
+	transferCompleted        = "completed"
+	transferFailed           = "failed"
+)
+
+const (
+	// withdrawalTimeout is the time after which an interrupted withdrawal missing from the
+	// history is considered never sent.
+	withdrawalTimeout = 1 * time.Hour
+	// depositTolerance is the share of the amount that can be lost in fees when no fee
+	// is reported by the withdrawal history.
+	depositTolerance = 0.01
+	// clockSkew is subtracted from the creation time when matching history entries.
+	clockSkew = 5 * time.Minute
+)
+
+// transfer is a withdrawal from one exchanger to another as stored in the `transfers`
+// table.
+type transfer struct {
+	id           string
+	currency     string
+	from         string
+	to           string
+	address      string
+	amount       float64
+	fee          float64
+	status       string
+	withdrawalId string
+	txId         string
+	depositId    string
+	err          string
+	created      time.Time
+	updated      time.Time
+}
+
+func (t *transfer) String() string {
+	return fmt.Sprintf("transfer %s: %f %s from %s to %s (%s)", t.id, t.amount, t.currency, t.from, t.to, t.status)
+}
+
+// transferStore persists the transfers.
+type transferStore interface {
+	insertTransfer(t *transfer) error
+	updateTransfer(t *transfer) error
+	// pendingTransfers returns the transfers that are neither completed nor failed.
+	pendingTransfers() ([]*transfer, error)
+	// depositClaimed reports whether a deposit was already matched with a transfer.
+	depositClaimed(ex, depositId string) (bool, error)
+	// withdrawalClaimed reports whether a withdrawal was already matched with a transfer.
+	withdrawalClaimed(ex, withdrawalId string) (bool, error)
+	// withdrawnSince returns the amount of cur sent since the given time.
+	withdrawnSince(cur string, since time.Time) (float64, error)
+	// audit appends an entry to the withdrawal audit trail.
+	audit(a *auditEntry) error
+}
+
+// transferWorker sends the requested transfers and follows them until the funds can be
+// traded on the destination. Its state lives in the store so that transfers survive
+// restarts. Funds are only sent to the destinations of the address book and each
+// withdrawal goes through the withdrawal policy.
+type transferWorker struct {
+	store       transferStore
+	withdrawers map[string]Withdrawer
+	book        *address.Book
+	policy      *withdrawalPolicy
+}
+
+func newTransferWorker(store transferStore, withdrawers map[string]Withdrawer, book *address.Book, policy *withdrawalPolicy) *transferWorker {
+	return &transferWorker{store, withdrawers, book, policy}
+}
+
+// request registers a transfer. It is sent on the next run.
+func (w *transferWorker) request(from, to, cur string, amount float64) (*transfer, error) {
+	now := time.Now()
+	t := &transfer{
+		id:       fmt.Sprintf("%s-%s-%s-%d", cur, exchangerKey(from), exchangerKey(to), now.UnixNano()),
+		currency: cur,
+		from:     from,
+		to:       to,
+		amount:   amount,
+		status:   transferRequested,
+		created:  now,
+		updated:  now,
+	}
+
+	if err := w.store.insertTransfer(t); err != nil {
+		return nil, fmt.Errorf("request: call to insertTransfer() failed - %s", err)
+	}
+
+	log.Printf("Transfer requested: %s\n", t)
+	return t, nil
+}
+
+// inFlight reports whether some transfers of cur are not completed yet.
+func (w *transferWorker) inFlight(cur string) (bool, error) {
+	transfers, err := w.store.pendingTransfers()
+	if err != nil {
+		return false, err
+	}
+
+	for _, t := range transfers {
+		if t.currency == cur {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// run processes the pending transfers every period.
+func (w *transferWorker) run(period time.Duration) {
+	for {
+		w.processAll()
+		time.Sleep(period)
+	}
+}
+
+func (w *transferWorker) processAll() {
+	defer errorutils.LogPanic()
+
+	transfers, err := w.store.pendingTransfers()
+	if err != nil {
+		log.Printf("transferWorker: call to pendingTransfers() failed - %s\n", err)
+		return
+	}
+
+	for _, t := range transfers {
+		w.process(t)
+	}
+}
+
+// process moves t forward as far as possible.
+func (w *transferWorker) process(t *transfer) {
+	for {
+		before := t.status
+
+		if err := w.step(t); err != nil {
+			log.Printf("transferWorker: %s - %s\n", t, err)
+			return
+		}
+
+		if t.status == before {
+			return
+		}
+
+		log.Printf("transferWorker: %s -> %s\n", t.id, t.status)
+		if t.status == transferCompleted || t.status == transferFailed {
+			return
+		}
+	}
+}
+
+func (w *transferWorker) step(t *transfer) error {
+	from, ok := w.withdrawers[t.from]
+	if !ok {
+		return w.fail(t, fmt.Sprintf("missing withdrawer for %s", t.from))
+	}
+
+	to, ok := w.withdrawers[t.to]
+	if !ok {
+		return w.fail(t, fmt.Sprintf("missing withdrawer for %s", t.to))
+	}
+
+	switch t.status {
+	case transferRequested, transferApproved:
+		return w.withdraw(t, from, to)
+	case transferWithdrawing, transferAcknowledged:
+		return w.checkWithdrawal(t, from)
+	case transferOnChain:
+		return w.checkDeposit(t, to)
+	case transferCredited:
+		// funds may have to be moved to the trading account (Hitbtc)
+		if err := to.AfterWithdraw(t.currency); err != nil {
+			return err
+		}
+		return w.update(t, transferCompleted)
+	}
+
+	return nil
+}
+
+func (w *transferWorker) withdraw(t *transfer, from, to Withdrawer) error {
+	dest, err := withdrawalDestination(w.book, from, to, t.currency)
+	if err != nil {
+		return w.fail(t, err.Error())
+	}
+
+	t.address = dest.Address
+
+	d, err := w.authorize(t, from)
+	if err != nil {
+		return err
+	}
+
+	switch d.verdict {
+	case decisionRejected:
+		return w.fail(t, d.reason)
+	case decisionApprovalRequired:
+		log.Printf("transferWorker: %s needs approval - %s\n", t, d.reason)
+		return w.update(t, transferAwaitingApproval)
+	}
+
+	if err := w.update(t, transferWithdrawing); err != nil {
+		return err
+	}
+
+	// Kraken requires to input the withdrawal addresses in the UI and to give them a
+	// unique name: withdrawals refer to this name.
+	target := dest.Address
+	if from.Exchanger() == "Kraken" {
+		target = dest.KrakenKey
+	}
+
+	log.Printf("Starting transfert of %f %s from %s to %s\n", t.amount, t.currency, t.from, t.to)
+	ack, err := from.Withdraw(t.amount, t.currency, target)
+	if err != nil && withdrawalRejected(err) {
+		return w.fail(t, fmt.Sprintf("cannot withdraw - %s", err))
+	} else if err != nil {
+		// the exchanger may have accepted the withdrawal before the error: the transfer
+		// stays in withdrawing until it is found in the history (see checkWithdrawal).
+		return fmt.Errorf("withdrawal outcome unknown - %s", err)
+	}
+
+	log.Printf("Transfer registered: %s\n", ack)
+	t.withdrawalId = ack
+	return w.update(t, transferAcknowledged)
+}
+
+func (w *transferWorker) checkWithdrawal(t *transfer, from Withdrawer) error {
+	history, err := from.Withdrawals(t.currency)
+	if err != nil {
+		return err
+	}
+
+	// the withdrawals of the other transfers can't match by amount and address
+	candidates := []*exchanger.Transfer{}
+	for _, wd := range history {
+		if wd.ID != "" && wd.ID != t.withdrawalId {
+			claimed, err := w.store.withdrawalClaimed(t.from, wd.ID)
+			if err != nil {
+				return err
+			}
+			if claimed {
+				continue
+			}
+		}
+		candidates = append(candidates, wd)
+	}
+
+	wd := matchWithdrawal(t, candidates)
+	if wd == nil {
+		if t.status == transferWithdrawing && time.Since(t.updated) > withdrawalTimeout {
+			return w.fail(t, "interrupted withdrawal not found in history")
+		}
+		return nil
+	}
+
+	t.withdrawalId = wd.ID
+	t.fee = wd.Fee
+
+	switch {
+	case wd.Status == exchanger.TransferFailed:
+		return w.fail(t, "withdrawal failed")
+	case wd.TxID != "":
+		t.txId = wd.TxID
+		return w.update(t, transferOnChain)
+	case t.status == transferWithdrawing:
+		return w.update(t, transferAcknowledged)
+	}
+
+	return nil
+}
+
+func (w *transferWorker) checkDeposit(t *transfer, to Withdrawer) error {
+	history, err := to.Deposits(t.currency)
+	if err != nil {
+		return err
+	}
+
+	candidates := []*exchanger.Transfer{}
+	for _, d := range history {
+		if d.ID != "" {
+			claimed, err := w.store.depositClaimed(t.to, d.ID)
+			if err != nil {
+				return err
+			}
+			if claimed {
+				continue
+			}
+		}
+		candidates = append(candidates, d)
+	}
+
+	d := matchDeposit(t, candidates)
+	if d == nil || d.Status != exchanger.TransferCompleted {
+		return nil
+	}
+
+	t.depositId = d.ID
+	if t.depositId == "" {
+		t.depositId = d.TxID
+	}
+	return w.update(t, transferCredited)
+}
+
+func (w *transferWorker) update(t *transfer, status string) error {
+	t.status = status
+	t.updated = time.Now()
+	return w.store.updateTransfer(t)
+}
+
+func (w *transferWorker) fail(t *transfer, reason string) error {
+	t.err = reason
+	if err := w.update(t, transferFailed); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s", reason)
+}
+
+// rejectedError is returned by a Withdrawer when no withdrawal was sent to the exchanger.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return e.err.Error()
+}
+
+// withdrawalRejected reports whether err says that the exchanger refused the withdrawal.
+// Other errors, such as timeouts or server errors, are ambiguous: the withdrawal may
+// have been accepted.
+func withdrawalRejected(err error) bool {
+	switch e := err.(type) {
+	case *rejectedError:
+		return true
+	case *httpreq.StatusError:
+		return e.Code >= 400 && e.Code < 500
+	}
+	return false
+}
+
+// matchWithdrawal returns the history entry of t: the one with the withdrawal id when
+// known, otherwise the first one sent to the same address with the same amount.
+func matchWithdrawal(t *transfer, history []*exchanger.Transfer) *exchanger.Transfer {
+	for _, wd := range history {
+		if t.withdrawalId != "" && wd.ID == t.withdrawalId {
+			return wd
+		}
+	}
+
+	for _, wd := range history {
+		if wd.Time.Before(t.created.Add(-clockSkew)) || math.Abs(wd.Amount-t.amount) > 1e-8 {
+			continue
+		}
+		if wd.Address != "" && t.address != "" && wd.Address != t.address {
+			continue
+		}
+		return wd
+	}
+
+	return nil
+}
+
+// matchDeposit returns the deposit of t: the one with the transaction hash when known,
+// otherwise the first one received after the transfer with the amount net of fees.
+func matchDeposit(t *transfer, history []*exchanger.Transfer) *exchanger.Transfer {
+	if t.txId != "" {
+		for _, d := range history {
+			if strings.EqualFold(d.TxID, t.txId) {
+				return d
+			}
+		}
+	}
+
+	max := t.amount - t.fee
+	min := max - t.amount*depositTolerance
+	if t.fee > 0 {
+		min = max - 1e-8
+	}
+
+	for _, d := range history {
+		if d.TxID != "" && t.txId != "" {
+			continue
+		}
+		if d.Time.Before(t.created.Add(-clockSkew)) || d.Amount < min || d.Amount > max+1e-8 {
+			continue
+		}
+		return d
+	}
+
+	return nil
+}
+
+// withdrawalDestination returns the approved destination of the funds sent from org to
+// dest. The deposit address reported by dest, when available, must still be the approved
+// one.
+func withdrawalDestination(book *address.Book, org, dest Withdrawer, cur string) (*address.Entry, error) {
+	if book == nil {
+		return nil, fmt.Errorf("no address book")
+	}
+
+	e, err := book.Destination(dest.Exchanger(), cur)
+	if err != nil {
+		return nil, err
+	}
+
+	if org.Exchanger() == "Kraken" && e.KrakenKey == "" {
+		return nil, fmt.Errorf("no Kraken key for the %s address of %s", cur, dest.Exchanger())
+	}
+
+	reported, err := dest.PaymentAddress(cur)
+	if err != nil {
+		log.Printf("withdrawalDestination: cannot check %s address of %s - %s\n", cur, dest.Exchanger(), err)
+	} else if err := book.Check(dest.Exchanger(), cur, reported); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func exchangerKey(ex string) string {
+	return strings.Replace(ex, " ", "-", -1)
+}
+
+// dbTransferStore stores the transfers in the `transfers` table.
+type dbTransferStore struct {
+	db *sql.DB
+}
+
+func (s *dbTransferStore) insertTransfer(t *transfer) error {
+	const stmt = `
+		insert into transfers
+			(transfer_id, currency, from_ex, to_ex, address, amount, fee, status,
+			 withdrawal_id, tx_id, deposit_id, error, created_at, updated_at)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.db.Exec(stmt, t.id, t.currency, t.from, t.to, t.address, t.amount, t.fee, t.status,
+		nullString(t.withdrawalId), nullString(t.txId), nullString(t.depositId), t.err, t.created, t.updated)
+	return err
+}
+
+func (s *dbTransferStore) updateTransfer(t *transfer) error {
+	const stmt = `
+		update transfers
+		set address = ?, fee = ?, status = ?, withdrawal_id = ?, tx_id = ?, deposit_id = ?,
+			error = ?, updated_at = ?
+		where transfer_id = ?
+	`
+	_, err := s.db.Exec(stmt, t.address, t.fee, t.status, nullString(t.withdrawalId), nullString(t.txId),
+		nullString(t.depositId), t.err, t.updated, t.id)
+	return err
+}
+
+func (s *dbTransferStore) pendingTransfers() ([]*transfer, error) {
+	const query = `
+		select
+			transfer_id, currency, from_ex, to_ex, address, amount, fee, status,
+			coalesce(withdrawal_id, ''), coalesce(tx_id, ''), coalesce(deposit_id, ''),
+			error, created_at, updated_at
+		from transfers
+		where status not in (?, ?)
+		order by created_at
+	`
+	rows, err := s.db.Query(query, transferCompleted, transferFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []*transfer{}
+	for rows.Next() {
+		t := &transfer{}
+		err := rows.Scan(&t.id, &t.currency, &t.from, &t.to, &t.address, &t.amount, &t.fee, &t.status,
+			&t.withdrawalId, &t.txId, &t.depositId, &t.err, &t.created, &t.updated)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+
+	return transfers, rows.Err()
+}
+
+func (s *dbTransferStore) depositClaimed(ex, depositId string) (bool, error) {
+	var n int
+	const query = "select count(*) from transfers where to_ex = ? and deposit_id = ?"
+	err := s.db.QueryRow(query, ex, depositId).Scan(&n)
+	return n > 0, err
+}
+
+func (s *dbTransferStore) withdrawalClaimed(ex, withdrawalId string) (bool, error) {
+	var n int
+	const query = "select count(*) from transfers where from_ex = ? and withdrawal_id = ?"
+	err := s.db.QueryRow(query, ex, withdrawalId).Scan(&n)
+	return n > 0, err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	"bitbot/exchanger"
 	"bitbot/exchanger/hitbtc"
 	"bitbot/exchanger/kraken"
 	"bitbot/exchanger/poloniex"
@@ -12,6 +13,7 @@ import (
 )
 
 type Withdrawer interface {
+	exchanger.TransferHistorian
 	Exchanger() string
 	TradingBalances() (map[string]float64, error)
 	Withdraw(vol float64, cur, address string) (string, error)
@@ -40,16 +42,32 @@ func (w *HitbtcWithdrawer) TradingBalances() (map[string]float64, error) {
 	return w.Client.TradingBalances()
 }
 
+// AccountBalances implements accountLister: funds are withdrawn and deposited through
+// the main account.
+func (w *HitbtcWithdrawer) AccountBalances() (map[string]map[string]float64, error) {
+	main, err := w.Client.MainBalances()
+	if err != nil {
+		return nil, fmt.Errorf("Hitbtc: MainBalances() failed - %s", err)
+	}
+
+	trading, err := w.Client.TradingBalances()
+	if err != nil {
+		return nil, fmt.Errorf("Hitbtc: TradingBalances() failed - %s", err)
+	}
+
+	return map[string]map[string]float64{mainAccount: main, tradingAccount: trading}, nil
+}
+
 func (w *HitbtcWithdrawer) Withdraw(vol float64, cur, address string) (string, error) {
 	result, err := w.Client.TransfertToMainAccount(vol, cur)
 	if err != nil {
-		return "", fmt.Errorf("Hitbtc: cannot transfert from `%s` trading account to main account: %s", cur, err)
+		// the funds didn't leave the exchanger
+		return "", &rejectedError{fmt.Errorf("Hitbtc: cannot transfert from `%s` trading account to main account: %s", cur, err)}
 	} else {
 		log.Printf("Hitbtc: transfert from trading to main account successed: %s\n", result)
 	}
 
-	_, err = w.Client.Withdraw(vol, cur, address)
-	return "ok", err
+	return w.Client.Withdraw(vol, cur, address)
 }
 
 func (w *HitbtcWithdrawer) AfterWithdraw(cur string) error {
@@ -138,6 +156,9 @@ func (w *KrakenWithdrawer) TradingBalances() (map[string]float64, error) {
 // - sending: sending transaction
 // - success:
 //
+// The status is tracked through WithdrawStatus (see kraken.Client) using the returned
+// reference.
+//
 // Fees:
 // - BTC: ฿0.00050
 // - ZEC: ⓩ0.00010
@@ -152,7 +173,9 @@ func (w *KrakenWithdrawer) Withdraw(vol float64, cur, account string) (string, e
 
 	resp := map[string]string{}
 	err := w.Client.Query("Withdraw", data, &resp)
-	if err != nil {
+	if e, ok := err.(*kraken.APIError); ok && e.Rejected() {
+		return "", &rejectedError{fmt.Errorf("Kraken: %s withdraw failed - %s", cur, err)}
+	} else if err != nil {
 		return "", fmt.Errorf("Kraken: %s withdraw failed - %s", cur, err)
 	}
 
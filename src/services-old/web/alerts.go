@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"bitbot/errorutils"
+)
+
+func alerts(db *sqlx.DB, limit int) interface{} {
+	const stmt = `
+        select
+            ts,
+            source,
+            kind,
+            exchanger,
+            currency,
+            message
+        from
+            alerts
+        order by
+            ts desc
+        limit
+            %d
+    `
+	var rows []*struct {
+		Date      string `db:"ts"`
+		Source    string `db:"source"`
+		Kind      string `db:"kind"`
+		Exchanger string `db:"exchanger"`
+		Currency  string `db:"currency"`
+		Message   string `db:"message"`
+	}
+
+	err := db.Select(&rows, fmt.Sprintf(stmt, limit))
+	errorutils.PanicOnError(err)
+	return rows
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"bitbot/episode"
+	"bitbot/errorutils"
+)
+
+type venueDurations struct {
+	BuyEx  string
+	SellEx string
+	*episode.Distribution
+}
+
+// EpisodeDurationsHandler returns the distribution of the episode durations per venue
+// pair, in seconds. Parameters: pair (required), from and to (YYYY-MM-DD).
+func EpisodeDurationsHandler(w http.ResponseWriter, r *http.Request) {
+	pair := r.FormValue("pair")
+	if !pairs[pair] {
+		http.Error(w, fmt.Sprintf("unsupported pair `%s`", pair), http.StatusBadRequest)
+		return
+	}
+
+	from, to := time.Time{}, time.Now()
+	var err error
+
+	if s := r.FormValue("from"); s != "" {
+		if from, err = time.Parse(dateFormat, s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if s := r.FormValue("to"); s != "" {
+		if to, err = time.Parse(dateFormat, s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	JSONResponse(w, episodeDurations(dbx, pair, from, to))
+}
+
+func episodeDurations(db *sqlx.DB, pair string, from, to time.Time) interface{} {
+	const stmt = `
+        select
+            buy_ex,
+            sell_ex,
+            start_ts,
+            end_ts
+        from
+            episodes
+        where
+            pair = ? and start_ts >= ? and start_ts < ?
+        order by
+            buy_ex, sell_ex
+    `
+
+	var rows []*struct {
+		BuyEx  string `db:"buy_ex"`
+		SellEx string `db:"sell_ex"`
+		Start  string `db:"start_ts"`
+		End    string `db:"end_ts"`
+	}
+
+	err := db.Select(&rows, stmt, pair, from, to)
+	errorutils.PanicOnError(err)
+
+	out := []*venueDurations{}
+	durations := []time.Duration{}
+
+	for i, row := range rows {
+		start, err := time.Parse(timeFormat, row.Start)
+		errorutils.PanicOnError(err)
+
+		end, err := time.Parse(timeFormat, row.End)
+		errorutils.PanicOnError(err)
+
+		durations = append(durations, end.Sub(start))
+
+		if i == len(rows)-1 || rows[i+1].BuyEx != row.BuyEx || rows[i+1].SellEx != row.SellEx {
+			out = append(out, &venueDurations{row.BuyEx, row.SellEx, episode.Distribute(durations)})
+			durations = []time.Duration{}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"bitbot/errorutils"
+)
+
+// bookLatencies returns the order book fetch latencies recorded since `since`, per
+// exchanger (see bitbot/latency).
+func bookLatencies(db *sqlx.DB, since time.Time) interface{} {
+	const stmt = `
+        select
+            ts,
+            exchanger,
+            samples,
+            errors,
+            p50,
+            p90,
+            p99,
+            max
+        from
+            book_latency
+        where
+            ts >= ?
+        order by
+            exchanger, ts
+    `
+	var rows []*struct {
+		Date      string  `db:"ts"`
+		Exchanger string  `db:"exchanger"`
+		Samples   int     `db:"samples"`
+		Errors    int     `db:"errors"`
+		P50       float64 `db:"p50"`
+		P90       float64 `db:"p90"`
+		P99       float64 `db:"p99"`
+		Max       float64 `db:"max"`
+	}
+
+	err := db.Select(&rows, stmt, since)
+	errorutils.PanicOnError(err)
+	return rows
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"bitbot/errorutils"
+)
+
+// leases returns the holders of the leases of the trading processes (see
+// bitbot/database.Lease). An expired lease is free.
+func leases(db *sqlx.DB) interface{} {
+	const stmt = `
+        select
+            name,
+            holder,
+            token,
+            acquired_at,
+            renewed_at,
+            expires_at,
+            expires_at < now(3) as expired
+        from
+            leases
+        order by
+            name
+    `
+	var rows []*struct {
+		Name     string `db:"name"`
+		Holder   string `db:"holder"`
+		Token    int64  `db:"token"`
+		Acquired string `db:"acquired_at"`
+		Renewed  string `db:"renewed_at"`
+		Expires  string `db:"expires_at"`
+		Expired  bool   `db:"expired"`
+	}
+
+	err := db.Select(&rows, stmt)
+	errorutils.PanicOnError(err)
+	return rows
+}
@@ -52,6 +52,10 @@ func main() {
 	dbx = database.Openx(*dbName, *dbHost, *dbPort, *dbUser, *dbPwd)
 	defer dbx.Close()
 
+	if err := database.CheckSchema(dbx.DB); err != nil {
+		log.Panic(err)
+	}
+
 	m := http.NewServeMux()
 
 	for pair, _ := range pairs {
@@ -67,6 +71,26 @@ func main() {
 		JSONResponse(w, trades(dbx, 100))
 	})
 
+	m.HandleFunc("/alerts", func(w http.ResponseWriter, r *http.Request) {
+		JSONResponse(w, alerts(dbx, 100))
+	})
+
+	m.HandleFunc("/episodes/durations", EpisodeDurationsHandler)
+
+	m.HandleFunc("/latency", func(w http.ResponseWriter, r *http.Request) {
+		JSONResponse(w, bookLatencies(dbx, time.Now().Add(-24*time.Hour)))
+	})
+
+	m.HandleFunc("/leases", func(w http.ResponseWriter, r *http.Request) {
+		JSONResponse(w, leases(dbx))
+	})
+
+	m.HandleFunc("/pnl", PnLHandler)
+	m.HandleFunc("/pnl/ledger.csv", PnLLedgerHandler)
+
+	m.HandleFunc("/portfolio", PortfolioHandler)
+	m.HandleFunc("/portfolio/latest", LatestPortfolioHandler)
+
 	m.Handle("/public/", http.StripPrefix("/public", http.FileServer(http.Dir(staticDir))))
 	m.HandleFunc("/", HomeHandler)
 
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"bitbot/pnl"
+)
+
+const (
+	dateFormat = "2006-01-02"
+	// maxPriceAge is the maximum age of the prices used to convert amounts.
+	maxPriceAge = time.Hour
+)
+
+var pnlGroups = map[string]pnl.KeyFunc{
+	"arbitrage": pnl.ByArbitrage,
+	"day":       pnl.ByDay,
+	"exchanger": pnl.ByExchanger,
+	"pair":      pnl.ByPair,
+}
+
+// PnLHandler returns the realized PnL grouped by arbitrage, day, exchanger or pair.
+// Parameters: group (default day), currency (default BTC), from and to (YYYY-MM-DD).
+func PnLHandler(w http.ResponseWriter, r *http.Request) {
+	group := r.FormValue("group")
+	if group == "" {
+		group = "day"
+	}
+
+	key, ok := pnlGroups[group]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown group `%s`", group), http.StatusBadRequest)
+		return
+	}
+
+	ledger, from, to, err := pnlLedger(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	JSONResponse(w, pnl.Summarize(ledger.Entries, key, from, to))
+}
+
+// PnLLedgerHandler exports the cost basis ledger as CSV.
+func PnLLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	ledger, from, to, err := pnlLedger(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=ledger.csv")
+	pnl.WriteCSV(w, ledger.Currency, pnl.Filter(ledger.Entries, from, to))
+}
+
+// pnlLedger computes the ledger of all the trades and transfers up to the end of the
+// requested range: lots acquired before the range are needed for the cost basis.
+func pnlLedger(r *http.Request) (*pnl.Ledger, time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	if s := r.FormValue("from"); s != "" {
+		if from, err = time.Parse(dateFormat, s); err != nil {
+			return nil, from, to, fmt.Errorf("invalid from date - %s", err)
+		}
+	}
+
+	end := time.Now()
+	if s := r.FormValue("to"); s != "" {
+		if to, err = time.Parse(dateFormat, s); err != nil {
+			return nil, from, to, fmt.Errorf("invalid to date - %s", err)
+		}
+		end = to
+	}
+
+	currency := r.FormValue("currency")
+	if currency == "" {
+		currency = "BTC"
+	}
+
+	trades, err := pnl.LoadTrades(dbx.DB, end)
+	if err != nil {
+		return nil, from, to, fmt.Errorf("cannot load trades - %s", err)
+	}
+
+	transfers, err := pnl.LoadTransfers(dbx.DB, end)
+	if err != nil {
+		return nil, from, to, fmt.Errorf("cannot load transfers - %s", err)
+	}
+
+	prices := pnl.NewPrices(currency, maxPriceAge)
+	prices.Source = &pnl.RecordedBooks{DB: dbx.DB}
+	prices.AddTrades(trades)
+
+	ledger, err := pnl.Compute(currency, prices, trades, transfers)
+	return ledger, from, to, err
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"bitbot/errorutils"
+)
+
+// valueColumns maps the valuation currencies to the columns of `balance_snapshot`.
+var valueColumns = map[string]string{
+	"BTC": "value_btc",
+	"USD": "value_usd",
+	"EUR": "value_eur",
+}
+
+type equityPoint struct {
+	Date  string
+	Total float64
+	// Exchangers maps exchangers to their value.
+	Exchangers map[string]float64
+	// Missing is set when some balances have no price.
+	Missing bool
+}
+
+// PortfolioHandler returns the value of the portfolio over time, per exchanger.
+// Parameters: currency (BTC, USD or EUR, default BTC), from and to (YYYY-MM-DD).
+func PortfolioHandler(w http.ResponseWriter, r *http.Request) {
+	currency := r.FormValue("currency")
+	if currency == "" {
+		currency = "BTC"
+	}
+
+	column, ok := valueColumns[currency]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported currency `%s`", currency), http.StatusBadRequest)
+		return
+	}
+
+	from, to := time.Time{}, time.Now()
+	var err error
+
+	if s := r.FormValue("from"); s != "" {
+		if from, err = time.Parse(dateFormat, s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if s := r.FormValue("to"); s != "" {
+		if to, err = time.Parse(dateFormat, s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	JSONResponse(w, equityHistory(dbx, column, from, to))
+}
+
+func equityHistory(db *sqlx.DB, column string, from, to time.Time) interface{} {
+	const stmt = `
+        select
+            ts,
+            exchanger,
+            coalesce(sum(%s), 0) as value,
+            sum(%s is null) as missing
+        from
+            balance_snapshot
+        where
+            ts >= ? and ts < ?
+        group by
+            ts, exchanger
+        order by
+            ts
+    `
+
+	var rows []*struct {
+		Date      string  `db:"ts"`
+		Exchanger string  `db:"exchanger"`
+		Value     float64 `db:"value"`
+		Missing   int     `db:"missing"`
+	}
+
+	err := db.Select(&rows, fmt.Sprintf(stmt, column, column), from, to)
+	errorutils.PanicOnError(err)
+
+	points := []*equityPoint{}
+	for _, row := range rows {
+		date, err := time.Parse(timeFormat, row.Date)
+		errorutils.PanicOnError(err)
+
+		d := date.Format(displayTimeFormat)
+		if len(points) == 0 || points[len(points)-1].Date != d {
+			points = append(points, &equityPoint{Date: d, Exchangers: map[string]float64{}})
+		}
+
+		p := points[len(points)-1]
+		p.Total += row.Value
+		p.Exchangers[row.Exchanger] += row.Value
+		p.Missing = p.Missing || row.Missing > 0
+	}
+
+	return points
+}
+
+// LatestPortfolioHandler returns the balances of the last snapshot.
+func LatestPortfolioHandler(w http.ResponseWriter, r *http.Request) {
+	JSONResponse(w, latestSnapshot(dbx))
+}
+
+func latestSnapshot(db *sqlx.DB) interface{} {
+	const stmt = `
+        select
+            ts,
+            exchanger,
+            account,
+            currency,
+            balance,
+            value_btc,
+            value_usd,
+            value_eur
+        from
+            balance_snapshot
+        where
+            ts = (select max(ts) from balance_snapshot)
+        order by
+            exchanger, account, currency
+    `
+
+	var rows []*struct {
+		Date      string   `db:"ts"`
+		Exchanger string   `db:"exchanger"`
+		Account   string   `db:"account"`
+		Currency  string   `db:"currency"`
+		Balance   float64  `db:"balance"`
+		ValueBTC  *float64 `db:"value_btc"`
+		ValueUSD  *float64 `db:"value_usd"`
+		ValueEUR  *float64 `db:"value_eur"`
+	}
+
+	err := db.Select(&rows, stmt)
+	errorutils.PanicOnError(err)
+	return rows
+}
@@ -73,6 +73,7 @@ func tradedArbitrages(db *sqlx.DB, limit int) interface{} {
 func trades(db *sqlx.DB, limit int) interface{} {
 	const stmt = `
         select
+            exchanger,
             arbitrage_id,
             trade_id,
             price,
@@ -80,16 +81,18 @@ func trades(db *sqlx.DB, limit int) interface{} {
             pair,
             side,
             fee,
-            fee_currency
+            fee_currency,
+            ts
         from
             trade
         order by
-            arbitrage_id desc
+            ts desc
         limit
             %d
     `
 	var rows []*struct {
-		ArbitrageId string  `db:"arbitrage_id"`
+		Exchanger   string  `db:"exchanger"`
+		ArbitrageId *string `db:"arbitrage_id"`
 		TradeId     string  `db:"trade_id"`
 		Price       float64 `db:"price"`
 		Quantity    float64 `db:"quantity"`
@@ -97,6 +100,7 @@ func trades(db *sqlx.DB, limit int) interface{} {
 		Side        string  `db:"side"`
 		Fee         float64 `db:"fee"`
 		FeeCurrency string  `db:"fee_currency"`
+		Date        string  `db:"ts"`
 	}
 
 	err := db.Select(&rows, fmt.Sprintf(stmt, limit))
@@ -9,7 +9,7 @@ import (
 	"golang.org/x/oauth2"
 )
 
-func authorize(config *oauth2.Config) {
+func authorize(config *oauth2.Config, tokenPath string) {
 	tok := getTokenFromWeb(config)
 	saveToken(tokenPath, tok)
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+
+	"golang.org/x/oauth2"
+)
+
+// Config holds the mail source and the confirmation rules.
+type Config struct {
+	Source SourceConfig
+	Rules  []*Rule
+}
+
+// SourceConfig selects the mail source. Type is gmail, imap, maildir or mbox.
+type SourceConfig struct {
+	Type string
+	// Label (gmail) or keyword (imap) tagging the processed messages.
+	Label string
+	// Gmail search query restricting the messages.
+	Query string
+	// Gmail OAuth token, written by the authorize command (defaults to gmail-token.json
+	// next to the configuration file).
+	TokenPath string
+	// Path of the Maildir directory or of the mbox file.
+	Path string
+	// IMAP server
+	Addr     string
+	User     string
+	Password string
+	Mailbox  string
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := &Config{}
+	err = json.Unmarshal(data, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	if dest.Source.Label == "" {
+		dest.Source.Label = "bitbot-confirmed"
+	}
+	if dest.Source.TokenPath == "" {
+		dest.Source.TokenPath = filepath.Join(filepath.Dir(path), "gmail-token.json")
+	}
+	if dest.Source.Mailbox == "" {
+		dest.Source.Mailbox = "INBOX"
+	}
+
+	return dest, nil
+}
+
+// newSource returns the configured source. oauth is only needed by Gmail.
+func newSource(conf SourceConfig, oauth *oauth2.Config) (Source, error) {
+	switch conf.Type {
+	case "gmail":
+		return &GmailSource{Config: oauth, TokenPath: conf.TokenPath, Label: conf.Label, Query: conf.Query}, nil
+	case "imap":
+		if _, _, err := net.SplitHostPort(conf.Addr); err != nil {
+			return nil, fmt.Errorf("invalid IMAP address `%s` - %s", conf.Addr, err)
+		}
+		return &IMAPSource{conf.Addr, conf.User, conf.Password, conf.Mailbox, conf.Label}, nil
+	case "maildir":
+		return &MaildirSource{conf.Path}, nil
+	case "mbox":
+		return &MboxSource{conf.Path}, nil
+	}
+
+	return nil, fmt.Errorf("unknown mail source `%s`", conf.Type)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Confirmation methods.
+const (
+	// methodGet requests the link.
+	methodGet = "get"
+	// methodPost posts an empty form to the link.
+	methodPost = "post"
+	// methodPostQuery posts the query string of the link as a form to the link without
+	// its query (Kraken).
+	methodPostQuery = "post-query"
+)
+
+// amountTolerance is the relative difference tolerated between the amount of an email
+// and the amount of the transfer (emails may round amounts).
+const amountTolerance = 1e-4
+
+// Rule describes the confirmation emails of an exchanger.
+type Rule struct {
+	Exchanger string
+	// Sender is the address ("noreply@kraken.com") or the domain ("@kraken.com") of the
+	// emails.
+	Sender string
+	// LinkPattern matches the confirmation link.
+	LinkPattern string
+	// AmountPattern and AddressPattern capture (first group) the amount and the
+	// destination of the withdrawal. The destination is an address or a Kraken key.
+	AmountPattern  string
+	AddressPattern string
+	// Method is get, post or post-query.
+	Method string
+}
+
+// rule is a Rule with compiled patterns.
+type rule struct {
+	*Rule
+	link    *regexp.Regexp
+	amount  *regexp.Regexp
+	address *regexp.Regexp
+}
+
+func compileRules(rules []*Rule) ([]*rule, error) {
+	out := []*rule{}
+	for _, r := range rules {
+		switch r.Method {
+		case methodGet, methodPost, methodPostQuery:
+		default:
+			return nil, fmt.Errorf("%s: unknown confirmation method `%s`", r.Exchanger, r.Method)
+		}
+
+		c := &rule{Rule: r}
+		for _, p := range []struct {
+			re      **regexp.Regexp
+			pattern string
+		}{{&c.link, r.LinkPattern}, {&c.amount, r.AmountPattern}, {&c.address, r.AddressPattern}} {
+			re, err := regexp.Compile(p.pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern `%s` - %s", r.Exchanger, p.pattern, err)
+			}
+			*p.re = re
+		}
+
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (r *rule) matches(m *Message) bool {
+	sender := strings.ToLower(r.Sender)
+	if strings.HasPrefix(sender, "@") {
+		return strings.HasSuffix(m.From, sender)
+	}
+	return m.From == sender
+}
+
+// withdrawal is the content of a confirmation email.
+type withdrawal struct {
+	link    string
+	amount  float64
+	address string
+}
+
+func (r *rule) extract(m *Message) (*withdrawal, error) {
+	// quoted-printable bodies are decoded but links may still be wrapped
+	body := strings.Replace(m.Body, "\r\n", "\n", -1)
+
+	link := r.link.FindString(body)
+	if link == "" {
+		return nil, fmt.Errorf("no confirmation link")
+	}
+
+	amount := r.amount.FindStringSubmatch(body)
+	if len(amount) < 2 {
+		return nil, fmt.Errorf("no amount")
+	}
+
+	vol, err := strconv.ParseFloat(strings.Replace(amount[1], ",", "", -1), 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse amount `%s` - %s", amount[1], err)
+	}
+
+	address := r.address.FindStringSubmatch(body)
+	if len(address) < 2 {
+		return nil, fmt.Errorf("no address")
+	}
+
+	return &withdrawal{link, vol, address[1]}, nil
+}
+
+// transferChecker looks up the pending transfers of the trader.
+type transferChecker interface {
+	// pendingWithdrawal returns the id of the transfer sent from ex matching the amount
+	// and the destination, or an empty string.
+	pendingWithdrawal(ex string, amount float64, address string) (string, error)
+}
+
+// confirmer confirms withdrawals.
+type confirmer interface {
+	confirm(method, link string) error
+}
+
+// process confirms the withdrawals of the unprocessed messages of src. Messages are
+// marked processed once confirmed. Messages that don't match a pending transfer are left
+// untouched and logged: they are either early (the transfer isn't recorded yet) or
+// suspicious.
+func process(src Source, rules []*rule, checker transferChecker, c confirmer) (int, error) {
+	messages, err := src.Unprocessed()
+	if err != nil {
+		return 0, err
+	}
+
+	confirmed := 0
+	for _, m := range messages {
+		var r *rule
+		for _, candidate := range rules {
+			if candidate.matches(m) {
+				r = candidate
+				break
+			}
+		}
+
+		if r == nil {
+			continue
+		}
+
+		w, err := r.extract(m)
+		if err != nil {
+			log.Printf("process: %s message %s ignored - %s\n", r.Exchanger, m.ID, err)
+			continue
+		}
+
+		id, err := checker.pendingWithdrawal(r.Exchanger, w.amount, w.address)
+		if err != nil {
+			log.Printf("process: call to pendingWithdrawal() failed - %s\n", err)
+			continue
+		} else if id == "" {
+			log.Printf("process: no pending transfer of %f to %s on %s (message %s)\n", w.amount, w.address, r.Exchanger, m.ID)
+			continue
+		}
+
+		log.Printf("Confirming %s withdrawal of transfer %s (message %s)...\n", r.Exchanger, id, m.ID)
+		if err := c.confirm(r.Method, w.link); err != nil {
+			log.Printf("process: confirm() failed - %s\n", err)
+			continue
+		}
+
+		if err := src.MarkProcessed(m); err != nil {
+			log.Printf("process: MarkProcessed() failed - %s\n", err)
+			continue
+		}
+
+		confirmed++
+		log.Printf("Message %s completed\n", m.ID)
+	}
+
+	return confirmed, nil
+}
+
+// dbChecker finds the pending transfers in the `transfers` table. Kraken emails refer to
+// the key of the address (see `address_book`).
+type dbChecker struct {
+	db *sql.DB
+}
+
+func (c *dbChecker) pendingWithdrawal(ex string, amount float64, address string) (string, error) {
+	const query = `
+		select t.transfer_id
+		from transfers t
+		left join address_book b on b.exchanger = t.to_ex and b.currency = t.currency
+		where
+			t.from_ex = ?
+			and t.status in ('withdrawing', 'withdrawal_acknowledged')
+			and abs(t.amount - ?) <= ?
+			and (t.address = ? or b.kraken_key = ?)
+		order by t.created_at
+		limit 1
+	`
+
+	var id string
+	err := c.db.QueryRow(query, ex, amount, amount*amountTolerance, address, address).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+type httpConfirmer struct{}
+
+func (httpConfirmer) confirm(method, rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("url.Parse() failed - %s", err)
+	}
+
+	var resp *http.Response
+	switch method {
+	case methodGet:
+		resp, err = http.Get(rawurl)
+	case methodPost:
+		resp, err = http.PostForm(rawurl, url.Values{})
+	case methodPostQuery:
+		query := u.Query()
+		u.RawQuery = ""
+		resp, err = http.PostForm(u.String(), query)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s failed - %s", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		status := http.StatusText(resp.StatusCode)
+		return fmt.Errorf("%s returned error - %s", method, status)
+	}
+
+	_, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadAll failed() - %s", err)
+	}
+
+	return nil
+}
+
+// logConfirmer only logs the links (dry run).
+type logConfirmer struct{}
+
+func (logConfirmer) confirm(method, link string) error {
+	log.Printf("Dry run: %s %s\n", method, link)
+	return nil
+}
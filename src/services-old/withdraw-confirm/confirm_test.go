@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testChecker map[string]string
+
+func (c testChecker) pendingWithdrawal(ex string, amount float64, address string) (string, error) {
+	for id, dest := range c {
+		if dest == address && amount == 0.14073129 {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+type testConfirmer struct {
+	links []string
+}
+
+func (c *testConfirmer) confirm(method, link string) error {
+	c.links = append(c.links, method+" "+link)
+	return nil
+}
+
+var testRules = []*Rule{{
+	Exchanger:      "Kraken",
+	Sender:         "@kraken.com",
+	LinkPattern:    `https://www\.kraken\.com/withdrawal-approve\?\S+`,
+	AmountPattern:  `withdrawal of ([0-9.,]+) [A-Z]+`,
+	AddressPattern: `withdrawal of [0-9.,]+ [A-Z]+ to ([A-Za-z0-9-]+)\.`,
+	Method:         methodPostQuery,
+}}
+
+// fixture copies the messages of testdata/maildir to a temporary Maildir.
+func fixture(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "withdraw-confirm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob("testdata/maildir/new/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "new", filepath.Base(f)), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestMaildir(t *testing.T) {
+	dir := fixture(t)
+	defer os.RemoveAll(dir)
+
+	rules, err := compileRules(testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &MaildirSource{dir}
+	checker := testChecker{"ZEC-Kraken-Poloniex-1": "Poloniex-ZEC"}
+	c := &testConfirmer{}
+
+	n, err := process(src, rules, checker, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "post-query https://www.kraken.com/withdrawal-approve?code=8f2a91c4&id=AQBCDEF-12345"
+	if n != 1 || len(c.links) != 1 || c.links[0] != expected {
+		t.Fatalf("only the known withdrawal should be confirmed, got %v", c.links)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "cur", "1500000000.1.bitbot:2,S")); err != nil {
+		t.Errorf("confirmed message should be marked as seen - %s", err)
+	}
+
+	// the other messages are left for review, the malformed one is skipped
+	messages, err := src.Unprocessed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("2 unprocessed messages expected, got %d", len(messages))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new", "1500000000.4.bitbot")); err != nil {
+		t.Errorf("malformed message should be left in place - %s", err)
+	}
+}
+
+func TestMbox(t *testing.T) {
+	dir := fixture(t)
+	defer os.RemoveAll(dir)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "new", "*"))
+	mbox := &bytes.Buffer{}
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(f)
+		mbox.WriteString("From bitbot@example.com Mon Jul 17 10:00:00 2017\n")
+		mbox.WriteString(strings.Replace(string(data), "\r\n", "\n", -1))
+		mbox.WriteString("\n")
+	}
+
+	path := filepath.Join(dir, "mbox")
+	if err := ioutil.WriteFile(path, mbox.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, _ := compileRules(testRules)
+	src := &MboxSource{path}
+	checker := testChecker{"ZEC-Kraken-Poloniex-1": "Poloniex-ZEC"}
+
+	for i, expected := range []int{1, 0} {
+		n, err := process(src, rules, checker, &testConfirmer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expected {
+			t.Errorf("run %d: %d confirmation expected, got %d", i, expected, n)
+		}
+	}
+}
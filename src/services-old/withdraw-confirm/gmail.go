@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/gmail/v1"
+)
+
+const (
+	// gmail user
+	me = "me"
+)
+
+type searchOptions struct {
+	key   string
+	value string
+}
+
+func (s searchOptions) Get() (key, value string) {
+	return s.key, s.value
+}
+
+// GmailSource reads the messages of a Gmail account through the Gmail API. Processed
+// messages are tagged with Label, which is created when missing. Messages that can't be
+// parsed are logged and skipped.
+type GmailSource struct {
+	Config    *oauth2.Config
+	TokenPath string
+	Label     string
+	// Query restricts the messages returned (Gmail search syntax).
+	Query string
+
+	labelId string
+}
+
+func (s *GmailSource) Unprocessed() ([]*Message, error) {
+	srv, err := s.service()
+	if err != nil {
+		return nil, err
+	}
+
+	q := searchOptions{"q", s.Query + " -label:" + s.Label}
+	r, err := srv.Users.Messages.List(me).Do(q)
+	if err != nil {
+		return nil, fmt.Errorf("Gmail: srv.Users.Messages.List() failed - %s", err)
+	}
+
+	messages := []*Message{}
+	for _, m := range r.Messages {
+		msg, err := srv.Users.Messages.Get(me, m.Id).Format("raw").Do()
+		if err != nil {
+			return nil, fmt.Errorf("Gmail: srv.Users.Messages.Get() failed - %s", err)
+		}
+
+		raw, err := base64.URLEncoding.DecodeString(msg.Raw)
+		if err != nil {
+			log.Printf("Gmail: skipping message %s - base64.URLEncoding.DecodeString failed - %s\n", m.Id, err)
+			continue
+		}
+
+		parsed, err := parseMessage(m.Id, raw)
+		if err != nil {
+			log.Printf("Gmail: skipping message - %s\n", err)
+			continue
+		}
+		messages = append(messages, parsed)
+	}
+
+	return messages, nil
+}
+
+func (s *GmailSource) MarkProcessed(m *Message) error {
+	srv, err := s.service()
+	if err != nil {
+		return err
+	}
+
+	params := &gmail.ModifyMessageRequest{
+		AddLabelIds:     []string{s.labelId},
+		ForceSendFields: []string{"AddLabelIds"},
+	}
+
+	_, err = srv.Users.Messages.Modify(me, m.ID, params).Do()
+	if err != nil {
+		return fmt.Errorf("Gmail: srv.Users.Messages.Modify() failed - %s", err)
+	}
+	return nil
+}
+
+func (s *GmailSource) service() (*gmail.Service, error) {
+	ctx := context.Background()
+	client, err := getClient(ctx, s.Config, s.TokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("Gmail: getClient() failed - %s", err)
+	}
+
+	srv, err := gmail.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Gmail: unable to retrieve gmail Client - %s", err)
+	}
+
+	if s.labelId == "" {
+		if s.labelId, err = labelId(srv, s.Label); err != nil {
+			return nil, err
+		}
+	}
+
+	return srv, nil
+}
+
+// labelId returns the id of the label, creating it if necessary.
+func labelId(srv *gmail.Service, name string) (string, error) {
+	r, err := srv.Users.Labels.List(me).Do()
+	if err != nil {
+		return "", fmt.Errorf("Gmail: srv.Users.Labels.List() failed - %s", err)
+	}
+
+	for _, l := range r.Labels {
+		if l.Name == name {
+			return l.Id, nil
+		}
+	}
+
+	l, err := srv.Users.Labels.Create(me, &gmail.Label{Name: name}).Do()
+	if err != nil {
+		return "", fmt.Errorf("Gmail: srv.Users.Labels.Create() failed - %s", err)
+	}
+	return l.Id, nil
+}
+
+// getClient uses a Context and Config to retrieve a Token
+// then generate a Client. It returns the generated Client.
+func getClient(ctx context.Context, config *oauth2.Config, tokenPath string) (*http.Client, error) {
+	f, err := os.Open(tokenPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tok := &oauth2.Token{}
+	err = json.NewDecoder(f).Decode(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Client(ctx, tok), nil
+}
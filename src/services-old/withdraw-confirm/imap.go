@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// IMAPSource reads the messages of an IMAP mailbox over TLS. Processed messages are
+// tagged with the Flag keyword, messages that can't be parsed are logged and skipped. Only
+// the few commands needed are implemented.
+type IMAPSource struct {
+	// Addr is the host:port of the server.
+	Addr     string
+	User     string
+	Password string
+	Mailbox  string
+	Flag     string
+}
+
+func (s *IMAPSource) Unprocessed() ([]*Message, error) {
+	c, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer c.logout()
+
+	lines, _, err := c.cmd("UID SEARCH NOT KEYWORD %s", s.Flag)
+	if err != nil {
+		return nil, err
+	}
+
+	uids := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "* SEARCH") {
+			uids = append(uids, strings.Fields(line)[2:]...)
+		}
+	}
+
+	messages := []*Message{}
+	for _, uid := range uids {
+		_, literals, err := c.cmd("UID FETCH %s BODY.PEEK[]", uid)
+		if err != nil {
+			return nil, err
+		}
+		if len(literals) == 0 {
+			log.Printf("IMAP: skipping message %s - empty body\n", uid)
+			continue
+		}
+
+		m, err := parseMessage(uid, literals[0])
+		if err != nil {
+			log.Printf("IMAP: skipping message - %s\n", err)
+			continue
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+func (s *IMAPSource) MarkProcessed(m *Message) error {
+	c, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer c.logout()
+
+	_, _, err = c.cmd("UID STORE %s +FLAGS (%s)", m.ID, s.Flag)
+	return err
+}
+
+func (s *IMAPSource) dial() (*imapConn, error) {
+	conn, err := tls.Dial("tcp", s.Addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("IMAP: cannot connect to %s - %s", s.Addr, err)
+	}
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+
+	// greeting
+	if _, err := c.r.ReadString('\n'); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP: no greeting - %s", err)
+	}
+
+	if _, _, err := c.cmd("LOGIN %s %s", quote(s.User), quote(s.Password)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, _, err := c.cmd("SELECT %s", quote(s.Mailbox)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type imapConn struct {
+	conn *tls.Conn
+	r    *bufio.Reader
+	seq  int
+}
+
+// cmd sends a command and returns the untagged response lines and the literals they
+// carry.
+func (c *imapConn) cmd(format string, args ...interface{}) ([]string, [][]byte, error) {
+	c.seq++
+	tag := fmt.Sprintf("a%d", c.seq)
+	command := fmt.Sprintf(format, args...)
+
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, nil, fmt.Errorf("IMAP: cannot send command - %s", err)
+	}
+
+	lines := []string{}
+	literals := [][]byte{}
+
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("IMAP: cannot read response - %s", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// literal: {size} at the end of the line followed by size bytes
+		for strings.HasSuffix(line, "}") {
+			i := strings.LastIndex(line, "{")
+			if i < 0 {
+				break
+			}
+			size, err := strconv.Atoi(line[i+1 : len(line)-1])
+			if err != nil {
+				break
+			}
+
+			literal := make([]byte, size)
+			if _, err := io.ReadFull(c.r, literal); err != nil {
+				return nil, nil, fmt.Errorf("IMAP: cannot read literal - %s", err)
+			}
+			literals = append(literals, literal)
+
+			rest, err := c.r.ReadString('\n')
+			if err != nil {
+				return nil, nil, fmt.Errorf("IMAP: cannot read response - %s", err)
+			}
+			line = line[:i] + strings.TrimRight(rest, "\r\n")
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				verb := strings.Fields(command)[0]
+				return nil, nil, fmt.Errorf("IMAP: %s failed - %s", verb, status)
+			}
+			return lines, literals, nil
+		}
+
+		lines = append(lines, line)
+	}
+}
+
+func (c *imapConn) logout() {
+	c.cmd("LOGOUT")
+	c.conn.Close()
+}
+
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
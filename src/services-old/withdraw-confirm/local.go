@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaildirSource reads the messages of a local Maildir. Processed messages are moved to
+// cur/ with the "seen" flag. Messages that can't be parsed are logged and left in place.
+type MaildirSource struct {
+	Path string
+}
+
+func (s *MaildirSource) Unprocessed() ([]*Message, error) {
+	messages := []*Message{}
+
+	for _, dir := range []string{"new", "cur"} {
+		files, err := ioutil.ReadDir(filepath.Join(s.Path, dir))
+		if err != nil {
+			return nil, fmt.Errorf("Maildir: cannot list %s - %s", dir, err)
+		}
+
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") || maildirSeen(f.Name()) {
+				continue
+			}
+
+			id := filepath.Join(dir, f.Name())
+			raw, err := ioutil.ReadFile(filepath.Join(s.Path, id))
+			if err != nil {
+				return nil, fmt.Errorf("Maildir: cannot read %s - %s", id, err)
+			}
+
+			m, err := parseMessage(id, raw)
+			if err != nil {
+				log.Printf("Maildir: skipping message - %s\n", err)
+				continue
+			}
+			messages = append(messages, m)
+		}
+	}
+
+	return messages, nil
+}
+
+func (s *MaildirSource) MarkProcessed(m *Message) error {
+	name := filepath.Base(m.ID)
+
+	// the info part follows ":2," and lists the flags in alphabetical order
+	base, flags := name, ""
+	if i := strings.Index(name, ":2,"); i >= 0 {
+		base, flags = name[:i], name[i+3:]
+	}
+
+	dest := filepath.Join(s.Path, "cur", base+":2,"+addFlag(flags, 'S'))
+	return os.Rename(filepath.Join(s.Path, m.ID), dest)
+}
+
+func maildirSeen(name string) bool {
+	i := strings.Index(name, ":2,")
+	return i >= 0 && strings.ContainsRune(name[i+3:], 'S')
+}
+
+func addFlag(flags string, flag rune) string {
+	if strings.ContainsRune(flags, flag) {
+		return flags
+	}
+
+	out := []rune(flags + string(flag))
+	for i := len(out) - 1; i > 0 && out[i] < out[i-1]; i-- {
+		out[i], out[i-1] = out[i-1], out[i]
+	}
+	return string(out)
+}
+
+// MboxSource reads the messages of a local mbox file. The mbox isn't modified: the
+// Message-IDs of processed messages are appended to Path + ".processed". Messages that
+// can't be parsed are logged and skipped.
+type MboxSource struct {
+	Path string
+}
+
+func (s *MboxSource) Unprocessed() ([]*Message, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("mbox: cannot read %s - %s", s.Path, err)
+	}
+
+	processed, err := s.processed()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []*Message{}
+	for i, raw := range splitMbox(data) {
+		id := messageID(raw)
+		if id == "" {
+			id = fmt.Sprintf("%s#%d", s.Path, i)
+		}
+		if processed[id] {
+			continue
+		}
+
+		m, err := parseMessage(id, raw)
+		if err != nil {
+			log.Printf("mbox: skipping message - %s\n", err)
+			continue
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+func (s *MboxSource) MarkProcessed(m *Message) error {
+	f, err := os.OpenFile(s.Path+".processed", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, m.ID)
+	return err
+}
+
+func (s *MboxSource) processed() (map[string]bool, error) {
+	out := map[string]bool{}
+
+	data, err := ioutil.ReadFile(s.Path + ".processed")
+	if os.IsNotExist(err) {
+		return out, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			out[line] = true
+		}
+	}
+	return out, nil
+}
+
+// splitMbox splits an mbox file on the "From " separator lines and unescapes the ">From "
+// lines of the bodies.
+func splitMbox(data []byte) [][]byte {
+	messages := [][]byte{}
+	var cur *bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "From ") {
+			if cur != nil {
+				messages = append(messages, cur.Bytes())
+			}
+			cur = &bytes.Buffer{}
+			continue
+		}
+
+		if cur == nil {
+			continue
+		}
+		if strings.HasPrefix(line, ">From ") {
+			line = line[1:]
+		}
+		cur.WriteString(line)
+		cur.WriteString("\r\n")
+	}
+
+	if cur != nil {
+		messages = append(messages, cur.Bytes())
+	}
+	return messages
+}
+
+func messageID(raw []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "message-id:") {
+			return strings.TrimSpace(line[len("message-id:"):])
+		}
+	}
+	return ""
+}
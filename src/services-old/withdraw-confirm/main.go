@@ -1,41 +1,133 @@
 package main
 
 import (
+	"database/sql"
 	"flag"
 	"io/ioutil"
 	"log"
+	"time"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
-)
 
-const (
-	tokenPath = "/tmp/gmail-token.json"
+	"bitbot/database"
 )
 
 var (
+	configPath  = flag.String("config", "ansible/secrets/withdraw-confirm.json", "JSON file holding the mail source and the confirmation rules.")
 	apiKeysPath = flag.String("api-keys", "ansible/secrets/gmail_api_keys.json", "Path to JSON file holding the Gmail API secret keys")
+	dbName      = flag.String("db-name", "bitbot", "MySQL database.")
+	dbHost      = flag.String("db-host", "localhost", "MySQL host.")
+	dbPort      = flag.String("db-port", "3306", "MySQL port.")
+	dbUser      = flag.String("db-user", "bitbot", "MySQL user.")
+	dbPwd       = flag.String("db-password", "password", "MySQL user's password.")
+	leaseTTL    = flag.Duration("lease-ttl", 30*time.Second, "Time after which the lease of a dead process expires.")
+)
+
+const (
+	// ticker duration in minutes
+	dur = 1
 )
 
 func main() {
 	flag.Parse()
 
-	b, err := ioutil.ReadFile(*apiKeysPath)
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Unable to read config file: %v", err)
+	}
+
+	var oauth *oauth2.Config
+	if config.Source.Type == "gmail" {
+		b, err := ioutil.ReadFile(*apiKeysPath)
+		if err != nil {
+			log.Fatalf("Unable to read client secret file: %v", err)
+		}
+
+		oauth, err = google.ConfigFromJSON(b, gmail.GmailReadonlyScope, gmail.GmailModifyScope)
+		if err != nil {
+			log.Fatalf("Unable to parse client secret file to config: %v", err)
+		}
+	}
+
+	cmd := flag.Arg(0)
+	if cmd == "authorize" {
+		if oauth == nil {
+			log.Fatal("authorize is only needed by the gmail source")
+		}
+		authorize(oauth, config.Source.TokenPath)
+		return
+	}
+
+	src, err := newSource(config.Source, oauth)
 	if err != nil {
-		log.Fatalf("Unable to read client secret file: %v", err)
+		log.Fatal(err)
 	}
 
-	config, err := google.ConfigFromJSON(b, gmail.GmailReadonlyScope, gmail.GmailModifyScope)
+	rules, err := compileRules(config.Rules)
 	if err != nil {
-		log.Fatalf("Unable to parse client secret file to config: %v", err)
+		log.Fatal(err)
 	}
 
-	switch cmd := flag.Arg(0); cmd {
-	case "authorize":
-		authorize(config)
+	db := database.Open(*dbName, *dbHost, *dbPort, *dbUser, *dbPwd)
+	defer db.Close()
+	checker := &dbChecker{db.DB}
+
+	switch cmd {
 	case "fetch":
-		fetch(config)
+		log.Println("Starting...")
+		lease := acquireLease(db.DB)
+		for _ = range time.Tick(dur * time.Minute) {
+			if !lease.Held() {
+				log.Fatalf("Lease %s expired, exiting\n", confirmLease)
+			}
+			if _, err := process(src, rules, checker, httpConfirmer{}); err != nil {
+				log.Printf("process() failed - %s\n", err)
+			}
+			log.Println("Waiting...")
+		}
+	case "check":
+		// dry run: nothing is confirmed nor marked
+		if _, err := process(readOnly{src}, rules, checker, logConfirmer{}); err != nil {
+			log.Fatal(err)
+		}
 	default:
-		log.Fatal("first argument must be `authorize` or `fetch`")
+		log.Fatal("first argument must be `authorize`, `fetch` or `check`")
 	}
 }
+
+// confirmLease is the lease held by the process confirming the withdrawals: two of them
+// would follow the links of the same messages.
+const confirmLease = "withdraw-confirm"
+
+// acquireLease takes the confirmation lease and keeps it in the background. The process
+// exits when another one holds it, or once it lost it.
+func acquireLease(db *sql.DB) *database.Lease {
+	lease := database.NewLease(db, confirmLease, database.HolderID(), *leaseTTL)
+
+	ok, err := lease.Acquire()
+	if err != nil {
+		log.Panic(err)
+	} else if !ok {
+		log.Fatalf("The %s lease is held by another process\n", confirmLease)
+	}
+
+	log.Printf("Lease %s acquired by %s (token %d)\n", confirmLease, lease.Holder, lease.Token())
+
+	go func() {
+		err := lease.Keep()
+		log.Fatalf("Lease %s lost, exiting - %s\n", confirmLease, err)
+	}()
+
+	return lease
+}
+
+// readOnly doesn't mark the messages of its source.
+type readOnly struct {
+	Source
+}
+
+func (readOnly) MarkProcessed(m *Message) error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+)
+
+// Message is an email fetched from a mail source.
+type Message struct {
+	// ID identifies the message within its source.
+	ID      string
+	From    string
+	Subject string
+	// Body is the concatenation of the text parts of the message, decoded.
+	Body string
+}
+
+// A Source gives access to a mailbox. Messages are marked once processed so that they
+// aren't returned again.
+type Source interface {
+	// Unprocessed returns the messages that aren't marked as processed yet.
+	Unprocessed() ([]*Message, error)
+	// MarkProcessed marks m as processed.
+	MarkProcessed(m *Message) error
+}
+
+// parseMessage parses a RFC 822 message.
+func parseMessage(id string, raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parseMessage: cannot read message %s - %s", id, err)
+	}
+
+	from := m.Header.Get("From")
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+
+	body, err := textBody(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parseMessage: cannot read body of %s - %s", id, err)
+	}
+
+	return &Message{
+		ID:      id,
+		From:    strings.ToLower(from),
+		Subject: m.Header.Get("Subject"),
+		Body:    body,
+	}, nil
+}
+
+// textBody returns the decoded text parts of a body.
+func textBody(contentType, encoding string, r io.Reader) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		parts := []string{}
+
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return "", err
+			}
+
+			text, err := textBody(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, text)
+		}
+
+		return strings.Join(parts, "\n"), nil
+	}
+
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
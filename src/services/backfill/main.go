@@ -0,0 +1,84 @@
+/*
+Command backfill collects the history of the public trades of a market, by time window
+or from a cursor of the exchanger:
+
+	backfill -exchanger Kraken -pair zec_btc -from 2017-06-01 -to 2017-06-08
+	backfill -exchanger Poloniex -pair zec_btc -cursor 1496275200
+
+The trades are saved in the storage of the recorder (see services/recorder), the ones
+already saved being ignored: windows can overlap and runs can be resumed. The cursor of
+the next trades is printed at the end. Bittrex only lists its most recent trades.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/tape"
+	"services"
+)
+
+var (
+	configPath = flag.String("config", "src/services/config.json", "JSON file that stores credentials.")
+	exName     = flag.String("exchanger", "", "Exchanger: Bitfinex, Bittrex, Kraken or Poloniex.")
+	pairName   = flag.String("pair", "", "Pair of the market: zec_btc.")
+	from       = flag.String("from", "", "Start of the window (2006-01-02 or RFC 3339).")
+	to         = flag.String("to", "", "End of the window, excluded (2006-01-02 or RFC 3339), now by default.")
+	cursor     = flag.String("cursor", "", "Cursor of the exchanger to start from, instead of -from.")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := backfill(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func backfill() error {
+	v, ok := tape.Venues[*exName]
+	if !ok {
+		return fmt.Errorf("no public trades for exchanger `%s`", *exName)
+	}
+
+	pair := exchanger.NewPair(strings.ToUpper(*pairName))
+	if *pairName == "" || !v.Supports(pair) {
+		return fmt.Errorf("%s: pair `%s` not supported", v.Name, *pairName)
+	}
+
+	until, err := services.ParseTime(*to, time.Now())
+	if err != nil {
+		return err
+	}
+
+	start := *cursor
+	if start == "" {
+		t, err := services.ParseTime(*from, time.Time{})
+		if err != nil {
+			return err
+		} else if t.IsZero() {
+			return fmt.Errorf("-from or -cursor is required")
+		}
+		start = v.Cursor(t)
+	}
+
+	config, err := services.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	store, err := services.OpenStore(config, config.Recorder.Storage)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	next, n, err := tape.Collect(store, v, pair, start, until)
+	log.Printf("%d %s %s trades saved, next cursor %s\n", n, v.Name, pair, next)
+	return err
+}
@@ -0,0 +1,117 @@
+/*
+Command bookconv converts the books of the `orderbooks` table to book files (see
+bitbot/bookfile), one file per exchanger and pair:
+
+	bookconv --config config.json -pair zec_btc -from 2017-06-01 -to 2017-07-01 -out books/
+
+Books already in the files are skipped, so that the conversion can be resumed or run
+periodically.
+*/
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bitbot/bookfile"
+	"bitbot/exchanger"
+	"services"
+)
+
+const dateFormat = "2006-01-02"
+
+var (
+	configPath = flag.String("config", "src/services/config.json", "JSON file that stores credentials.")
+	pairName   = flag.String("pair", "", "Pair to convert: zec_btc.")
+	fromDate   = flag.String("from", "", "First day to convert (2006-01-02).")
+	toDate     = flag.String("to", time.Now().UTC().Format(dateFormat), "Day following the last day to convert.")
+	outDir     = flag.String("out", "books", "Directory of the book files.")
+	keyframes  = flag.Int("keyframes", bookfile.DefaultKeyframeInterval, "Number of books between two keyframes.")
+)
+
+func main() {
+	flag.Parse()
+
+	if *pairName == "" || *fromDate == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pair := exchanger.NewPair(strings.ToUpper(*pairName))
+
+	from, err := time.Parse(dateFormat, *fromDate)
+	if err != nil {
+		log.Fatalf("invalid -from - %s\n", err)
+	}
+	to, err := time.Parse(dateFormat, *toDate)
+	if err != nil {
+		log.Fatalf("invalid -to - %s\n", err)
+	}
+
+	config, err := services.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := services.OpenStore(config, services.StorageConfig{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	writers := map[string]*bookfile.FileWriter{}
+	defer func() {
+		for ex, w := range writers {
+			if err := w.Close(); err != nil {
+				log.Printf("cannot close the %s file - %s\n", ex, err)
+			}
+		}
+	}()
+
+	// a day at a time to bound the memory
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		books, err := store.Books(pair, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			log.Fatalf("cannot load the books of %s - %s\n", day.Format(dateFormat), err)
+		}
+
+		written := 0
+		for _, b := range books {
+			w, ok := writers[b.Exchanger]
+			if !ok {
+				path := filepath.Join(*outDir, strings.ToLower(b.Exchanger+"_"+pair.String())+".bkf")
+				if w, err = bookfile.OpenWriter(path, bookfile.Header{Exchanger: b.Exchanger, Pair: pair}); err != nil {
+					log.Fatalf("cannot open %s - %s\n", path, err)
+				}
+				w.KeyframeInterval = *keyframes
+				writers[b.Exchanger] = w
+			}
+
+			// already converted
+			if !b.Time.After(w.Last()) {
+				continue
+			}
+
+			if err := w.Write(b.Time, b.OrderBook); err != nil {
+				log.Fatalf("cannot write the %s book of %s - %s\n", b.Exchanger, b.Time, err)
+			}
+			written++
+		}
+
+		for _, w := range writers {
+			if err := w.Flush(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		log.Printf("%s: %d books converted\n", day.Format(dateFormat), written)
+	}
+}
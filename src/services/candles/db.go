@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"bitbot/candle"
+	"bitbot/database"
+	"bitbot/exchanger"
+)
+
+func saveCandles(db *sql.DB, candles []*candle.Candle) error {
+	const stmt = `
+		replace into candles
+			(exchanger, pair, resolution, start_ts, open, high, low, close, volume, trades, source)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	return database.WithTx(db, func(tx *sql.Tx) error {
+		for _, c := range candles {
+			_, err := tx.Exec(stmt, c.Exchanger, c.Pair.String(), database.Seconds(c.Interval), c.Start, c.Open, c.High,
+				c.Low, c.Close, c.Volume, c.Trades, c.Source)
+			if err != nil {
+				return fmt.Errorf("tx.Exec() failed - %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+// loadCandles returns the bars of a market at interval between from and to.
+func loadCandles(db *sql.DB, m *market, interval time.Duration, from, to time.Time) ([]*candle.Candle, error) {
+	const query = `
+		select start_ts, open, high, low, close, volume, trades, source
+		from candles
+		where exchanger = ? and pair = ? and resolution = ? and start_ts >= ? and start_ts < ?
+		order by start_ts
+	`
+
+	rows, err := db.Query(query, m.ex, m.pair.String(), database.Seconds(interval), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candles := []*candle.Candle{}
+	for rows.Next() {
+		c := &candle.Candle{Candle: exchanger.Candle{Exchanger: m.ex, Pair: m.pair, Interval: interval}}
+		var start database.Timestamp
+
+		err := rows.Scan(&start, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume, &c.Trades, &c.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Start = start.Time
+		candles = append(candles, c)
+	}
+	return candles, rows.Err()
+}
+
+// builtUntil returns the end of the periods of a market at interval already built, zero
+// before the first run.
+func builtUntil(db *sql.DB, m *market, interval time.Duration) (time.Time, error) {
+	const query = "select built_until from candle_state where exchanger = ? and pair = ? and resolution = ?"
+
+	var t database.Timestamp
+	err := db.QueryRow(query, m.ex, m.pair.String(), database.Seconds(interval)).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return t.Time, err
+}
+
+func setBuiltUntil(db *sql.DB, m *market, interval time.Duration, t time.Time) error {
+	const stmt = "replace into candle_state (exchanger, pair, resolution, built_until) values (?, ?, ?, ?)"
+	_, err := db.Exec(stmt, m.ex, m.pair.String(), database.Seconds(interval), t)
+	return err
+}
@@ -0,0 +1,283 @@
+/*
+Command candles builds the OHLCV bars of the markets in the `candles` table.
+
+The bars of the first interval are built from the public trades recorded by the recorder,
+or from the mid price of the books when there is no trade, the bars of the other
+intervals are merged from them. The bars still missing are filled from the candles of
+the exchanger APIs (Bitfinex, Bittrex, Kraken and Poloniex). Only the complete periods
+are built. The markets and intervals are read from the `candles` section of the config:
+
+	"candles": {
+		"intervals": ["1m", "5m", "1h", "1d"],
+		"history": 604800,
+		"venues": [
+			{"name": "Kraken", "pairs": ["zec_btc", "eth_btc"]},
+			{"name": "Poloniex", "pairs": ["zec_btc"]}
+		]
+	}
+
+Each run resumes where the previous one stopped, as recorded in the `candle_state` table
+for each market and interval, even when there was no data to build. The periods whose
+exchanger candles couldn't be fetched are built again by the next run. The first run
+covers `history` seconds, 7 days by default. The trades and the books are read from the
+storage of the recorder (see services/recorder).
+*/
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bitbot/candle"
+	"bitbot/database"
+	"bitbot/exchanger"
+	"bitbot/exchanger/bitfinex"
+	"bitbot/exchanger/bittrex"
+	"bitbot/exchanger/kraken"
+	"bitbot/exchanger/poloniex"
+	"bitbot/storage"
+	"services"
+)
+
+var (
+	configPath = flag.String("config", "src/services/config.json", "JSON file that stores credentials.")
+	period     = flag.Duration("period", time.Minute, "Time between two runs.")
+	once       = flag.Bool("once", false, "Run once and exit.")
+)
+
+const (
+	defaultHistory = 7 * 24 * time.Hour
+	// grace is the delay before a period is built, for the trades and books written late.
+	grace = 5 * time.Minute
+)
+
+// venueCandles are the exchangers with a candle endpoint.
+var venueCandles = map[string]exchanger.CandleFunc{
+	bitfinex.ExchangerName: bitfinex.Candles,
+	bittrex.ExchangerName:  bittrex.Candles,
+	kraken.ExchangerName:   kraken.Candles,
+	poloniex.ExchangerName: poloniex.Candles,
+}
+
+// market is an exchanger pair.
+type market struct {
+	ex   string
+	pair exchanger.Pair
+}
+
+type job struct {
+	db        *sql.DB
+	store     storage.Store
+	intervals []time.Duration
+	history   time.Duration
+}
+
+func main() {
+	log.Println("Start candles...")
+	flag.Parse()
+
+	config, err := services.LoadConfig(*configPath)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	conf := config.Candles
+	intervals := candle.DefaultIntervals
+	if len(conf.Intervals) > 0 {
+		intervals = []time.Duration{}
+		for _, s := range conf.Intervals {
+			d, err := candle.ParseInterval(s)
+			if err != nil {
+				log.Panic(err)
+			}
+			intervals = append(intervals, d)
+		}
+	}
+
+	if err := candle.Validate(intervals); err != nil {
+		log.Panic(err)
+	}
+
+	markets := []*market{}
+	for _, vc := range conf.Venues {
+		for _, p := range vc.Pairs {
+			markets = append(markets, &market{vc.Name, exchanger.NewPair(strings.ToUpper(p))})
+		}
+	}
+	if len(markets) == 0 {
+		log.Panic("no market to build")
+	}
+
+	history := time.Duration(conf.History) * time.Second
+	if history == 0 {
+		history = defaultHistory
+	}
+
+	// open db
+	creds := config.Mysql
+	db := database.Open(creds.Db, creds.Host, creds.Port, creds.User, creds.Pwd)
+	defer db.Close()
+
+	if err := database.CheckSchema(db.DB); err != nil {
+		log.Panic(err)
+	}
+
+	store, err := services.OpenStore(config, config.Recorder.Storage)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer store.Close()
+
+	j := &job{db: db.DB, store: store, intervals: intervals, history: history}
+
+	for {
+		for _, m := range markets {
+			j.run(m, time.Now())
+		}
+
+		if *once {
+			return
+		}
+		time.Sleep(*period)
+	}
+}
+
+// run builds the bars of a market. Markets are independent: the errors are logged.
+func (j *job) run(m *market, now time.Time) {
+	for i := range j.intervals {
+		if err := j.build(m, i, now); err != nil {
+			log.Printf("run: cannot build the %s candles of %s - %s\n", candle.FormatInterval(j.intervals[i]), m, err)
+			// the next intervals are merged from this one
+			return
+		}
+	}
+}
+
+// build builds the bars of interval i since the last run.
+func (j *job) build(m *market, i int, now time.Time) error {
+	interval := j.intervals[i]
+	until := now.Add(-grace).Truncate(interval)
+
+	from, err := builtUntil(j.db, m, interval)
+	if err != nil {
+		return err
+	}
+	// the last bar is built again: it may have been filled before its trades were recorded
+	if !from.IsZero() {
+		from = from.Add(-interval)
+	}
+	if floor := now.Add(-j.history).Truncate(interval); from.Before(floor) {
+		from = floor
+	}
+
+	// chunks of a day at least
+	chunk := 24 * time.Hour / interval * interval
+	if chunk < interval {
+		chunk = interval
+	}
+
+	for from.Before(until) {
+		to := from.Add(chunk)
+		if to.After(until) {
+			to = until
+		}
+
+		var candles []*candle.Candle
+		if i == 0 {
+			candles, err = j.fromRaw(m, interval, from, to)
+		} else {
+			candles, err = loadCandles(j.db, m, j.intervals[0], from, to)
+			candles = candle.Merge(candles, interval)
+		}
+		if err != nil {
+			return err
+		}
+
+		var fillErr error
+		if missing(candles, from, to, interval) {
+			var filled []*candle.Candle
+			filled, fillErr = j.fromVenue(m, interval, from, to)
+			candles = candle.Fill(candles, filled)
+		}
+
+		if err := saveCandles(j.db, candles); err != nil {
+			return err
+		}
+		// the chunk is filled again on the next run
+		if fillErr != nil {
+			return fillErr
+		}
+		// the periods without data are not scanned again
+		if err := setBuiltUntil(j.db, m, interval, to); err != nil {
+			return err
+		}
+
+		from = to
+	}
+	return nil
+}
+
+// fromRaw builds the bars of the trades between from and to, completed with the ones of
+// the books.
+func (j *job) fromRaw(m *market, interval time.Duration, from, to time.Time) ([]*candle.Candle, error) {
+	trades, err := j.store.PublicTrades(m.ex, m.pair, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := candle.FromTrades(trades, interval)
+	if !missing(candles, from, to, interval) {
+		return candles, nil
+	}
+
+	books, err := j.store.Books(m.pair, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	exBooks := []*storage.Book{}
+	for _, b := range books {
+		if b.Exchanger == m.ex {
+			exBooks = append(exBooks, b)
+		}
+	}
+
+	return candle.Fill(candles, candle.FromBooks(exBooks, interval)), nil
+}
+
+// fromVenue returns the candles of the exchanger API between from and to, none when the
+// exchanger doesn't provide them.
+func (j *job) fromVenue(m *market, interval time.Duration, from, to time.Time) ([]*candle.Candle, error) {
+	f, ok := venueCandles[m.ex]
+	if !ok {
+		return []*candle.Candle{}, nil
+	}
+
+	candles, err := f(m.pair, interval, from)
+	if _, ok := err.(*exchanger.IntervalError); ok {
+		return []*candle.Candle{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("fromVenue: cannot fetch the candles of %s - %s", m, err)
+	}
+
+	kept := []*exchanger.Candle{}
+	for _, c := range candles {
+		if !c.Start.Before(from) && c.Start.Before(to) {
+			kept = append(kept, c)
+		}
+	}
+	return candle.FromVenue(kept), nil
+}
+
+// missing reports whether bars are missing between from and to.
+func missing(candles []*candle.Candle, from, to time.Time, interval time.Duration) bool {
+	return len(candles) < int(to.Sub(from)/interval)
+}
+
+func (m *market) String() string {
+	return fmt.Sprintf("%s %s", m.ex, m.pair)
+}
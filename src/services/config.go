@@ -17,6 +17,92 @@ type Config struct {
 		Key    string `json:"key"`
 		Secret string `json:"secret"`
 	} `json:"bittrex"`
+	Recorder  RecorderConfig  `json:"recorder"`
+	Retention RetentionConfig `json:"retention"`
+	Tickers   TickersConfig   `json:"tickers"`
+	Candles   CandlesConfig   `json:"candles"`
+}
+
+// RecorderConfig configures the order book recorder. Intervals are in seconds.
+type RecorderConfig struct {
+	Venues []VenueConfig `json:"venues"`
+	// Depth is the number of orders saved on each side of the books.
+	Depth int `json:"depth"`
+	// Interval is the default polling interval of the venues.
+	Interval int `json:"interval"`
+	// BatchSize is the number of snapshots written at once.
+	BatchSize int `json:"batch_size"`
+	// FlushInterval is the maximum time a snapshot waits before being written.
+	FlushInterval int `json:"flush_interval"`
+	// MaxSkew is the maximum time between the books of two venues compared for arbitrage.
+	MaxSkew int `json:"max_skew"`
+	// StatsInterval is the period of the fetch latency statistics.
+	StatsInterval int           `json:"stats_interval"`
+	Storage       StorageConfig `json:"storage"`
+	Tape          TapeConfig    `json:"tape"`
+}
+
+// TapeConfig configures the collection of the public trades by the recorder. Intervals
+// are in seconds.
+type TapeConfig struct {
+	Venues []VenueConfig `json:"venues"`
+	// Interval is the default polling interval of the venues.
+	Interval int `json:"interval"`
+	// Backfill is the history collected at startup, the most recent trades only when 0.
+	Backfill int `json:"backfill"`
+}
+
+// StorageConfig selects where records are saved (see bitbot/storage).
+type StorageConfig struct {
+	// Backend is "mysql" (the default), "sqlite" or "dir".
+	Backend string `json:"backend"`
+	// Path is the SQLite file or the directory.
+	Path string `json:"path"`
+	// Format is the format of the directory files: "jsonl" (the default) or "csv".
+	Format string `json:"format"`
+}
+
+// VenueConfig configures the polling of an exchanger.
+type VenueConfig struct {
+	Name string `json:"name"`
+	// Pairs are lower case pairs: "zec_btc".
+	Pairs []string `json:"pairs"`
+	// Interval overrides the default polling interval.
+	Interval int `json:"interval"`
+}
+
+// TickersConfig configures the ticker poller of services/trader. Without venues, every
+// pair of the exchangers with a batch ticker endpoint is polled.
+type TickersConfig struct {
+	Venues []VenueConfig `json:"venues"`
+	// Interval is the default polling interval of the venues, in seconds.
+	Interval int `json:"interval"`
+}
+
+// CandlesConfig configures the candle job.
+type CandlesConfig struct {
+	// Intervals are written 1m, 5m, 1h or 1d. The first one is built from the trades or
+	// the books, the others are merged from it.
+	Intervals []string `json:"intervals"`
+	// Venues are the markets of the candles, the polling intervals are ignored.
+	Venues []VenueConfig `json:"venues"`
+	// History is the time covered by the first run, in seconds.
+	History int `json:"history"`
+}
+
+// RetentionConfig configures the downsampling of the market data. Durations are in
+// seconds.
+type RetentionConfig struct {
+	Policies []PolicyConfig `json:"policies"`
+	// BatchSize is the number of rows deleted at once.
+	BatchSize int `json:"batch_size"`
+}
+
+// PolicyConfig keeps the data at a resolution, 0 for the raw rows, for a time, 0 to keep
+// it forever.
+type PolicyConfig struct {
+	Resolution int `json:"resolution"`
+	Keep       int `json:"keep"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -0,0 +1,415 @@
+/*
+Command dataset exports recorded data for analysis, and imports it into another database.
+
+	dataset export -kind books -pair zec_btc -exchanger Kraken -from 2017-06-01 -to 2017-06-08 -format csv -out books.csv
+	dataset export -kind books -pair zec_btc -exchanger Kraken -from 2017-06-01 -format bkf -out kraken_zec_btc.bkf
+	dataset export -kind market_summaries -market BTC-ZEC -from 2017-06-01 -format jsonl
+	dataset import -kind books -format csv -in books.csv -backend sqlite -path local.db
+
+The kinds are books, arbitrages, market_summaries, trades and public_trades. The formats are csv, jsonl
+and, for the books of an exchanger, the compact book format bkf (see bitbot/bookfile).
+
+Exports read the range a chunk at a time and write the records as they come, imports
+save them by batches: the memory used doesn't depend on the size of the range. The
+database is the MySQL one of the config unless -backend selects another storage backend
+(see bitbot/storage).
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"bitbot/bookfile"
+	"bitbot/exchanger"
+	"bitbot/storage"
+	"services"
+)
+
+const (
+	// bkf is the compact book format.
+	bkf = "bkf"
+	// batchSize is the number of records saved at once by the imports.
+	batchSize = 1000
+)
+
+var kinds = []string{storage.Books, storage.Arbitrages, storage.MarketSummaries, storage.Trades, storage.PublicTrades}
+
+// options are the flags of both commands.
+type options struct {
+	config  string
+	kind    string
+	format  string
+	file    string
+	backend string
+	path    string
+	dirFmt  string
+
+	// export filters
+	pair      string
+	exchanger string
+	market    string
+	from      string
+	to        string
+	chunk     time.Duration
+}
+
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&o.config, "config", "src/services/config.json", "JSON file that stores credentials.")
+	fs.StringVar(&o.kind, "kind", "", "Kind of records: "+strings.Join(kinds, ", ")+".")
+	fs.StringVar(&o.format, "format", storage.CSV, "Format of the file: csv, jsonl or bkf.")
+	fs.StringVar(&o.backend, "backend", "mysql", "Storage backend of the database: mysql, sqlite or dir.")
+	fs.StringVar(&o.path, "path", "", "SQLite file or directory of the sqlite and dir backends.")
+	fs.StringVar(&o.dirFmt, "dir-format", storage.JSONL, "Format of the files of the dir backend.")
+	return fs
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: dataset export|import [flags]")
+		os.Exit(2)
+	}
+
+	o := &options{}
+	var err error
+
+	switch os.Args[1] {
+	case "export":
+		fs := newFlagSet("export", o)
+		fs.StringVar(&o.file, "out", "-", "Output file, - for the standard output.")
+		fs.StringVar(&o.pair, "pair", "", "Pair of the books, arbitrages and trades: zec_btc.")
+		fs.StringVar(&o.exchanger, "exchanger", "", "Exchanger of the books, arbitrages and trades, all of them if empty.")
+		fs.StringVar(&o.market, "market", "", "Market of the summaries: BTC-ZEC.")
+		fs.StringVar(&o.from, "from", "", "Start of the range (2006-01-02 or RFC 3339).")
+		fs.StringVar(&o.to, "to", "", "End of the range, excluded (2006-01-02 or RFC 3339), now by default.")
+		fs.DurationVar(&o.chunk, "chunk", time.Hour, "Range read at once.")
+		fs.Parse(os.Args[2:])
+		err = export(o)
+	case "import":
+		fs := newFlagSet("import", o)
+		fs.StringVar(&o.file, "in", "-", "Input file, - for the standard input.")
+		fs.Parse(os.Args[2:])
+		err = importFile(o)
+	default:
+		err = fmt.Errorf("unknown command `%s`", os.Args[1])
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func openStore(o *options) (storage.Store, error) {
+	config, err := services.LoadConfig(o.config)
+	if err != nil && o.backend == "mysql" {
+		return nil, err
+	}
+	if config == nil {
+		config = &services.Config{}
+	}
+
+	return services.OpenStore(config, services.StorageConfig{Backend: o.backend, Path: o.path, Format: o.dirFmt})
+}
+
+func checkKind(kind string) error {
+	for _, k := range kinds {
+		if k == kind {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown kind `%s`, expected one of %s", kind, strings.Join(kinds, ", "))
+}
+
+func export(o *options) error {
+	if err := checkKind(o.kind); err != nil {
+		return err
+	}
+
+	from, err := services.ParseTime(o.from, time.Time{})
+	if err != nil {
+		return err
+	} else if from.IsZero() {
+		return fmt.Errorf("-from is required")
+	}
+
+	to, err := services.ParseTime(o.to, time.Now())
+	if err != nil {
+		return err
+	}
+
+	pair := exchanger.NewPair(strings.ToUpper(o.pair))
+	if o.kind == storage.MarketSummaries {
+		if o.market == "" {
+			return fmt.Errorf("-market is required")
+		}
+	} else if o.pair == "" {
+		return fmt.Errorf("-pair is required")
+	}
+
+	store, err := openStore(o)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	write, closeOut, err := output(o, pair)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for start := from; start.Before(to); start = start.Add(o.chunk) {
+		end := start.Add(o.chunk)
+		if end.After(to) {
+			end = to
+		}
+
+		records, err := load(store, o, pair, start, end)
+		if err != nil {
+			closeOut()
+			return fmt.Errorf("cannot load the %s of %s - %s", o.kind, start, err)
+		}
+
+		for _, r := range records {
+			if err := write(r); err != nil {
+				closeOut()
+				return err
+			}
+		}
+		n += len(records)
+	}
+
+	if err := closeOut(); err != nil {
+		return err
+	}
+
+	log.Printf("%d %s exported\n", n, o.kind)
+	return nil
+}
+
+// output returns the function writing a record to the output file, and the one flushing
+// and closing it.
+func output(o *options, pair exchanger.Pair) (func(interface{}) error, func() error, error) {
+	if o.format == bkf {
+		if o.kind != storage.Books || o.exchanger == "" || o.file == "-" {
+			return nil, nil, fmt.Errorf("the bkf format requires books, an -exchanger and an -out file")
+		}
+
+		w, err := bookfile.OpenWriter(o.file, bookfile.Header{Exchanger: o.exchanger, Pair: pair})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		write := func(r interface{}) error {
+			b := r.(*storage.Book)
+			// already in the file
+			if !b.Time.After(w.Last()) {
+				return nil
+			}
+			return w.Write(b.Time, b.OrderBook)
+		}
+		return write, w.Close, nil
+	}
+
+	var f io.WriteCloser = os.Stdout
+	if o.file != "-" {
+		var err error
+		if f, err = os.Create(o.file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	buf := bufio.NewWriter(f)
+	enc, err := storage.NewEncoder(buf, o.kind, o.format)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	closeOut := func() error {
+		defer f.Close()
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		return buf.Flush()
+	}
+	return enc.Encode, closeOut, nil
+}
+
+// load returns the records of a chunk matching the filters.
+func load(store storage.Store, o *options, pair exchanger.Pair, from, to time.Time) ([]interface{}, error) {
+	records := []interface{}{}
+
+	switch o.kind {
+	case storage.Books:
+		books, err := store.Books(pair, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range books {
+			if o.exchanger == "" || b.Exchanger == o.exchanger {
+				records = append(records, b)
+			}
+		}
+	case storage.Arbitrages:
+		arbitrages, err := store.Arbitrages(pair, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range arbitrages {
+			if o.exchanger == "" || a.BuyEx == o.exchanger || a.SellEx == o.exchanger {
+				records = append(records, a)
+			}
+		}
+	case storage.MarketSummaries:
+		summaries, err := store.MarketSummaries(o.market, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range summaries {
+			records = append(records, m)
+		}
+	case storage.Trades:
+		trades, err := store.Trades(o.exchanger, pair, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range trades {
+			records = append(records, t)
+		}
+	case storage.PublicTrades:
+		trades, err := store.PublicTrades(o.exchanger, pair, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range trades {
+			records = append(records, t)
+		}
+	}
+
+	return records, nil
+}
+
+func importFile(o *options) error {
+	if err := checkKind(o.kind); err != nil {
+		return err
+	}
+
+	store, err := openStore(o)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	batch := []interface{}{}
+	n := 0
+
+	add := func(r interface{}) error {
+		batch = append(batch, r)
+		if len(batch) < batchSize {
+			return nil
+		}
+
+		n += len(batch)
+		err := save(store, o.kind, batch)
+		batch = []interface{}{}
+		return err
+	}
+
+	if o.format == bkf {
+		if o.kind != storage.Books || o.file == "-" {
+			return fmt.Errorf("the bkf format requires books and an -in file")
+		}
+
+		r, err := bookfile.Open(o.file)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		err = r.Range(r.First(), r.Last().Add(time.Millisecond), func(b *storage.Book) error {
+			return add(b)
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		var f io.ReadCloser = os.Stdin
+		if o.file != "-" {
+			if f, err = os.Open(o.file); err != nil {
+				return err
+			}
+		}
+		defer f.Close()
+
+		dec, err := storage.NewDecoder(bufio.NewReader(f), o.kind, o.format)
+		if err != nil {
+			return err
+		}
+
+		for {
+			r, err := dec.Decode()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			if err := add(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	n += len(batch)
+	if err := save(store, o.kind, batch); err != nil {
+		return err
+	}
+
+	log.Printf("%d %s imported\n", n, o.kind)
+	return nil
+}
+
+// save saves a batch of records of kind.
+func save(store storage.Store, kind string, batch []interface{}) error {
+	switch kind {
+	case storage.Books:
+		books := make([]*storage.Book, len(batch))
+		for i, r := range batch {
+			books[i] = r.(*storage.Book)
+		}
+		return store.SaveBooks(books)
+	case storage.Arbitrages:
+		arbitrages := make([]*storage.Arbitrage, len(batch))
+		for i, r := range batch {
+			arbitrages[i] = r.(*storage.Arbitrage)
+		}
+		return store.SaveArbitrages(arbitrages)
+	case storage.MarketSummaries:
+		summaries := make([]*storage.MarketSummary, len(batch))
+		for i, r := range batch {
+			summaries[i] = r.(*storage.MarketSummary)
+		}
+		return store.SaveMarketSummaries(summaries)
+	case storage.Trades:
+		trades := make([]*storage.Trade, len(batch))
+		for i, r := range batch {
+			trades[i] = r.(*storage.Trade)
+		}
+		return store.SaveTrades(trades)
+	case storage.PublicTrades:
+		trades := make([]*exchanger.PublicTrade, len(batch))
+		for i, r := range batch {
+			trades[i] = r.(*exchanger.PublicTrade)
+		}
+		return store.SavePublicTrades(trades)
+	}
+	return fmt.Errorf("unknown kind `%s`", kind)
+}
@@ -0,0 +1,88 @@
+/*
+Command migrate applies and rolls back the schema migrations of the MySQL database
+(see bitbot/database/migrations.go).
+
+	migrate status           prints the current and latest versions
+	migrate up               applies the migrations not applied yet
+	migrate up -to 2         applies the migrations until version 2
+	migrate down             rolls back the last migration
+	migrate down -to 1       rolls back every migration but the initial one, which
+	                         can't be reverted
+
+The services refuse to start until the schema is at the latest version.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"bitbot/database"
+	"services"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: migrate status|up|down [flags]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	configPath := fs.String("config", "src/services/config.json", "JSON file that stores credentials.")
+	to := fs.Int("to", -1, "Target version: the latest one for up, the previous one for down.")
+	fs.Parse(os.Args[2:])
+
+	config, err := services.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	creds := config.Mysql
+	db := database.Open(creds.Db, creds.Host, creds.Port, creds.User, creds.Pwd)
+	defer db.Close()
+
+	m, err := database.NewMigrator(db.DB, database.Migrations)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var done []*database.Migration
+	switch os.Args[1] {
+	case "status":
+		fmt.Printf("version %d, latest %d\n", current, m.Latest())
+		return
+	case "up":
+		if *to < 0 {
+			*to = m.Latest()
+		}
+		done, err = m.Up(*to)
+	case "down":
+		if *to < 0 {
+			*to = current - 1
+		}
+		if *to < 0 {
+			*to = 0
+		}
+		done, err = m.Down(*to)
+	default:
+		log.Fatalf("unknown command `%s`", os.Args[1])
+	}
+
+	for _, mig := range done {
+		log.Printf("%s %s\n", os.Args[1], mig)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(done) == 0 {
+		log.Printf("nothing to do, version %d\n", current)
+	}
+}
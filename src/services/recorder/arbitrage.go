@@ -0,0 +1,156 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"bitbot/episode"
+	"bitbot/exchanger"
+	"bitbot/latency"
+	"bitbot/storage"
+)
+
+// comparator compares each book with the latest books of the other venues of its pair.
+// The crossings are saved in the `arbitrages` table and linked into episodes.
+type comparator struct {
+	store   storage.Store
+	maxSkew time.Duration
+	tracker *episode.Tracker
+
+	mu     sync.Mutex
+	latest map[exchanger.Pair]map[string]*exchanger.OrderBook
+}
+
+func newComparator(store storage.Store, maxSkew, maxGap time.Duration) *comparator {
+	return &comparator{
+		store:   store,
+		maxSkew: maxSkew,
+		tracker: episode.NewTracker(maxGap),
+		latest:  map[exchanger.Pair]map[string]*exchanger.OrderBook{},
+	}
+}
+
+// compare saves the crossings of book with the books of the other venues fetched less
+// than maxSkew apart, and the episodes they close. The venues are polled on their own
+// schedules: each venue the book is compared with is a snapshot of the two venues for
+// the tracker.
+func (c *comparator) compare(pair exchanger.Pair, book *exchanger.OrderBook) {
+	others := c.swap(pair, book)
+
+	arbitrages := []*storage.Arbitrage{}
+	episodes := []*storage.Episode{}
+	for _, other := range others {
+		if exchanger.Skew(book, other) > c.maxSkew {
+			continue
+		}
+
+		crossings := []*episode.Crossing{}
+		for _, a := range []*storage.Arbitrage{cross(pair, book, other), cross(pair, other, book)} {
+			if a == nil {
+				continue
+			}
+
+			a.Time = book.Time()
+			arbitrages = append(arbitrages, a)
+			crossings = append(crossings, &episode.Crossing{BuyEx: a.BuyEx, SellEx: a.SellEx, Spread: a.Spread,
+				Volume: a.Volume})
+		}
+
+		venues := []string{book.Exchanger, other.Exchanger}
+		for _, e := range c.tracker.Observe(pair, book.Time(), venues, crossings) {
+			episodes = append(episodes, &storage.Episode{Pair: e.Pair, BuyEx: e.BuyEx, SellEx: e.SellEx,
+				Start: e.Start, End: e.End, PeakSpread: e.PeakSpread, AvgVolume: e.AvgVolume(),
+				Snapshots: e.Snapshots})
+		}
+	}
+
+	if err := c.store.SaveArbitrages(arbitrages); err != nil {
+		log.Printf("compare: %d %s arbitrages lost - %s\n", len(arbitrages), pair, err)
+	}
+	if err := c.store.SaveEpisodes(episodes); err != nil {
+		log.Printf("compare: %d %s episodes lost - %s\n", len(episodes), pair, err)
+	}
+}
+
+// swap keeps book as the latest one of its venue and returns the latest books of the
+// other venues, sorted by exchanger.
+func (c *comparator) swap(pair exchanger.Pair, book *exchanger.OrderBook) []*exchanger.OrderBook {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	books, ok := c.latest[pair]
+	if !ok {
+		books = map[string]*exchanger.OrderBook{}
+		c.latest[pair] = books
+	}
+	books[book.Exchanger] = book
+
+	names := []string{}
+	for ex := range books {
+		if ex != book.Exchanger {
+			names = append(names, ex)
+		}
+	}
+	sort.Strings(names)
+
+	others := make([]*exchanger.OrderBook, len(names))
+	for i, ex := range names {
+		others[i] = books[ex]
+	}
+	return others
+}
+
+// cross returns the opportunity of buying the best ask of buy and selling at the best bid
+// of sell, nil if there is none.
+func cross(pair exchanger.Pair, buy, sell *exchanger.OrderBook) *storage.Arbitrage {
+	if len(buy.Asks) == 0 || len(sell.Bids) == 0 {
+		return nil
+	}
+
+	ask, bid := buy.Asks[0], sell.Bids[0]
+	if ask.Price >= bid.Price {
+		return nil
+	}
+
+	return &storage.Arbitrage{
+		BuyEx:     buy.Exchanger,
+		SellEx:    sell.Exchanger,
+		Pair:      pair,
+		BuyPrice:  ask.Price,
+		SellPrice: bid.Price,
+		Volume:    math.Min(ask.Volume, bid.Volume),
+		Spread:    100 * (bid.Price/ask.Price - 1),
+	}
+}
+
+// saveLatencies saves the fetch latency statistics of the venues every period, and a last
+// time once stop is closed.
+func saveLatencies(store storage.Store, latencies *latency.Recorder, period time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			saveStats(store, time.Now(), latencies.Flush())
+			return
+		}
+		saveStats(store, time.Now(), latencies.Flush())
+	}
+}
+
+func saveStats(store storage.Store, t time.Time, stats []*latency.Stats) {
+	rows := make([]*storage.Latency, len(stats))
+	for i, s := range stats {
+		rows[i] = &storage.Latency{Time: t, Exchanger: s.Exchanger, Samples: s.Count, Errors: s.Errors,
+			P50: s.P50, P90: s.P90, P99: s.P99, Max: s.Max}
+	}
+
+	if err := store.SaveLatencies(rows); err != nil {
+		log.Printf("saveLatencies: %d statistics lost - %s\n", len(rows), err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+)
+
+func TestComparator(t *testing.T) {
+	pair := exchanger.ZEC_BTC
+	t0 := time.Now()
+
+	// books snapshotted at t0 + offset
+	book := func(ex string, offset time.Duration, bid, ask float64) *exchanger.OrderBook {
+		at := t0.Add(offset)
+		return &exchanger.OrderBook{
+			Exchanger: ex,
+			Bids:      []*exchanger.Order{{Price: bid, Volume: 1}},
+			Asks:      []*exchanger.Order{{Price: ask, Volume: 2}},
+			Sent:      at,
+			Received:  at,
+		}
+	}
+
+	store := newMemStore()
+	c := newComparator(store, 5*time.Second, time.Minute)
+
+	c.compare(pair, book("A", 0, 0.99, 1.00))
+	c.compare(pair, book("B", time.Second, 1.02, 1.03))
+	if len(store.arbitrages) != 1 {
+		t.Fatalf("1 arbitrage expected, got %d", len(store.arbitrages))
+	}
+	if a := store.arbitrages[0]; a.BuyEx != "A" || a.SellEx != "B" || a.Volume != 1 || a.Spread < 1.99 || a.Spread > 2.01 {
+		t.Errorf("buy A at 1.00 and sell B at 1.02 expected, got %+v", a)
+	}
+
+	// C crosses A and B, but its book was taken too long after theirs
+	c.compare(pair, book("C", 10*time.Second, 1.10, 1.11))
+	if len(store.arbitrages) != 1 {
+		t.Errorf("skewed books should not be compared, got %d arbitrages", len(store.arbitrages))
+	}
+
+	// A and B are fetched again without crossing: the episode is closed
+	c.compare(pair, book("A", 20*time.Second, 0.99, 1.00))
+	if len(store.episodes) != 0 {
+		t.Fatalf("the episode should still be open, got %d episodes", len(store.episodes))
+	}
+	c.compare(pair, book("B", 21*time.Second, 0.995, 1.005))
+	if len(store.episodes) != 1 {
+		t.Fatalf("1 episode expected, got %d", len(store.episodes))
+	}
+	if e := store.episodes[0]; e.BuyEx != "A" || e.SellEx != "B" || e.Snapshots != 1 || e.AvgVolume != 1 {
+		t.Errorf("1 snapshot episode of A and B expected, got %+v", e)
+	}
+}
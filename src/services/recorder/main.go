@@ -0,0 +1,228 @@
+/*
+Command recorder saves the order books of the exchangers in the `orderbooks` table.
+
+The venues, their pairs and polling intervals, the depth of the books and the batching
+of the writes are read from the `recorder` section of the config:
+
+	"recorder": {
+		"depth": 10,
+		"interval": 60,
+		"batch_size": 50,
+		"flush_interval": 10,
+		"max_skew": 5,
+		"stats_interval": 300,
+		"storage": {"backend": "dir", "path": "/var/lib/bitbot/books"},
+		"venues": [
+			{"name": "Kraken", "pairs": ["zec_btc", "eth_btc"]},
+			{"name": "Poloniex", "pairs": ["zec_btc"], "interval": 30}
+		]
+	}
+
+Each venue is polled on its own schedule: the pairs of a venue are fetched one after the
+other so that the rate limits of the API are shared.
+
+Each book is compared with the latest books of the other venues of its pair fetched less
+than `max_skew` seconds apart (5 by default): the crossings, the ask of a venue below the
+bid of another one, are saved in the `arbitrages` table and linked into episodes, saved
+in the `episodes` table once closed (see bitbot/episode). The fetch latency percentiles
+of the venues are saved in the `book_latency` table every `stats_interval` seconds (300
+by default).
+
+The public trades are collected from the venues of the `tape` section (Bitfinex,
+Bittrex, Kraken and Poloniex), into the `public_trades` table. At startup, the last
+`backfill` seconds of the tapes are collected first:
+
+	"tape": {
+		"interval": 60,
+		"backfill": 86400,
+		"venues": [{"name": "Kraken", "pairs": ["zec_btc"]}]
+	}
+
+Older history is collected by the backfill command.
+
+The books are saved in MySQL unless another storage backend is configured (see
+services.OpenStore).
+*/
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"bitbot/errorutils"
+	"bitbot/exchanger"
+	"bitbot/latency"
+	"services"
+)
+
+var (
+	configPath = flag.String("config", "src/services/config.json", "JSON file that stores credentials.")
+)
+
+// Defaults of the optional settings.
+const (
+	defaultDepth         = 10
+	defaultBatchSize     = 50
+	defaultFlushInterval = 10
+	defaultMaxSkew       = 5
+	defaultStatsInterval = 300
+)
+
+func main() {
+	log.Println("Start recorder...")
+	flag.Parse()
+
+	config, err := services.LoadConfig(*configPath)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	conf := config.Recorder
+	if conf.Depth == 0 {
+		conf.Depth = defaultDepth
+	}
+	if conf.BatchSize == 0 {
+		conf.BatchSize = defaultBatchSize
+	}
+	if conf.FlushInterval == 0 {
+		conf.FlushInterval = defaultFlushInterval
+	}
+	if conf.MaxSkew == 0 {
+		conf.MaxSkew = defaultMaxSkew
+	}
+	if conf.StatsInterval == 0 {
+		conf.StatsInterval = defaultStatsInterval
+	}
+
+	venues, err := newVenues(conf)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	tapes, err := newTapeVenues(conf.Tape)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if len(venues) == 0 && len(tapes) == 0 {
+		log.Panic("no venue to record")
+	}
+
+	store, err := services.OpenStore(config, conf.Storage)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer store.Close()
+
+	w := newWriter(store, conf.Depth, conf.BatchSize, time.Duration(conf.FlushInterval)*time.Second)
+	go w.run()
+
+	// an episode survives two missed snapshots of the slowest venue
+	maxGap := time.Duration(0)
+	for _, v := range venues {
+		if 3*v.interval > maxGap {
+			maxGap = 3 * v.interval
+		}
+	}
+
+	r := &recorder{
+		w:         w,
+		c:         newComparator(store, time.Duration(conf.MaxSkew)*time.Second, maxGap),
+		latencies: latency.NewRecorder(),
+	}
+
+	// the pollers are stopped before the writer: they could write to a closed queue. The
+	// tapes are stopped with them so that the store isn't closed while they write.
+	stop := make(chan struct{})
+	var pollers sync.WaitGroup
+	for _, v := range venues {
+		pollers.Add(1)
+		go func(v *venue) {
+			defer pollers.Done()
+			r.record(v, stop)
+		}(v)
+	}
+
+	pollers.Add(1)
+	go func() {
+		defer pollers.Done()
+		saveLatencies(store, r.latencies, time.Duration(conf.StatsInterval)*time.Second, stop)
+	}()
+
+	backfill := time.Duration(conf.Tape.Backfill) * time.Second
+	for _, v := range tapes {
+		pollers.Add(1)
+		go func(v *tapeVenue) {
+			defer pollers.Done()
+			recordTape(v, store, backfill, stop)
+		}(v)
+	}
+
+	// the queued snapshots are written before exiting
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("Stopping recorder (%s)...\n", <-sig)
+	close(stop)
+	pollers.Wait()
+	w.close()
+}
+
+// recorder handles the books fetched by the pollers of the venues.
+type recorder struct {
+	w         *writer
+	c         *comparator
+	latencies *latency.Recorder
+}
+
+// record fetches the books of a venue every interval until stop is closed.
+func (r *recorder) record(v *venue, stop <-chan struct{}) {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, pair := range v.pairs {
+			if stopped(stop) {
+				return
+			}
+			if book := r.fetch(v, pair); book != nil {
+				r.w.write(&snapshot{pair, book})
+				r.c.compare(pair, book)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// stopped reports whether stop is closed.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *recorder) fetch(v *venue, pair exchanger.Pair) *exchanger.OrderBook {
+	defer errorutils.LogPanic()
+
+	book, err := exchanger.Fetch(v.book, pair)
+	if err != nil {
+		r.latencies.AddError(v.name)
+		log.Printf("record: cannot fetch %s %s - %s\n", v.name, pair, err)
+		return nil
+	}
+
+	r.latencies.Add(v.name, book.Latency())
+	return book
+}
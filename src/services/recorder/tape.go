@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bitbot/errorutils"
+	"bitbot/exchanger"
+	"bitbot/storage"
+	"bitbot/tape"
+	"services"
+)
+
+// tapeVenue is an exchanger whose public trades are collected on its own schedule.
+type tapeVenue struct {
+	*tape.Venue
+	pairs    []exchanger.Pair
+	interval time.Duration
+}
+
+// newTapeVenues validates the configuration of the tapes.
+func newTapeVenues(conf services.TapeConfig) ([]*tapeVenue, error) {
+	venues := []*tapeVenue{}
+
+	for _, vc := range conf.Venues {
+		tv, ok := tape.Venues[vc.Name]
+		if !ok {
+			return nil, fmt.Errorf("no public trades for exchanger `%s`", vc.Name)
+		}
+
+		interval := vc.Interval
+		if interval == 0 {
+			interval = conf.Interval
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("%s: no tape polling interval", vc.Name)
+		}
+
+		v := &tapeVenue{tv, []exchanger.Pair{}, time.Duration(interval) * time.Second}
+		for _, p := range vc.Pairs {
+			pair := exchanger.NewPair(strings.ToUpper(p))
+			if !tv.Supports(pair) {
+				return nil, fmt.Errorf("%s: pair `%s` not supported", vc.Name, p)
+			}
+			v.pairs = append(v.pairs, pair)
+		}
+
+		if len(v.pairs) == 0 {
+			return nil, fmt.Errorf("%s: no pair to record", vc.Name)
+		}
+
+		venues = append(venues, v)
+	}
+
+	return venues, nil
+}
+
+// recordTape collects the public trades of a venue every interval, starting backfill
+// ago, until stop is closed.
+func recordTape(v *tapeVenue, store storage.Store, backfill time.Duration, stop <-chan struct{}) {
+	cursors := map[exchanger.Pair]string{}
+	if backfill > 0 {
+		for _, pair := range v.pairs {
+			cursors[pair] = v.Cursor(time.Now().Add(-backfill))
+		}
+	}
+
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, pair := range v.pairs {
+			if stopped(stop) {
+				return
+			}
+			cursors[pair] = collect(v, store, pair, cursors[pair])
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// collect saves the trades following cursor and returns the next cursor, the same one
+// on errors.
+func collect(v *tapeVenue, store storage.Store, pair exchanger.Pair, cursor string) (next string) {
+	defer errorutils.LogPanic()
+	next = cursor
+
+	next, _, err := tape.Collect(store, v.Venue, pair, cursor, time.Time{})
+	if err != nil {
+		log.Printf("recordTape: cannot collect %s %s - %s\n", v.Name, pair, err)
+	}
+	return next
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/exchanger/bitfinex"
+	"bitbot/exchanger/btce"
+	"bitbot/exchanger/cex"
+	"bitbot/exchanger/gemini"
+	"bitbot/exchanger/hitbtc"
+	"bitbot/exchanger/kraken"
+	"bitbot/exchanger/poloniex"
+	"bitbot/exchanger/therocktrading"
+	"services"
+)
+
+// bookFunc fetches the order book of a pair.
+type bookFunc func(exchanger.Pair) (*exchanger.OrderBook, error)
+
+type exchange struct {
+	pairs map[exchanger.Pair]string
+	book  bookFunc
+}
+
+// exchanges are the exchangers that can be recorded.
+var exchanges = map[string]*exchange{
+	bitfinex.ExchangerName:       {bitfinex.Pairs, bitfinex.OrderBook},
+	btce.ExchangerName:           {btce.Pairs, btce.OrderBook},
+	cex.ExchangerName:            {cex.Pairs, cex.OrderBook},
+	gemini.ExchangerName:         {gemini.Pairs, gemini.OrderBook},
+	hitbtc.ExchangerName:         {hitbtc.Pairs, hitbtc.OrderBook},
+	kraken.ExchangerName:         {kraken.Pairs, kraken.OrderBook},
+	poloniex.ExchangerName:       {poloniex.Pairs, poloniex.OrderBook},
+	therocktrading.ExchangerName: {therocktrading.Pairs, therocktrading.OrderBook},
+}
+
+// venue is an exchanger recorded on its own schedule.
+type venue struct {
+	name     string
+	pairs    []exchanger.Pair
+	interval time.Duration
+	book     bookFunc
+}
+
+// newVenues validates the configuration of the venues.
+func newVenues(conf services.RecorderConfig) ([]*venue, error) {
+	venues := []*venue{}
+
+	for _, vc := range conf.Venues {
+		ex, ok := exchanges[vc.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown exchanger `%s`", vc.Name)
+		}
+
+		interval := vc.Interval
+		if interval == 0 {
+			interval = conf.Interval
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("%s: no polling interval", vc.Name)
+		}
+
+		v := &venue{vc.Name, []exchanger.Pair{}, time.Duration(interval) * time.Second, ex.book}
+		for _, p := range vc.Pairs {
+			pair := exchanger.NewPair(strings.ToUpper(p))
+			if _, ok := ex.pairs[pair]; !ok {
+				return nil, fmt.Errorf("%s: pair `%s` not supported", vc.Name, p)
+			}
+			v.pairs = append(v.pairs, pair)
+		}
+
+		if len(v.pairs) == 0 {
+			return nil, fmt.Errorf("%s: no pair to record", vc.Name)
+		}
+
+		venues = append(venues, v)
+	}
+
+	return venues, nil
+}
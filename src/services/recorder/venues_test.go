@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"services"
+)
+
+func TestNewVenues(t *testing.T) {
+	kraken := services.VenueConfig{Name: "Kraken", Pairs: []string{"zec_btc", "eth_btc"}}
+	poloniex := services.VenueConfig{Name: "Poloniex", Pairs: []string{"zec_btc"}, Interval: 30}
+
+	venues, err := newVenues(services.RecorderConfig{Interval: 60, Venues: []services.VenueConfig{kraken, poloniex}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(venues) != 2 || len(venues[0].pairs) != 2 || venues[0].interval.Seconds() != 60 ||
+		venues[1].interval.Seconds() != 30 {
+		t.Errorf("Kraken every 60s and Poloniex every 30s expected, got %+v %+v", venues[0], venues[1])
+	}
+
+	invalid := []services.RecorderConfig{
+		// unknown exchanger
+		{Interval: 60, Venues: []services.VenueConfig{{Name: "Mt.Gox", Pairs: []string{"zec_btc"}}}},
+		// no interval
+		{Venues: []services.VenueConfig{kraken}},
+		{Interval: 60, Venues: []services.VenueConfig{{Name: "Kraken", Pairs: []string{"zec_btc"}, Interval: -1}}},
+		// unsupported pair
+		{Interval: 60, Venues: []services.VenueConfig{{Name: "Kraken", Pairs: []string{"zec_xyz"}}}},
+		// no pair
+		{Interval: 60, Venues: []services.VenueConfig{{Name: "Kraken"}}},
+	}
+
+	for _, conf := range invalid {
+		if _, err := newVenues(conf); err == nil {
+			t.Errorf("%+v should be invalid", conf.Venues)
+		}
+	}
+}
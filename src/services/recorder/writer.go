@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+// snapshot is an order book waiting to be written.
+type snapshot struct {
+	pair exchanger.Pair
+	book *exchanger.OrderBook
+}
+
+// writer saves the snapshots in the store. Snapshots are written by
+// batches: when batchSize snapshots are waiting or once flushInterval elapsed.
+type writer struct {
+	store         storage.Store
+	depth         int
+	batchSize     int
+	flushInterval time.Duration
+
+	c    chan *snapshot
+	done chan struct{}
+}
+
+func newWriter(store storage.Store, depth, batchSize int, flushInterval time.Duration) *writer {
+	return &writer{
+		store:         store,
+		depth:         depth,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		c:             make(chan *snapshot, batchSize),
+		done:          make(chan struct{}),
+	}
+}
+
+// write queues a snapshot. It blocks while a batch is being written and the queue is
+// full.
+func (w *writer) write(s *snapshot) {
+	w.c <- s
+}
+
+// close writes the queued snapshots and stops the writer. The snapshots must no longer
+// be written: the callers of write are stopped first.
+func (w *writer) close() {
+	close(w.c)
+	<-w.done
+}
+
+// run writes the snapshots until the writer is closed.
+func (w *writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := []*snapshot{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := w.flush(batch); err != nil {
+			log.Printf("writer: %d snapshots lost - %s\n", len(batch), err)
+		}
+		batch = []*snapshot{}
+	}
+
+	for {
+		select {
+		case s, ok := <-w.c:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, s)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (w *writer) flush(batch []*snapshot) error {
+	books := make([]*storage.Book, len(batch))
+	for i, s := range batch {
+		b := *s.book
+		b.Bids = b.Bids[:min(len(b.Bids), w.depth)]
+		b.Asks = b.Asks[:min(len(b.Asks), w.depth)]
+		books[i] = &storage.Book{Pair: s.pair, Time: b.Time(), OrderBook: &b}
+	}
+
+	return w.store.SaveBooks(books)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"bitbot/exchanger"
+	"bitbot/storage"
+)
+
+// memStore records the books, arbitrages and episodes saved by the recorder. The sizes
+// of the batches of books are sent to batches.
+type memStore struct {
+	storage.Store
+
+	mu         sync.Mutex
+	books      []*storage.Book
+	arbitrages []*storage.Arbitrage
+	episodes   []*storage.Episode
+	batches    chan int
+}
+
+func newMemStore() *memStore {
+	return &memStore{batches: make(chan int, 10)}
+}
+
+func (s *memStore) SaveBooks(books []*storage.Book) error {
+	s.mu.Lock()
+	s.books = append(s.books, books...)
+	s.mu.Unlock()
+
+	s.batches <- len(books)
+	return nil
+}
+
+func (s *memStore) SaveArbitrages(arbitrages []*storage.Arbitrage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.arbitrages = append(s.arbitrages, arbitrages...)
+	return nil
+}
+
+func (s *memStore) SaveEpisodes(episodes []*storage.Episode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.episodes = append(s.episodes, episodes...)
+	return nil
+}
+
+// nextBatch returns the size of the next batch of books saved, 0 if none is saved
+// within a second.
+func (s *memStore) nextBatch() int {
+	select {
+	case n := <-s.batches:
+		return n
+	case <-time.After(time.Second):
+		return 0
+	}
+}
+
+func testSnapshot(ex string, orders int) *snapshot {
+	book := &exchanger.OrderBook{Exchanger: ex, Sent: time.Now(), Received: time.Now()}
+	for i := 0; i < orders; i++ {
+		book.Bids = append(book.Bids, &exchanger.Order{Price: 1, Volume: 1})
+		book.Asks = append(book.Asks, &exchanger.Order{Price: 2, Volume: 1})
+	}
+	return &snapshot{exchanger.ZEC_BTC, book}
+}
+
+func TestWriterBatches(t *testing.T) {
+	store := newMemStore()
+	w := newWriter(store, 2, 2, time.Hour)
+	go w.run()
+
+	for i := 0; i < 3; i++ {
+		w.write(testSnapshot("Kraken", 5))
+	}
+	if n := store.nextBatch(); n != 2 {
+		t.Fatalf("a batch of 2 snapshots expected, got %d", n)
+	}
+
+	// the last snapshot waits for the flush interval, it is written on close
+	w.close()
+	if n := store.nextBatch(); n != 1 {
+		t.Fatalf("the queued snapshot should be written on close, got %d", n)
+	}
+
+	for _, b := range store.books {
+		if len(b.Bids) != 2 || len(b.Asks) != 2 {
+			t.Errorf("books should be cut at depth 2, got %d bids and %d asks", len(b.Bids), len(b.Asks))
+		}
+	}
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	store := newMemStore()
+	w := newWriter(store, 10, 50, 10*time.Millisecond)
+	go w.run()
+	defer w.close()
+
+	w.write(testSnapshot("Kraken", 1))
+	if n := store.nextBatch(); n != 1 {
+		t.Errorf("the snapshot should be written after the flush interval, got %d", n)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"bitbot/database"
+	"bitbot/exchanger"
+	"bitbot/retention"
+	"bitbot/storage"
+)
+
+// keys returns the distinct values of column in the rows of table between from and to.
+func keys(db *sql.DB, table, column, tsColumn string, from, to time.Time) ([]string, error) {
+	query := fmt.Sprintf("select distinct %s from %s where %s >= ? and %s < ?", column, table, tsColumn, tsColumn)
+
+	rows, err := db.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func saveBookAggregates(db *sql.DB, aggs []*retention.BookAggregate) error {
+	const stmt = `
+		replace into book_aggregates
+			(exchanger, pair, resolution, start_ts, samples, bid_open, bid_high, bid_low, bid_close,
+			ask_open, ask_high, ask_low, ask_close, mid, spread_avg, spread_min, spread_max, bid_depth, ask_depth)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	return database.WithTx(db, func(tx *sql.Tx) error {
+		for _, a := range aggs {
+			bidDepth, err := json.Marshal(a.BidDepth)
+			if err != nil {
+				return err
+			}
+			askDepth, err := json.Marshal(a.AskDepth)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(stmt, a.Exchanger, a.Pair.String(), database.Seconds(a.Resolution), a.Start, a.Samples,
+				a.Bid.Open, a.Bid.High, a.Bid.Low, a.Bid.Close, a.Ask.Open, a.Ask.High, a.Ask.Low, a.Ask.Close,
+				a.Mid, a.SpreadAvg, a.SpreadMin, a.SpreadMax, string(bidDepth), string(askDepth))
+			if err != nil {
+				return fmt.Errorf("tx.Exec() failed - %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+func loadBookAggregates(db *sql.DB, resolution time.Duration, from, to time.Time) ([]*retention.BookAggregate, error) {
+	const query = `
+		select exchanger, pair, start_ts, samples, bid_open, bid_high, bid_low, bid_close,
+			ask_open, ask_high, ask_low, ask_close, mid, spread_avg, spread_min, spread_max, bid_depth, ask_depth
+		from book_aggregates
+		where resolution = ? and start_ts >= ? and start_ts < ?
+		order by start_ts
+	`
+
+	rows, err := db.Query(query, database.Seconds(resolution), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aggs := []*retention.BookAggregate{}
+	for rows.Next() {
+		a := &retention.BookAggregate{Resolution: resolution}
+		var pair string
+		var start database.Timestamp
+		var bidDepth, askDepth []byte
+
+		err := rows.Scan(&a.Exchanger, &pair, &start, &a.Samples, &a.Bid.Open, &a.Bid.High, &a.Bid.Low, &a.Bid.Close,
+			&a.Ask.Open, &a.Ask.High, &a.Ask.Low, &a.Ask.Close, &a.Mid, &a.SpreadAvg, &a.SpreadMin, &a.SpreadMax,
+			&bidDepth, &askDepth)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(bidDepth, &a.BidDepth); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(askDepth, &a.AskDepth); err != nil {
+			return nil, err
+		}
+
+		a.Pair = exchanger.NewPair(pair)
+		a.Start = start.Time
+		aggs = append(aggs, a)
+	}
+	return aggs, rows.Err()
+}
+
+func saveSummaryAggregates(db *sql.DB, aggs []*retention.SummaryAggregate) error {
+	const stmt = `
+		replace into market_summary_aggregates
+			(market_name, resolution, start_ts, samples, last_open, last_high, last_low, last_close,
+			bid, ask, volume, base_volume)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	return database.WithTx(db, func(tx *sql.Tx) error {
+		for _, a := range aggs {
+			_, err := tx.Exec(stmt, a.MarketName, database.Seconds(a.Resolution), a.Start, a.Samples, a.Last.Open,
+				a.Last.High, a.Last.Low, a.Last.Close, a.Bid, a.Ask, a.Volume, a.BaseVolume)
+			if err != nil {
+				return fmt.Errorf("tx.Exec() failed - %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+func loadSummaryAggregates(db *sql.DB, resolution time.Duration, from, to time.Time) ([]*retention.SummaryAggregate, error) {
+	const query = `
+		select market_name, start_ts, samples, last_open, last_high, last_low, last_close,
+			bid, ask, volume, base_volume
+		from market_summary_aggregates
+		where resolution = ? and start_ts >= ? and start_ts < ?
+		order by start_ts
+	`
+
+	rows, err := db.Query(query, database.Seconds(resolution), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aggs := []*retention.SummaryAggregate{}
+	for rows.Next() {
+		a := &retention.SummaryAggregate{Resolution: resolution}
+		var start database.Timestamp
+
+		err := rows.Scan(&a.MarketName, &start, &a.Samples, &a.Last.Open, &a.Last.High, &a.Last.Low, &a.Last.Close,
+			&a.Bid, &a.Ask, &a.Volume, &a.BaseVolume)
+		if err != nil {
+			return nil, err
+		}
+
+		a.Start = start.Time
+		aggs = append(aggs, a)
+	}
+	return aggs, rows.Err()
+}
+
+func saveArbitrageAggregates(db *sql.DB, aggs []*retention.ArbitrageAggregate) error {
+	const stmt = `
+		replace into arbitrage_aggregates
+			(pair, buy_ex, sell_ex, resolution, start_ts, count, spread_avg, spread_max, vol)
+		values
+			(?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	return database.WithTx(db, func(tx *sql.Tx) error {
+		for _, a := range aggs {
+			_, err := tx.Exec(stmt, a.Pair.String(), a.BuyEx, a.SellEx, database.Seconds(a.Resolution), a.Start, a.Count,
+				a.SpreadAvg, a.SpreadMax, a.Volume)
+			if err != nil {
+				return fmt.Errorf("tx.Exec() failed - %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+func loadArbitrageAggregates(db *sql.DB, resolution time.Duration, from, to time.Time) ([]*retention.ArbitrageAggregate, error) {
+	const query = `
+		select pair, buy_ex, sell_ex, start_ts, count, spread_avg, spread_max, vol
+		from arbitrage_aggregates
+		where resolution = ? and start_ts >= ? and start_ts < ?
+		order by start_ts
+	`
+
+	rows, err := db.Query(query, database.Seconds(resolution), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aggs := []*retention.ArbitrageAggregate{}
+	for rows.Next() {
+		a := &retention.ArbitrageAggregate{Resolution: resolution}
+		var pair string
+		var start database.Timestamp
+
+		if err := rows.Scan(&pair, &a.BuyEx, &a.SellEx, &start, &a.Count, &a.SpreadAvg, &a.SpreadMax, &a.Volume); err != nil {
+			return nil, err
+		}
+
+		a.Pair = exchanger.NewPair(pair)
+		a.Start = start.Time
+		aggs = append(aggs, a)
+	}
+	return aggs, rows.Err()
+}
+
+// loadRawArbitrages returns the arbitrages of every pair between from and to.
+func loadRawArbitrages(db *sql.DB, store storage.Store, from, to time.Time) ([]*storage.Arbitrage, error) {
+	pairs, err := keys(db, "arbitrages", "pair", "ts", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	arbitrages := []*storage.Arbitrage{}
+	for _, pair := range pairs {
+		a, err := store.Arbitrages(exchanger.NewPair(pair), from, to)
+		if err != nil {
+			return nil, err
+		}
+		arbitrages = append(arbitrages, a...)
+	}
+	return arbitrages, nil
+}
+
+// watermark returns the time until which the aggregates of a dataset at resolution are
+// complete, zero before the first run.
+func watermark(db *sql.DB, dataset string, resolution time.Duration) (time.Time, error) {
+	const query = "select aggregated_until from retention_state where dataset = ? and resolution = ?"
+
+	var t database.Timestamp
+	err := db.QueryRow(query, dataset, database.Seconds(resolution)).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return t.Time, err
+}
+
+func setWatermark(db *sql.DB, dataset string, resolution time.Duration, t time.Time) error {
+	const stmt = "replace into retention_state (dataset, resolution, aggregated_until) values (?, ?, ?)"
+	_, err := db.Exec(stmt, dataset, database.Seconds(resolution), t)
+	return err
+}
@@ -0,0 +1,339 @@
+/*
+Command retention downsamples the recorded market data and purges the old rows.
+
+The `orderbooks`, `market_summary` and `arbitrages` tables are aggregated to the
+resolutions of the retention policies (book_aggregates, market_summary_aggregates and
+arbitrage_aggregates), each resolution from the previous one. Rows older than the
+retention of their resolution are deleted in batches, once the next resolution covers
+them. The policies are read from the `retention` section of the config:
+
+	"retention": {
+		"batch_size": 5000,
+		"policies": [
+			{"resolution": 0, "keep": 604800},
+			{"resolution": 60, "keep": 7776000},
+			{"resolution": 3600}
+		]
+	}
+
+Resolutions and retentions are in seconds, a zero retention keeps the data forever.
+Without policies, raw rows are kept for 7 days, 1 minute aggregates for 90 days and
+hourly aggregates forever.
+*/
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"bitbot/database"
+	"bitbot/exchanger"
+	"bitbot/retention"
+	"bitbot/storage"
+	"services"
+)
+
+var (
+	configPath = flag.String("config", "src/services/config.json", "JSON file that stores credentials.")
+	period     = flag.Duration("period", time.Hour, "Time between two runs.")
+	once       = flag.Bool("once", false, "Run once and exit.")
+)
+
+const (
+	defaultBatchSize = 5000
+	// grace is the delay before a period is aggregated, for the rows written late.
+	grace = 5 * time.Minute
+	// pause is the time between two batches of deletes, to let the writers through.
+	pause = 100 * time.Millisecond
+)
+
+// dataset is a raw table and its aggregates.
+type dataset struct {
+	name     string
+	rawTable string
+	rawTime  string
+	aggTable string
+	// aggregate aggregates the rows of the previous resolution between from and to.
+	aggregate func(j *job, from, to time.Time, prev, res time.Duration) error
+}
+
+var datasets = []*dataset{
+	{
+		name:     "orderbooks",
+		rawTable: "orderbooks",
+		rawTime:  "ts",
+		aggTable: "book_aggregates",
+		aggregate: func(j *job, from, to time.Time, prev, res time.Duration) error {
+			if prev > 0 {
+				aggs, err := loadBookAggregates(j.db, prev, from, to)
+				if err != nil {
+					return err
+				}
+				return saveBookAggregates(j.db, retention.MergeBooks(aggs, res))
+			}
+
+			pairs, err := keys(j.db, "orderbooks", "pair", "ts", from, to)
+			if err != nil {
+				return err
+			}
+
+			for _, pair := range pairs {
+				books, err := j.store.Books(exchanger.NewPair(pair), from, to)
+				if err != nil {
+					return err
+				}
+				if err := saveBookAggregates(j.db, retention.AggregateBooks(books, res)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name:     "market_summary",
+		rawTable: "market_summary",
+		rawTime:  "creation_date",
+		aggTable: "market_summary_aggregates",
+		aggregate: func(j *job, from, to time.Time, prev, res time.Duration) error {
+			if prev > 0 {
+				aggs, err := loadSummaryAggregates(j.db, prev, from, to)
+				if err != nil {
+					return err
+				}
+				return saveSummaryAggregates(j.db, retention.MergeSummaries(aggs, res))
+			}
+
+			markets, err := keys(j.db, "market_summary", "market_name", "creation_date", from, to)
+			if err != nil {
+				return err
+			}
+
+			for _, market := range markets {
+				summaries, err := j.store.MarketSummaries(market, from, to)
+				if err != nil {
+					return err
+				}
+				if err := saveSummaryAggregates(j.db, retention.AggregateSummaries(summaries, res)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name:     "arbitrages",
+		rawTable: "arbitrages",
+		rawTime:  "ts",
+		aggTable: "arbitrage_aggregates",
+		aggregate: func(j *job, from, to time.Time, prev, res time.Duration) error {
+			if prev > 0 {
+				aggs, err := loadArbitrageAggregates(j.db, prev, from, to)
+				if err != nil {
+					return err
+				}
+				return saveArbitrageAggregates(j.db, retention.MergeArbitrages(aggs, res))
+			}
+
+			arbitrages, err := loadRawArbitrages(j.db, j.store, from, to)
+			if err != nil {
+				return err
+			}
+			return saveArbitrageAggregates(j.db, retention.AggregateArbitrages(arbitrages, res))
+		},
+	},
+}
+
+type job struct {
+	db        *sql.DB
+	store     storage.Store
+	policies  []retention.Policy
+	batchSize int
+}
+
+func main() {
+	log.Println("Start retention...")
+	flag.Parse()
+
+	config, err := services.LoadConfig(*configPath)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	policies := retention.DefaultPolicies
+	if len(config.Retention.Policies) > 0 {
+		policies = []retention.Policy{}
+		for _, p := range config.Retention.Policies {
+			policies = append(policies, retention.Policy{
+				Resolution: time.Duration(p.Resolution) * time.Second,
+				Keep:       time.Duration(p.Keep) * time.Second,
+			})
+		}
+	}
+
+	if err := retention.Validate(policies); err != nil {
+		log.Panic(err)
+	}
+
+	batchSize := config.Retention.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+
+	// open db
+	creds := config.Mysql
+	db := database.Open(creds.Db, creds.Host, creds.Port, creds.User, creds.Pwd)
+	defer db.Close()
+
+	if err := database.CheckSchema(db.DB); err != nil {
+		log.Panic(err)
+	}
+
+	j := &job{db: db.DB, store: storage.OpenMySQL(db.DB), policies: policies, batchSize: batchSize}
+
+	for {
+		for _, d := range datasets {
+			j.run(d, time.Now())
+		}
+
+		if *once {
+			return
+		}
+		time.Sleep(*period)
+	}
+}
+
+// run aggregates a dataset, then purges it. Datasets are independent: the errors are
+// logged.
+func (j *job) run(d *dataset, now time.Time) {
+	for i := 1; i < len(j.policies); i++ {
+		if err := j.downsample(d, i, now); err != nil {
+			log.Printf("run: cannot aggregate %s at %s - %s\n", d.name, j.policies[i].Resolution, err)
+			// the next resolutions and the purges wait for this one
+			return
+		}
+	}
+
+	for i := range j.policies {
+		n, err := j.purge(d, i, now)
+		if err != nil {
+			log.Printf("run: cannot purge %s (%s) - %s\n", d.name, j.policies[i], err)
+		} else if n > 0 {
+			log.Printf("run: %d rows of %s purged (%s)\n", n, d.name, j.policies[i])
+		}
+	}
+}
+
+// downsample aggregates the complete periods of policy i not aggregated yet.
+func (j *job) downsample(d *dataset, i int, now time.Time) error {
+	prev, res := j.policies[i-1].Resolution, j.policies[i].Resolution
+
+	until := now.Add(-grace).Truncate(res)
+	if i > 1 {
+		// the previous resolution must cover the periods
+		covered, err := watermark(j.db, d.name, prev)
+		if err != nil {
+			return err
+		}
+		if covered = covered.Truncate(res); covered.Before(until) {
+			until = covered
+		}
+	}
+
+	from, err := watermark(j.db, d.name, res)
+	if err != nil {
+		return err
+	}
+
+	if from.IsZero() {
+		first, err := j.first(d, prev)
+		if err != nil || first.IsZero() {
+			return err
+		}
+		from = first.Truncate(res)
+	}
+
+	// chunks of 1440 periods: a day of minutes, two months of hours
+	for from.Before(until) {
+		to := from.Add(1440 * res)
+		if to.After(until) {
+			to = until
+		}
+
+		if err := d.aggregate(j, from, to, prev, res); err != nil {
+			return err
+		}
+		if err := setWatermark(j.db, d.name, res, to); err != nil {
+			return err
+		}
+
+		from = to
+	}
+	return nil
+}
+
+// first returns the time of the oldest row at resolution, zero when there is none.
+func (j *job) first(d *dataset, res time.Duration) (time.Time, error) {
+	var t database.Timestamp
+	var err error
+
+	if res == 0 {
+		query := fmt.Sprintf("select min(%s) from %s", d.rawTime, d.rawTable)
+		err = j.db.QueryRow(query).Scan(&t)
+	} else {
+		query := fmt.Sprintf("select min(start_ts) from %s where resolution = ?", d.aggTable)
+		err = j.db.QueryRow(query, database.Seconds(res)).Scan(&t)
+	}
+	return t.Time, err
+}
+
+// purge deletes the rows of policy i older than its retention and covered by the next
+// resolution, by batches.
+func (j *job) purge(d *dataset, i int, now time.Time) (int64, error) {
+	p := j.policies[i]
+	if p.Keep == 0 {
+		return 0, nil
+	}
+
+	cutoff := now.Add(-p.Keep)
+	if i+1 < len(j.policies) {
+		covered, err := watermark(j.db, d.name, j.policies[i+1].Resolution)
+		if err != nil {
+			return 0, err
+		}
+		if covered.Before(cutoff) {
+			cutoff = covered
+		}
+	}
+
+	var stmt string
+	params := []interface{}{}
+	if p.Resolution == 0 {
+		stmt = fmt.Sprintf("delete from %s where %s < ? order by %s limit ?", d.rawTable, d.rawTime, d.rawTime)
+	} else {
+		stmt = fmt.Sprintf("delete from %s where resolution = ? and start_ts < ? order by start_ts limit ?", d.aggTable)
+		params = append(params, database.Seconds(p.Resolution))
+	}
+	params = append(params, cutoff, j.batchSize)
+
+	var total int64
+	for {
+		res, err := j.db.Exec(stmt, params...)
+		if err != nil {
+			return total, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+		if n < int64(j.batchSize) {
+			return total, nil
+		}
+		time.Sleep(pause)
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"fmt"
+
+	// driver of the SQLite backend
+	_ "github.com/mattn/go-sqlite3"
+
+	"bitbot/database"
+	"bitbot/storage"
+)
+
+// OpenStore opens the storage backend selected by s. The MySQL backend uses the
+// credentials of config, and fails unless its schema is current.
+func OpenStore(config *Config, s StorageConfig) (storage.Store, error) {
+	switch s.Backend {
+	case "", "mysql":
+		creds := config.Mysql
+		db := database.Open(creds.Db, creds.Host, creds.Port, creds.User, creds.Pwd)
+		if err := database.CheckSchema(db.DB); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return storage.OpenMySQL(db.DB), nil
+	case "sqlite":
+		return storage.OpenSQLite(s.Path)
+	case "dir":
+		format := s.Format
+		if format == "" {
+			format = storage.JSONL
+		}
+		return storage.OpenDir(s.Path, format)
+	default:
+		return nil, fmt.Errorf("unknown storage backend `%s`", s.Backend)
+	}
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseTime parses the times given to the commands and the web server: a date
+// ("2017-06-01") or a RFC 3339 time. It returns def for the empty string.
+func ParseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time `%s`", s)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/toorop/go-bittrex"
 
 	"bitbot/database"
+	bittrexapi "bitbot/exchanger/bittrex"
 	"services"
 )
 
@@ -33,6 +34,18 @@ func main() {
 	db := database.Open(creds.Db, creds.Host, creds.Port, creds.User, creds.Pwd)
 	defer db.Close()
 
+	if err := database.CheckSchema(db.DB); err != nil {
+		log.Panic(err)
+	}
+
+	venues, err := newTickerVenues(config.Tickers)
+	if err != nil {
+		log.Panic(err)
+	}
+	for _, v := range venues {
+		go pollTickers(db, v)
+	}
+
 	// Get markets
 	for {
 		log.Println("Fetching market summaries...")
@@ -41,6 +54,8 @@ func main() {
 			log.Println("ERROR: ", err)
 		} else if err = saveMarketSummaries(db, summaries); err != nil {
 			log.Println("ERROR: ", err)
+		} else if err = saveTickers(db, bittrexapi.SummaryTickers(summaries, time.Now())); err != nil {
+			log.Println("ERROR: ", err)
 		}
 
 		time.Sleep(1 * time.Minute)
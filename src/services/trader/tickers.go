@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bitbot/database"
+	"bitbot/exchanger"
+	"bitbot/exchanger/cex"
+	"bitbot/exchanger/hitbtc"
+	"bitbot/exchanger/kraken"
+	"bitbot/exchanger/poloniex"
+	"services"
+)
+
+const defaultTickerInterval = 60
+
+type tickerExchange struct {
+	pairs   map[exchanger.Pair]string
+	tickers exchanger.TickerFunc
+}
+
+// tickerExchanges are the exchangers with a batch ticker endpoint. Bittrex tickers come
+// from the market summaries.
+var tickerExchanges = map[string]*tickerExchange{
+	cex.ExchangerName:      {cex.Pairs, cex.Tickers},
+	hitbtc.ExchangerName:   {hitbtc.Pairs, hitbtc.Tickers},
+	kraken.ExchangerName:   {kraken.Pairs, kraken.Tickers},
+	poloniex.ExchangerName: {poloniex.Pairs, poloniex.Tickers},
+}
+
+// tickerVenue is an exchanger polled on its own schedule.
+type tickerVenue struct {
+	name     string
+	pairs    []exchanger.Pair
+	interval time.Duration
+	tickers  exchanger.TickerFunc
+}
+
+// newTickerVenues validates the configuration of the venues.
+func newTickerVenues(conf services.TickersConfig) ([]*tickerVenue, error) {
+	interval := conf.Interval
+	if interval == 0 {
+		interval = defaultTickerInterval
+	}
+
+	venues := conf.Venues
+	if len(venues) == 0 {
+		for name := range tickerExchanges {
+			venues = append(venues, services.VenueConfig{Name: name})
+		}
+	}
+
+	out := []*tickerVenue{}
+	for _, vc := range venues {
+		ex, ok := tickerExchanges[vc.Name]
+		if !ok {
+			return nil, fmt.Errorf("no ticker for exchanger `%s`", vc.Name)
+		}
+
+		v := &tickerVenue{vc.Name, []exchanger.Pair{}, time.Duration(interval) * time.Second, ex.tickers}
+		if vc.Interval > 0 {
+			v.interval = time.Duration(vc.Interval) * time.Second
+		}
+
+		for _, p := range vc.Pairs {
+			pair := exchanger.NewPair(strings.ToUpper(p))
+			if _, ok := ex.pairs[pair]; !ok {
+				return nil, fmt.Errorf("%s: pair `%s` not supported", vc.Name, p)
+			}
+			v.pairs = append(v.pairs, pair)
+		}
+
+		// every pair by default
+		if len(vc.Pairs) == 0 {
+			for pair := range ex.pairs {
+				v.pairs = append(v.pairs, pair)
+			}
+		}
+
+		out = append(out, v)
+	}
+
+	return out, nil
+}
+
+// pollTickers saves the tickers of a venue every interval.
+func pollTickers(db *database.DB, v *tickerVenue) {
+	for {
+		if tickers, err := v.tickers(v.pairs); err != nil {
+			log.Printf("pollTickers: cannot fetch %s tickers - %s\n", v.name, err)
+		} else if err := saveTickers(db, tickers); err != nil {
+			log.Printf("pollTickers: cannot save %s tickers - %s\n", v.name, err)
+		}
+
+		time.Sleep(v.interval)
+	}
+}
+
+func saveTickers(db *database.DB, tickers []*exchanger.Ticker) error {
+	if len(tickers) == 0 {
+		return nil
+	}
+
+	placeholders := []string{}
+	params := []interface{}{}
+
+	for _, t := range tickers {
+		params = append(params, t.Exchanger, t.Pair.String(), t.Time, t.Last, t.Bid, t.Ask, t.High, t.Low,
+			t.BaseVolume, t.QuoteVolume, t.PrevDay)
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	}
+
+	stmt := `
+        insert ignore into tickers
+            (exchanger, pair, ts, last, bid, ask, high, low, base_volume, quote_volume, prev_day)
+        values
+    ` + strings.Join(placeholders, ",")
+
+	_, err := db.Exec(stmt, params...)
+	return err
+}
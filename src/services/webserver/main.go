@@ -7,12 +7,15 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/shopspring/decimal"
 
+	"bitbot/candle"
 	"bitbot/database"
 	"bitbot/errorutils"
 	"services"
@@ -47,12 +50,18 @@ func main() {
 	dbx = database.Openx(creds.Db, creds.Host, creds.Port, creds.User, creds.Pwd)
 	defer dbx.Close()
 
+	if err := database.CheckSchema(dbx.DB); err != nil {
+		log.Panic(err)
+	}
+
 	m := mux.NewRouter()
 	m.PathPrefix("/public/").Handler(http.StripPrefix("/public/", http.FileServer(http.Dir(staticDir))))
 
 	api := m.PathPrefix("/api/v1").Subrouter()
 	api.HandleFunc("/bittrex/market_summary", JSONWrapper(BittrexMarketSummary))
 	api.HandleFunc("/bittrex/market_history/{market}", JSONWrapper(BittrexMarketHistory))
+	api.HandleFunc("/tickers", JSONWrapper(Tickers))
+	api.HandleFunc("/candles/{exchange}/{pair}", JSONWrapper(Candles))
 
 	m.HandleFunc("/", HomeHandler)
 	http.HandleFunc("/", timeItWrapper(m))
@@ -103,35 +112,219 @@ func BittrexMarketSummary(db *sqlx.DB, r *http.Request) interface{} {
 	return rows
 }
 
+// Limits of the market history.
+const (
+	defaultHistoryLimit = 1000
+	maxHistoryLimit     = 10000
+)
+
+// BittrexMarketHistory returns the summaries of a market between `from` and `to` (RFC 3339
+// or 2006-01-02, the last 24 hours by default), at most `limit` of them. With a
+// `resolution` in seconds, the summaries are read from the aggregates of the retention
+// job: the last price is the close one.
 func BittrexMarketHistory(db *sqlx.DB, r *http.Request) interface{} {
+	var rows []*struct {
+		MarketName   string          `db:"market_name"`
+		Volume       decimal.Decimal `db:"volume"`
+		Last         decimal.Decimal `db:"last"`
+		PrevDay      decimal.Decimal `db:"prev_day"`
+		CreationDate string          `db:"creation_date"`
+	}
+
+	to, err := parseTimeParam(r, "to", time.Now())
+	errorutils.PanicOnError(err)
+	from, err := parseTimeParam(r, "from", to.Add(-24*time.Hour))
+	errorutils.PanicOnError(err)
+
+	limit := defaultHistoryLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	market := mux.Vars(r)["market"]
+
+	if res := r.URL.Query().Get("resolution"); res != "" && res != "0" {
+		const stmt = `
+            select
+                market_name,
+                volume,
+                last_close as last,
+                0 as prev_day,
+                start_ts as creation_date
+            from
+                market_summary_aggregates
+            where
+                market_name = ?
+                and resolution = ?
+                and start_ts >= ?
+                and start_ts < ?
+            order by
+                start_ts
+            limit ?
+        `
+		err = db.Select(&rows, stmt, market, res, from, to, limit)
+	} else {
+		const stmt = `
+            select
+                market_name,
+                volume,
+                last,
+                prev_day,
+                creation_date
+            from
+                market_summary
+            where
+                market_name = ?
+                and creation_date >= ?
+                and creation_date < ?
+            order by
+                creation_date
+            limit ?
+        `
+		err = db.Select(&rows, stmt, market, from, to, limit)
+	}
+	errorutils.PanicOnError(err)
+	return rows
+}
+
+// tickerWindow is the time within which the last ticker of a market must have been
+// fetched to be listed.
+const tickerWindow = time.Hour
+
+// Tickers returns the last ticker of every market of every exchanger, so that the
+// markets can be compared across venues. An optional `pair` (zec_btc) selects a market.
+func Tickers(db *sqlx.DB, r *http.Request) interface{} {
+	const stmt = `
+        select
+            t.exchanger,
+            t.pair,
+            t.ts,
+            t.last,
+            t.bid,
+            t.ask,
+            t.high,
+            t.low,
+            t.base_volume,
+            t.quote_volume,
+            t.prev_day
+        from
+            tickers t
+            inner join (
+                select
+                    exchanger,
+                    pair,
+                    max(ts) as ts
+                from
+                    tickers
+                where
+                    ts >= ?
+                    and (? = '' or pair = ?)
+                group by
+                    1, 2
+            )
+            as d on d.exchanger = t.exchanger and d.pair = t.pair and d.ts = t.ts
+        order by
+            pair, exchanger
+    `
+	var rows []*struct {
+		Exchanger   string  `db:"exchanger"`
+		Pair        string  `db:"pair"`
+		Ts          string  `db:"ts"`
+		Last        float64 `db:"last"`
+		Bid         float64 `db:"bid"`
+		Ask         float64 `db:"ask"`
+		High        float64 `db:"high"`
+		Low         float64 `db:"low"`
+		BaseVolume  float64 `db:"base_volume"`
+		QuoteVolume float64 `db:"quote_volume"`
+		PrevDay     float64 `db:"prev_day"`
+	}
+
+	pair := strings.ToUpper(r.URL.Query().Get("pair"))
+	err := db.Select(&rows, stmt, time.Now().Add(-tickerWindow), pair, pair)
+	errorutils.PanicOnError(err)
+	return rows
+}
+
+// defaultCandles is the number of bars returned without `from`.
+const defaultCandles = 200
+
+// Candles returns the OHLCV bars of a market (zec_btc) of an exchanger built by the
+// candle job, at an `interval` (1m, 5m, 1h or 1d, 1h by default) between `from` and `to`
+// (RFC 3339 or 2006-01-02, the last 200 bars by default), at most `limit` of them.
+func Candles(db *sqlx.DB, r *http.Request) interface{} {
 	const stmt = `
         select
-            market_name,
+            start_ts,
+            open,
+            high,
+            low,
+            close,
             volume,
-            last,
-            prev_day,
-            creation_date
+            trades,
+            source
         from
-            market_summary
+            candles
         where
-            market_name = ?
+            exchanger = ?
+            and pair = ?
+            and resolution = ?
+            and start_ts >= ?
+            and start_ts < ?
         order by
-            creation_date
+            start_ts
+        limit ?
     `
 	var rows []*struct {
-		MarketName   string          `db:"market_name"`
-		Volume       decimal.Decimal `db:"volume"`
-		Last         decimal.Decimal `db:"last"`
-		PrevDay      decimal.Decimal `db:"prev_day"`
-		CreationDate string          `db:"creation_date"`
+		Start  string  `db:"start_ts"`
+		Open   float64 `db:"open"`
+		High   float64 `db:"high"`
+		Low    float64 `db:"low"`
+		Close  float64 `db:"close"`
+		Volume float64 `db:"volume"`
+		Trades int     `db:"trades"`
+		Source string  `db:"source"`
 	}
 
-	market := mux.Vars(r)["market"]
-	err := db.Select(&rows, fmt.Sprintf(stmt), market)
+	interval := time.Hour
+	if v := r.URL.Query().Get("interval"); v != "" {
+		var err error
+		interval, err = candle.ParseInterval(v)
+		errorutils.PanicOnError(err)
+	}
+
+	to, err := parseTimeParam(r, "to", time.Now())
+	errorutils.PanicOnError(err)
+	from, err := parseTimeParam(r, "from", to.Add(-defaultCandles*interval))
+	errorutils.PanicOnError(err)
+
+	limit := defaultHistoryLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	vars := mux.Vars(r)
+	pair := strings.ToUpper(vars["pair"])
+	err = db.Select(&rows, stmt, vars["exchange"], pair, int64(interval/time.Second), from, to, limit)
 	errorutils.PanicOnError(err)
 	return rows
 }
 
+// parseTimeParam parses the query parameter name, def when missing.
+func parseTimeParam(r *http.Request, name string, def time.Time) (time.Time, error) {
+	t, err := services.ParseTime(r.URL.Query().Get(name), def)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s - %s", name, err)
+	}
+	return t, nil
+}
+
 func timeItWrapper(h http.Handler) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()